@@ -0,0 +1,119 @@
+// Package config reads the broker configuration, the Java properties of
+// server.properties.
+package config
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// Properties are the broker configs by name.
+type Properties map[string]string
+
+// Load reads the properties file at path.
+func Load(path string) (Properties, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// Parse reads properties as `key=value` or `key: value` lines, skipping
+// blank lines and the comments starting with # or !. A line ending with a
+// backslash continues on the next one.
+func Parse(r io.Reader) (Properties, error) {
+	properties := make(Properties)
+	scanner := bufio.NewScanner(r)
+	var line string
+
+	for scanner.Scan() {
+		text := strings.TrimLeft(scanner.Text(), " \t\f")
+
+		if line == "" && (text == "" || text[0] == '#' || text[0] == '!') {
+			continue
+		}
+
+		if strings.HasSuffix(text, `\`) && !strings.HasSuffix(text, `\\`) {
+			line += strings.TrimSuffix(text, `\`)
+			continue
+		}
+
+		line += text
+		properties.set(line)
+		line = ""
+	}
+
+	if line != "" {
+		properties.set(line)
+	}
+
+	return properties, scanner.Err()
+}
+
+func (p Properties) set(line string) {
+	separator := strings.IndexAny(line, "=:")
+
+	if separator < 0 {
+		p[strings.TrimSpace(line)] = ""
+		return
+	}
+
+	p[strings.TrimSpace(line[:separator])] = strings.TrimSpace(line[separator+1:])
+}
+
+// String returns the value of key, or def when it is not set.
+func (p Properties) String(key string, def string) string {
+	if value, found := p[key]; found {
+		return value
+	}
+
+	return def
+}
+
+// List returns the comma separated values of key, or def when it is not set.
+func (p Properties) List(key string, def ...string) []string {
+	value, found := p[key]
+
+	if !found {
+		return def
+	}
+
+	var values []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+
+	return values
+}
+
+// DefaultLogDir is the log.dir default.
+const DefaultLogDir = "/tmp/kafka-logs"
+
+// LogDirs returns the log.dirs, falling back to log.dir.
+func (p Properties) LogDirs() []string {
+	return p.List("log.dirs", p.String("log.dir", DefaultLogDir))
+}
+
+// MetadataLogDir returns the metadata.log.dir, the first of the LogDirs
+// when it is not set, as brokers do.
+func (p Properties) MetadataLogDir() string {
+	if dir := p.String("metadata.log.dir", ""); dir != "" {
+		return dir
+	}
+
+	if dirs := p.LogDirs(); len(dirs) > 0 {
+		return dirs[0]
+	}
+
+	return DefaultLogDir
+}
@@ -0,0 +1,58 @@
+package config_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/config"
+)
+
+func TestParse(t *testing.T) {
+	properties, err := config.Parse(strings.NewReader(`
+# broker
+! legacy comment
+node.id=1
+listeners = PLAINTEXT://:9092, \
+    CONTROLLER://:9093
+log.dirs: /tmp/a,/tmp/b
+flag
+`))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := config.Properties{
+		"node.id":   "1",
+		"listeners": "PLAINTEXT://:9092, CONTROLLER://:9093",
+		"log.dirs":  "/tmp/a,/tmp/b",
+		"flag":      "",
+	}
+
+	if !reflect.DeepEqual(expected, properties) {
+		t.Fatalf("expected: %v, result: %v", expected, properties)
+	}
+
+	if dir := properties.MetadataLogDir(); dir != "/tmp/a" {
+		t.Fatalf("expected: /tmp/a, result: %s", dir)
+	}
+}
+
+func TestLogDirsDefaults(t *testing.T) {
+	properties := config.Properties{"log.dir": "/tmp/single"}
+
+	if dirs := properties.LogDirs(); !reflect.DeepEqual(dirs, []string{"/tmp/single"}) {
+		t.Fatalf("expected: [/tmp/single], result: %v", dirs)
+	}
+
+	properties["metadata.log.dir"] = "/tmp/metadata"
+
+	if dir := properties.MetadataLogDir(); dir != "/tmp/metadata" {
+		t.Fatalf("expected: /tmp/metadata, result: %s", dir)
+	}
+
+	if dir := (config.Properties{}).MetadataLogDir(); dir != config.DefaultLogDir {
+		t.Fatalf("expected: %s, result: %s", config.DefaultLogDir, dir)
+	}
+}
@@ -30,13 +30,15 @@ type DecoderOpts struct {
 	Version int
 	Compact bool // TODO: compact to be not shared between array and string
 	Nilable bool
+	Raw     bool
 }
 
 func (d *DecoderOpts) withTagOps(tagOpts *tagOpts) *DecoderOpts {
 	return &DecoderOpts{
 		d.Version,
-		tagOpts.compact,
+		tagOpts.isCompact(d.Version),
 		tagOpts.nilable,
+		tagOpts.raw,
 	}
 }
 
@@ -72,14 +74,24 @@ func (d *Decoder) DecodeWithOpts(data any, opts *DecoderOpts) (err error) {
 
 func getDecoder(t reflect.Type) decoderFunc {
 	switch t.Kind() {
+	case reflect.Bool:
+		return boolDecoder
+	case reflect.Int8:
+		return int8Decoder
 	case reflect.Uint8:
 		return byteDecoder
 	case reflect.Int16:
 		return int16Decoder
+	case reflect.Uint16:
+		return uint16Decoder
 	case reflect.Int32:
 		return int32Decoder
+	case reflect.Int64:
+		return int64Decoder
 	case reflect.Uint32:
 		return uint32Decoder
+	case reflect.Float64:
+		return float64Decoder
 	case reflect.String:
 		return stringDecoder
 	case reflect.Array:
@@ -88,6 +100,8 @@ func getDecoder(t reflect.Type) decoderFunc {
 		return sliceDecoder
 	case reflect.Struct:
 		return structDecoder
+	case reflect.Pointer:
+		return pointerDecoder
 	default:
 		return nil
 	}
@@ -105,6 +119,17 @@ func cachedDecoder(t reflect.Type) decoderFunc {
 	return f.(decoderFunc)
 }
 
+func boolDecoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
+	var value byte
+
+	if value, err = d.reader.ReadByte(); err != nil {
+		return err
+	}
+
+	v.SetBool(value != 0)
+	return nil
+}
+
 func byteDecoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
 	var value byte
 
@@ -116,6 +141,17 @@ func byteDecoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
 	return nil
 }
 
+func int8Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
+	var value byte
+
+	if value, err = d.reader.ReadByte(); err != nil {
+		return err
+	}
+
+	v.SetInt(int64(int8(value)))
+	return nil
+}
+
 func int16Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
 	var value int16
 
@@ -127,6 +163,17 @@ func int16Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
 	return nil
 }
 
+func uint16Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
+	var value uint16
+
+	if value, err = d.reader.ReadUint16(); err != nil {
+		return err
+	}
+
+	v.SetUint(uint64(value))
+	return nil
+}
+
 func int32Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
 	var value int32
 
@@ -138,6 +185,17 @@ func int32Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
 	return nil
 }
 
+func int64Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
+	var value int64
+
+	if value, err = d.reader.ReadInt64(); err != nil {
+		return err
+	}
+
+	v.SetInt(value)
+	return nil
+}
+
 func uint32Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
 	var value uint32
 
@@ -149,6 +207,17 @@ func uint32Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
 	return nil
 }
 
+func float64Decoder(d *Decoder, _ *DecoderOpts, v *reflect.Value) (err error) {
+	var value float64
+
+	if value, err = d.reader.ReadFloat64(); err != nil {
+		return err
+	}
+
+	v.SetFloat(value)
+	return nil
+}
+
 func stringDecoder(d *Decoder, opts *DecoderOpts, v *reflect.Value) (err error) {
 	var lenght int16
 
@@ -172,8 +241,8 @@ func stringDecoder(d *Decoder, opts *DecoderOpts, v *reflect.Value) (err error)
 
 func readStringLenght(d *Decoder, opts *DecoderOpts) (lenght int16, err error) {
 	if opts.Compact {
-		var compactLenght uint8
-		if compactLenght, err = d.reader.ReadUint8(); err != nil {
+		var compactLenght uint64
+		if compactLenght, err = d.reader.ReadUvarint(); err != nil {
 			return 0, err
 		}
 		return int16(compactLenght) - 1, nil
@@ -206,11 +275,11 @@ func structDecoder(d *Decoder, opts *DecoderOpts, v *reflect.Value) (err error)
 	}
 
 	for _, field := range fields {
-		if field.tagOps.minVersion > opts.Version {
+		if !field.tagOps.inVersion(opts.Version) {
 			continue
 		}
 		fv := v.Field(field.fieldIdx)
-		decoder := cachedDecoder(field.fieldType)
+		decoder := cachedDecoder(fv.Type())
 
 		if err = decoder(d, opts.withTagOps(field.tagOps), &fv); err != nil {
 			return err
@@ -220,22 +289,56 @@ func structDecoder(d *Decoder, opts *DecoderOpts, v *reflect.Value) (err error)
 	return nil
 }
 
-func arrayDecoder(d *Decoder, opts *DecoderOpts, v *reflect.Value) (err error) {
-	var lenght int32
+// pointerDecoder decodes nilable structs into pointers, which stay nil when
+// the struct is null.
+func pointerDecoder(d *Decoder, opts *DecoderOpts, v *reflect.Value) (err error) {
+	if opts.Nilable {
+		var nilableByte byte
 
-	if lenght, err = readArrayLenght(d, opts); err != nil {
+		if nilableByte, err = d.reader.ReadByte(); err != nil {
+			return err
+		}
+
+		if nilableByte == 0xff {
+			v.SetZero()
+			return nil
+		}
+	}
+
+	elem := reflect.New(v.Type().Elem())
+	elemValue := elem.Elem()
+	elemOpts := *opts
+	elemOpts.Nilable = false
+
+	if err = cachedDecoder(elemValue.Type())(d, &elemOpts, &elemValue); err != nil {
 		return err
 	}
 
+	v.Set(elem)
+	return nil
+}
+
+func arrayDecoder(d *Decoder, opts *DecoderOpts, v *reflect.Value) (err error) {
+	lenght := int32(v.Len())
+
+	if !opts.Raw {
+		if lenght, err = readArrayLenght(d, opts); err != nil {
+			return err
+		}
+	}
+
 	if lenght < 0 {
 		return
 	}
 
 	elemType := v.Type().Elem()
 	elemDecoder := cachedDecoder(elemType)
+	elemOpts := *opts
+	elemOpts.Nilable = false
+
 	for i := range int(lenght) {
 		elemValue := v.Index(i)
-		if err = elemDecoder(d, opts, &elemValue); err != nil {
+		if err = elemDecoder(d, &elemOpts, &elemValue); err != nil {
 			return err
 		}
 	}
@@ -255,10 +358,33 @@ func sliceDecoder(d *Decoder, opts *DecoderOpts, v *reflect.Value) (err error) {
 	}
 
 	elemType := v.Type().Elem()
+
+	// byte slices are read at once instead of byte by byte
+	if elemType.Kind() == reflect.Uint8 {
+		bytes := reflect.MakeSlice(v.Type(), int(lenght), int(lenght))
+
+		if _, err = io.ReadFull(d.reader, bytes.Bytes()); err != nil {
+			return err
+		}
+
+		v.Set(bytes)
+		return nil
+	}
+
+	// an empty array isn't null
+	if lenght == 0 {
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		return nil
+	}
+
 	elemDecoder := cachedDecoder(elemType)
+	// nilable is about the slice, not its elements
+	elemOpts := *opts
+	elemOpts.Nilable = false
+
 	for range int(lenght) {
 		elemValue := reflect.New(elemType).Elem()
-		if err = elemDecoder(d, opts, &elemValue); err != nil {
+		if err = elemDecoder(d, &elemOpts, &elemValue); err != nil {
 			return err
 		}
 
@@ -270,8 +396,8 @@ func sliceDecoder(d *Decoder, opts *DecoderOpts, v *reflect.Value) (err error) {
 
 func readArrayLenght(d *Decoder, opts *DecoderOpts) (lenght int32, err error) {
 	if opts.Compact {
-		var compactLenght uint8
-		if compactLenght, err = d.reader.ReadUint8(); err != nil {
+		var compactLenght uint64
+		if compactLenght, err = d.reader.ReadUvarint(); err != nil {
 			return 0, err
 		}
 		return int32(compactLenght) - 1, nil
@@ -227,6 +227,15 @@ func TestDecodeEmptyString(t *testing.T) {
 	}
 }
 
+func TestDecodeEmptyStringAtEnd(t *testing.T) {
+	// a bytes.Reader at its end fails the empty reads too
+	var result string
+
+	if err := kafka.NewDecoder(bytes.NewReader([]byte{0, 0})).Decode(&result); err != nil || result != "" {
+		t.Fatalf("unexpecte error %v, result: %q", err, result)
+	}
+}
+
 func TestDecodeCompactString(t *testing.T) {
 	expected := "this is a compact string."
 
@@ -459,6 +468,45 @@ func TestDecodeStuctArray(t *testing.T) {
 	}
 }
 
+func TestDecodeNilableStructSlice(t *testing.T) {
+	type ns struct {
+		Structs []struct {
+			I32 int32 `kafka:"0"`
+		} `kafka:"0,compact,nilable"`
+	}
+
+	// the elements of a nilable slice aren't nilable
+	buffer := bytes.NewBuffer([]byte{3, 0, 0, 0, 1, 0, 0, 0, 2})
+	var result ns
+
+	if err := kafka.NewDecoder(buffer).Decode(&result); err != nil {
+		t.Fatalf("unexpecte error %s", err)
+	}
+
+	if len(result.Structs) != 2 || result.Structs[1].I32 != 2 {
+		t.Fatalf("unexpected structs: %v", result.Structs)
+	}
+}
+
+func TestDecodeEmptyNilableSlice(t *testing.T) {
+	type ns struct {
+		Int32s []int32 `kafka:"0,compact,nilable"`
+	}
+
+	// a null array stays nil, an empty one doesn't
+	for data, null := range map[byte]bool{0: true, 1: false} {
+		var result ns
+
+		if err := kafka.NewDecoder(bytes.NewBuffer([]byte{data})).Decode(&result); err != nil {
+			t.Fatalf("unexpecte error %s", err)
+		}
+
+		if (result.Int32s == nil) != null || len(result.Int32s) != 0 {
+			t.Fatalf("length %d, unexpected slice: %#v", data, result.Int32s)
+		}
+	}
+}
+
 func TestDecodeInt32Slice(t *testing.T) {
 	expected := []int32{0, 1, 2}
 
@@ -600,3 +648,94 @@ func Equals(thisList []ss, otherList []ss) bool {
 
 	return true
 }
+
+func TestDecodeRawArray(t *testing.T) {
+	type raw struct {
+		Id [4]byte `kafka:"0,raw"`
+	}
+
+	expected := raw{Id: [4]byte{1, 2, 3, 4}}
+
+	var result raw
+	if err := kafka.NewDecoder(bytes.NewReader([]byte{1, 2, 3, 4})).Decode(&result); err != nil {
+		t.Fatalf("unexpecte error %s", err)
+	}
+
+	if expected != result {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+}
+
+func TestDecodeInt8(t *testing.T) {
+	expected := int8(-2)
+
+	buffer := new(bytes.Buffer)
+	binary.Write(buffer, binary.BigEndian, expected)
+
+	var result int8
+
+	if err := kafka.NewDecoder(buffer).Decode(&result); err != nil {
+		t.Fatalf("unexpecte error %s", err)
+	}
+
+	if expected != result {
+		t.Errorf("expected: %s, result: %s", fmt.Sprint(expected), fmt.Sprint(result))
+	}
+}
+
+func TestDecodeFloat64(t *testing.T) {
+	expected := 1024.5
+
+	buffer := new(bytes.Buffer)
+	binary.Write(buffer, binary.BigEndian, expected)
+
+	var result float64
+
+	if err := kafka.NewDecoder(buffer).Decode(&result); err != nil {
+		t.Fatalf("unexpecte error %s", err)
+	}
+
+	if expected != result {
+		t.Errorf("expected: %s, result: %s", fmt.Sprint(expected), fmt.Sprint(result))
+	}
+}
+
+func TestDecodeUint16(t *testing.T) {
+	expected := uint16(9092)
+
+	buffer := new(bytes.Buffer)
+	binary.Write(buffer, binary.BigEndian, expected)
+
+	var result uint16
+
+	if err := kafka.NewDecoder(buffer).Decode(&result); err != nil {
+		t.Fatalf("unexpecte error %s", err)
+	}
+
+	if expected != result {
+		t.Errorf("expected: %s, result: %s", fmt.Sprint(expected), fmt.Sprint(result))
+	}
+}
+
+func TestDecodeNilableStructPointer(t *testing.T) {
+	type inner struct {
+		Value int32 `kafka:"0"`
+	}
+
+	type outer struct {
+		Null    *inner `kafka:"0,nilable"`
+		NotNull *inner `kafka:"1,nilable"`
+	}
+
+	expected := outer{NotNull: &inner{Value: 7}}
+	buffer := bytes.NewBuffer([]byte{0xff, 0x01, 0x00, 0x00, 0x00, 0x07})
+	var result outer
+
+	if err := kafka.NewDecoder(buffer).Decode(&result); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	if !reflect.DeepEqual(expected, result) {
+		t.Fatalf("expected: %+v, result: %+v", expected, result)
+	}
+}
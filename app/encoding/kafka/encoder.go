@@ -34,7 +34,7 @@ type EncoderOpts struct {
 func (e *EncoderOpts) withTagOps(tagOpts *tagOpts) *EncoderOpts {
 	return &EncoderOpts{
 		e.Version,
-		tagOpts.compact,
+		tagOpts.isCompact(e.Version),
 		tagOpts.nilable,
 		tagOpts.raw,
 	}
@@ -79,14 +79,22 @@ func getEncoder(t reflect.Type) encoderFunc {
 	switch t.Kind() {
 	case reflect.Bool:
 		return boolEncoder
+	case reflect.Int8:
+		return int8Encoder
 	case reflect.Uint8:
 		return byteEncoder
 	case reflect.Int16:
 		return int16Encoder
+	case reflect.Uint16:
+		return uint16Encoder
 	case reflect.Int32:
 		return int32Encoder
+	case reflect.Int64:
+		return int64Encoder
 	case reflect.Uint32:
 		return uint32Encoder
+	case reflect.Float64:
+		return float64Encoder
 	case reflect.String:
 		return stringEncoder
 	case reflect.Array, reflect.Slice:
@@ -94,20 +102,26 @@ func getEncoder(t reflect.Type) encoderFunc {
 	case reflect.Struct:
 		return structEncoder
 	default:
-		fmt.Println(t.Kind())
-		panic("type not supported on encoder")
+		return nil
 	}
 }
 
 var encodeFuncCache sync.Map // map[reflect.Kind][]encodeFunc
 
 func cachedEncoder(t reflect.Type) encoderFunc {
-	k := realType(t).Kind()
+	t = realType(t)
+	k := t.Kind()
 	if f, ok := encodeFuncCache.Load(k); ok {
 		return f.(encoderFunc)
 	}
 
-	f, _ := encodeFuncCache.LoadOrStore(k, getEncoder(t))
+	encoder := getEncoder(t)
+
+	if encoder == nil {
+		panic(fmt.Sprintf("type %s not supported on encoder", t))
+	}
+
+	f, _ := encodeFuncCache.LoadOrStore(k, encoder)
 	return f.(encoderFunc)
 }
 
@@ -134,6 +148,14 @@ func byteEncoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
 	return nil
 }
 
+func int8Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
+	if err = e.writer.WriteByte(byte(int8(v.Int()))); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func int16Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
 	value := int16(v.Int())
 
@@ -144,6 +166,16 @@ func int16Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
 	return nil
 }
 
+func uint16Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
+	value := uint16(v.Uint())
+
+	if err = e.writer.WriteUint16(value); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func int32Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
 	value := int32(v.Int())
 
@@ -154,6 +186,14 @@ func int32Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
 	return nil
 }
 
+func int64Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
+	if err = e.writer.WriteInt64(v.Int()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func uint32Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
 	value := uint32(v.Uint())
 
@@ -164,6 +204,14 @@ func uint32Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
 	return nil
 }
 
+func float64Encoder(e *Encoder, _ *EncoderOpts, v *reflect.Value) (err error) {
+	if err = e.writer.WriteFloat64(v.Float()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func stringEncoder(e *Encoder, opts *EncoderOpts, v *reflect.Value) (err error) {
 	str := v.String()
 	lenght := int16(len(str))
@@ -178,7 +226,7 @@ func stringEncoder(e *Encoder, opts *EncoderOpts, v *reflect.Value) (err error)
 			return err
 		}
 	case opts.Compact:
-		if err = e.writer.WriteByte(byte(lenght + 1)); err != nil {
+		if err = e.writer.WriteUvarint(uint64(lenght) + 1); err != nil {
 			return err
 		}
 	default:
@@ -211,12 +259,22 @@ func arrayEncoder(e *Encoder, opts *EncoderOpts, v *reflect.Value) (err error) {
 		return nil
 	}
 
+	// byte slices are written at once instead of byte by byte
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		_, err = e.writer.Write(v.Bytes())
+		return err
+	}
+
+	// nilable is about the array, not its elements
+	elemOpts := *opts
+	elemOpts.Nilable = false
+
 	for i := range lenght {
 		elem := v.Index(i)
 
 		elemEncoder := cachedEncoder(elem.Type())
 
-		if err = elemEncoder(e, opts, &elem); err != nil {
+		if err = elemEncoder(e, &elemOpts, &elem); err != nil {
 			return err
 		}
 	}
@@ -237,7 +295,7 @@ func arrayLengthEncoder(e *Encoder, opts *EncoderOpts, v *reflect.Value) (err er
 			return err
 		}
 	case opts.Compact:
-		if err = e.writer.WriteByte(byte(lenght + 1)); err != nil {
+		if err = e.writer.WriteUvarint(uint64(lenght) + 1); err != nil {
 			return err
 		}
 	default:
@@ -265,6 +323,14 @@ func structEncoder(e *Encoder, opts *EncoderOpts, v *reflect.Value) (err error)
 			return ErrNonNilableStruct
 		}
 
+		if opts.Nilable {
+			if err = e.writer.WriteByte(0x01); err != nil {
+				return err
+			}
+		}
+
+		elem := v.Elem()
+		v = &elem
 	}
 
 	fields, err := cachedTypeFields(v)
@@ -274,7 +340,7 @@ func structEncoder(e *Encoder, opts *EncoderOpts, v *reflect.Value) (err error)
 	}
 
 	for _, field := range fields {
-		if field.tagOps.minVersion > opts.Version {
+		if !field.tagOps.inVersion(opts.Version) {
 			continue
 		}
 		fv := v.Field(field.fieldIdx)
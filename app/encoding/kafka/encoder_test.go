@@ -2,6 +2,7 @@ package kafka_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"reflect"
 	"slices"
@@ -658,3 +659,188 @@ func TestEncodeStruct(t *testing.T) {
 		t.Fatalf("expected: %s, result: %s", fmt.Sprint(expected), fmt.Sprint(result))
 	}
 }
+
+type versionedCompact struct {
+	Removed string   `kafka:"0,maxVersion=0"`
+	Names   []string `kafka:"1,compact=1"`
+}
+
+var testEncodeVersionedCompactCases = []struct {
+	version  int
+	expected []byte
+}{
+	{
+		version:  0,
+		expected: []byte{0, 1, 'r', 0, 0, 0, 1, 0, 1, 'a'},
+	},
+	{
+		version:  1,
+		expected: []byte{2, 2, 'a'},
+	},
+}
+
+func TestEncodeVersionedCompactStruct(t *testing.T) {
+	value := versionedCompact{
+		Removed: "r",
+		Names:   []string{"a"},
+	}
+
+	for _, testCase := range testEncodeVersionedCompactCases {
+		buffer := new(bytes.Buffer)
+
+		if err := kafka.NewEncoder(buffer).EncodeWithOpts(value, &kafka.EncoderOpts{
+			Version: testCase.version,
+		}); err != nil {
+			t.Fatalf("unexpected encode error: %s", err)
+		}
+
+		if !slices.Equal(testCase.expected, buffer.Bytes()) {
+			t.Errorf("version: %d, expected: %v, result: %v", testCase.version, testCase.expected, buffer.Bytes())
+		}
+	}
+}
+
+func TestCheckEncodable(t *testing.T) {
+	type supported struct {
+		Values []versionedCompact `kafka:"0"`
+	}
+
+	if err := kafka.CheckEncodable(reflect.TypeOf(supported{})); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	type unsupported struct {
+		Values []map[string]string `kafka:"0"`
+	}
+
+	var unsupportedTypeError *kafka.UnsupportedTypeError
+	if err := kafka.CheckEncodable(reflect.TypeOf(unsupported{})); !errors.As(err, &unsupportedTypeError) {
+		t.Fatalf("expected: *kafka.UnsupportedTypeError, result: %v", err)
+	}
+}
+
+func TestEncodeLongCompactBytes(t *testing.T) {
+	expected := bytes.Repeat([]byte{'a'}, 200)
+
+	buffer := new(bytes.Buffer)
+
+	if err := kafka.NewEncoder(buffer).EncodeWithOpts(expected, &kafka.EncoderOpts{
+		Compact: true,
+	}); err != nil {
+		t.Fatalf("unexpected encode error: %s", err)
+	}
+
+	// 201 as an unsigned varint
+	if !slices.Equal([]byte{0xc9, 0x01}, buffer.Bytes()[:2]) {
+		t.Fatalf("expectedLenght: %v, resultLenght: %v", []byte{0xc9, 0x01}, buffer.Bytes()[:2])
+	}
+
+	var result []byte
+
+	if err := kafka.NewDecoder(buffer).DecodeWithOpts(&result, &kafka.DecoderOpts{
+		Compact: true,
+	}); err != nil {
+		t.Fatalf("unexpected decode error: %s", err)
+	}
+
+	if !slices.Equal(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+}
+
+func TestEncodeInt64(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	expected := int64(1) << 40
+
+	var err error
+	if err = kafka.NewEncoder(buffer).Encode(expected); err != nil {
+		t.Fatalf("unexpected encode error: %s", err)
+	}
+
+	var result int64
+
+	if result, err = kafka.NewKafkaReader(buffer).ReadInt64(); err != nil {
+		t.Fatalf("unexpected read error: %s", err)
+	}
+
+	if expected != result {
+		t.Fatalf("expected: %d, result: %d", expected, result)
+	}
+}
+
+func TestEncodeInt8(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	var err error
+	if err = kafka.NewEncoder(buffer).Encode(int8(-2)); err != nil {
+		t.Fatalf("unexpected encode error: %s", err)
+	}
+
+	expected := []byte{0xfe}
+	result := buffer.Bytes()
+
+	if !slices.Equal(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+}
+
+func TestEncodeFloat64(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	expected := 1024.5
+
+	var err error
+	if err = kafka.NewEncoder(buffer).Encode(expected); err != nil {
+		t.Fatalf("unexpected encode error: %s", err)
+	}
+
+	var result float64
+
+	if result, err = kafka.NewKafkaReader(buffer).ReadFloat64(); err != nil {
+		t.Fatalf("unexpected read error: %s", err)
+	}
+
+	if expected != result {
+		t.Fatalf("expected: %f, result: %f", expected, result)
+	}
+}
+
+func TestEncodeUint16(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	var err error
+	if err = kafka.NewEncoder(buffer).Encode(uint16(65535)); err != nil {
+		t.Fatalf("unexpected encode error: %s", err)
+	}
+
+	expected := []byte{0xff, 0xff}
+	result := buffer.Bytes()
+
+	if !slices.Equal(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+}
+
+func TestEncodeNilableStructPointer(t *testing.T) {
+	type inner struct {
+		Value int32 `kafka:"0"`
+	}
+
+	type outer struct {
+		Null    *inner `kafka:"0,nilable"`
+		NotNull *inner `kafka:"1,nilable"`
+	}
+
+	buffer := new(bytes.Buffer)
+
+	if err := kafka.NewEncoder(buffer).Encode(outer{NotNull: &inner{Value: 7}}); err != nil {
+		t.Fatalf("unexpected encode error: %s", err)
+	}
+
+	expected := []byte{0xff, 0x01, 0x00, 0x00, 0x00, 0x07}
+
+	if !bytes.Equal(expected, buffer.Bytes()) {
+		t.Fatalf("expected: %v, result: %v", expected, buffer.Bytes())
+	}
+}
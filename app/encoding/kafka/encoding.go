@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"fmt"
 	"reflect"
 	"sort"
 	"sync"
@@ -70,3 +71,59 @@ func realType(t reflect.Type) reflect.Type {
 	}
 	return t
 }
+
+type UnsupportedTypeError struct {
+	Type reflect.Type
+	Op   string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("kafka: %s of type %s is not supported", e.Op, e.Type)
+}
+
+// CheckEncodable reports whether every field reachable from t can be encoded.
+func CheckEncodable(t reflect.Type) error {
+	return checkType(t, "encode", func(t reflect.Type) bool {
+		return getEncoder(t) != nil
+	}, make(map[reflect.Type]bool))
+}
+
+// CheckDecodable reports whether every field reachable from t can be decoded.
+func CheckDecodable(t reflect.Type) error {
+	return checkType(t, "decode", func(t reflect.Type) bool {
+		return getDecoder(t) != nil
+	}, make(map[reflect.Type]bool))
+}
+
+func checkType(t reflect.Type, op string, supported func(reflect.Type) bool, visited map[reflect.Type]bool) error {
+	t = realType(t)
+
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+
+	if !supported(t) {
+		return &UnsupportedTypeError{t, op}
+	}
+
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice:
+		return checkType(t.Elem(), op, supported, visited)
+	case reflect.Struct:
+		v := reflect.New(t).Elem()
+		fields, err := cachedTypeFields(&v)
+
+		if err != nil {
+			return err
+		}
+
+		for _, field := range fields {
+			if err = checkType(field.fieldType, op, supported, visited); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
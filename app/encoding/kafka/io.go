@@ -35,6 +35,15 @@ func (kr *KafkaReader) ReadInt16() (int16, error) {
 	return value, nil
 }
 
+func (kr *KafkaReader) ReadUint16() (uint16, error) {
+	var value uint16
+	err := binary.Read(kr, binary.BigEndian, &value)
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
 func (kr *KafkaReader) ReadUint32() (uint32, error) {
 	var value uint32
 	err := binary.Read(kr, binary.BigEndian, &value)
@@ -53,6 +62,28 @@ func (kr *KafkaReader) ReadInt32() (int32, error) {
 	return value, nil
 }
 
+func (kr *KafkaReader) ReadInt64() (int64, error) {
+	var value int64
+	err := binary.Read(kr, binary.BigEndian, &value)
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+func (kr *KafkaReader) ReadFloat64() (float64, error) {
+	var value float64
+	err := binary.Read(kr, binary.BigEndian, &value)
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+func (kr *KafkaReader) ReadUvarint() (uint64, error) {
+	return binary.ReadUvarint(kr)
+}
+
 func (kr *KafkaReader) ReadByte() (byte, error) {
 	var value byte
 	err := binary.Read(kr, binary.BigEndian, &value)
@@ -66,7 +97,8 @@ func (kr *KafkaReader) ReadByte() (byte, error) {
 func (kr *KafkaReader) ReadString(lenght int16) (string, error) {
 	bytes := make([]byte, lenght)
 
-	if _, err := kr.Read(bytes); err != nil {
+	// an empty string may end the data
+	if _, err := io.ReadFull(kr, bytes); err != nil {
 		return "", err
 	}
 
@@ -101,6 +133,14 @@ func (kw *KafkaWriter) WriteInt16(value int16) error {
 	return nil
 }
 
+func (kw *KafkaWriter) WriteUint16(value uint16) error {
+	err := binary.Write(kw, binary.BigEndian, value)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (kw *KafkaWriter) WriteInt32(value int32) error {
 	err := binary.Write(kw, binary.BigEndian, value)
 	if err != nil {
@@ -117,6 +157,27 @@ func (kw *KafkaWriter) WriteUint32(value uint32) error {
 	return nil
 }
 
+func (kw *KafkaWriter) WriteInt64(value int64) error {
+	err := binary.Write(kw, binary.BigEndian, value)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (kw *KafkaWriter) WriteFloat64(value float64) error {
+	err := binary.Write(kw, binary.BigEndian, value)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (kw *KafkaWriter) WriteUvarint(value uint64) error {
+	_, err := kw.Write(binary.AppendUvarint(nil, value))
+	return err
+}
+
 func (kw *KafkaWriter) WriteString(value string) error {
 	err := binary.Write(kw, binary.BigEndian, []byte(value))
 	if err != nil {
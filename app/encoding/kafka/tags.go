@@ -7,14 +7,34 @@ import (
 )
 
 type tagOpts struct {
-	order      int
-	minVersion int
-	compact    bool
-	nilable    bool
-	raw        bool
+	order          int
+	minVersion     int
+	maxVersion     int
+	hasMaxVersion  bool
+	compact        bool
+	compactVersion int
+	nilable        bool
+	raw            bool
+}
+
+// inVersion reports whether the field is present in the given version.
+func (t *tagOpts) inVersion(version int) bool {
+	if version < t.minVersion {
+		return false
+	}
+
+	return !t.hasMaxVersion || version <= t.maxVersion
+}
+
+// isCompact reports whether the field uses the compact encoding in the
+// given version, `compact=3` makes it compact only from version 3 on.
+func (t *tagOpts) isCompact(version int) bool {
+	return t.compact && version >= t.compactVersion
 }
 
 var ErrMinVersionInvalid = errors.New("min version is invalid should be `kafka:\"orderNumberHere,minVersion=versionNumberHere\"` ")
+var ErrMaxVersionInvalid = errors.New("max version is invalid should be `kafka:\"orderNumberHere,maxVersion=versionNumberHere\"` ")
+var ErrCompactVersionInvalid = errors.New("compact version is invalid should be `kafka:\"orderNumberHere,compact=versionNumberHere\"` ")
 var ErrOrderInvalid = errors.New("order is invalid should be `kafka:\"orderNumberHere\"` ")
 
 func parseTag(tag string) (tagOpts tagOpts, err error) {
@@ -34,8 +54,22 @@ func parseTag(tag string) (tagOpts tagOpts, err error) {
 			if tagOpts.minVersion, err = strconv.Atoi(value); err != nil {
 				return tagOpts, ErrMinVersionInvalid
 			}
+		case "maxVersion":
+			if !found {
+				return tagOpts, ErrMaxVersionInvalid
+			}
+			if tagOpts.maxVersion, err = strconv.Atoi(value); err != nil {
+				return tagOpts, ErrMaxVersionInvalid
+			}
+			tagOpts.hasMaxVersion = true
 		case "compact":
 			tagOpts.compact = true
+			if !found {
+				continue
+			}
+			if tagOpts.compactVersion, err = strconv.Atoi(value); err != nil {
+				return tagOpts, ErrCompactVersionInvalid
+			}
 		case "nilable":
 			tagOpts.nilable = true
 		case "raw":
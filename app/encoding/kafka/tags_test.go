@@ -70,6 +70,23 @@ var testParseTagCases = []struct {
 			nilable:    true,
 		},
 	},
+	{
+		tag: "10002,maxVersion=2",
+		expected: tagOpts{
+			order:         10002,
+			maxVersion:    2,
+			hasMaxVersion: true,
+		},
+	},
+	{
+		tag: "10003,minVersion=1,compact=3",
+		expected: tagOpts{
+			order:          10003,
+			minVersion:     1,
+			compact:        true,
+			compactVersion: 3,
+		},
+	},
 }
 
 func TestParseTag(t *testing.T) {
@@ -109,6 +126,14 @@ var testParseInvalidTagCase = []struct {
 		tag: "0,minVersion=invalid",
 		err: ErrMinVersionInvalid,
 	},
+	{
+		tag: "0,maxVersion",
+		err: ErrMaxVersionInvalid,
+	},
+	{
+		tag: "0,compact=invalid",
+		err: ErrCompactVersionInvalid,
+	},
 }
 
 func TestParseInvalidTag(t *testing.T) {
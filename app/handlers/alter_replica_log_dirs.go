@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+type AlterReplicaLogDirTopic struct {
+	Name         string               `kafka:"0,compact=2"`
+	Partitions   []int32              `kafka:"1,compact=2"`
+	TaggedFields []server.TaggedField `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+type AlterReplicaLogDir struct {
+	// Path is the log directory the partitions are moved to.
+	Path         string                    `kafka:"0,compact=2"`
+	Topics       []AlterReplicaLogDirTopic `kafka:"1,compact=2"`
+	TaggedFields []server.TaggedField      `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+type AlterReplicaLogDirsRequest struct {
+	Dirs         []AlterReplicaLogDir `kafka:"0,compact=2"`
+	TaggedFields []server.TaggedField `kafka:"1,minVersion=2,compact,nilable"`
+}
+
+func (AlterReplicaLogDirsRequest) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 2}
+}
+
+type AlterReplicaLogDirPartitionResult struct {
+	PartitionIndex int32                `kafka:"0"`
+	ErrorCode      server.ErrorCode     `kafka:"1"`
+	TaggedFields   []server.TaggedField `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+type AlterReplicaLogDirTopicResult struct {
+	TopicName    string                              `kafka:"0,compact=2"`
+	Partitions   []AlterReplicaLogDirPartitionResult `kafka:"1,compact=2"`
+	TaggedFields []server.TaggedField                `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+type AlterReplicaLogDirsResponse struct {
+	ThrottleTimeMs int32                           `kafka:"0"`
+	Results        []AlterReplicaLogDirTopicResult `kafka:"1,compact=2"`
+	TaggedFields   []server.TaggedField            `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+func (AlterReplicaLogDirsResponse) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 2}
+}
+
+func (r AlterReplicaLogDirsRequest) ErrorResponse(
+	ctx context.Context,
+	_ server.ApiVersion,
+	errorCode server.ErrorCode,
+) *AlterReplicaLogDirsResponse {
+	responseBody := &AlterReplicaLogDirsResponse{
+		ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+	}
+
+	for _, dir := range r.Dirs {
+		for _, topic := range dir.Topics {
+			result := AlterReplicaLogDirTopicResult{TopicName: topic.Name}
+
+			for _, partition := range topic.Partitions {
+				result.Partitions = append(result.Partitions, AlterReplicaLogDirPartitionResult{
+					PartitionIndex: partition,
+					ErrorCode:      errorCode,
+				})
+			}
+
+			responseBody.Results = append(responseBody.Results, result)
+		}
+	}
+
+	return responseBody
+}
+
+// NewAlterReplicaLogDirsHandler moves the logs of the partitions to the log
+// directories requested, online: the moves go on in the background, see
+// log.Manager.AlterLogDir. The directory of a partition without log yet is
+// the one it is created on, REPLICA_NOT_AVAILABLE is answered then.
+func NewAlterReplicaLogDirsHandler(
+	publisher metadata.Publisher,
+	logs *log.Manager,
+) server.TypedHandlerFunc[AlterReplicaLogDirsRequest, AlterReplicaLogDirsResponse] {
+	return func(
+		ctx context.Context,
+		requestData *AlterReplicaLogDirsRequest,
+		_ server.ApiVersion,
+	) (*AlterReplicaLogDirsResponse, error) {
+		image := publisher.Image()
+		logger := server.LoggerFromContext(ctx)
+		responseBody := &AlterReplicaLogDirsResponse{
+			ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+		}
+
+		for _, dir := range requestData.Dirs {
+			for _, topic := range dir.Topics {
+				result := AlterReplicaLogDirTopicResult{TopicName: topic.Name}
+				metadataTopic, topicFound := image.Topic(topic.Name)
+
+				for _, partition := range topic.Partitions {
+					partitionResult := AlterReplicaLogDirPartitionResult{PartitionIndex: partition}
+
+					if !topicFound || metadataTopic.Partitions[partition] == nil {
+						partitionResult.ErrorCode = server.ErrUnknownTopicOrPartition
+						result.Partitions = append(result.Partitions, partitionResult)
+						continue
+					}
+
+					tp := log.TopicPartition{Topic: topic.Name, Partition: partition}
+
+					switch err := logs.AlterLogDir(tp, dir.Path); {
+					case err == nil:
+					case errors.Is(err, log.ErrLogDirNotFound):
+						partitionResult.ErrorCode = server.ErrLogDirNotFound
+					case errors.Is(err, log.ErrLogNotFound):
+						partitionResult.ErrorCode = server.ErrReplicaNotAvailable
+					case errors.Is(err, log.ErrLogDirOffline):
+						partitionResult.ErrorCode = server.ErrKafkaStorageError
+					default:
+						logger.Error("couldn't move log", "partition", tp, "log_dir", dir.Path, "error", err)
+						partitionResult.ErrorCode = server.ErrKafkaStorageError
+					}
+
+					result.Partitions = append(result.Partitions, partitionResult)
+				}
+
+				responseBody.Results = append(responseBody.Results, result)
+			}
+		}
+
+		return responseBody, nil
+	}
+}
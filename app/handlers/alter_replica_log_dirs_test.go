@@ -0,0 +1,76 @@
+package handlers_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/handlers"
+	"github.com/codecrafters-io/kafka-starter-go/app/kafkatest"
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+func TestAlterReplicaLogDirs(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	logs := kafkatest.NewLogs(t, log.DefaultConfig, dirs...)
+	kafkatest.AppendRecords(t, logs, log.TopicPartition{Topic: "foo", Partition: 0})
+
+	image := kafkatest.NewImage(kafkatest.TopicRecords("foo", metadata.Uuid{1}, 2)...)
+	s := kafkatest.NewPipeServer(t)
+
+	server.HandleFlexible(
+		s.KafkaServer, server.AlterReplicaLogDirs, server.ApiVersionRange{Min: 0, Max: 1}, server.ApiVersionRange{Min: 2, Max: 2},
+		handlers.NewAlterReplicaLogDirsHandler(metadata.NewStaticPublisher(image), logs),
+	)
+
+	client := s.Dial()
+	request := &handlers.AlterReplicaLogDirsRequest{
+		Dirs: []handlers.AlterReplicaLogDir{
+			{Path: dirs[1], Topics: []handlers.AlterReplicaLogDirTopic{
+				{Name: "foo", Partitions: []int32{0, 1, 2}},
+				{Name: "bar", Partitions: []int32{0}},
+			}},
+			{Path: t.TempDir(), Topics: []handlers.AlterReplicaLogDirTopic{{Name: "foo", Partitions: []int32{0}}}},
+		},
+	}
+
+	expected := []server.ErrorCode{
+		server.ErrNone, server.ErrReplicaNotAvailable, server.ErrUnknownTopicOrPartition,
+		server.ErrUnknownTopicOrPartition,
+		server.ErrLogDirNotFound,
+	}
+
+	for _, version := range []server.ApiVersion{1, 2} {
+		response := kafkatest.MustCall[handlers.AlterReplicaLogDirsResponse](t, client, server.AlterReplicaLogDirs, version, request)
+
+		var errorCodes []server.ErrorCode
+
+		for _, result := range response.Results {
+			for _, partition := range result.Partitions {
+				errorCodes = append(errorCodes, partition.ErrorCode)
+			}
+		}
+
+		if len(errorCodes) != len(expected) {
+			t.Fatalf("v%d, unexpected response: %+v", version, response)
+		}
+
+		for i, errorCode := range errorCodes {
+			if errorCode != expected[i] {
+				t.Fatalf("v%d, expected: %v, result: %v", version, expected, errorCodes)
+			}
+		}
+	}
+
+	// foo-1 is created on the directory asked for
+	l, err := logs.GetOrCreate(log.TopicPartition{Topic: "foo", Partition: 1}, log.DefaultConfig)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if filepath.Dir(l.Dir()) != dirs[1] {
+		t.Fatalf("expected foo-1 on %s, result: %s", dirs[1], l.Dir())
+	}
+}
@@ -1,54 +1,84 @@
 package handlers
 
 import (
-	"fmt"
+	"context"
 
-	"github.com/codecrafters-io/kafka-starter-go/app/encoding/kafka"
 	"github.com/codecrafters-io/kafka-starter-go/app/server"
 )
 
 type ApiVersionsRequest struct {
-	ClientId      string               `kafka:"0,compact"`
-	ClientVersion string               `kafka:"1,compact"`
-	TaggedFields  []server.TaggedField `kafka:"2,compact"`
+	ClientId      string               `kafka:"0,minVersion=3,compact"`
+	ClientVersion string               `kafka:"1,minVersion=3,compact"`
+	TaggedFields  []server.TaggedField `kafka:"2,minVersion=3,compact"`
+}
+
+func (ApiVersionsRequest) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 4}
 }
 
 type ApiVersionsResponse struct {
 	ErrorCode      server.ErrorCode     `kafka:"0"`
-	ApiKeys        []ApiKeyVersion      `kafka:"1,compact"`
-	ThrottleTimeMs int32                `kafka:"2"`
-	TaggedFields   []server.TaggedField `kafka:"3,compact,nilable"`
+	ApiKeys        []ApiKeyVersion      `kafka:"1,compact=3"`
+	ThrottleTimeMs int32                `kafka:"2,minVersion=1"`
+	TaggedFields   []server.TaggedField `kafka:"3,minVersion=3,compact,nilable"`
+}
+
+func (ApiVersionsResponse) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 4}
 }
 
 type ApiKeyVersion struct {
 	Key          server.ApiKey        `kafka:"0"`
 	MinVersion   server.ApiVersion    `kafka:"1"`
 	MaxVersion   server.ApiVersion    `kafka:"2"`
-	TaggedFields []server.TaggedField `kafka:"3,compact,nilable"`
+	TaggedFields []server.TaggedField `kafka:"3,minVersion=3,compact,nilable"`
 }
 
-func ApiVersionsHandler(responseWriter server.ResponseWriter, request *server.Request) (err error) {
-	var requestData ApiVersionsRequest
+func ApiVersionsHandler(
+	ctx context.Context,
+	requestData *ApiVersionsRequest,
+	_ server.ApiVersion,
+) (*ApiVersionsResponse, error) {
+	server.LoggerFromContext(ctx).Debug("api versions",
+		"client_software_name", requestData.ClientId,
+		"client_software_version", requestData.ClientVersion,
+	)
 
-	if err = kafka.NewDecoder(request.Body).Decode(&requestData); err != nil {
-		return err
+	responseBody := &ApiVersionsResponse{
+		ApiKeys:        supportedApiKeys(ctx),
+		ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
 	}
 
-	fmt.Printf("ClientName: %s, ClientVersion: %s\n", requestData.ClientId, requestData.ClientVersion)
+	return responseBody, nil
+}
 
+// ErrorResponse keeps the supported api keys on ErrUnsupportedVersion errors,
+// so the client can pick a version both sides support.
+func (ApiVersionsRequest) ErrorResponse(
+	ctx context.Context,
+	_ server.ApiVersion,
+	errorCode server.ErrorCode,
+) *ApiVersionsResponse {
 	responseBody := &ApiVersionsResponse{
-		ThrottleTimeMs: 0,
+		ErrorCode:      errorCode,
+		ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+	}
+
+	if errorCode == server.ErrUnsupportedVersion {
+		responseBody.ApiKeys = supportedApiKeys(ctx)
 	}
 
-	supportedApis := server.GetSupportedApis()
+	return responseBody
+}
 
-	for apiKey, rangeVersion := range supportedApis {
-		responseBody.ApiKeys = append(responseBody.ApiKeys, ApiKeyVersion{
-			Key:        apiKey,
-			MinVersion: rangeVersion.Min,
-			MaxVersion: rangeVersion.Max,
+func supportedApiKeys(ctx context.Context) (apiKeys []ApiKeyVersion) {
+	for _, supportedApi := range server.SupportedApisFromContext(ctx) {
+		apiKeys = append(apiKeys, ApiKeyVersion{
+			Key:        supportedApi.Key,
+			MinVersion: supportedApi.Versions.Min,
+			MaxVersion: supportedApi.Versions.Max,
 		})
 	}
 
-	return kafka.NewEncoder(responseWriter).Encode(responseBody)
+	return apiKeys
 }
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/quota"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+// ClientQuotaEntityComponent is a component of a quota entity, an empty
+// EntityName is sent as null and names the default entity.
+type ClientQuotaEntityComponent struct {
+	EntityType   string               `kafka:"0,compact=1"`
+	EntityName   string               `kafka:"1,compact=1,nilable"`
+	TaggedFields []server.TaggedField `kafka:"2,minVersion=1,compact,nilable"`
+}
+
+type ClientQuotaValue struct {
+	Key          string               `kafka:"0,compact=1"`
+	Value        float64              `kafka:"1"`
+	TaggedFields []server.TaggedField `kafka:"2,minVersion=1,compact,nilable"`
+}
+
+type ClientQuotaEntry struct {
+	Entity       []ClientQuotaEntityComponent `kafka:"0,compact=1"`
+	Values       []ClientQuotaValue           `kafka:"1,compact=1"`
+	TaggedFields []server.TaggedField         `kafka:"2,minVersion=1,compact,nilable"`
+}
+
+var errInvalidEntity = errors.New("invalid quota entity")
+
+// quotaEntity turns the components into a quota.Entity, each entity type
+// can appear only once.
+func quotaEntity(components []ClientQuotaEntityComponent) (quota.Entity, error) {
+	var entity quota.Entity
+	var seen []string
+
+	for _, component := range components {
+		if slices.Contains(seen, component.EntityType) {
+			return entity, fmt.Errorf("%w: entity type %s is repeated", errInvalidEntity, component.EntityType)
+		}
+		seen = append(seen, component.EntityType)
+
+		name := component.EntityName
+
+		if name == "" {
+			name = quota.Default
+		}
+
+		switch component.EntityType {
+		case quota.UserEntity:
+			entity.User = name
+		case quota.ClientIdEntity:
+			entity.ClientId = name
+		default:
+			return entity, fmt.Errorf("%w: unsupported entity type %s", errInvalidEntity, component.EntityType)
+		}
+	}
+
+	if entity == (quota.Entity{}) {
+		return entity, fmt.Errorf("%w: no entity type", errInvalidEntity)
+	}
+
+	return entity, nil
+}
+
+func entityComponents(entity quota.Entity) (components []ClientQuotaEntityComponent) {
+	entityName := func(name string) string {
+		if name == quota.Default {
+			return ""
+		}
+		return name
+	}
+
+	if entity.User != "" {
+		components = append(components, ClientQuotaEntityComponent{
+			EntityType: quota.UserEntity,
+			EntityName: entityName(entity.User),
+		})
+	}
+
+	if entity.ClientId != "" {
+		components = append(components, ClientQuotaEntityComponent{
+			EntityType: quota.ClientIdEntity,
+			EntityName: entityName(entity.ClientId),
+		})
+	}
+
+	return components
+}
+
+// The match types of DescribeClientQuotas filters.
+const (
+	MatchTypeExact     int8 = 0
+	MatchTypeDefault   int8 = 1
+	MatchTypeSpecified int8 = 2
+)
+
+type DescribeClientQuotasComponent struct {
+	EntityType   string               `kafka:"0,compact=1"`
+	MatchType    int8                 `kafka:"1"`
+	Match        string               `kafka:"2,compact=1,nilable"`
+	TaggedFields []server.TaggedField `kafka:"3,minVersion=1,compact"`
+}
+
+type DescribeClientQuotasRequest struct {
+	Components   []DescribeClientQuotasComponent `kafka:"0,compact=1"`
+	Strict       bool                            `kafka:"1"`
+	TaggedFields []server.TaggedField            `kafka:"2,minVersion=1,compact"`
+}
+
+func (DescribeClientQuotasRequest) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 1}
+}
+
+type DescribeClientQuotasResponse struct {
+	ThrottleTimeMs int32                `kafka:"0"`
+	ErrorCode      server.ErrorCode     `kafka:"1"`
+	ErrorMessage   string               `kafka:"2,compact=1,nilable"`
+	Entries        []ClientQuotaEntry   `kafka:"3,compact=1"`
+	TaggedFields   []server.TaggedField `kafka:"4,minVersion=1,compact,nilable"`
+}
+
+func (DescribeClientQuotasResponse) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 1}
+}
+
+func (DescribeClientQuotasRequest) ErrorResponse(
+	ctx context.Context,
+	_ server.ApiVersion,
+	errorCode server.ErrorCode,
+) *DescribeClientQuotasResponse {
+	return &DescribeClientQuotasResponse{
+		ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+		ErrorCode:      errorCode,
+		ErrorMessage:   errorCode.Message(),
+	}
+}
+
+// matchName reports whether the entity name, empty when the entity has no
+// such component, is matched by the filter component.
+func matchName(component DescribeClientQuotasComponent, name string) bool {
+	switch component.MatchType {
+	case MatchTypeExact:
+		return name == component.Match
+	case MatchTypeDefault:
+		return name == quota.Default
+	default:
+		return name != "" && name != quota.Default
+	}
+}
+
+// filter returns the filter of the request components, on strict requests
+// the entities can't have components out of the filter.
+func (r *DescribeClientQuotasRequest) filter() (func(quota.Entity) bool, error) {
+	var user, clientId *DescribeClientQuotasComponent
+
+	for i, component := range r.Components {
+		if component.MatchType < MatchTypeExact || component.MatchType > MatchTypeSpecified {
+			return nil, fmt.Errorf("invalid match type %d", component.MatchType)
+		}
+
+		switch {
+		case component.EntityType == quota.UserEntity && user == nil:
+			user = &r.Components[i]
+		case component.EntityType == quota.ClientIdEntity && clientId == nil:
+			clientId = &r.Components[i]
+		default:
+			return nil, fmt.Errorf("%w: entity type %s is unsupported or repeated", errInvalidEntity, component.EntityType)
+		}
+	}
+
+	return func(entity quota.Entity) bool {
+		if user != nil && !matchName(*user, entity.User) {
+			return false
+		}
+
+		if clientId != nil && !matchName(*clientId, entity.ClientId) {
+			return false
+		}
+
+		if r.Strict {
+			return (user != nil || entity.User == "") && (clientId != nil || entity.ClientId == "")
+		}
+
+		return true
+	}, nil
+}
+
+func NewDescribeClientQuotasHandler(manager *quota.Manager) server.TypedHandlerFunc[DescribeClientQuotasRequest, DescribeClientQuotasResponse] {
+	return func(
+		ctx context.Context,
+		requestData *DescribeClientQuotasRequest,
+		_ server.ApiVersion,
+	) (*DescribeClientQuotasResponse, error) {
+		filter, err := requestData.filter()
+
+		if err != nil {
+			return nil, server.NewError(server.ErrInvalidRequest, err)
+		}
+
+		responseBody := &DescribeClientQuotasResponse{
+			ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+			Entries:        []ClientQuotaEntry{},
+		}
+
+		for entity, values := range manager.Quotas(filter) {
+			entry := ClientQuotaEntry{Entity: entityComponents(entity)}
+
+			for _, key := range quota.Keys {
+				if value, found := values[key]; found {
+					entry.Values = append(entry.Values, ClientQuotaValue{Key: key, Value: value})
+				}
+			}
+
+			responseBody.Entries = append(responseBody.Entries, entry)
+		}
+
+		slices.SortFunc(responseBody.Entries, func(a, b ClientQuotaEntry) int {
+			return compareEntities(a.Entity, b.Entity)
+		})
+
+		return responseBody, nil
+	}
+}
+
+func compareEntities(a, b []ClientQuotaEntityComponent) int {
+	return slices.CompareFunc(a, b, func(a, b ClientQuotaEntityComponent) int {
+		if a.EntityType != b.EntityType {
+			return strings.Compare(a.EntityType, b.EntityType)
+		}
+		return strings.Compare(a.EntityName, b.EntityName)
+	})
+}
+
+type AlterClientQuotasOp struct {
+	Key          string               `kafka:"0,compact=1"`
+	Value        float64              `kafka:"1"`
+	Remove       bool                 `kafka:"2"`
+	TaggedFields []server.TaggedField `kafka:"3,minVersion=1,compact"`
+}
+
+type AlterClientQuotasEntry struct {
+	Entity       []ClientQuotaEntityComponent `kafka:"0,compact=1"`
+	Ops          []AlterClientQuotasOp        `kafka:"1,compact=1"`
+	TaggedFields []server.TaggedField         `kafka:"2,minVersion=1,compact"`
+}
+
+type AlterClientQuotasRequest struct {
+	Entries      []AlterClientQuotasEntry `kafka:"0,compact=1"`
+	ValidateOnly bool                     `kafka:"1"`
+	TaggedFields []server.TaggedField     `kafka:"2,minVersion=1,compact"`
+}
+
+func (AlterClientQuotasRequest) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 1}
+}
+
+type AlterClientQuotasEntryResponse struct {
+	ErrorCode    server.ErrorCode             `kafka:"0"`
+	ErrorMessage string                       `kafka:"1,compact=1,nilable"`
+	Entity       []ClientQuotaEntityComponent `kafka:"2,compact=1"`
+	TaggedFields []server.TaggedField         `kafka:"3,minVersion=1,compact,nilable"`
+}
+
+type AlterClientQuotasResponse struct {
+	ThrottleTimeMs int32                            `kafka:"0"`
+	Entries        []AlterClientQuotasEntryResponse `kafka:"1,compact=1"`
+	TaggedFields   []server.TaggedField             `kafka:"2,minVersion=1,compact,nilable"`
+}
+
+func (AlterClientQuotasResponse) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 1}
+}
+
+func (r AlterClientQuotasRequest) ErrorResponse(
+	ctx context.Context,
+	_ server.ApiVersion,
+	errorCode server.ErrorCode,
+) *AlterClientQuotasResponse {
+	responseBody := &AlterClientQuotasResponse{
+		ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+	}
+
+	for _, entry := range r.Entries {
+		responseBody.Entries = append(responseBody.Entries, AlterClientQuotasEntryResponse{
+			ErrorCode:    errorCode,
+			ErrorMessage: errorCode.Message(),
+			Entity:       entry.Entity,
+		})
+	}
+
+	return responseBody
+}
+
+// validate checks every op of the entry, so an entry is applied whole or not at all.
+func (e *AlterClientQuotasEntry) validate() (quota.Entity, error) {
+	entity, err := quotaEntity(e.Entity)
+
+	if err != nil {
+		return entity, err
+	}
+
+	for _, op := range e.Ops {
+		if !slices.Contains(quota.Keys, op.Key) {
+			return entity, fmt.Errorf("%w: %s", quota.ErrUnknownKey, op.Key)
+		}
+
+		if !op.Remove && op.Value <= 0 {
+			return entity, fmt.Errorf("%w: %s=%f", quota.ErrInvalidValue, op.Key, op.Value)
+		}
+	}
+
+	return entity, nil
+}
+
+func (e *AlterClientQuotasEntry) apply(manager *quota.Manager, entity quota.Entity) error {
+	for _, op := range e.Ops {
+		var err error
+
+		if op.Remove {
+			err = manager.Remove(entity, op.Key)
+		} else {
+			err = manager.Set(entity, op.Key, op.Value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewAlterClientQuotasHandler applies the entries to manager, which keeps
+// them in memory only, they don't survive a restart of the broker.
+func NewAlterClientQuotasHandler(manager *quota.Manager) server.TypedHandlerFunc[AlterClientQuotasRequest, AlterClientQuotasResponse] {
+	return func(
+		ctx context.Context,
+		requestData *AlterClientQuotasRequest,
+		_ server.ApiVersion,
+	) (*AlterClientQuotasResponse, error) {
+		responseBody := &AlterClientQuotasResponse{
+			ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+		}
+
+		for _, entry := range requestData.Entries {
+			entryResponse := AlterClientQuotasEntryResponse{Entity: entry.Entity}
+			entity, err := entry.validate()
+
+			if err == nil && !requestData.ValidateOnly {
+				err = entry.apply(manager, entity)
+			}
+
+			if err != nil {
+				entryResponse.ErrorCode = server.ErrInvalidRequest
+				entryResponse.ErrorMessage = err.Error()
+			}
+
+			responseBody.Entries = append(responseBody.Entries, entryResponse)
+		}
+
+		return responseBody, nil
+	}
+}
@@ -0,0 +1,67 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/handlers"
+	"github.com/codecrafters-io/kafka-starter-go/app/kafkatest"
+	"github.com/codecrafters-io/kafka-starter-go/app/quota"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+func newQuotasServer(t *testing.T) (*kafkatest.Client, *quota.Manager) {
+	s := kafkatest.NewPipeServer(t)
+	manager := quota.NewManager(quota.DefaultConfig)
+
+	server.HandleFlexible(
+		s.KafkaServer, server.DescribeClientQuotas, server.ApiVersionRange{Min: 0, Max: 0}, server.ApiVersionRange{Min: 1, Max: 1},
+		handlers.NewDescribeClientQuotasHandler(manager),
+	)
+	server.HandleFlexible(
+		s.KafkaServer, server.AlterClientQuotas, server.ApiVersionRange{Min: 0, Max: 0}, server.ApiVersionRange{Min: 1, Max: 1},
+		handlers.NewAlterClientQuotasHandler(manager),
+	)
+
+	return s.Dial(), manager
+}
+
+func TestAlterAndDescribeClientQuotas(t *testing.T) {
+	for _, version := range []server.ApiVersion{0, 1} {
+		client, _ := newQuotasServer(t)
+
+		alter := kafkatest.MustCall[handlers.AlterClientQuotasResponse](t, client, server.AlterClientQuotas, version,
+			&handlers.AlterClientQuotasRequest{
+				Entries: []handlers.AlterClientQuotasEntry{
+					{
+						Entity: []handlers.ClientQuotaEntityComponent{{EntityType: quota.UserEntity, EntityName: "alice"}},
+						Ops:    []handlers.AlterClientQuotasOp{{Key: quota.ProducerByteRate, Value: 1024}},
+					},
+					{
+						Entity: []handlers.ClientQuotaEntityComponent{{EntityType: quota.UserEntity}},
+						Ops:    []handlers.AlterClientQuotasOp{{Key: "unknown_rate", Value: 1}},
+					},
+				},
+			},
+		)
+
+		if len(alter.Entries) != 2 || alter.Entries[0].ErrorCode != server.ErrNone || alter.Entries[1].ErrorCode != server.ErrInvalidRequest {
+			t.Fatalf("v%d expected the second entry to fail, result: %+v", version, alter.Entries)
+		}
+
+		describe := kafkatest.MustCall[handlers.DescribeClientQuotasResponse](t, client, server.DescribeClientQuotas, version,
+			&handlers.DescribeClientQuotasRequest{
+				Components: []handlers.DescribeClientQuotasComponent{
+					{EntityType: quota.UserEntity, MatchType: handlers.MatchTypeSpecified},
+				},
+			},
+		)
+
+		if len(describe.Entries) != 1 || describe.Entries[0].Entity[0].EntityName != "alice" {
+			t.Fatalf("v%d expected the quota of alice, result: %+v", version, describe.Entries)
+		}
+
+		if values := describe.Entries[0].Values; len(values) != 1 || values[0].Value != 1024 {
+			t.Fatalf("v%d expected: %s=1024, result: %+v", version, quota.ProducerByteRate, values)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+type DeleteRecordsPartition struct {
+	PartitionIndex int32 `kafka:"0"`
+	// Offset is the offset the records are deleted before, -1 for the high
+	// watermark.
+	Offset       int64                `kafka:"1"`
+	TaggedFields []server.TaggedField `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+type DeleteRecordsTopic struct {
+	Name         string                   `kafka:"0,compact=2"`
+	Partitions   []DeleteRecordsPartition `kafka:"1,compact=2"`
+	TaggedFields []server.TaggedField     `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+type DeleteRecordsRequest struct {
+	Topics       []DeleteRecordsTopic `kafka:"0,compact=2"`
+	TimeoutMs    int32                `kafka:"1"`
+	TaggedFields []server.TaggedField `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+func (DeleteRecordsRequest) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 2}
+}
+
+type DeleteRecordsPartitionResult struct {
+	PartitionIndex int32 `kafka:"0"`
+	// LowWatermark is the log start offset after the deletion, -1 on error.
+	LowWatermark int64                `kafka:"1"`
+	ErrorCode    server.ErrorCode     `kafka:"2"`
+	TaggedFields []server.TaggedField `kafka:"3,minVersion=2,compact,nilable"`
+}
+
+type DeleteRecordsTopicResult struct {
+	Name         string                         `kafka:"0,compact=2"`
+	Partitions   []DeleteRecordsPartitionResult `kafka:"1,compact=2"`
+	TaggedFields []server.TaggedField           `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+type DeleteRecordsResponse struct {
+	ThrottleTimeMs int32                      `kafka:"0"`
+	Topics         []DeleteRecordsTopicResult `kafka:"1,compact=2"`
+	TaggedFields   []server.TaggedField       `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+func (DeleteRecordsResponse) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 2}
+}
+
+func (r DeleteRecordsRequest) ErrorResponse(
+	ctx context.Context,
+	_ server.ApiVersion,
+	errorCode server.ErrorCode,
+) *DeleteRecordsResponse {
+	responseBody := &DeleteRecordsResponse{
+		ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+	}
+
+	for _, topic := range r.Topics {
+		result := DeleteRecordsTopicResult{Name: topic.Name}
+
+		for _, partition := range topic.Partitions {
+			result.Partitions = append(result.Partitions, DeleteRecordsPartitionResult{
+				PartitionIndex: partition.PartitionIndex,
+				LowWatermark:   -1,
+				ErrorCode:      errorCode,
+			})
+		}
+
+		responseBody.Topics = append(responseBody.Topics, result)
+	}
+
+	return responseBody
+}
+
+// NewDeleteRecordsHandler moves the log start offset of the partitions to
+// the offsets requested, deleting the segments before them. The partitions
+// have to be known to the cluster metadata and have a log on the broker, on
+// a log directory online.
+func NewDeleteRecordsHandler(
+	publisher metadata.Publisher,
+	logs *log.Manager,
+) server.TypedHandlerFunc[DeleteRecordsRequest, DeleteRecordsResponse] {
+	return func(
+		ctx context.Context,
+		requestData *DeleteRecordsRequest,
+		_ server.ApiVersion,
+	) (*DeleteRecordsResponse, error) {
+		image := publisher.Image()
+		logger := server.LoggerFromContext(ctx)
+		responseBody := &DeleteRecordsResponse{
+			ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+		}
+
+		for _, topic := range requestData.Topics {
+			result := DeleteRecordsTopicResult{Name: topic.Name}
+			metadataTopic, topicFound := image.Topic(topic.Name)
+
+			for _, partition := range topic.Partitions {
+				partitionResult := DeleteRecordsPartitionResult{
+					PartitionIndex: partition.PartitionIndex,
+					LowWatermark:   -1,
+				}
+
+				tp := log.TopicPartition{Topic: topic.Name, Partition: partition.PartitionIndex}
+				l, logFound := logs.Log(tp)
+
+				switch {
+				case !topicFound || metadataTopic.Partitions[partition.PartitionIndex] == nil:
+					partitionResult.ErrorCode = server.ErrUnknownTopicOrPartition
+				case !logFound && logs.Offline(tp):
+					partitionResult.ErrorCode = server.ErrKafkaStorageError
+				case !logFound:
+					partitionResult.ErrorCode = server.ErrNotLeaderOrFollower
+				default:
+					lowWatermark, err := l.DeleteRecordsBefore(partition.Offset)
+
+					switch {
+					case errors.Is(err, log.ErrOffsetOutOfRange):
+						partitionResult.ErrorCode = server.ErrOffsetOutOfRange
+					case err != nil:
+						logger.Error("couldn't delete records", "partition", tp, "error", err)
+						partitionResult.ErrorCode = server.ErrKafkaStorageError
+					default:
+						partitionResult.LowWatermark = lowWatermark
+					}
+				}
+
+				result.Partitions = append(result.Partitions, partitionResult)
+			}
+
+			responseBody.Topics = append(responseBody.Topics, result)
+		}
+
+		return responseBody, nil
+	}
+}
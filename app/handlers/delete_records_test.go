@@ -0,0 +1,76 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/handlers"
+	"github.com/codecrafters-io/kafka-starter-go/app/kafkatest"
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+func TestDeleteRecords(t *testing.T) {
+	logs := kafkatest.NewLogs(t, log.DefaultConfig)
+	l := kafkatest.AppendRecords(t, logs, log.TopicPartition{Topic: "foo", Partition: 0}, make([]record.Record, 5))
+
+	image := kafkatest.NewImage(kafkatest.TopicRecords("foo", metadata.Uuid{1}, 2)...)
+	s := kafkatest.NewPipeServer(t)
+
+	server.HandleFlexible(
+		s.KafkaServer, server.DeleteRecords, server.ApiVersionRange{Min: 0, Max: 1}, server.ApiVersionRange{Min: 2, Max: 2},
+		handlers.NewDeleteRecordsHandler(metadata.NewStaticPublisher(image), logs),
+	)
+
+	client := s.Dial()
+	request := &handlers.DeleteRecordsRequest{
+		Topics: []handlers.DeleteRecordsTopic{
+			{Name: "foo", Partitions: []handlers.DeleteRecordsPartition{
+				{PartitionIndex: 0, Offset: 3},
+				{PartitionIndex: 1, Offset: 3},
+				{PartitionIndex: 2, Offset: 3},
+			}},
+			{Name: "bar", Partitions: []handlers.DeleteRecordsPartition{{PartitionIndex: 0, Offset: 3}}},
+		},
+	}
+
+	expected := []handlers.DeleteRecordsPartitionResult{
+		{PartitionIndex: 0, LowWatermark: 3, ErrorCode: server.ErrNone},
+		{PartitionIndex: 1, LowWatermark: -1, ErrorCode: server.ErrNotLeaderOrFollower},
+		{PartitionIndex: 2, LowWatermark: -1, ErrorCode: server.ErrUnknownTopicOrPartition},
+	}
+
+	for _, version := range []server.ApiVersion{1, 2} {
+		response := kafkatest.MustCall[handlers.DeleteRecordsResponse](t, client, server.DeleteRecords, version, request)
+
+		if len(response.Topics) != 2 || len(response.Topics[0].Partitions) != 3 {
+			t.Fatalf("v%d, unexpected response: %+v", version, response)
+		}
+
+		for i, partition := range response.Topics[0].Partitions {
+			if partition.PartitionIndex != expected[i].PartitionIndex ||
+				partition.LowWatermark != expected[i].LowWatermark ||
+				partition.ErrorCode != expected[i].ErrorCode {
+				t.Fatalf("v%d, expected: %+v, result: %+v", version, expected[i], partition)
+			}
+		}
+
+		if bar := response.Topics[1].Partitions[0]; bar.ErrorCode != server.ErrUnknownTopicOrPartition {
+			t.Fatalf("v%d, expected: %d, result: %+v", version, server.ErrUnknownTopicOrPartition, bar)
+		}
+	}
+
+	request.Topics = []handlers.DeleteRecordsTopic{
+		{Name: "foo", Partitions: []handlers.DeleteRecordsPartition{{PartitionIndex: 0, Offset: 6}}},
+	}
+	response := kafkatest.MustCall[handlers.DeleteRecordsResponse](t, client, server.DeleteRecords, 2, request)
+
+	if partition := response.Topics[0].Partitions[0]; partition.ErrorCode != server.ErrOffsetOutOfRange {
+		t.Fatalf("expected: %d, result: %+v", server.ErrOffsetOutOfRange, partition)
+	}
+
+	if l.LogStartOffset() != 3 {
+		t.Fatalf("expected: 3, result: %d", l.LogStartOffset())
+	}
+}
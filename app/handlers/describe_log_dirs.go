@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"syscall"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+type DescribableLogDirTopic struct {
+	Topic        string               `kafka:"0,compact=2"`
+	Partitions   []int32              `kafka:"1,compact=2"`
+	TaggedFields []server.TaggedField `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+type DescribeLogDirsRequest struct {
+	// Topics are the partitions to describe, every partition when null.
+	Topics       []DescribableLogDirTopic `kafka:"0,compact=2,nilable"`
+	TaggedFields []server.TaggedField     `kafka:"1,minVersion=2,compact,nilable"`
+}
+
+func (DescribeLogDirsRequest) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 4}
+}
+
+type DescribeLogDirsPartition struct {
+	PartitionIndex int32 `kafka:"0"`
+	PartitionSize  int64 `kafka:"1"`
+	// OffsetLag is how far a future log is behind the log it replaces.
+	OffsetLag    int64                `kafka:"2"`
+	IsFutureKey  bool                 `kafka:"3"`
+	TaggedFields []server.TaggedField `kafka:"4,minVersion=2,compact,nilable"`
+}
+
+type DescribeLogDirsTopic struct {
+	Name         string                     `kafka:"0,compact=2"`
+	Partitions   []DescribeLogDirsPartition `kafka:"1,compact=2"`
+	TaggedFields []server.TaggedField       `kafka:"2,minVersion=2,compact,nilable"`
+}
+
+type DescribeLogDirsResult struct {
+	// ErrorCode is KAFKA_STORAGE_ERROR for a directory offline.
+	ErrorCode server.ErrorCode       `kafka:"0"`
+	LogDir    string                 `kafka:"1,compact=2"`
+	Topics    []DescribeLogDirsTopic `kafka:"2,compact=2"`
+	// TotalBytes and UsableBytes are the size and the free space of the
+	// volume, -1 when it can't be read.
+	TotalBytes   int64                `kafka:"3,minVersion=4"`
+	UsableBytes  int64                `kafka:"4,minVersion=4"`
+	TaggedFields []server.TaggedField `kafka:"5,minVersion=2,compact,nilable"`
+}
+
+type DescribeLogDirsResponse struct {
+	ThrottleTimeMs int32                   `kafka:"0"`
+	ErrorCode      server.ErrorCode        `kafka:"1,minVersion=3"`
+	Results        []DescribeLogDirsResult `kafka:"2,compact=2"`
+	TaggedFields   []server.TaggedField    `kafka:"3,minVersion=2,compact,nilable"`
+}
+
+func (DescribeLogDirsResponse) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 4}
+}
+
+func (DescribeLogDirsRequest) ErrorResponse(
+	ctx context.Context,
+	_ server.ApiVersion,
+	errorCode server.ErrorCode,
+) *DescribeLogDirsResponse {
+	return &DescribeLogDirsResponse{
+		ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+		ErrorCode:      errorCode,
+	}
+}
+
+// NewDescribeLogDirsHandler describes the log directories of the broker and
+// the partition logs they hold, the future logs of the moves in progress
+// included.
+func NewDescribeLogDirsHandler(
+	logs *log.Manager,
+) server.TypedHandlerFunc[DescribeLogDirsRequest, DescribeLogDirsResponse] {
+	return func(
+		ctx context.Context,
+		requestData *DescribeLogDirsRequest,
+		_ server.ApiVersion,
+	) (*DescribeLogDirsResponse, error) {
+		responseBody := &DescribeLogDirsResponse{
+			ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+		}
+
+		requested := func(tp log.TopicPartition) bool {
+			return requestData.Topics == nil || slices.ContainsFunc(requestData.Topics, func(topic DescribableLogDirTopic) bool {
+				return topic.Topic == tp.Topic && slices.Contains(topic.Partitions, tp.Partition)
+			})
+		}
+
+		for _, dir := range logs.LogDirs() {
+			result := DescribeLogDirsResult{LogDir: dir.Path}
+			result.TotalBytes, result.UsableBytes = volumeBytes(dir.Path)
+
+			if dir.Err != nil {
+				result.ErrorCode = server.ErrKafkaStorageError
+				responseBody.Results = append(responseBody.Results, result)
+				continue
+			}
+
+			topics := make(map[string][]DescribeLogDirsPartition)
+
+			for tp, l := range dir.Logs {
+				if requested(tp) {
+					topics[tp.Topic] = append(topics[tp.Topic], DescribeLogDirsPartition{
+						PartitionIndex: tp.Partition,
+						PartitionSize:  l.Size(),
+					})
+				}
+			}
+
+			for tp, future := range dir.FutureLogs {
+				if !requested(tp) {
+					continue
+				}
+
+				partition := DescribeLogDirsPartition{
+					PartitionIndex: tp.Partition,
+					PartitionSize:  future.Size(),
+					IsFutureKey:    true,
+				}
+
+				if l, found := logs.Log(tp); found {
+					partition.OffsetLag = max(l.LogEndOffset()-future.LogEndOffset(), 0)
+				}
+
+				topics[tp.Topic] = append(topics[tp.Topic], partition)
+			}
+
+			for name, partitions := range topics {
+				slices.SortFunc(partitions, func(a, b DescribeLogDirsPartition) int {
+					return cmp.Compare(a.PartitionIndex, b.PartitionIndex)
+				})
+
+				result.Topics = append(result.Topics, DescribeLogDirsTopic{Name: name, Partitions: partitions})
+			}
+
+			slices.SortFunc(result.Topics, func(a, b DescribeLogDirsTopic) int {
+				return cmp.Compare(a.Name, b.Name)
+			})
+
+			responseBody.Results = append(responseBody.Results, result)
+		}
+
+		return responseBody, nil
+	}
+}
+
+// volumeBytes returns the size and the space available to the broker of the
+// volume of the directory at path, -1 when it can't be read.
+func volumeBytes(path string) (int64, int64) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return -1, -1
+	}
+
+	return int64(stat.Bsize) * int64(stat.Blocks), int64(stat.Bsize) * int64(stat.Bavail)
+}
@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/encoding/kafka"
+	"github.com/codecrafters-io/kafka-starter-go/app/handlers"
+	"github.com/codecrafters-io/kafka-starter-go/app/kafkatest"
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+func TestDescribeLogDirs(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	logs := kafkatest.NewLogs(t, log.DefaultConfig, dirs...)
+	var size int64
+
+	for partition := range int32(3) {
+		size = kafkatest.AppendRecords(t, logs, log.TopicPartition{Topic: "foo", Partition: partition}, make([]record.Record, 5)).Size()
+	}
+
+	// the second directory fails
+	failing, found := logs.Log(log.TopicPartition{Topic: "foo", Partition: 1})
+
+	if !found {
+		t.Fatal("expected the log of foo-1")
+	}
+
+	if err := os.RemoveAll(failing.Dir()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := failing.Roll(); err == nil {
+		t.Fatal("expected the roll to fail")
+	}
+
+	s := kafkatest.NewPipeServer(t)
+
+	server.HandleFlexible(
+		s.KafkaServer, server.DescribeLogDirs, server.ApiVersionRange{Min: 0, Max: 1}, server.ApiVersionRange{Min: 2, Max: 4},
+		handlers.NewDescribeLogDirsHandler(logs),
+	)
+
+	client := s.Dial()
+
+	for _, version := range []server.ApiVersion{1, 4} {
+		response := kafkatest.MustCall[handlers.DescribeLogDirsResponse](t, client, server.DescribeLogDirs, version, &handlers.DescribeLogDirsRequest{})
+
+		if len(response.Results) != 2 {
+			t.Fatalf("v%d, unexpected response: %+v", version, response)
+		}
+
+		online, offline := response.Results[0], response.Results[1]
+
+		if online.ErrorCode != server.ErrNone || online.LogDir != dirs[0] || len(online.Topics) != 1 || len(online.Topics[0].Partitions) != 2 {
+			t.Fatalf("v%d, unexpected result: %+v", version, online)
+		}
+
+		if partition := online.Topics[0].Partitions[1]; partition.PartitionIndex != 2 || partition.PartitionSize != size {
+			t.Fatalf("v%d, unexpected partition: %+v", version, partition)
+		}
+
+		if version >= 4 && (online.TotalBytes <= 0 || online.UsableBytes < 0 || online.UsableBytes > online.TotalBytes) {
+			t.Fatalf("v%d, unexpected volume: %d bytes, %d usable", version, online.TotalBytes, online.UsableBytes)
+		}
+
+		if offline.ErrorCode != server.ErrKafkaStorageError || len(offline.Topics) != 0 {
+			t.Fatalf("v%d, unexpected result: %+v", version, offline)
+		}
+	}
+
+	request := &handlers.DescribeLogDirsRequest{
+		Topics: []handlers.DescribableLogDirTopic{{Topic: "foo", Partitions: []int32{2}}},
+	}
+	response := kafkatest.MustCall[handlers.DescribeLogDirsResponse](t, client, server.DescribeLogDirs, 4, request)
+
+	if topics := response.Results[0].Topics; len(topics) != 1 || len(topics[0].Partitions) != 1 || topics[0].Partitions[0].PartitionIndex != 2 {
+		t.Fatalf("expected foo-2 only, result: %+v", topics)
+	}
+
+	// an empty array describes no partition, unlike null, the encoder writes
+	// it as null: the topics and the tagged fields are written by hand
+	body, err := client.RoundTrip(server.DescribeLogDirs, 4, []byte{1, 0})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	response = &handlers.DescribeLogDirsResponse{}
+
+	if err = kafka.NewDecoder(bytes.NewReader(body)).DecodeWithOpts(response, &kafka.DecoderOpts{Version: 4}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(response.Results) != 2 || len(response.Results[0].Topics) != 0 {
+		t.Fatalf("expected no partition, result: %+v", response.Results)
+	}
+}
@@ -1,38 +1,55 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"slices"
 
-	"github.com/codecrafters-io/kafka-starter-go/app/encoding/kafka"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
 	"github.com/codecrafters-io/kafka-starter-go/app/server"
 )
 
 type DescribeTopicPartitionsCursor struct {
-	Topic          string               `kafka:"0"`
+	Topic          string               `kafka:"0,compact"`
 	PartitionIndex int32                `kafka:"1"`
 	TaggedFields   []server.TaggedField `kafka:"2,compact,nilable"`
 }
 
+type DescribeTopicPartitionsRequestTopic struct {
+	Name         string               `kafka:"0,compact"`
+	TaggedFields []server.TaggedField `kafka:"1,compact"`
+}
+
 type DescribeTopicPartitionsRequest struct {
-	Topics []struct {
-		Name         string               `kafka:"0,compact"`
-		TaggedFields []server.TaggedField `kafka:"1,compact"`
-	} `kafka:"0,compact"`
-	ResponsePartionLimit int32                          `kafka:"1"`
-	Cursor               *DescribeTopicPartitionsCursor `kafka:"2,nilable"`
-	TaggedFields         []server.TaggedField           `kafka:"3,compact,nilable"`
+	// Topics are the topics to describe, every topic when empty.
+	Topics               []DescribeTopicPartitionsRequestTopic `kafka:"0,compact"`
+	ResponsePartionLimit int32                                 `kafka:"1"`
+	// Cursor is the first partition to describe, the NextCursor of the
+	// previous response.
+	Cursor       *DescribeTopicPartitionsCursor `kafka:"2,nilable"`
+	TaggedFields []server.TaggedField           `kafka:"3,compact,nilable"`
+}
+
+func (DescribeTopicPartitionsRequest) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 0}
 }
 
 type DescribeTopicPartitionsResponse struct {
 	ThrottleTimeMs int32                          `kafka:"1"`
 	Topics         []PartitionsTopicsResponseBody `kafka:"2,compact"`
-	NextCursor     *DescribeTopicPartitionsCursor `kafka:"3,nilable"`
-	TaggedFields   []server.TaggedField           `kafka:"4,compact,nilable"`
+	// NextCursor is the first partition left out by the partition limit,
+	// nil when every partition was described.
+	NextCursor   *DescribeTopicPartitionsCursor `kafka:"3,nilable"`
+	TaggedFields []server.TaggedField           `kafka:"4,compact,nilable"`
 }
 
-func NewDescribeTopicPartitionsResponse() *DescribeTopicPartitionsResponse {
+func (DescribeTopicPartitionsResponse) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 0, Max: 0}
+}
+
+func NewDescribeTopicPartitionsResponse(ctx context.Context) *DescribeTopicPartitionsResponse {
 	return &DescribeTopicPartitionsResponse{
-		ThrottleTimeMs: 0,
+		ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
 	}
 }
 
@@ -46,30 +63,199 @@ type PartitionsTopicsResponseBody struct {
 	TaggedFields         []server.TaggedField             `kafka:"6,compact,nilable"`
 }
 
-type DescribePartitionsResponseBody struct{}
+type DescribePartitionsResponseBody struct {
+	ErrorCode              server.ErrorCode     `kafka:"0"`
+	PartitionIndex         int32                `kafka:"1"`
+	LeaderId               int32                `kafka:"2"`
+	LeaderEpoch            int32                `kafka:"3"`
+	ReplicaNodes           []int32              `kafka:"4,compact"`
+	IsrNodes               []int32              `kafka:"5,compact"`
+	EligibleLeaderReplicas []int32              `kafka:"6,compact"`
+	LastKnownElr           []int32              `kafka:"7,compact"`
+	OfflineReplicas        []int32              `kafka:"8,compact"`
+	TaggedFields           []server.TaggedField `kafka:"9,compact,nilable"`
+}
+
+// internalTopics are the topics brokers keep for themselves.
+var internalTopics = []string{"__consumer_offsets", "__transaction_state"}
+
+// MaxResponsePartitionLimit caps the partitions of a response, as the
+// max.request.partition.size.limit default of brokers.
+const MaxResponsePartitionLimit = 2000
+
+// NewDescribeTopicPartitionsHandler answers with the topics of the image
+// published when the request is handled, sorted by name. The partitions are
+// described from the request cursor until the response partition limit,
+// which spans the topics, NextCursor pointing at the first partition left
+// out.
+func NewDescribeTopicPartitionsHandler(publisher metadata.Publisher) server.TypedHandlerFunc[DescribeTopicPartitionsRequest, DescribeTopicPartitionsResponse] {
+	return func(
+		ctx context.Context,
+		requestData *DescribeTopicPartitionsRequest,
+		_ server.ApiVersion,
+	) (*DescribeTopicPartitionsResponse, error) {
+		server.LoggerFromContext(ctx).Debug("describe topic partitions",
+			"topics", len(requestData.Topics),
+			"response_partition_limit", requestData.ResponsePartionLimit,
+		)
+
+		image := publisher.Image()
+		names := requestedTopicNames(image, requestData.Topics)
+		cursor := requestData.Cursor
+
+		if cursor != nil {
+			if _, found := slices.BinarySearch(names, cursor.Topic); !found && len(requestData.Topics) > 0 {
+				return nil, server.NewError(server.ErrInvalidRequest,
+					fmt.Errorf("the topics don't contain the cursor topic %s", cursor.Topic))
+			}
+		}
+
+		limit := int(requestData.ResponsePartionLimit)
+
+		if limit <= 0 || limit > MaxResponsePartitionLimit {
+			limit = MaxResponsePartitionLimit
+		}
+
+		responseBody := NewDescribeTopicPartitionsResponse(ctx)
+
+		for _, name := range names {
+			var startIndex int32
+
+			if cursor != nil {
+				if name < cursor.Topic {
+					continue
+				}
+
+				if name == cursor.Topic {
+					startIndex = cursor.PartitionIndex
+				}
+			}
+
+			topicResponse := PartitionsTopicsResponseBody{
+				ErrorCode:            server.ErrUnknownTopicOrPartition,
+				Name:                 name,
+				IsInternal:           slices.Contains(internalTopics, name),
+				AuthorizedOperations: 0b0000_1101_1111_1000,
+			}
+
+			// the topics after a full page, unknown ones included, are left for
+			// the next one
+			if limit == 0 {
+				responseBody.NextCursor = &DescribeTopicPartitionsCursor{Topic: name, PartitionIndex: startIndex}
+				break
+			}
+
+			topic, found := image.Topic(name)
+
+			if !found {
+				responseBody.Topics = append(responseBody.Topics, topicResponse)
+				continue
+			}
+
+			topicResponse.ErrorCode = server.ErrNone
+			topicResponse.Id = topic.Id
+
+			for _, partition := range topic.SortedPartitions() {
+				if partition.Index < startIndex {
+					continue
+				}
+
+				if limit == 0 {
+					responseBody.NextCursor = &DescribeTopicPartitionsCursor{Topic: name, PartitionIndex: partition.Index}
+					break
+				}
 
-func DescribeTopicPartitionsHandler(responseWriter server.ResponseWriter, request *server.Request) (err error) {
-	var requestData DescribeTopicPartitionsRequest
+				topicResponse.Partitions = append(topicResponse.Partitions, describePartition(image, partition))
+				limit--
+			}
 
-	if err = kafka.NewDecoder(request.Body).Decode(&requestData); err != nil {
-		fmt.Println(requestData)
-		return err
+			responseBody.Topics = append(responseBody.Topics, topicResponse)
+
+			if responseBody.NextCursor != nil {
+				break
+			}
+		}
+
+		return responseBody, nil
+	}
+}
+
+// requestedTopicNames returns the sorted names of the requested topics, or
+// of every topic of image when none is requested.
+func requestedTopicNames(image *metadata.Image, topics []DescribeTopicPartitionsRequestTopic) []string {
+	var names []string
+
+	if len(topics) == 0 {
+		for _, topic := range image.SortedTopics() {
+			names = append(names, topic.Name)
+		}
+
+		return names
+	}
+
+	for _, topic := range topics {
+		names = append(names, topic.Name)
+	}
+
+	slices.Sort(names)
+
+	return slices.Compact(names)
+}
+
+func describePartition(image *metadata.Image, partition *metadata.Partition) DescribePartitionsResponseBody {
+	errorCode := server.ErrNone
+
+	if partition.Leader < 0 {
+		errorCode = server.ErrLeaderNotAvailable
 	}
 
-	fmt.Printf("Topics: %s\nResponsePartionLimit: %d\n", fmt.Sprint(requestData.Topics), requestData.ResponsePartionLimit)
+	return DescribePartitionsResponseBody{
+		ErrorCode:              errorCode,
+		PartitionIndex:         partition.Index,
+		LeaderId:               partition.Leader,
+		LeaderEpoch:            partition.LeaderEpoch,
+		ReplicaNodes:           partition.Replicas,
+		IsrNodes:               partition.Isr,
+		EligibleLeaderReplicas: partition.EligibleLeaderReplicas,
+		LastKnownElr:           partition.LastKnownElr,
+		OfflineReplicas:        offlineReplicas(image, partition),
+	}
+}
 
-	responseBody := NewDescribeTopicPartitionsResponse()
+// offlineReplicas returns the replicas on brokers that aren't registered, or
+// whose log directory is lost. The registrations are only known when the
+// metadata holds some, without them every replica is considered online.
+func offlineReplicas(image *metadata.Image, partition *metadata.Partition) []int32 {
+	var offline []int32
 
-	for _, topic := range requestData.Topics {
-		topicResponse := PartitionsTopicsResponseBody{
-			ErrorCode:            server.UnknownTopic,
-			Name:                 topic.Name,
-			IsInternal:           false,
-			AuthorizedOperations: 0b0000_1101_1111_1000,
+	if len(image.Brokers) == 0 {
+		return nil
+	}
+
+	for i, replica := range partition.Replicas {
+		_, registered := image.Brokers[replica]
+
+		if !registered || (i < len(partition.Directories) && partition.Directories[i] == metadata.LostDirectory) {
+			offline = append(offline, replica)
 		}
+	}
+
+	return offline
+}
+
+func (r DescribeTopicPartitionsRequest) ErrorResponse(
+	ctx context.Context,
+	_ server.ApiVersion,
+	errorCode server.ErrorCode,
+) *DescribeTopicPartitionsResponse {
+	responseBody := NewDescribeTopicPartitionsResponse(ctx)
 
-		responseBody.Topics = append(responseBody.Topics, topicResponse)
+	for _, topic := range r.Topics {
+		responseBody.Topics = append(responseBody.Topics, PartitionsTopicsResponseBody{
+			ErrorCode: errorCode,
+			Name:      topic.Name,
+		})
 	}
 
-	return kafka.NewEncoder(responseWriter).Encode(responseBody)
+	return responseBody
 }
@@ -0,0 +1,141 @@
+package handlers_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/handlers"
+	"github.com/codecrafters-io/kafka-starter-go/app/kafkatest"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+func describeTopicPartitionsClient(t *testing.T, image *metadata.Image) *kafkatest.Client {
+	s := kafkatest.NewPipeServer(t)
+
+	server.AddTyped(
+		s.Handler(server.DescribeTopicPartitions).Version(0, 0).Opts().ResponseHeaderVersion(1).And(),
+		handlers.NewDescribeTopicPartitionsHandler(metadata.NewStaticPublisher(image)),
+	)
+
+	return s.Dial()
+}
+
+func TestDescribeTopicPartitions(t *testing.T) {
+	id := metadata.Uuid{1, 2, 3}
+	client := describeTopicPartitionsClient(t, kafkatest.NewImage(kafkatest.TopicRecords("foo", id, 2)...))
+
+	request := &handlers.DescribeTopicPartitionsRequest{
+		Topics:               []handlers.DescribeTopicPartitionsRequestTopic{{Name: "unknown"}, {Name: "foo"}},
+		ResponsePartionLimit: 100,
+	}
+
+	response := kafkatest.MustCall[handlers.DescribeTopicPartitionsResponse](t, client, server.DescribeTopicPartitions, 0, request)
+
+	if len(response.Topics) != 2 || response.NextCursor != nil {
+		t.Fatalf("expected 2 topics without cursor, result: %+v", response)
+	}
+
+	foo := response.Topics[0]
+
+	if foo.ErrorCode != server.ErrNone || foo.Id != id || len(foo.Partitions) != 2 {
+		t.Fatalf("expected the topic foo, result: %+v", foo)
+	}
+
+	if partition := foo.Partitions[1]; partition.PartitionIndex != 1 || partition.LeaderId != 1 ||
+		!slices.Equal(partition.ReplicaNodes, []int32{1}) || !slices.Equal(partition.IsrNodes, []int32{1}) {
+		t.Fatalf("unexpected partition: %+v", partition)
+	}
+
+	if unknown := response.Topics[1]; unknown.ErrorCode != server.ErrUnknownTopicOrPartition {
+		t.Fatalf("expected: %d, result: %+v", server.ErrUnknownTopicOrPartition, unknown)
+	}
+}
+
+func TestDescribeTopicPartitionsPagination(t *testing.T) {
+	records := kafkatest.TopicRecords("b", metadata.Uuid{2}, 3)
+	records = append(records, kafkatest.TopicRecords("a", metadata.Uuid{1}, 2)...)
+	records = append(records, kafkatest.TopicRecords("c", metadata.Uuid{3}, 1)...)
+	client := describeTopicPartitionsClient(t, kafkatest.NewImage(records...))
+
+	type page struct {
+		partitions []string
+		cursor     *handlers.DescribeTopicPartitionsCursor
+	}
+
+	expected := []page{
+		{[]string{"a-0", "a-1"}, &handlers.DescribeTopicPartitionsCursor{Topic: "b", PartitionIndex: 0}},
+		{[]string{"b-0", "b-1"}, &handlers.DescribeTopicPartitionsCursor{Topic: "b", PartitionIndex: 2}},
+		{[]string{"b-2", "c-0"}, nil},
+	}
+
+	request := &handlers.DescribeTopicPartitionsRequest{ResponsePartionLimit: 2}
+
+	for i, expectedPage := range expected {
+		response := kafkatest.MustCall[handlers.DescribeTopicPartitionsResponse](t, client, server.DescribeTopicPartitions, 0, request)
+		var partitions []string
+
+		for _, topic := range response.Topics {
+			for _, partition := range topic.Partitions {
+				partitions = append(partitions, topic.Name+"-"+string(rune('0'+partition.PartitionIndex)))
+			}
+		}
+
+		if !slices.Equal(expectedPage.partitions, partitions) {
+			t.Fatalf("page %d, expected: %v, result: %v", i, expectedPage.partitions, partitions)
+		}
+
+		if (expectedPage.cursor == nil) != (response.NextCursor == nil) ||
+			(expectedPage.cursor != nil && (expectedPage.cursor.Topic != response.NextCursor.Topic ||
+				expectedPage.cursor.PartitionIndex != response.NextCursor.PartitionIndex)) {
+			t.Fatalf("page %d, expected: %+v, result: %+v", i, expectedPage.cursor, response.NextCursor)
+		}
+
+		request.Cursor = response.NextCursor
+	}
+}
+
+func TestDescribeTopicPartitionsPaginationUnknownTopics(t *testing.T) {
+	records := kafkatest.TopicRecords("a", metadata.Uuid{1}, 2)
+	records = append(records, kafkatest.TopicRecords("c", metadata.Uuid{3}, 1)...)
+	client := describeTopicPartitionsClient(t, kafkatest.NewImage(records...))
+
+	request := &handlers.DescribeTopicPartitionsRequest{
+		Topics:               []handlers.DescribeTopicPartitionsRequestTopic{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+		ResponsePartionLimit: 2,
+	}
+
+	// the unknown topic b is on the second page, after the cursor
+	response := kafkatest.MustCall[handlers.DescribeTopicPartitionsResponse](t, client, server.DescribeTopicPartitions, 0, request)
+
+	if len(response.Topics) != 1 || response.Topics[0].Name != "a" || response.NextCursor == nil || response.NextCursor.Topic != "b" {
+		t.Fatalf("expected the topic a and a cursor on b, result: %+v", response)
+	}
+
+	request.Cursor = response.NextCursor
+	response = kafkatest.MustCall[handlers.DescribeTopicPartitionsResponse](t, client, server.DescribeTopicPartitions, 0, request)
+
+	if len(response.Topics) != 2 || response.NextCursor != nil {
+		t.Fatalf("expected the topics b and c without cursor, result: %+v", response)
+	}
+
+	if b, c := response.Topics[0], response.Topics[1]; b.Name != "b" || b.ErrorCode != server.ErrUnknownTopicOrPartition ||
+		c.Name != "c" || c.ErrorCode != server.ErrNone {
+		t.Fatalf("unexpected topics: %+v", response.Topics)
+	}
+}
+
+func TestDescribeTopicPartitionsCursorOutsideTopics(t *testing.T) {
+	client := describeTopicPartitionsClient(t, kafkatest.NewImage(kafkatest.TopicRecords("foo", metadata.Uuid{1}, 1)...))
+
+	request := &handlers.DescribeTopicPartitionsRequest{
+		Topics: []handlers.DescribeTopicPartitionsRequestTopic{{Name: "foo"}},
+		Cursor: &handlers.DescribeTopicPartitionsCursor{Topic: "bar"},
+	}
+
+	response := kafkatest.MustCall[handlers.DescribeTopicPartitionsResponse](t, client, server.DescribeTopicPartitions, 0, request)
+
+	if len(response.Topics) != 1 || response.Topics[0].ErrorCode != server.ErrInvalidRequest {
+		t.Fatalf("expected: %d, result: %+v", server.ErrInvalidRequest, response.Topics)
+	}
+}
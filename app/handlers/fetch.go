@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+type FetchPartition struct {
+	Partition          int32 `kafka:"0"`
+	CurrentLeaderEpoch int32 `kafka:"1,minVersion=9"`
+	FetchOffset        int64 `kafka:"2"`
+	LastFetchedEpoch   int32 `kafka:"3,minVersion=12"`
+	// LogStartOffset is the one of the follower, -1 for the consumers.
+	LogStartOffset    int64                `kafka:"4,minVersion=5"`
+	PartitionMaxBytes int32                `kafka:"5"`
+	TaggedFields      []server.TaggedField `kafka:"6,minVersion=12,compact,nilable"`
+}
+
+// FetchTopic is named up to v12, identified by its id from v13.
+type FetchTopic struct {
+	Topic        string               `kafka:"0,maxVersion=12,compact=12"`
+	TopicId      [16]byte             `kafka:"1,minVersion=13,raw"`
+	Partitions   []FetchPartition     `kafka:"2,compact=12"`
+	TaggedFields []server.TaggedField `kafka:"3,minVersion=12,compact,nilable"`
+}
+
+type ForgottenTopic struct {
+	Topic        string               `kafka:"0,maxVersion=12,compact=12"`
+	TopicId      [16]byte             `kafka:"1,minVersion=13,raw"`
+	Partitions   []int32              `kafka:"2,compact=12"`
+	TaggedFields []server.TaggedField `kafka:"3,minVersion=12,compact,nilable"`
+}
+
+type FetchRequest struct {
+	// ReplicaId is the broker id of a follower, -1 for the consumers. From
+	// v15 it is in the ReplicaState tagged field, which isn't decoded: the
+	// fetches are the consumers' ones.
+	ReplicaId int32 `kafka:"0,maxVersion=14"`
+	MaxWaitMs int32 `kafka:"1"`
+	MinBytes  int32 `kafka:"2"`
+	MaxBytes  int32 `kafka:"3"`
+	// IsolationLevel is 0 for READ_UNCOMMITTED, 1 for READ_COMMITTED.
+	IsolationLevel      int8                 `kafka:"4"`
+	SessionId           int32                `kafka:"5,minVersion=7"`
+	SessionEpoch        int32                `kafka:"6,minVersion=7"`
+	Topics              []FetchTopic         `kafka:"7,compact=12"`
+	ForgottenTopicsData []ForgottenTopic     `kafka:"8,minVersion=7,compact=12"`
+	RackId              string               `kafka:"9,minVersion=11,compact=12"`
+	TaggedFields        []server.TaggedField `kafka:"10,minVersion=12,compact,nilable"`
+}
+
+// FetchRequest starts at v4, the versions before read message sets.
+func (FetchRequest) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 4, Max: 16}
+}
+
+type FetchAbortedTransaction struct {
+	ProducerId   int64                `kafka:"0"`
+	FirstOffset  int64                `kafka:"1"`
+	TaggedFields []server.TaggedField `kafka:"2,minVersion=12,compact,nilable"`
+}
+
+type FetchPartitionData struct {
+	PartitionIndex   int32            `kafka:"0"`
+	ErrorCode        server.ErrorCode `kafka:"1"`
+	HighWatermark    int64            `kafka:"2"`
+	LastStableOffset int64            `kafka:"3"`
+	LogStartOffset   int64            `kafka:"4,minVersion=5"`
+	// AbortedTransactions is null, the transactions aren't tracked.
+	AbortedTransactions  []FetchAbortedTransaction `kafka:"5,compact=12,nilable"`
+	PreferredReadReplica int32                     `kafka:"6,minVersion=11"`
+	Records              []byte                    `kafka:"7,compact=12,nilable"`
+	TaggedFields         []server.TaggedField      `kafka:"8,minVersion=12,compact,nilable"`
+}
+
+type FetchableTopicResponse struct {
+	Topic        string               `kafka:"0,maxVersion=12,compact=12"`
+	TopicId      [16]byte             `kafka:"1,minVersion=13,raw"`
+	Partitions   []FetchPartitionData `kafka:"2,compact=12"`
+	TaggedFields []server.TaggedField `kafka:"3,minVersion=12,compact,nilable"`
+}
+
+type FetchResponse struct {
+	ThrottleTimeMs int32                    `kafka:"0"`
+	ErrorCode      server.ErrorCode         `kafka:"1,minVersion=7"`
+	SessionId      int32                    `kafka:"2,minVersion=7"`
+	Responses      []FetchableTopicResponse `kafka:"3,compact=12"`
+	TaggedFields   []server.TaggedField     `kafka:"4,minVersion=12,compact,nilable"`
+}
+
+func (FetchResponse) Versions() server.ApiVersionRange {
+	return server.ApiVersionRange{Min: 4, Max: 16}
+}
+
+func (r FetchRequest) ErrorResponse(
+	ctx context.Context,
+	_ server.ApiVersion,
+	errorCode server.ErrorCode,
+) *FetchResponse {
+	responseBody := &FetchResponse{
+		ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+		ErrorCode:      errorCode,
+	}
+
+	for _, topic := range r.Topics {
+		result := FetchableTopicResponse{Topic: topic.Topic, TopicId: topic.TopicId}
+
+		for _, partition := range topic.Partitions {
+			result.Partitions = append(result.Partitions, newFetchPartitionData(partition.Partition, errorCode))
+		}
+
+		responseBody.Responses = append(responseBody.Responses, result)
+	}
+
+	return responseBody
+}
+
+func newFetchPartitionData(partition int32, errorCode server.ErrorCode) FetchPartitionData {
+	return FetchPartitionData{
+		PartitionIndex:       partition,
+		ErrorCode:            errorCode,
+		HighWatermark:        -1,
+		LastStableOffset:     -1,
+		LogStartOffset:       -1,
+		PreferredReadReplica: -1,
+	}
+}
+
+// NewFetchHandler reads the partitions from the offsets requested, the
+// consumers up to the high watermark and the followers up to the log end.
+// The offsets moved to the remote tier are read from it by the logs. The
+// fetch sessions aren't kept: every fetch is a full one, answered without
+// session id, and the responses don't wait for MinBytes. The IsolationLevel
+// is ignored as the transactions aren't tracked: READ_COMMITTED is served
+// like READ_UNCOMMITTED, with the high watermark as LastStableOffset and no
+// aborted transactions.
+func NewFetchHandler(
+	publisher metadata.Publisher,
+	logs *log.Manager,
+) server.TypedHandlerFunc[FetchRequest, FetchResponse] {
+	return func(
+		ctx context.Context,
+		requestData *FetchRequest,
+		version server.ApiVersion,
+	) (*FetchResponse, error) {
+		image := publisher.Image()
+		logger := server.LoggerFromContext(ctx)
+		responseBody := &FetchResponse{
+			ThrottleTimeMs: server.ThrottleTimeMsFromContext(ctx),
+		}
+
+		if requestData.SessionId != 0 {
+			responseBody.ErrorCode = server.ErrFetchSessionIdNotFound
+			return responseBody, nil
+		}
+
+		isolation := log.FetchHighWatermark
+
+		if requestData.ReplicaId >= 0 && version < 15 {
+			isolation = log.FetchLogEnd
+		}
+
+		remainingBytes := int(requestData.MaxBytes)
+
+		if remainingBytes <= 0 {
+			remainingBytes = math.MaxInt32
+		}
+
+		for _, topic := range requestData.Topics {
+			result := FetchableTopicResponse{Topic: topic.Topic, TopicId: topic.TopicId}
+			metadataTopic, topicFound := image.Topic(topic.Topic)
+
+			if version >= 13 {
+				metadataTopic, topicFound = image.TopicById(metadata.Uuid(topic.TopicId))
+			}
+
+			for _, partition := range topic.Partitions {
+				partitionData := newFetchPartitionData(partition.Partition, server.ErrNone)
+
+				switch {
+				case !topicFound && version >= 13:
+					partitionData.ErrorCode = server.ErrUnknownTopicId
+				case !topicFound || metadataTopic.Partitions[partition.Partition] == nil:
+					partitionData.ErrorCode = server.ErrUnknownTopicOrPartition
+				default:
+					tp := log.TopicPartition{Topic: metadataTopic.Name, Partition: partition.Partition}
+					l, logFound := logs.Log(tp)
+
+					switch {
+					case !logFound && logs.Offline(tp):
+						partitionData.ErrorCode = server.ErrKafkaStorageError
+					case !logFound:
+						partitionData.ErrorCode = server.ErrNotLeaderOrFollower
+					case remainingBytes <= 0:
+						// the response is full, the next fetch reads it
+						partitionData.HighWatermark = l.HighWatermark()
+						partitionData.LastStableOffset = partitionData.HighWatermark
+						partitionData.LogStartOffset = l.LogStartOffset()
+					default:
+						info, err := l.Read(partition.FetchOffset, min(int(partition.PartitionMaxBytes), remainingBytes), isolation)
+
+						switch {
+						case errors.Is(err, log.ErrOffsetOutOfRange):
+							partitionData.ErrorCode = server.ErrOffsetOutOfRange
+							partitionData.HighWatermark = l.HighWatermark()
+							partitionData.LastStableOffset = partitionData.HighWatermark
+							partitionData.LogStartOffset = l.LogStartOffset()
+						case err != nil:
+							logger.Error("couldn't read log", "partition", tp, "offset", partition.FetchOffset, "error", err)
+							partitionData.ErrorCode = server.ErrKafkaStorageError
+						default:
+							partitionData.HighWatermark = info.HighWatermark
+							partitionData.LastStableOffset = info.HighWatermark
+							partitionData.LogStartOffset = info.LogStartOffset
+							partitionData.Records = info.Records
+							remainingBytes -= len(info.Records)
+						}
+					}
+				}
+
+				result.Partitions = append(result.Partitions, partitionData)
+			}
+
+			responseBody.Responses = append(responseBody.Responses, result)
+		}
+
+		return responseBody, nil
+	}
+}
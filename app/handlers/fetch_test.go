@@ -0,0 +1,278 @@
+package handlers_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/handlers"
+	"github.com/codecrafters-io/kafka-starter-go/app/kafkatest"
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+// fetchedOffsets returns the offsets of the records of the batches fetched.
+func fetchedOffsets(t testing.TB, data []byte) []int64 {
+	t.Helper()
+
+	var offsets []int64
+	reader := bytes.NewReader(data)
+
+	for {
+		batch, err := record.ReadBatch(reader)
+
+		if errors.Is(err, io.EOF) {
+			return offsets
+		}
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		for _, rec := range batch.Records {
+			offsets = append(offsets, batch.BaseOffset+int64(rec.OffsetDelta))
+		}
+	}
+}
+
+func TestFetchLocal(t *testing.T) {
+	logs := kafkatest.NewLogs(t, log.DefaultConfig)
+	records := make([]record.Record, 3)
+
+	for i := range records {
+		records[i] = record.Record{Value: bytes.Repeat([]byte{'v'}, 100)}
+	}
+
+	// 3 batches of 3 records on each partition
+	var batchBytes int32
+
+	for partition := range int32(2) {
+		l := kafkatest.AppendRecords(t, logs, log.TopicPartition{Topic: "foo", Partition: partition}, records, records, records)
+		batchBytes = int32(l.Size() / 3)
+	}
+
+	image := kafkatest.NewImage(kafkatest.TopicRecords("foo", metadata.Uuid{1}, 2)...)
+	s := kafkatest.NewPipeServer(t)
+
+	server.HandleFlexible(
+		s.KafkaServer, server.Fetch, server.ApiVersionRange{Min: 4, Max: 11}, server.ApiVersionRange{Min: 12, Max: 16},
+		handlers.NewFetchHandler(metadata.NewStaticPublisher(image), logs),
+	)
+
+	client := s.Dial()
+	partitions := func(partitionMaxBytes int32) []handlers.FetchPartition {
+		return []handlers.FetchPartition{
+			{Partition: 0, LogStartOffset: -1, PartitionMaxBytes: partitionMaxBytes},
+			{Partition: 1, LogStartOffset: -1, PartitionMaxBytes: partitionMaxBytes},
+		}
+	}
+
+	testCases := []struct {
+		maxBytes          int32
+		partitionMaxBytes int32
+		expected          [][]int64
+	}{
+		{maxBytes: 1 << 20, partitionMaxBytes: 1 << 20, expected: [][]int64{{0, 1, 2, 3, 4, 5, 6, 7, 8}, {0, 1, 2, 3, 4, 5, 6, 7, 8}}},
+		// a batch at least, whole batches only
+		{maxBytes: 1 << 20, partitionMaxBytes: batchBytes + batchBytes/2, expected: [][]int64{{0, 1, 2}, {0, 1, 2}}},
+		{maxBytes: 1 << 20, partitionMaxBytes: 1, expected: [][]int64{{0, 1, 2}, {0, 1, 2}}},
+		// the second partition is left for the next fetch
+		{maxBytes: 2 * batchBytes, partitionMaxBytes: 1 << 20, expected: [][]int64{{0, 1, 2, 3, 4, 5}, nil}},
+	}
+
+	for _, testCase := range testCases {
+		// READ_COMMITTED is served like READ_UNCOMMITTED
+		request := &handlers.FetchRequest{
+			ReplicaId:      -1,
+			MaxBytes:       testCase.maxBytes,
+			IsolationLevel: 1,
+			Topics:         []handlers.FetchTopic{{Topic: "foo", Partitions: partitions(testCase.partitionMaxBytes)}},
+		}
+		response := kafkatest.MustCall[handlers.FetchResponse](t, client, server.Fetch, 12, request)
+
+		if response.ErrorCode != server.ErrNone || len(response.Responses) != 1 || len(response.Responses[0].Partitions) != 2 {
+			t.Fatalf("max bytes %d, unexpected response: %+v", testCase.maxBytes, response)
+		}
+
+		for i, expected := range testCase.expected {
+			partition := response.Responses[0].Partitions[i]
+
+			if partition.ErrorCode != server.ErrNone || partition.HighWatermark != 9 || partition.LastStableOffset != 9 ||
+				partition.LogStartOffset != 0 || partition.AbortedTransactions != nil {
+				t.Fatalf("max bytes %d, unexpected partition: %+v", testCase.maxBytes, partition)
+			}
+
+			if offsets := fetchedOffsets(t, partition.Records); !slices.Equal(offsets, expected) {
+				t.Fatalf("max bytes %d/%d, partition %d, expected: %v, result: %v",
+					testCase.maxBytes, testCase.partitionMaxBytes, i, expected, offsets)
+			}
+		}
+	}
+}
+
+func TestFetchUncommitted(t *testing.T) {
+	logs := kafkatest.NewLogs(t, log.DefaultConfig)
+	l := kafkatest.AppendRecords(t, logs, log.TopicPartition{Topic: "foo", Partition: 0}, make([]record.Record, 3))
+
+	// the last batch isn't committed, the high watermark stays at 3
+	batch, err := record.NewBatch(0, time.Now().UnixMilli(), make([]record.Record, 2)...).Encode()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err = l.Append(batch, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fooId := metadata.Uuid{1}
+	image := kafkatest.NewImage(kafkatest.TopicRecords("foo", fooId, 1)...)
+	s := kafkatest.NewPipeServer(t)
+
+	server.HandleFlexible(
+		s.KafkaServer, server.Fetch, server.ApiVersionRange{Min: 4, Max: 11}, server.ApiVersionRange{Min: 12, Max: 16},
+		handlers.NewFetchHandler(metadata.NewStaticPublisher(image), logs),
+	)
+
+	client := s.Dial()
+
+	// the followers read up to the log end, the consumers up to the high
+	// watermark, the replica id isn't sent from v15
+	testCases := []struct {
+		version   server.ApiVersion
+		replicaId int32
+		expected  []int64
+	}{
+		{version: 11, replicaId: 1, expected: []int64{0, 1, 2, 3, 4}},
+		{version: 11, replicaId: -1, expected: []int64{0, 1, 2}},
+		{version: 16, expected: []int64{0, 1, 2}},
+	}
+
+	for _, testCase := range testCases {
+		request := &handlers.FetchRequest{
+			ReplicaId: testCase.replicaId,
+			MaxBytes:  1 << 20,
+			Topics: []handlers.FetchTopic{{Topic: "foo", TopicId: fooId, Partitions: []handlers.FetchPartition{
+				{Partition: 0, LogStartOffset: -1, PartitionMaxBytes: 1 << 20},
+			}}},
+		}
+		response := kafkatest.MustCall[handlers.FetchResponse](t, client, server.Fetch, testCase.version, request)
+		partition := response.Responses[0].Partitions[0]
+
+		if partition.ErrorCode != server.ErrNone || partition.HighWatermark != 3 {
+			t.Fatalf("v%d, replica %d, unexpected partition: %+v", testCase.version, testCase.replicaId, partition)
+		}
+
+		if offsets := fetchedOffsets(t, partition.Records); !slices.Equal(offsets, testCase.expected) {
+			t.Fatalf("v%d, replica %d, expected: %v, result: %v", testCase.version, testCase.replicaId, testCase.expected, offsets)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	config := log.DefaultConfig
+	config.SegmentBytes = 1024
+	config.FileDeleteDelay = 0
+	config.RemoteStorageEnable = true
+	config.LocalRetentionBytes = 0
+
+	logs := kafkatest.NewLogs(t, config)
+	storage, err := log.NewFileRemoteStorage(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	logs.EnableRemoteStorage(storage)
+
+	// 5 batches of 3 records on segments of 2 batches, the first 2 segments
+	// are only on the remote tier
+	records := make([]record.Record, 3)
+
+	for i := range records {
+		records[i] = record.Record{Value: bytes.Repeat([]byte{'v'}, 100)}
+	}
+
+	l := kafkatest.AppendRecords(t, logs, log.TopicPartition{Topic: "foo", Partition: 0}, records, records, records, records, records)
+	if copied := logs.CopyToRemote(); copied != 2 {
+		t.Fatalf("expected 2 segments copied, result: %d", copied)
+	}
+
+	if _, err = l.DeleteOldSegments(time.Now()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if l.NumberOfSegments() != 1 || l.LogStartOffset() != 0 {
+		t.Fatalf("unexpected log: %d segments from %d", l.NumberOfSegments(), l.LogStartOffset())
+	}
+
+	fooId := metadata.Uuid{1}
+	image := kafkatest.NewImage(kafkatest.TopicRecords("foo", fooId, 2)...)
+	s := kafkatest.NewPipeServer(t)
+
+	server.HandleFlexible(
+		s.KafkaServer, server.Fetch, server.ApiVersionRange{Min: 4, Max: 11}, server.ApiVersionRange{Min: 12, Max: 16},
+		handlers.NewFetchHandler(metadata.NewStaticPublisher(image), logs),
+	)
+
+	client := s.Dial()
+	fetch := func(offset int64, partition int32) handlers.FetchTopic {
+		return handlers.FetchTopic{Topic: "foo", TopicId: fooId, Partitions: []handlers.FetchPartition{
+			{Partition: partition, FetchOffset: offset, LogStartOffset: -1, PartitionMaxBytes: 1 << 20},
+		}}
+	}
+
+	for _, version := range []server.ApiVersion{4, 12, 13} {
+		request := &handlers.FetchRequest{
+			ReplicaId:    -1,
+			MaxBytes:     1 << 20,
+			SessionEpoch: -1,
+			Topics:       []handlers.FetchTopic{fetch(0, 0), fetch(12, 0), fetch(20, 0), fetch(0, 1), fetch(0, 5)},
+		}
+		response := kafkatest.MustCall[handlers.FetchResponse](t, client, server.Fetch, version, request)
+
+		if response.ErrorCode != server.ErrNone || response.SessionId != 0 || len(response.Responses) != 5 {
+			t.Fatalf("v%d, unexpected response: %+v", version, response)
+		}
+
+		// the first offsets are read from the remote tier, a segment at once
+		for i, expected := range [][]int64{{0, 1, 2, 3, 4, 5}, {12, 13, 14}} {
+			partition := response.Responses[i].Partitions[0]
+
+			if partition.ErrorCode != server.ErrNone || partition.HighWatermark != 15 || (version >= 5 && partition.LogStartOffset != 0) {
+				t.Fatalf("v%d, unexpected partition: %+v", version, partition)
+			}
+
+			if offsets := fetchedOffsets(t, partition.Records); !slices.Equal(offsets, expected) {
+				t.Fatalf("v%d, expected: %v, result: %v", version, expected, offsets)
+			}
+		}
+
+		for i, expected := range []server.ErrorCode{server.ErrOffsetOutOfRange, server.ErrNotLeaderOrFollower, server.ErrUnknownTopicOrPartition} {
+			if partition := response.Responses[i+2].Partitions[0]; partition.ErrorCode != expected || partition.Records != nil {
+				t.Fatalf("v%d, expected: %d, result: %+v", version, expected, partition)
+			}
+		}
+	}
+
+	request := &handlers.FetchRequest{ReplicaId: -1, MaxBytes: 1 << 20, Topics: []handlers.FetchTopic{fetch(0, 0)}}
+	request.Topics[0].TopicId = metadata.Uuid{2}
+	response := kafkatest.MustCall[handlers.FetchResponse](t, client, server.Fetch, 16, request)
+
+	if partition := response.Responses[0].Partitions[0]; partition.ErrorCode != server.ErrUnknownTopicId {
+		t.Fatalf("expected: %d, result: %+v", server.ErrUnknownTopicId, partition)
+	}
+
+	// the incremental fetches need a session, which isn't kept
+	request.SessionId = 7
+	response = kafkatest.MustCall[handlers.FetchResponse](t, client, server.Fetch, 16, request)
+
+	if response.ErrorCode != server.ErrFetchSessionIdNotFound {
+		t.Fatalf("expected: %d, result: %+v", server.ErrFetchSessionIdNotFound, response)
+	}
+}
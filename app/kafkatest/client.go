@@ -0,0 +1,197 @@
+package kafkatest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/encoding/kafka"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+// firstFlexibleVersions are the first versions of the apis sent with the
+// request header v2 and answered with the response header v1.
+var firstFlexibleVersions = map[server.ApiKey]server.ApiVersion{
+	server.Produce:                 9,
+	server.Fetch:                   12,
+	server.SaslAuthenticate:        2,
+	server.ApiVersions:             3,
+	server.DeleteRecords:           2,
+	server.AlterReplicaLogDirs:     2,
+	server.DescribeLogDirs:         2,
+	server.DescribeClientQuotas:    1,
+	server.AlterClientQuotas:       1,
+	server.DescribeTopicPartitions: 0,
+}
+
+// HeaderVersions returns the request and response header versions of the
+// api on version. ApiVersions responses always use the header v0, so the
+// clients can read them before knowing what the broker supports.
+func HeaderVersions(apiKey server.ApiKey, version server.ApiVersion) (request int, response int) {
+	first, found := firstFlexibleVersions[apiKey]
+
+	if !found || version < first {
+		return 1, 0
+	}
+
+	if apiKey == server.ApiVersions {
+		return 2, 0
+	}
+
+	return 2, 1
+}
+
+type requestHeader struct {
+	ApiKey     server.ApiKey     `kafka:"0"`
+	ApiVersion server.ApiVersion `kafka:"1"`
+}
+
+type responseHeader struct {
+	CorrelationId int32                `kafka:"0"`
+	TaggedFields  []server.TaggedField `kafka:"1,minVersion=1,compact,nilable"`
+}
+
+// Client sends one request at a time over its connection.
+type Client struct {
+	ClientId string
+	// Timeout bounds every round trip, one second by default.
+	Timeout time.Duration
+
+	conn          net.Conn
+	correlationId int32
+}
+
+func NewClient(conn net.Conn) *Client {
+	return &Client{
+		ClientId: "kafkatest",
+		Timeout:  time.Second,
+		conn:     conn,
+	}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// RoundTrip sends body as a request with the header versions of
+// HeaderVersions and returns the body of the response.
+func (c *Client) RoundTrip(apiKey server.ApiKey, version server.ApiVersion, body []byte) ([]byte, error) {
+	requestHeaderVersion, responseHeaderVersion := HeaderVersions(apiKey, version)
+	return c.RoundTripWithHeaders(apiKey, version, requestHeaderVersion, responseHeaderVersion, body)
+}
+
+// RoundTripWithHeaders is RoundTrip with explicit header versions, for
+// apis the client doesn't know or requests with unusual headers.
+func (c *Client) RoundTripWithHeaders(
+	apiKey server.ApiKey,
+	version server.ApiVersion,
+	requestHeaderVersion int,
+	responseHeaderVersion int,
+	body []byte,
+) ([]byte, error) {
+	c.correlationId++
+
+	message := new(bytes.Buffer)
+	encoder := kafka.NewEncoder(message)
+
+	if err := encoder.Encode(&requestHeader{ApiKey: apiKey, ApiVersion: version}); err != nil {
+		return nil, err
+	}
+
+	if err := encoder.EncodeWithOpts(&server.RequestHeaders{
+		CorrelationId: c.correlationId,
+		ClientId:      c.ClientId,
+	}, &kafka.EncoderOpts{Version: requestHeaderVersion}); err != nil {
+		return nil, err
+	}
+
+	message.Write(body)
+
+	if c.Timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	}
+
+	if err := binary.Write(c.conn, binary.BigEndian, int32(message.Len())); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.conn.Write(message.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var size int32
+
+	if err := binary.Read(c.conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, size)
+
+	if _, err := io.ReadFull(c.conn, response); err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(response)
+	var header responseHeader
+
+	if err := kafka.NewDecoder(reader).DecodeWithOpts(&header, &kafka.DecoderOpts{
+		Version: responseHeaderVersion,
+	}); err != nil {
+		return nil, fmt.Errorf("kafkatest: couldn't decode the response header: %w", err)
+	}
+
+	if header.CorrelationId != c.correlationId {
+		return nil, fmt.Errorf("kafkatest: expected correlation id %d, got %d", c.correlationId, header.CorrelationId)
+	}
+
+	return response[len(response)-reader.Len():], nil
+}
+
+// Call encodes request with version, sends it and decodes the answer into
+// response, failing if the response has bytes its type doesn't describe.
+func (c *Client) Call(apiKey server.ApiKey, version server.ApiVersion, request any, response any) error {
+	body := new(bytes.Buffer)
+
+	if err := kafka.NewEncoder(body).EncodeWithOpts(request, &kafka.EncoderOpts{
+		Version: int(version),
+	}); err != nil {
+		return fmt.Errorf("kafkatest: couldn't encode the request: %w", err)
+	}
+
+	responseBody, err := c.RoundTrip(apiKey, version, body.Bytes())
+
+	if err != nil {
+		return err
+	}
+
+	reader := bytes.NewReader(responseBody)
+
+	if err = kafka.NewDecoder(reader).DecodeWithOpts(response, &kafka.DecoderOpts{
+		Version: int(version),
+	}); err != nil {
+		return fmt.Errorf("kafkatest: couldn't decode the response: %w", err)
+	}
+
+	if reader.Len() > 0 {
+		return fmt.Errorf("kafkatest: %d bytes left after decoding the response", reader.Len())
+	}
+
+	return nil
+}
+
+// MustCall is Call for tests, it fails the test on error.
+func MustCall[Resp any](t testing.TB, c *Client, apiKey server.ApiKey, version server.ApiVersion, request any) *Resp {
+	t.Helper()
+
+	response := new(Resp)
+
+	if err := c.Call(apiKey, version, request, response); err != nil {
+		t.Fatalf("api with key %d v%d: %s", apiKey, version, err)
+	}
+
+	return response
+}
@@ -0,0 +1,113 @@
+package kafkatest_test
+
+import (
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/handlers"
+	"github.com/codecrafters-io/kafka-starter-go/app/kafkatest"
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+func registerApiVersions(s *kafkatest.Server) {
+	server.AddTyped(
+		s.Handler(server.ApiVersions).Version(0, 2).Opts().RequestHeaderVersion(1).And(),
+		handlers.ApiVersionsHandler,
+	)
+
+	server.Handle(s.KafkaServer, server.ApiVersions, server.ApiVersionRange{Min: 3, Max: 4}, handlers.ApiVersionsHandler)
+}
+
+func TestServers(t *testing.T) {
+	servers := map[string]func(testing.TB) *kafkatest.Server{
+		"tcp":  kafkatest.NewServer,
+		"pipe": kafkatest.NewPipeServer,
+	}
+
+	for name, newServer := range servers {
+		t.Run(name, func(t *testing.T) {
+			s := newServer(t)
+			registerApiVersions(s)
+			client := s.Dial()
+
+			for _, version := range []server.ApiVersion{0, 3, 4} {
+				response := kafkatest.MustCall[handlers.ApiVersionsResponse](
+					t, client, server.ApiVersions, version, &handlers.ApiVersionsRequest{ClientId: "kafkatest"},
+				)
+
+				if response.ErrorCode != server.ErrNone {
+					t.Fatalf("expected: %d, result: %d", server.ErrNone, response.ErrorCode)
+				}
+
+				if len(response.ApiKeys) != 1 || response.ApiKeys[0].MaxVersion != 4 {
+					t.Fatalf("expected ApiVersions up to v4, result: %v", response.ApiKeys)
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownApi(t *testing.T) {
+	s := kafkatest.NewPipeServer(t)
+	registerApiVersions(s)
+	client := s.Dial()
+
+	if _, err := client.RoundTrip(server.Fetch, 4, nil); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestHeaderVersions(t *testing.T) {
+	cases := []struct {
+		apiKey   server.ApiKey
+		version  server.ApiVersion
+		request  int
+		response int
+	}{
+		{server.ApiVersions, 2, 1, 0},
+		{server.ApiVersions, 3, 2, 0},
+		{server.DescribeTopicPartitions, 0, 2, 1},
+		{server.SaslHandshake, 1, 1, 0},
+	}
+
+	for _, c := range cases {
+		request, response := kafkatest.HeaderVersions(c.apiKey, c.version)
+
+		if request != c.request || response != c.response {
+			t.Fatalf("api with key %d v%d, expected: %d/%d, result: %d/%d",
+				c.apiKey, c.version, c.request, c.response, request, response)
+		}
+	}
+}
+
+func TestWriteClusterMetadata(t *testing.T) {
+	logDir := t.TempDir()
+	kafkatest.WriteClusterMetadata(t, logDir, kafkatest.TopicRecords("foo", metadata.Uuid{1}, 3)...)
+
+	image, err := metadata.LoadClusterMetadata(logDir)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if topic, found := image.Topic("foo"); !found || len(topic.Partitions) != 3 {
+		t.Fatalf("expected the topic foo with 3 partitions, result: %+v", topic)
+	}
+}
+
+func TestAppendRecords(t *testing.T) {
+	logs := kafkatest.NewLogs(t, log.DefaultConfig)
+	tp := log.TopicPartition{Topic: "foo", Partition: 0}
+
+	l := kafkatest.AppendRecords(t, logs, tp, make([]record.Record, 3), make([]record.Record, 2))
+
+	if l.LogEndOffset() != 5 || l.HighWatermark() != 5 {
+		t.Fatalf("expected 5 records committed, result: %d up to %d", l.HighWatermark(), l.LogEndOffset())
+	}
+
+	if found, _ := logs.Log(tp); found != l {
+		t.Fatalf("expected the log of %s on the logs", tp)
+	}
+}
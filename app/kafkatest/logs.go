@@ -0,0 +1,65 @@
+package kafkatest
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+// NewLogs opens the partition logs of the log.dirs dirs, a temporary
+// directory of the test when there is none, with config as the broker
+// defaults. They are closed when the test ends.
+func NewLogs(t testing.TB, config log.Config, dirs ...string) *log.Manager {
+	t.Helper()
+
+	if len(dirs) == 0 {
+		dirs = []string{t.TempDir()}
+	}
+
+	logs, err := log.OpenManager(dirs, config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err != nil {
+		t.Fatalf("kafkatest: couldn't open the logs: %s", err)
+	}
+
+	t.Cleanup(func() {
+		if err := logs.Close(); err != nil {
+			t.Errorf("kafkatest: couldn't close the logs: %s", err)
+		}
+	})
+
+	return logs
+}
+
+// AppendRecords appends a batch per element of batches to the log of tp,
+// created with the defaults of logs when missing, and commits them: the high
+// watermark moves to the log end. It returns the log.
+func AppendRecords(t testing.TB, logs *log.Manager, tp log.TopicPartition, batches ...[]record.Record) *log.Log {
+	t.Helper()
+
+	l, err := logs.GetOrCreate(tp, logs.Config())
+
+	if err != nil {
+		t.Fatalf("kafkatest: couldn't create the log of %s: %s", tp, err)
+	}
+
+	for _, records := range batches {
+		batch, err := record.NewBatch(0, time.Now().UnixMilli(), records...).Encode()
+
+		if err != nil {
+			t.Fatalf("kafkatest: couldn't encode a batch: %s", err)
+		}
+
+		if _, err = l.Append(batch, 0); err != nil {
+			t.Fatalf("kafkatest: couldn't append to %s: %s", tp, err)
+		}
+	}
+
+	l.UpdateHighWatermark(l.LogEndOffset())
+
+	return l
+}
@@ -0,0 +1,146 @@
+// Package kafkatest runs brokers in memory for tests, with a client that
+// speaks just enough of the protocol to send typed requests to them, and
+// helpers preloading the topics and the records they serve.
+package kafkatest
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+// Server is a broker serving the test, the handlers registered on it are
+// visible to the connections opened before and after.
+type Server struct {
+	*server.KafkaServer
+	// Addr is the address of the ephemeral listener, empty on pipe servers.
+	Addr string
+
+	t testing.TB
+}
+
+func newServer(t testing.TB) *Server {
+	ks := server.NewKafkaServer()
+	ks.SetLogger(server.NewLogger(io.Discard, server.LogText, ks.LogLevel()))
+
+	return &Server{KafkaServer: ks, t: t}
+}
+
+// NewServer starts a broker on an ephemeral port of the loopback interface,
+// it is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := newServer(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("kafkatest: couldn't listen: %s", err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	s.Addr = listener.Addr().String()
+
+	go s.ServeListener(server.DefaultListenerName, listener)
+
+	return s
+}
+
+// NewPipeServer returns a broker without listener, every Dial serves a new
+// net.Pipe, which avoids the network stack altogether.
+func NewPipeServer(t testing.TB) *Server {
+	return newServer(t)
+}
+
+// SetLogOutput sends the logs of the broker to w, like os.Stderr when a
+// test needs them.
+func (s *Server) SetLogOutput(w io.Writer, level slog.Level) {
+	s.LogLevel().Set(level)
+	s.SetLogger(server.NewLogger(w, server.LogText, s.LogLevel()))
+}
+
+// Dial opens a connection to the broker, it is closed when the test ends.
+func (s *Server) Dial() *Client {
+	s.t.Helper()
+
+	var conn net.Conn
+
+	if s.Addr == "" {
+		var serverConn net.Conn
+		conn, serverConn = net.Pipe()
+
+		go s.ServeConn(server.DefaultListenerName, serverConn)
+	} else {
+		var err error
+
+		if conn, err = net.Dial("tcp", s.Addr); err != nil {
+			s.t.Fatalf("kafkatest: couldn't dial %s: %s", s.Addr, err)
+		}
+	}
+
+	client := NewClient(conn)
+	s.t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// WriteClusterMetadata writes records as the metadata log of the
+// metadata.log.dir logDir, for metadata.LoadClusterMetadata to read.
+func WriteClusterMetadata(t testing.TB, logDir string, records ...metadata.Record) {
+	t.Helper()
+
+	dir := filepath.Join(logDir, metadata.ClusterMetadataDir)
+	batch, err := metadata.EncodeBatch(0, time.Now().UnixMilli(), records...)
+
+	if err == nil {
+		err = os.MkdirAll(dir, 0o755)
+	}
+
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "00000000000000000000.log"), batch, 0o644)
+	}
+
+	if err != nil {
+		t.Fatalf("kafkatest: couldn't write the cluster metadata: %s", err)
+	}
+}
+
+// TopicRecords returns the records creating a topic whose partitions are
+// led by broker 1, the only replica.
+func TopicRecords(name string, id metadata.Uuid, partitions int) []metadata.Record {
+	records := []metadata.Record{&metadata.TopicRecord{Name: name, TopicId: id}}
+
+	for i := range partitions {
+		records = append(records, &metadata.PartitionRecord{
+			PartitionId:      int32(i),
+			TopicId:          id,
+			Replicas:         []int32{1},
+			Isr:              []int32{1},
+			RemovingReplicas: []int32{},
+			AddingReplicas:   []int32{},
+			Leader:           1,
+			Directories:      []metadata.Uuid{},
+		})
+	}
+
+	return records
+}
+
+// NewImage returns the metadata image holding records.
+func NewImage(records ...metadata.Record) *metadata.Image {
+	image := metadata.NewImage()
+
+	for _, record := range records {
+		image.Apply(record)
+	}
+
+	return image
+}
@@ -0,0 +1,169 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The files of a log directory, next to the partition directories.
+const (
+	// RecoveryPointCheckpointFile holds the recovery point of every log.
+	RecoveryPointCheckpointFile = "recovery-point-offset-checkpoint"
+	// LogStartOffsetCheckpointFile holds the log start offset of every log,
+	// which DeleteRecords moves past the first segment.
+	LogStartOffsetCheckpointFile = "log-start-offset-checkpoint"
+	// CleanerOffsetCheckpointFile holds the offset every compacted log is
+	// compacted up to.
+	CleanerOffsetCheckpointFile = "cleaner-offset-checkpoint"
+	// CleanShutdownFile is written once every log was flushed and closed.
+	CleanShutdownFile = ".kafka_cleanshutdown"
+)
+
+const checkpointVersion = 0
+
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+func (tp TopicPartition) String() string {
+	return DirName(tp.Topic, tp.Partition)
+}
+
+// readCheckpoint reads the offsets of a checkpoint file as Kafka writes them:
+// the version, the number of entries and the entries as `topic partition
+// offset` lines. A missing file has no offsets.
+func readCheckpoint(path string) (map[TopicPartition]int64, error) {
+	offsets := make(map[TopicPartition]int64)
+	file, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return offsets, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	var lines []string
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) < 2 || lines[0] != strconv.Itoa(checkpointVersion) {
+		return nil, fmt.Errorf("log: malformed checkpoint %s", path)
+	}
+
+	if count, err := strconv.Atoi(lines[1]); err != nil || count != len(lines)-2 {
+		return nil, fmt.Errorf("log: malformed checkpoint %s, expected %s entries", path, lines[1])
+	}
+
+	for _, line := range lines[2:] {
+		fields := strings.Fields(line)
+
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("log: malformed checkpoint %s entry %q", path, line)
+		}
+
+		partition, err := strconv.ParseInt(fields[1], 10, 32)
+
+		if err != nil {
+			return nil, fmt.Errorf("log: malformed checkpoint %s entry %q", path, line)
+		}
+
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("log: malformed checkpoint %s entry %q", path, line)
+		}
+
+		offsets[TopicPartition{Topic: fields[0], Partition: int32(partition)}] = offset
+	}
+
+	return offsets, nil
+}
+
+// writeCheckpoint replaces the checkpoint file at path with offsets, going
+// through a temporary file so that a crash leaves either file whole.
+func writeCheckpoint(path string, offsets map[TopicPartition]int64) error {
+	partitions := make([]TopicPartition, 0, len(offsets))
+
+	for tp := range offsets {
+		partitions = append(partitions, tp)
+	}
+
+	slices.SortFunc(partitions, func(a, b TopicPartition) int {
+		if c := strings.Compare(a.Topic, b.Topic); c != 0 {
+			return c
+		}
+
+		return int(a.Partition - b.Partition)
+	})
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "%d\n%d\n", checkpointVersion, len(partitions))
+
+	for _, tp := range partitions {
+		fmt.Fprintf(&content, "%s %d %d\n", tp.Topic, tp.Partition, offsets[tp])
+	}
+
+	return writeFileAtomically(path, []byte(content.String()))
+}
+
+// writeFileAtomically writes data to a temporary file, synced, that is then
+// renamed to path.
+func writeFileAtomically(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes the changes of the entries of dir durable, like a rename.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return file.Sync()
+}
@@ -0,0 +1,933 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+// errSegmentsDeleted aborts the compaction of segments deleted meanwhile by
+// the retention.
+var errSegmentsDeleted = errors.New("log: the compacted segments were deleted")
+
+// CleanerStats describe the compaction of a log.
+type CleanerStats struct {
+	Partition TopicPartition
+	// FirstDirtyOffset to EndOffset are the offsets compacted, the records
+	// before FirstDirtyOffset were already.
+	FirstDirtyOffset int64
+	EndOffset        int64
+	BytesRead        int64
+	BytesWritten     int64
+	RecordsRead      int
+	RecordsDiscarded int
+	Duration         time.Duration
+}
+
+// cleaner compacts the logs with the compact cleanup policy, each of its
+// threads compacting the dirtiest log left.
+type cleaner struct {
+	manager   *Manager
+	config    Config
+	logger    *slog.Logger
+	throttler *throttler
+
+	mu sync.Mutex
+	// checkpoints are the offsets the logs are compacted up to, the first
+	// dirty offsets.
+	checkpoints map[TopicPartition]int64
+	inProgress  map[TopicPartition]bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newCleaner(m *Manager, checkpoints map[TopicPartition]int64) *cleaner {
+	return &cleaner{
+		manager:     m,
+		config:      m.config,
+		logger:      m.logger.With("component", "cleaner"),
+		throttler:   newThrottler(m.config.CleanerIoMaxBytesPerSecond),
+		checkpoints: checkpoints,
+		inProgress:  make(map[TopicPartition]bool),
+	}
+}
+
+// start runs the threads until stop.
+func (c *cleaner) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	threads := max(c.config.CleanerThreads, 1)
+
+	for range threads {
+		c.wg.Add(1)
+
+		go func() {
+			defer c.wg.Done()
+			c.run(ctx, newOffsetMap(c.config.CleanerDedupeBufferSize/int64(threads)))
+		}()
+	}
+
+	c.logger.Info("started the cleaner", "threads", c.config.CleanerThreads)
+}
+
+// stop stops the threads, waiting for the compactions in progress to abort.
+func (c *cleaner) stop() {
+	if c.cancel == nil {
+		return
+	}
+
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *cleaner) run(ctx context.Context, offsets *offsetMap) {
+	for {
+		stats, err := c.cleanDirtiest(ctx, offsets, time.Now())
+
+		if err != nil && ctx.Err() == nil {
+			c.logger.Error("couldn't compact log", "error", err)
+		}
+
+		if stats != nil && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.config.CleanerBackoff):
+		}
+	}
+}
+
+// cleanDirtiest compacts the log with the greatest share of dirty bytes,
+// over its min.cleanable.dirty.ratio. It returns nil stats when no log is.
+func (c *cleaner) cleanDirtiest(ctx context.Context, offsets *offsetMap, now time.Time) (*CleanerStats, error) {
+	tp, l, found := c.grabDirtiest(now)
+
+	if !found {
+		return nil, nil
+	}
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.inProgress, tp)
+		c.mu.Unlock()
+	}()
+
+	c.mu.Lock()
+	checkpoint := c.checkpoints[tp]
+	c.mu.Unlock()
+
+	stats, err := l.clean(ctx, cleaning{
+		offsets:   offsets,
+		throttler: c.throttler,
+		now:       now,
+	}, checkpoint)
+
+	if err != nil {
+		l.report(&err)
+		return nil, fmt.Errorf("log: compacting %s: %w", tp, err)
+	}
+
+	// the dirty records are all in open transactions
+	if stats.EndOffset == stats.FirstDirtyOffset {
+		return nil, nil
+	}
+
+	stats.Partition = tp
+	c.logger.Info("compacted log",
+		"topic", tp.Topic, "partition", tp.Partition,
+		"first_dirty_offset", stats.FirstDirtyOffset, "end_offset", stats.EndOffset,
+		"bytes_read", stats.BytesRead, "bytes_written", stats.BytesWritten,
+		"records_read", stats.RecordsRead, "records_discarded", stats.RecordsDiscarded,
+		"duration", stats.Duration,
+	)
+
+	c.mu.Lock()
+	c.checkpoints[tp] = stats.EndOffset
+	c.mu.Unlock()
+
+	if err = c.checkpoint(); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// grabDirtiest returns the dirtiest log, marked in progress.
+func (c *cleaner) grabDirtiest(now time.Time) (TopicPartition, *Log, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var dirtiest TopicPartition
+	var dirtiestLog *Log
+	var dirtiestRatio float64
+
+	for tp, l := range c.manager.Logs() {
+		config := l.Config()
+
+		if c.inProgress[tp] || !config.CleanupPolicy.Compact() {
+			continue
+		}
+
+		r := l.cleanableRange(c.checkpoints[tp], now)
+
+		if r.dirtyBytes == 0 {
+			continue
+		}
+
+		ratio := float64(r.dirtyBytes) / float64(r.cleanBytes+r.dirtyBytes)
+
+		if ratio >= config.MinCleanableDirtyRatio && ratio > dirtiestRatio {
+			dirtiest, dirtiestLog, dirtiestRatio = tp, l, ratio
+		}
+	}
+
+	if dirtiestLog == nil {
+		return dirtiest, nil, false
+	}
+
+	c.inProgress[dirtiest] = true
+
+	return dirtiest, dirtiestLog, true
+}
+
+// checkpoint writes the offsets the logs are compacted up to, in the log
+// directories of the logs.
+func (c *cleaner) checkpoint() error {
+	c.mu.Lock()
+	checkpoints := maps.Clone(c.checkpoints)
+	c.mu.Unlock()
+
+	return c.manager.writeCheckpoints(CleanerOffsetCheckpointFile, checkpoints)
+}
+
+// cleanableRange is the part of a log to compact, from the first dirty
+// offset to the first uncleanable one, which starts a segment.
+type cleanableRange struct {
+	firstDirtyOffset       int64
+	firstUncleanableOffset int64
+	// cleanBytes are the bytes of the segments before the first dirty
+	// offset, dirtyBytes the ones of the segments after.
+	cleanBytes int64
+	dirtyBytes int64
+}
+
+// cleanableRange returns the range to compact after the checkpoint: the
+// active segment, the segments holding offsets from the high watermark and
+// the ones with records newer than MinCompactionLag aren't compacted.
+func (l *Log) cleanableRange(checkpoint int64, now time.Time) cleanableRange {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	r := cleanableRange{firstDirtyOffset: checkpoint}
+
+	if checkpoint < l.logStartOffset || checkpoint > l.activeSegment().nextOffset {
+		r.firstDirtyOffset = l.logStartOffset
+	}
+
+	uncleanable := min(l.activeSegment().baseOffset, l.highWatermark)
+
+	if lag := l.config.MinCompactionLag; lag > 0 {
+		for _, s := range l.segments {
+			if s.maxTimestamp > now.Add(-lag).UnixMilli() {
+				uncleanable = min(uncleanable, s.baseOffset)
+				break
+			}
+		}
+	}
+
+	r.firstUncleanableOffset = l.segments[l.segmentIndex(uncleanable)].baseOffset
+
+	for i, s := range l.segments {
+		upperBound := s.nextOffset
+
+		if i+1 < len(l.segments) {
+			upperBound = l.segments[i+1].baseOffset
+		}
+
+		switch {
+		case upperBound <= r.firstDirtyOffset:
+			r.cleanBytes += s.size
+		case s.baseOffset < r.firstUncleanableOffset:
+			r.dirtyBytes += s.size
+		}
+	}
+
+	if r.firstDirtyOffset >= r.firstUncleanableOffset {
+		r.dirtyBytes = 0
+	}
+
+	return r
+}
+
+// cleaning holds the state of a compaction.
+type cleaning struct {
+	offsets   *offsetMap
+	throttler *throttler
+	now       time.Time
+
+	config Config
+	txns   *transactions
+	stats  *CleanerStats
+	// retainedTxnData tells for every producer whether the records of its
+	// current transaction were kept, the marker ending it is kept then.
+	retainedTxnData map[int64]bool
+}
+
+// clean compacts the log from the checkpoint: it maps the keys of the dirty
+// records to their last offset, then rewrites the segments up to the dirty
+// ones mapped with the records not superseded by a later one of the same
+// key. The tombstones and the transaction markers are kept until their
+// delete horizon, DeleteRetention after their first compaction, and the
+// records of the aborted transactions are discarded.
+func (l *Log) clean(ctx context.Context, c cleaning, checkpoint int64) (*CleanerStats, error) {
+	start := time.Now()
+	r := l.cleanableRange(checkpoint, c.now)
+
+	l.mu.RLock()
+	segments := slices.Clone(l.segments)
+	c.config = l.config
+	l.mu.RUnlock()
+
+	c.stats = &CleanerStats{FirstDirtyOffset: r.firstDirtyOffset, EndOffset: r.firstDirtyOffset}
+	c.retainedTxnData = make(map[int64]bool)
+
+	var cleanable []*segment
+
+	for _, s := range segments {
+		if s.baseOffset < r.firstUncleanableOffset {
+			cleanable = append(cleanable, s)
+		}
+	}
+
+	var err error
+
+	if c.txns, err = scanTransactions(cleanable); err != nil {
+		return nil, err
+	}
+
+	// the open transactions aren't compacted until they end
+	if firstUnstable, found := c.txns.firstUnstableOffset(); found {
+		cleanable = slices.DeleteFunc(cleanable, func(s *segment) bool {
+			return s.nextOffset > firstUnstable
+		})
+	}
+
+	if len(cleanable) == 0 || cleanable[len(cleanable)-1].nextOffset <= r.firstDirtyOffset {
+		return c.stats, nil
+	}
+
+	// the segments are cleanable up to the next one
+	endOffset := segments[len(cleanable)].baseOffset
+
+	if c.stats.EndOffset, err = c.buildOffsetMap(ctx, cleanable, r.firstDirtyOffset, endOffset); err != nil {
+		return nil, err
+	}
+
+	cleanable = slices.DeleteFunc(cleanable, func(s *segment) bool {
+		return s.baseOffset >= c.stats.EndOffset
+	})
+
+	for _, group := range groupSegments(cleanable, c.config) {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		cleaned, err := c.cleanSegments(ctx, l.dir, group)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = l.replaceSegments(group, cleaned); err != nil {
+			if cleaned != nil {
+				cleaned.delete()
+			}
+
+			return nil, err
+		}
+	}
+
+	c.stats.Duration = time.Since(start)
+
+	return c.stats, nil
+}
+
+// buildOffsetMap maps the keys of the records of the segments from
+// firstDirtyOffset, until the map is full. It returns the offset the map
+// stops at, endOffset unless it is full.
+func (c *cleaning) buildOffsetMap(ctx context.Context, segments []*segment, firstDirtyOffset int64, endOffset int64) (int64, error) {
+	c.offsets.reset()
+	errFull := errors.New("full offset map")
+
+	for _, s := range segments {
+		if s.nextOffset <= firstDirtyOffset {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		err := s.forEachBatch(func(position int64, header *record.Batch) error {
+			if header.LastOffset() < firstDirtyOffset || header.IsControl() || c.txns.aborted(header) {
+				return nil
+			}
+
+			data, err := s.readData(position, header)
+
+			if err != nil {
+				return err
+			}
+
+			c.throttler.maybeThrottle(len(data))
+			batch, err := record.DecodeBatch(data)
+
+			if err != nil {
+				return fmt.Errorf("%s at %d: %w", s.path, position, err)
+			}
+
+			if !c.offsets.fits(len(batch.Records)) {
+				if c.offsets.len() == 0 {
+					return fmt.Errorf("the dedupe buffer can't map the batch at %d, raise log.cleaner.dedupe.buffer.size", batch.BaseOffset)
+				}
+
+				endOffset = batch.BaseOffset
+				return errFull
+			}
+
+			for i := range batch.Records {
+				if key := batch.Records[i].Key; key != nil {
+					c.offsets.put(key, batch.BaseOffset+int64(batch.Records[i].OffsetDelta))
+				}
+			}
+
+			return nil
+		})
+
+		if errors.Is(err, errFull) {
+			break
+		}
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return endOffset, nil
+}
+
+// groupSegments groups the consecutive segments that fit together in a
+// segment, by size and by index entries, to be compacted into one.
+func groupSegments(segments []*segment, config Config) [][]*segment {
+	var groups [][]*segment
+
+	for len(segments) > 0 {
+		group := segments[:1]
+		size := segments[0].size
+		offsetEntries, timeEntries := len(segments[0].offsetIndex.entries), len(segments[0].timeIndex.entries)
+
+		for _, s := range segments[1:] {
+			size += s.size
+			offsetEntries += len(s.offsetIndex.entries)
+			timeEntries += len(s.timeIndex.entries)
+
+			if size > config.SegmentBytes ||
+				offsetEntries > config.SegmentIndexBytes/offsetEntrySize ||
+				timeEntries > config.SegmentIndexBytes/timeEntrySize ||
+				s.nextOffset-1-group[0].baseOffset > math.MaxInt32 {
+				break
+			}
+
+			group = segments[:len(group)+1]
+		}
+
+		groups = append(groups, group)
+		segments = segments[len(group):]
+	}
+
+	return groups
+}
+
+// cleanSegments writes the records of the group kept by the compaction to
+// a segment with CleanedFileSuffix, nil when none is.
+func (c *cleaning) cleanSegments(ctx context.Context, dir string, group []*segment) (cleaned *segment, err error) {
+	cleaned, err = openSegmentWithSuffix(dir, group[0].baseOffset, CleanedFileSuffix, c.config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			cleaned.delete()
+		}
+	}()
+
+	for _, s := range group {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		err = s.forEachBatch(func(position int64, header *record.Batch) error {
+			data, err := s.readData(position, header)
+
+			if err != nil {
+				return err
+			}
+
+			c.throttler.maybeThrottle(len(data))
+			c.stats.BytesRead += int64(len(data))
+
+			retained, retainedHeader, err := c.filterBatch(data, header)
+
+			if err != nil {
+				return fmt.Errorf("%s at %d: %w", s.path, position, err)
+			}
+
+			if retained == nil {
+				return nil
+			}
+
+			c.throttler.maybeThrottle(len(retained))
+			c.stats.BytesWritten += int64(len(retained))
+
+			return cleaned.append(retained, retainedHeader, c.config)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cleaned.size == 0 {
+		return nil, cleaned.delete()
+	}
+
+	if err = cleaned.onRoll(); err != nil {
+		return nil, err
+	}
+
+	if err = cleaned.flush(); err != nil {
+		return nil, err
+	}
+
+	return cleaned, nil
+}
+
+// filterBatch returns the batch at data without the records the compaction
+// discards, as is when it keeps them all, or nil when it keeps none.
+func (c *cleaning) filterBatch(data []byte, header *record.Batch) ([]byte, *record.Batch, error) {
+	if !header.IsControl() && c.txns.aborted(header) {
+		c.stats.RecordsRead += int(header.LastOffsetDelta) + 1
+		c.stats.RecordsDiscarded += int(header.LastOffsetDelta) + 1
+		return nil, nil, nil
+	}
+
+	batch, err := record.DecodeBatch(data)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.stats.RecordsRead += len(batch.Records)
+	horizon, hasHorizon := batch.DeleteHorizon()
+	expired := hasHorizon && c.now.UnixMilli() >= horizon
+
+	if batch.IsControl() {
+		if !batch.IsTransactional() {
+			return data, batch, nil
+		}
+
+		// the marker is kept while records of its transaction are, then
+		// until its delete horizon
+		retainedData := c.retainedTxnData[batch.ProducerId]
+		delete(c.retainedTxnData, batch.ProducerId)
+
+		switch {
+		case retainedData:
+			return data, batch, nil
+		case expired:
+			c.stats.RecordsDiscarded += len(batch.Records)
+			return nil, nil, nil
+		case hasHorizon:
+			return data, batch, nil
+		}
+
+		return c.withDeleteHorizon(batch, batch.Records)
+	}
+
+	var retained []record.Record
+	var tombstones bool
+
+	for _, rec := range batch.Records {
+		offset := batch.BaseOffset + int64(rec.OffsetDelta)
+
+		if rec.Key != nil {
+			if latest, found := c.offsets.get(rec.Key); found && offset < latest {
+				continue
+			}
+
+			if rec.Value == nil {
+				if expired {
+					continue
+				}
+
+				tombstones = true
+			}
+		}
+
+		retained = append(retained, rec)
+	}
+
+	c.stats.RecordsDiscarded += len(batch.Records) - len(retained)
+
+	if len(retained) == 0 {
+		return nil, nil, nil
+	}
+
+	if batch.IsTransactional() {
+		c.retainedTxnData[batch.ProducerId] = true
+	}
+
+	if tombstones && !hasHorizon {
+		return c.withDeleteHorizon(batch, retained)
+	}
+
+	if len(retained) == len(batch.Records) {
+		return data, batch, nil
+	}
+
+	filtered := *batch
+	filtered.Records = retained
+	encoded, err := filtered.Encode()
+
+	return encoded, &filtered, err
+}
+
+// withDeleteHorizon returns the batch holding records, with its delete
+// horizon set to DeleteRetention from now. The horizon replaces the base
+// timestamp, the timestamp deltas of the records are shifted to keep their
+// timestamps.
+func (c *cleaning) withDeleteHorizon(batch *record.Batch, records []record.Record) ([]byte, *record.Batch, error) {
+	horizon := c.now.Add(c.config.DeleteRetention).UnixMilli()
+	shift := horizon - batch.BaseTimestamp
+
+	filtered := *batch
+	filtered.Records = slices.Clone(records)
+	filtered.Attributes |= record.DeleteHorizonFlag
+	filtered.BaseTimestamp = horizon
+
+	for i := range filtered.Records {
+		filtered.Records[i].TimestampDelta -= shift
+	}
+
+	encoded, err := filtered.Encode()
+
+	return encoded, &filtered, err
+}
+
+// replaceSegments swaps the group for the segment cleaned from it, through
+// SwapFileSuffix so that a crash leaves either the group or the cleaned
+// segment, see completeSwaps. It fails when the retention deleted the group
+// meanwhile.
+func (l *Log) replaceSegments(group []*segment, cleaned *segment) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i := slices.Index(l.segments, group[0])
+
+	if i < 0 || i+len(group) > len(l.segments) || !slices.Equal(l.segments[i:i+len(group)], group) {
+		return errSegmentsDeleted
+	}
+
+	var replacement []*segment
+
+	if cleaned != nil {
+		if err := cleaned.changeSuffix(CleanedFileSuffix, SwapFileSuffix); err != nil {
+			return err
+		}
+
+		replacement = append(replacement, cleaned)
+	}
+
+	for _, s := range group {
+		if err := s.markDeleted(); err != nil {
+			return err
+		}
+
+		l.scheduleDelete(s, l.config.FileDeleteDelay)
+	}
+
+	if cleaned != nil {
+		if err := cleaned.changeSuffix(SwapFileSuffix, ""); err != nil {
+			return err
+		}
+	}
+
+	l.segments = slices.Concat(l.segments[:i], replacement, l.segments[i+len(group):])
+
+	return nil
+}
+
+// completeSwaps finishes the swaps interrupted by a crash: the segments a
+// swapped segment was cleaned from are removed, then it replaces them.
+func completeSwaps(dir string, config Config) error {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), LogFileSuffix+SwapFileSuffix)
+
+		if !found {
+			continue
+		}
+
+		baseOffset, err := strconv.ParseInt(name, 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		swapped, err := openSegmentWithSuffix(dir, baseOffset, SwapFileSuffix, config)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = swapped.recover(config); err != nil {
+			swapped.close()
+			return err
+		}
+
+		offsets, err := segmentOffsets(dir)
+
+		if err != nil {
+			swapped.close()
+			return err
+		}
+
+		for _, offset := range offsets {
+			if offset < baseOffset || offset >= swapped.nextOffset {
+				continue
+			}
+
+			for _, suffix := range []string{LogFileSuffix, IndexFileSuffix, TimeIndexFileSuffix} {
+				if err = os.Remove(filepath.Join(dir, filenamePrefix(offset)+suffix)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					swapped.close()
+					return err
+				}
+			}
+		}
+
+		if err = swapped.changeSuffix(SwapFileSuffix, ""); err != nil {
+			swapped.close()
+			return err
+		}
+
+		if err = swapped.close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// offsetRange are the offsets from first to last.
+type offsetRange struct {
+	first int64
+	last  int64
+}
+
+// transactions are the transactions of the part of a log to compact.
+type transactions struct {
+	// abortedRanges are the offsets of the aborted transactions by producer.
+	abortedRanges map[int64][]offsetRange
+	// open are the first offsets of the transactions not ended yet.
+	open map[int64]int64
+}
+
+// scanTransactions reads the transactions of the segments from the headers
+// of their batches and their markers.
+func scanTransactions(segments []*segment) (*transactions, error) {
+	txns := &transactions{abortedRanges: make(map[int64][]offsetRange), open: make(map[int64]int64)}
+
+	for _, s := range segments {
+		err := s.forEachBatch(func(position int64, header *record.Batch) error {
+			if !header.IsTransactional() {
+				return nil
+			}
+
+			if !header.IsControl() {
+				if _, found := txns.open[header.ProducerId]; !found {
+					txns.open[header.ProducerId] = header.BaseOffset
+				}
+
+				return nil
+			}
+
+			data, err := s.readData(position, header)
+
+			if err != nil {
+				return err
+			}
+
+			batch, err := record.DecodeBatch(data)
+
+			if err != nil || len(batch.Records) == 0 {
+				return fmt.Errorf("%s at %d: invalid marker: %w", s.path, position, err)
+			}
+
+			controlType, err := batch.Records[0].ControlType()
+
+			if err != nil {
+				return err
+			}
+
+			if first, found := txns.open[header.ProducerId]; found && controlType == record.ControlAbort {
+				txns.abortedRanges[header.ProducerId] = append(txns.abortedRanges[header.ProducerId], offsetRange{first, header.BaseOffset})
+			}
+
+			delete(txns.open, header.ProducerId)
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return txns, nil
+}
+
+// aborted tells whether the batch belongs to an aborted transaction.
+func (t *transactions) aborted(header *record.Batch) bool {
+	if !header.IsTransactional() {
+		return false
+	}
+
+	for _, r := range t.abortedRanges[header.ProducerId] {
+		if header.BaseOffset >= r.first && header.BaseOffset <= r.last {
+			return true
+		}
+	}
+
+	return false
+}
+
+// firstUnstableOffset is the first offset of the transactions not ended.
+func (t *transactions) firstUnstableOffset() (int64, bool) {
+	if len(t.open) == 0 {
+		return 0, false
+	}
+
+	first := int64(math.MaxInt64)
+
+	for _, offset := range t.open {
+		first = min(first, offset)
+	}
+
+	return first, true
+}
+
+// offsetMapEntrySize is the memory taken by a key of the offset map, as
+// counted by Kafka: the hash of the key and its offset.
+const offsetMapEntrySize = 24
+
+// offsetMap maps the keys of the dirty records to their last offset. It
+// holds as many keys as its share of the dedupe buffer does, at a load
+// factor of 0.9 like Kafka's.
+type offsetMap struct {
+	offsets  map[string]int64
+	capacity int
+}
+
+func newOffsetMap(bufferSize int64) *offsetMap {
+	return &offsetMap{
+		offsets:  make(map[string]int64),
+		capacity: int(float64(bufferSize) / offsetMapEntrySize * 0.9),
+	}
+}
+
+func (m *offsetMap) reset() {
+	clear(m.offsets)
+}
+
+func (m *offsetMap) len() int {
+	return len(m.offsets)
+}
+
+// fits tells whether n more keys fit.
+func (m *offsetMap) fits(n int) bool {
+	return len(m.offsets)+n <= m.capacity
+}
+
+func (m *offsetMap) put(key []byte, offset int64) {
+	m.offsets[string(key)] = offset
+}
+
+func (m *offsetMap) get(key []byte) (int64, bool) {
+	offset, found := m.offsets[string(key)]
+	return offset, found
+}
+
+// throttlerCheckInterval is how often the throttler measures the rate.
+const throttlerCheckInterval = 300 * time.Millisecond
+
+// throttler caps the rate of the IO shared by the cleaner threads by making
+// them sleep once they went over.
+type throttler struct {
+	bytesPerSecond float64
+
+	mu          sync.Mutex
+	periodStart time.Time
+	observed    float64
+}
+
+func newThrottler(bytesPerSecond float64) *throttler {
+	return &throttler{bytesPerSecond: bytesPerSecond, periodStart: time.Now()}
+}
+
+// maybeThrottle accounts for n bytes of IO, sleeping when the rate since
+// the start of the period is over the cap.
+func (t *throttler) maybeThrottle(n int) {
+	if t == nil || t.bytesPerSecond <= 0 || t.bytesPerSecond == math.MaxFloat64 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.observed += float64(n)
+	elapsed := time.Since(t.periodStart)
+
+	if elapsed < throttlerCheckInterval {
+		return
+	}
+
+	if t.observed/elapsed.Seconds() > t.bytesPerSecond {
+		time.Sleep(time.Duration(t.observed/t.bytesPerSecond*float64(time.Second)) - elapsed)
+	}
+
+	t.periodStart, t.observed = time.Now(), 0
+}
@@ -0,0 +1,309 @@
+package log_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+func compactConfig() log.Config {
+	config := retentionConfig()
+	config.CleanupPolicy = log.CleanupCompact
+	config.DeleteRetention = time.Hour
+	config.MinCleanableDirtyRatio = 0
+
+	return config
+}
+
+// keyValue is a record of key, a tombstone when value is empty.
+func keyValue(key string, value string) record.Record {
+	rec := record.Record{Key: []byte(key)}
+
+	if value != "" {
+		rec.Value = []byte(value)
+	}
+
+	return rec
+}
+
+// appendRecords appends a batch of records and commits it, the batch is
+// transactional when producerId isn't record.NoProducerId.
+func appendRecords(t testing.TB, l *log.Log, producerId int64, records ...record.Record) {
+	t.Helper()
+
+	batch := record.NewBatch(0, now(), records...)
+
+	if producerId != record.NoProducerId {
+		batch.Attributes |= record.TransactionalFlag
+		batch.ProducerId, batch.ProducerEpoch = producerId, 0
+	}
+
+	data, err := batch.Encode()
+
+	if err == nil {
+		_, err = l.Append(data, 0)
+	}
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	commit(l)
+}
+
+func appendMarker(t testing.TB, l *log.Log, producerId int64, controlType int16) {
+	t.Helper()
+
+	data, _ := record.NewEndTxnMarker(0, now(), producerId, 0, controlType, 0).Encode()
+
+	if _, err := l.Append(data, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	commit(l)
+}
+
+// readRecords returns the records of the log as key=value, markers as
+// abort or commit.
+func readRecords(t testing.TB, l *log.Log) []string {
+	t.Helper()
+
+	var records []string
+
+	for offset := l.LogStartOffset(); offset < l.LogEndOffset(); {
+		info, err := l.Read(offset, 1<<20, log.FetchLogEnd)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if len(info.Records) == 0 {
+			break
+		}
+
+		for data := info.Records; len(data) > 0; {
+			batch, err := record.ReadBatch(bytes.NewReader(data))
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			data, offset = data[batch.Size():], batch.NextOffset()
+
+			for _, rec := range batch.Records {
+				switch controlType, _ := rec.ControlType(); {
+				case batch.IsControl() && controlType == record.ControlAbort:
+					records = append(records, "abort")
+				case batch.IsControl():
+					records = append(records, "commit")
+				default:
+					records = append(records, fmt.Sprintf("%s=%s", rec.Key, rec.Value))
+				}
+			}
+		}
+	}
+
+	return records
+}
+
+func openCompactedLog(t testing.TB, config log.Config) (*log.Manager, *log.Log) {
+	t.Helper()
+
+	m, _ := openManager(t, t.TempDir(), config)
+	t.Cleanup(func() { m.Close() })
+
+	l, err := m.GetOrCreate(foo0, config)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return m, l
+}
+
+func compact(t testing.TB, m *log.Manager, now time.Time) *log.CleanerStats {
+	t.Helper()
+
+	stats, err := m.Compact(now)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return stats
+}
+
+func TestCompact(t *testing.T) {
+	m, l := openCompactedLog(t, compactConfig())
+
+	for round := range 10 {
+		appendRecords(t, l, record.NoProducerId,
+			keyValue("a", fmt.Sprint("a", round)),
+			keyValue("b", fmt.Sprint("b", round)),
+			keyValue("c", fmt.Sprint("c", round)),
+		)
+	}
+
+	appendRecords(t, l, record.NoProducerId, keyValue("b", ""))
+	l.Roll()
+
+	stats := compact(t, m, time.Now())
+
+	if stats == nil || stats.RecordsDiscarded != 28 || stats.EndOffset != 31 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// the tombstone is kept until its delete horizon
+	if records := readRecords(t, l); !slices.Equal(records, []string{"a=a9", "c=c9", "b="}) {
+		t.Fatalf("unexpected records: %v", records)
+	}
+
+	if l.NumberOfSegments() != 2 || l.LogEndOffset() != 31 {
+		t.Fatalf("expected the compacted segments merged, result: %d segments", l.NumberOfSegments())
+	}
+
+	if stats = compact(t, m, time.Now()); stats != nil {
+		t.Fatalf("expected the log to be clean, result: %+v", stats)
+	}
+
+	appendRecords(t, l, record.NoProducerId, keyValue("a", "a10"))
+	l.Roll()
+
+	compact(t, m, time.Now().Add(2*time.Hour))
+
+	if records := readRecords(t, l); !slices.Equal(records, []string{"c=c9", "a=a10"}) {
+		t.Fatalf("unexpected records after the delete horizon: %v", records)
+	}
+
+	if info, _ := l.Read(0, 1<<20, log.FetchLogEnd); len(info.Records) == 0 {
+		t.Fatal("expected the records to be read from the log start")
+	}
+}
+
+func TestCompactTransactions(t *testing.T) {
+	m, l := openCompactedLog(t, compactConfig())
+
+	appendRecords(t, l, 7, keyValue("a", "aborted"))
+	appendRecords(t, l, 8, keyValue("b", "committed"))
+	appendMarker(t, l, 7, record.ControlAbort)
+	appendMarker(t, l, 8, record.ControlCommit)
+	appendRecords(t, l, record.NoProducerId, keyValue("c", "c"))
+	l.Roll()
+	// the transaction of 9 is open, it isn't compacted
+	appendRecords(t, l, 9, keyValue("d", "open"))
+	l.Roll()
+	appendRecords(t, l, record.NoProducerId, keyValue("c", "c2"))
+	l.Roll()
+
+	stats := compact(t, m, time.Now())
+
+	if stats == nil || stats.EndOffset != 5 {
+		t.Fatalf("expected the log compacted up to the open transaction, result: %+v", stats)
+	}
+
+	expected := []string{"b=committed", "abort", "commit", "c=c", "d=open", "c=c2"}
+
+	if records := readRecords(t, l); !slices.Equal(records, expected) {
+		t.Fatalf("expected: %v, result: %v", expected, records)
+	}
+
+	appendMarker(t, l, 9, record.ControlCommit)
+	l.Roll()
+
+	compact(t, m, time.Now().Add(2*time.Hour))
+
+	// the markers go once their transaction records did and past the horizon
+	expected = []string{"b=committed", "commit", "d=open", "c=c2", "commit"}
+
+	if records := readRecords(t, l); !slices.Equal(records, expected) {
+		t.Fatalf("expected: %v, result: %v", expected, records)
+	}
+}
+
+func TestCompactDirtyRatioAndLag(t *testing.T) {
+	config := compactConfig()
+	config.MinCleanableDirtyRatio = 0.9
+	config.MinCompactionLag = time.Hour
+	m, l := openCompactedLog(t, config)
+
+	for range 3 {
+		appendRecords(t, l, record.NoProducerId, keyValue("a", "a"), keyValue("b", "b"))
+	}
+
+	l.Roll()
+
+	if stats := compact(t, m, time.Now()); stats != nil {
+		t.Fatalf("expected the records newer than the lag to be left, result: %+v", stats)
+	}
+
+	if stats := compact(t, m, time.Now().Add(2*time.Hour)); stats == nil {
+		t.Fatal("expected the log to be compacted")
+	}
+
+	appendRecords(t, l, record.NoProducerId, keyValue("a", "a"))
+	l.Roll()
+
+	// the new segment is less than 90% of the log
+	if stats := compact(t, m, time.Now().Add(2*time.Hour)); stats != nil {
+		t.Fatalf("expected the log to be left under the dirty ratio, result: %+v", stats)
+	}
+}
+
+func TestCompactDeletePolicy(t *testing.T) {
+	m, l := openCompactedLog(t, retentionConfig())
+
+	appendRecords(t, l, record.NoProducerId, keyValue("a", "a"), keyValue("a", "a"))
+	l.Roll()
+
+	if stats := compact(t, m, time.Now()); stats != nil {
+		t.Fatalf("expected the log not to be compacted, result: %+v", stats)
+	}
+}
+
+func TestCompleteSwap(t *testing.T) {
+	dir := t.TempDir()
+	config := segmentConfig()
+	writeLog(t, dir, config, 5)
+
+	// the cleaner crashed while swapping in the records 3 to 5 and 9 to 11
+	segments := [][]byte{}
+
+	for _, name := range []string{"00000000000000000000.log", "00000000000000000006.log"} {
+		data, _ := os.ReadFile(filepath.Join(dir, "foo-0", name))
+		segments = append(segments, data[len(data)/2:])
+	}
+
+	swap := filepath.Join(dir, "foo-0", "00000000000000000000.log"+log.SwapFileSuffix)
+	os.WriteFile(swap, slices.Concat(segments...), 0o644)
+	os.WriteFile(filepath.Join(dir, "foo-0", "00000000000000000012.log"+log.CleanedFileSuffix), []byte("partial"), 0o644)
+
+	m, _ := openManager(t, dir, config)
+	defer m.Close()
+
+	l, _ := m.Log(foo0)
+
+	if l.NumberOfSegments() != 2 || l.LogEndOffset() != 15 {
+		t.Fatalf("expected the swapped segment and the active one, result: %d segments", l.NumberOfSegments())
+	}
+
+	info, err := l.Read(0, 1<<20, log.FetchLogEnd)
+
+	if offsets := readOffsets(t, info.Records); err != nil || len(offsets) != 6 || offsets[0] != 3 || offsets[3] != 9 {
+		t.Fatalf("unexpected offsets: %v %v", offsets, err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(dir, "foo-0"))
+
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) == log.SwapFileSuffix || filepath.Ext(entry.Name()) == log.CleanedFileSuffix {
+			t.Fatalf("unexpected file %s", entry.Name())
+		}
+	}
+}
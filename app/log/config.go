@@ -0,0 +1,389 @@
+package log
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/config"
+)
+
+// CleanupPolicy is how the old segments of a log are removed, cleanup.policy,
+// it can combine both policies.
+type CleanupPolicy int8
+
+const (
+	// CleanupDelete deletes the segments breaching the retention.
+	CleanupDelete CleanupPolicy = 1 << iota
+	// CleanupCompact keeps the latest record of every key.
+	CleanupCompact
+)
+
+// ParseCleanupPolicy parses a list of policies, like "compact,delete".
+func ParseCleanupPolicy(value string) (CleanupPolicy, error) {
+	var policy CleanupPolicy
+
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case "delete":
+			policy |= CleanupDelete
+		case "compact":
+			policy |= CleanupCompact
+		case "":
+		default:
+			return 0, fmt.Errorf("unknown cleanup policy %s", name)
+		}
+	}
+
+	return policy, nil
+}
+
+func (p CleanupPolicy) Delete() bool {
+	return p&CleanupDelete != 0
+}
+
+func (p CleanupPolicy) Compact() bool {
+	return p&CleanupCompact != 0
+}
+
+// Config are the configs of a partition log, the topic configs of the same
+// name override the broker defaults.
+type Config struct {
+	// SegmentBytes is the size a segment is rolled at, segment.bytes.
+	SegmentBytes int64
+	// SegmentMs is the age a segment is rolled at, from the timestamp of its
+	// first batch, segment.ms.
+	SegmentMs time.Duration
+	// IndexIntervalBytes are the bytes appended between two entries of the
+	// offset index, index.interval.bytes.
+	IndexIntervalBytes int
+	// SegmentIndexBytes is the size of the offset index a segment is rolled
+	// at, segment.index.bytes.
+	SegmentIndexBytes int
+	// RetentionMs is the age the segments are deleted at, from their
+	// greatest timestamp, retention.ms. Negative keeps them forever.
+	RetentionMs time.Duration
+	// RetentionBytes is the size the log is kept under by deleting its
+	// oldest segments, retention.bytes. Negative keeps them all.
+	RetentionBytes int64
+	// FileDeleteDelay is how long the files of a deleted segment are kept,
+	// renamed with the .deleted suffix, for the reads in progress,
+	// file.delete.delay.ms.
+	FileDeleteDelay time.Duration
+	// RetentionCheckInterval is how often the retention is enforced, the
+	// broker property log.retention.check.interval.ms.
+	RetentionCheckInterval time.Duration
+
+	// FlushMessages is the number of messages appended that flushes the log,
+	// flush.messages.
+	FlushMessages int64
+	// FlushMs is the time since the last flush that flushes the log, checked
+	// every FlushSchedulerInterval, flush.ms.
+	FlushMs time.Duration
+	// FlushSchedulerInterval is how often the logs are checked against their
+	// flush.ms, the broker property log.flush.scheduler.interval.ms. Like
+	// Kafka, it is unset by default and the flushes are left to the OS.
+	FlushSchedulerInterval time.Duration
+	// FlushOffsetCheckpointInterval is how often the recovery points are
+	// checkpointed, log.flush.offset.checkpoint.interval.ms.
+	FlushOffsetCheckpointInterval time.Duration
+	// FlushStartOffsetCheckpointInterval is how often the log start offsets
+	// are checkpointed, log.flush.start.offset.checkpoint.interval.ms.
+	FlushStartOffsetCheckpointInterval time.Duration
+
+	// CleanupPolicy tells whether the log is deleted or compacted,
+	// cleanup.policy.
+	CleanupPolicy CleanupPolicy
+	// DeleteRetention is how long the tombstones and the transaction
+	// markers are kept once compacted, delete.retention.ms.
+	DeleteRetention time.Duration
+	// MinCleanableDirtyRatio is the share of the log not compacted yet it
+	// is compacted from, min.cleanable.dirty.ratio.
+	MinCleanableDirtyRatio float64
+	// MinCompactionLag is the age the records are compacted from,
+	// min.compaction.lag.ms.
+	MinCompactionLag time.Duration
+
+	// The cleaner compacting the logs is configured by the broker only.
+	//
+	// CleanerEnable runs the cleaner, log.cleaner.enable.
+	CleanerEnable bool
+	// CleanerThreads is the number of logs compacted at once,
+	// log.cleaner.threads.
+	CleanerThreads int
+	// CleanerIoMaxBytesPerSecond caps the bytes read and written by the
+	// cleaner threads together, log.cleaner.io.max.bytes.per.second.
+	CleanerIoMaxBytesPerSecond float64
+	// CleanerDedupeBufferSize is the memory of the offset maps of the
+	// threads, log.cleaner.dedupe.buffer.size.
+	CleanerDedupeBufferSize int64
+	// CleanerBackoff is how long a thread sleeps when there is no log to
+	// compact, log.cleaner.backoff.ms.
+	CleanerBackoff time.Duration
+
+	// RemoteStorageEnable copies the segments of the log to the remote
+	// tier, remote.storage.enable. It is ignored for the compacted logs.
+	RemoteStorageEnable bool
+	// LocalRetentionMs and LocalRetentionBytes are the retention.ms and
+	// retention.bytes of the segments kept on the log directory once copied
+	// to the remote tier, local.retention.ms and local.retention.bytes, the
+	// whole retention when -2.
+	LocalRetentionMs    time.Duration
+	LocalRetentionBytes int64
+	// RemoteLogStorageSystemEnable enables the remote tier, the broker
+	// property remote.log.storage.system.enable.
+	RemoteLogStorageSystemEnable bool
+	// RemoteLogManagerTaskInterval is how often the segments are copied to
+	// the remote tier, remote.log.manager.task.interval.ms.
+	RemoteLogManagerTaskInterval time.Duration
+}
+
+var DefaultConfig = Config{
+	SegmentBytes:       1 << 30,
+	SegmentMs:          7 * 24 * time.Hour,
+	IndexIntervalBytes: 4096,
+	SegmentIndexBytes:  10 << 20,
+
+	RetentionMs:            7 * 24 * time.Hour,
+	RetentionBytes:         -1,
+	FileDeleteDelay:        time.Minute,
+	RetentionCheckInterval: 5 * time.Minute,
+
+	FlushMessages:                      math.MaxInt64,
+	FlushMs:                            math.MaxInt64,
+	FlushSchedulerInterval:             math.MaxInt64,
+	FlushOffsetCheckpointInterval:      time.Minute,
+	FlushStartOffsetCheckpointInterval: time.Minute,
+
+	CleanupPolicy:          CleanupDelete,
+	DeleteRetention:        24 * time.Hour,
+	MinCleanableDirtyRatio: 0.5,
+
+	CleanerEnable:              true,
+	CleanerThreads:             1,
+	CleanerIoMaxBytesPerSecond: math.MaxFloat64,
+	CleanerDedupeBufferSize:    128 << 20,
+	CleanerBackoff:             15 * time.Second,
+
+	LocalRetentionMs:             -2 * time.Millisecond,
+	LocalRetentionBytes:          -2,
+	RemoteLogManagerTaskInterval: 30 * time.Second,
+}
+
+// localRetentionMs is LocalRetentionMs, RetentionMs when -2.
+func (c Config) localRetentionMs() time.Duration {
+	if c.LocalRetentionMs == -2*time.Millisecond {
+		return c.RetentionMs
+	}
+
+	return c.LocalRetentionMs
+}
+
+// localRetentionBytes is LocalRetentionBytes, RetentionBytes when -2.
+func (c Config) localRetentionBytes() int64 {
+	if c.LocalRetentionBytes == -2 {
+		return c.RetentionBytes
+	}
+
+	return c.LocalRetentionBytes
+}
+
+// configKey is a topic config, set by default by broker properties. The
+// broker only configs have no topic name.
+type configKey struct {
+	topic string
+	// broker are the broker properties by priority, with the unit of their
+	// values.
+	broker []brokerKey
+	// set parses value, scaled by unit when it is a number.
+	set func(c *Config, value string, unit int64) error
+}
+
+type brokerKey struct {
+	name string
+	unit int64
+}
+
+func intConfig(set func(c *Config, value int64)) func(*Config, string, int64) error {
+	return func(c *Config, value string, unit int64) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil {
+			return err
+		}
+
+		set(c, parsed*unit)
+		return nil
+	}
+}
+
+// msConfig parses the configs in milliseconds, the ones too long for a
+// time.Duration, like Long.MaxValue for never, are capped.
+func msConfig(set func(c *Config, value time.Duration)) func(*Config, string, int64) error {
+	return intConfig(func(c *Config, value int64) {
+		if value > math.MaxInt64/int64(time.Millisecond) {
+			set(c, math.MaxInt64)
+			return
+		}
+
+		set(c, time.Duration(value)*time.Millisecond)
+	})
+}
+
+func boolConfig(set func(c *Config, value bool)) func(*Config, string, int64) error {
+	return func(c *Config, value string, _ int64) error {
+		parsed, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return err
+		}
+
+		set(c, parsed)
+		return nil
+	}
+}
+
+func floatConfig(set func(c *Config, value float64)) func(*Config, string, int64) error {
+	return func(c *Config, value string, _ int64) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+
+		if err != nil {
+			return err
+		}
+
+		set(c, parsed)
+		return nil
+	}
+}
+
+const (
+	minutes = int64(time.Minute / time.Millisecond)
+	hours   = int64(time.Hour / time.Millisecond)
+)
+
+var configKeys = []configKey{
+	{"segment.bytes", []brokerKey{{"log.segment.bytes", 1}}, intConfig(func(c *Config, value int64) {
+		c.SegmentBytes = value
+	})},
+	{"segment.ms", []brokerKey{{"log.roll.ms", 1}, {"log.roll.hours", hours}}, msConfig(func(c *Config, value time.Duration) {
+		c.SegmentMs = value
+	})},
+	{"index.interval.bytes", []brokerKey{{"log.index.interval.bytes", 1}}, intConfig(func(c *Config, value int64) {
+		c.IndexIntervalBytes = int(value)
+	})},
+	{"segment.index.bytes", []brokerKey{{"log.index.size.max.bytes", 1}}, intConfig(func(c *Config, value int64) {
+		c.SegmentIndexBytes = int(value)
+	})},
+	{"retention.ms", []brokerKey{{"log.retention.ms", 1}, {"log.retention.minutes", minutes}, {"log.retention.hours", hours}}, msConfig(func(c *Config, value time.Duration) {
+		c.RetentionMs = value
+	})},
+	{"retention.bytes", []brokerKey{{"log.retention.bytes", 1}}, intConfig(func(c *Config, value int64) {
+		c.RetentionBytes = value
+	})},
+	{"file.delete.delay.ms", []brokerKey{{"log.segment.delete.delay.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.FileDeleteDelay = value
+	})},
+	{"", []brokerKey{{"log.retention.check.interval.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.RetentionCheckInterval = value
+	})},
+	{"flush.messages", []brokerKey{{"log.flush.interval.messages", 1}}, intConfig(func(c *Config, value int64) {
+		c.FlushMessages = value
+	})},
+	{"flush.ms", []brokerKey{{"log.flush.interval.ms", 1}, {"log.flush.scheduler.interval.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.FlushMs = value
+	})},
+	{"", []brokerKey{{"log.flush.scheduler.interval.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.FlushSchedulerInterval = value
+	})},
+	{"", []brokerKey{{"log.flush.offset.checkpoint.interval.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.FlushOffsetCheckpointInterval = value
+	})},
+	{"", []brokerKey{{"log.flush.start.offset.checkpoint.interval.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.FlushStartOffsetCheckpointInterval = value
+	})},
+	{"cleanup.policy", []brokerKey{{"log.cleanup.policy", 1}}, func(c *Config, value string, _ int64) (err error) {
+		c.CleanupPolicy, err = ParseCleanupPolicy(value)
+		return err
+	}},
+	{"delete.retention.ms", []brokerKey{{"log.cleaner.delete.retention.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.DeleteRetention = value
+	})},
+	{"min.cleanable.dirty.ratio", []brokerKey{{"log.cleaner.min.cleanable.ratio", 1}}, floatConfig(func(c *Config, value float64) {
+		c.MinCleanableDirtyRatio = value
+	})},
+	{"min.compaction.lag.ms", []brokerKey{{"log.cleaner.min.compaction.lag.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.MinCompactionLag = value
+	})},
+	{"", []brokerKey{{"log.cleaner.enable", 1}}, boolConfig(func(c *Config, value bool) {
+		c.CleanerEnable = value
+	})},
+	{"", []brokerKey{{"log.cleaner.threads", 1}}, intConfig(func(c *Config, value int64) {
+		c.CleanerThreads = int(value)
+	})},
+	{"", []brokerKey{{"log.cleaner.io.max.bytes.per.second", 1}}, floatConfig(func(c *Config, value float64) {
+		c.CleanerIoMaxBytesPerSecond = value
+	})},
+	{"", []brokerKey{{"log.cleaner.dedupe.buffer.size", 1}}, intConfig(func(c *Config, value int64) {
+		c.CleanerDedupeBufferSize = value
+	})},
+	{"", []brokerKey{{"log.cleaner.backoff.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.CleanerBackoff = value
+	})},
+	{"remote.storage.enable", nil, boolConfig(func(c *Config, value bool) {
+		c.RemoteStorageEnable = value
+	})},
+	{"local.retention.ms", []brokerKey{{"log.local.retention.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.LocalRetentionMs = value
+	})},
+	{"local.retention.bytes", []brokerKey{{"log.local.retention.bytes", 1}}, intConfig(func(c *Config, value int64) {
+		c.LocalRetentionBytes = value
+	})},
+	{"", []brokerKey{{"remote.log.storage.system.enable", 1}}, boolConfig(func(c *Config, value bool) {
+		c.RemoteLogStorageSystemEnable = value
+	})},
+	{"", []brokerKey{{"remote.log.manager.task.interval.ms", 1}}, msConfig(func(c *Config, value time.Duration) {
+		c.RemoteLogManagerTaskInterval = value
+	})},
+}
+
+// BrokerConfig returns DefaultConfig overridden by the broker properties.
+func BrokerConfig(properties config.Properties) (Config, error) {
+	c := DefaultConfig
+
+	for _, key := range configKeys {
+		for _, brokerKey := range key.broker {
+			value, found := properties[brokerKey.name]
+
+			if !found {
+				continue
+			}
+
+			if err := key.set(&c, value, brokerKey.unit); err != nil {
+				return c, fmt.Errorf("log: invalid %s: %w", brokerKey.name, err)
+			}
+
+			break
+		}
+	}
+
+	return c, nil
+}
+
+// WithTopicConfigs returns c overridden by the configs of a topic.
+func (c Config) WithTopicConfigs(configs map[string]string) (Config, error) {
+	for _, key := range configKeys {
+		value, found := configs[key.topic]
+
+		if !found || key.topic == "" {
+			continue
+		}
+
+		if err := key.set(&c, value, 1); err != nil {
+			return c, fmt.Errorf("log: invalid %s: %w", key.topic, err)
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,299 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+const (
+	offsetEntrySize = 8
+	timeEntrySize   = 12
+)
+
+// offsetEntry maps the last offset of a batch to its position on the
+// segment, the offsets of the index file are relative to the base offset.
+type offsetEntry struct {
+	offset   int64
+	position int64
+}
+
+// timeEntry maps the greatest timestamp of a segment so far to the offset
+// holding it.
+type timeEntry struct {
+	timestamp int64
+	offset    int64
+}
+
+// offsetIndex is the sparse .index of a segment, kept in memory and appended
+// to its file.
+type offsetIndex struct {
+	path       string
+	file       *os.File
+	baseOffset int64
+	entries    []offsetEntry
+	maxEntries int
+	// created is set when the file was missing.
+	created bool
+	// partialEntry is set when the file ends with a partial entry.
+	partialEntry bool
+}
+
+// openOffsetIndex reads the index at path, creating it when missing.
+func openOffsetIndex(path string, baseOffset int64, maxBytes int) (*offsetIndex, error) {
+	data, file, created, err := openIndexFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	index := &offsetIndex{
+		path:         path,
+		file:         file,
+		baseOffset:   baseOffset,
+		maxEntries:   maxBytes / offsetEntrySize,
+		created:      created,
+		partialEntry: len(data)%offsetEntrySize != 0,
+		entries:      parseOffsetEntries(data, baseOffset),
+	}
+
+	return index, nil
+}
+
+// parseOffsetEntries parses the entries of an offset index file, a partial
+// entry at the end is ignored.
+func parseOffsetEntries(data []byte, baseOffset int64) []offsetEntry {
+	var entries []offsetEntry
+
+	for entry := data; len(entry) >= offsetEntrySize; entry = entry[offsetEntrySize:] {
+		entries = append(entries, offsetEntry{
+			offset:   baseOffset + int64(binary.BigEndian.Uint32(entry)),
+			position: int64(binary.BigEndian.Uint32(entry[4:])),
+		})
+	}
+
+	return entries
+}
+
+// openIndexFile returns the content of the index at path, and the file
+// opened to append to it. It tells whether the file was created.
+func openIndexFile(path string) ([]byte, *os.File, bool, error) {
+	_, err := os.Stat(path)
+	created := errors.Is(err, fs.ErrNotExist)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		file.Close()
+		return nil, nil, false, err
+	}
+
+	return data, file, created, nil
+}
+
+func (i *offsetIndex) isFull() bool {
+	return len(i.entries) >= i.maxEntries
+}
+
+func (i *offsetIndex) last() (offsetEntry, bool) {
+	if len(i.entries) == 0 {
+		return offsetEntry{}, false
+	}
+
+	return i.entries[len(i.entries)-1], true
+}
+
+func (i *offsetIndex) append(offset int64, position int64) error {
+	if last, found := i.last(); found && offset <= last.offset {
+		return fmt.Errorf("log: offset %d indexed after %d on %s", offset, last.offset, i.path)
+	}
+
+	entry := make([]byte, offsetEntrySize)
+	binary.BigEndian.PutUint32(entry, uint32(offset-i.baseOffset))
+	binary.BigEndian.PutUint32(entry[4:], uint32(position))
+
+	if _, err := i.file.Write(entry); err != nil {
+		return err
+	}
+
+	i.entries = append(i.entries, offsetEntry{offset: offset, position: position})
+
+	return nil
+}
+
+// lookup returns the position to scan the segment from to find offset, the
+// one of the greatest entry below it.
+func (i *offsetIndex) lookup(offset int64) int64 {
+	n := sort.Search(len(i.entries), func(n int) bool {
+		return i.entries[n].offset >= offset
+	})
+
+	if n == 0 {
+		return 0
+	}
+
+	return i.entries[n-1].position
+}
+
+// sanityCheck checks that the entries grow and point inside a segment of
+// size bytes.
+func (i *offsetIndex) sanityCheck(size int64) error {
+	if i.partialEntry {
+		return fmt.Errorf("%s ends with a partial entry", i.path)
+	}
+
+	previous := offsetEntry{offset: i.baseOffset - 1, position: -1}
+
+	for _, entry := range i.entries {
+		if entry.offset <= previous.offset || entry.position <= previous.position || entry.position >= size {
+			return fmt.Errorf("%s has the invalid entry %d at %d after %d at %d",
+				i.path, entry.offset, entry.position, previous.offset, previous.position)
+		}
+
+		previous = entry
+	}
+
+	return nil
+}
+
+// reset removes every entry.
+func (i *offsetIndex) reset() error {
+	i.entries, i.partialEntry = nil, false
+	return i.file.Truncate(0)
+}
+
+func (i *offsetIndex) close() error {
+	return i.file.Close()
+}
+
+// timeIndex is the .timeindex of a segment, kept in memory and appended to
+// its file.
+type timeIndex struct {
+	path         string
+	file         *os.File
+	baseOffset   int64
+	entries      []timeEntry
+	maxEntries   int
+	created      bool
+	partialEntry bool
+}
+
+// openTimeIndex reads the time index at path, creating it when missing.
+func openTimeIndex(path string, baseOffset int64, maxBytes int) (*timeIndex, error) {
+	data, file, created, err := openIndexFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	index := &timeIndex{
+		path:         path,
+		file:         file,
+		baseOffset:   baseOffset,
+		maxEntries:   maxBytes / timeEntrySize,
+		created:      created,
+		partialEntry: len(data)%timeEntrySize != 0,
+		entries:      parseTimeEntries(data, baseOffset),
+	}
+
+	return index, nil
+}
+
+// parseTimeEntries parses the entries of a time index file, a partial entry
+// at the end is ignored.
+func parseTimeEntries(data []byte, baseOffset int64) []timeEntry {
+	var entries []timeEntry
+
+	for entry := data; len(entry) >= timeEntrySize; entry = entry[timeEntrySize:] {
+		entries = append(entries, timeEntry{
+			timestamp: int64(binary.BigEndian.Uint64(entry)),
+			offset:    baseOffset + int64(binary.BigEndian.Uint32(entry[8:])),
+		})
+	}
+
+	return entries
+}
+
+func (i *timeIndex) isFull() bool {
+	return len(i.entries) >= i.maxEntries
+}
+
+func (i *timeIndex) last() (timeEntry, bool) {
+	if len(i.entries) == 0 {
+		return timeEntry{}, false
+	}
+
+	return i.entries[len(i.entries)-1], true
+}
+
+// maybeAppend appends the entry when timestamp is greater than the last
+// one, the timestamps of the index only grow.
+func (i *timeIndex) maybeAppend(timestamp int64, offset int64) error {
+	if last, found := i.last(); found && timestamp <= last.timestamp {
+		return nil
+	}
+
+	entry := make([]byte, timeEntrySize)
+	binary.BigEndian.PutUint64(entry, uint64(timestamp))
+	binary.BigEndian.PutUint32(entry[8:], uint32(offset-i.baseOffset))
+
+	if _, err := i.file.Write(entry); err != nil {
+		return err
+	}
+
+	i.entries = append(i.entries, timeEntry{timestamp: timestamp, offset: offset})
+
+	return nil
+}
+
+// lookup returns the offset to search timestamp from, the one of the
+// greatest entry below it.
+func (i *timeIndex) lookup(timestamp int64) (int64, bool) {
+	n := sort.Search(len(i.entries), func(n int) bool {
+		return i.entries[n].timestamp >= timestamp
+	})
+
+	if n == 0 {
+		return 0, false
+	}
+
+	return i.entries[n-1].offset, true
+}
+
+// sanityCheck checks that the timestamps grow and the offsets are the ones
+// of a segment ending before nextOffset.
+func (i *timeIndex) sanityCheck(nextOffset int64) error {
+	if i.partialEntry {
+		return fmt.Errorf("%s ends with a partial entry", i.path)
+	}
+
+	previous := timeEntry{timestamp: -1, offset: i.baseOffset}
+
+	for _, entry := range i.entries {
+		if entry.timestamp < previous.timestamp || entry.offset < previous.offset || entry.offset >= nextOffset {
+			return fmt.Errorf("%s has the invalid entry %d at %d after %d at %d",
+				i.path, entry.offset, entry.timestamp, previous.offset, previous.timestamp)
+		}
+
+		previous = entry
+	}
+
+	return nil
+}
+
+func (i *timeIndex) reset() error {
+	i.entries, i.partialEntry = nil, false
+	return i.file.Truncate(0)
+}
+
+func (i *timeIndex) close() error {
+	return i.file.Close()
+}
@@ -0,0 +1,731 @@
+// Package log stores the record batches of the topic partitions, each one on
+// a directory of rolling segments laid out as Kafka does: the .log holding
+// the batches, the .index mapping offsets to positions and the .timeindex
+// mapping timestamps to offsets.
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+var ErrOffsetOutOfRange = errors.New("log: offset out of range")
+var ErrEmptyBatch = errors.New("log: empty batch")
+
+// Isolation is how far Read goes.
+type Isolation int8
+
+const (
+	// FetchLogEnd reads up to the log end offset, like the followers do.
+	FetchLogEnd Isolation = iota
+	// FetchHighWatermark reads the committed offsets, like the consumers do.
+	FetchHighWatermark
+)
+
+// DirName is the name of the directory of a topic partition log.
+func DirName(topic string, partition int32) string {
+	return fmt.Sprintf("%s-%d", topic, partition)
+}
+
+// ParseDirName returns the topic and partition of a log directory name.
+func ParseDirName(name string) (string, int32, error) {
+	separator := strings.LastIndexByte(name, '-')
+
+	if separator <= 0 {
+		return "", 0, fmt.Errorf("log: invalid directory name %s", name)
+	}
+
+	partition, err := strconv.ParseInt(name[separator+1:], 10, 32)
+
+	if err != nil || partition < 0 {
+		return "", 0, fmt.Errorf("log: invalid directory name %s", name)
+	}
+
+	return name[:separator], int32(partition), nil
+}
+
+// AppendInfo describes the batches appended by Log.Append.
+type AppendInfo struct {
+	FirstOffset          int64
+	LastOffset           int64
+	MaxTimestamp         int64
+	OffsetOfMaxTimestamp int64
+}
+
+// ReadInfo holds the batches returned by Log.Read, with the offsets of the
+// log at the time.
+type ReadInfo struct {
+	Records        []byte
+	HighWatermark  int64
+	LogStartOffset int64
+	LogEndOffset   int64
+}
+
+// Log is the log of a topic partition, it is safe for concurrent use.
+type Log struct {
+	mu     sync.RWMutex
+	dir    string
+	config Config
+	// segments are ordered by base offset, the last one is the active
+	// segment receiving the batches.
+	segments []*segment
+
+	logStartOffset int64
+	highWatermark  int64
+	// recoveryPoint is the offset the segments were flushed up to.
+	recoveryPoint int64
+	// lastFlush is when the log was last flushed, for flush.ms.
+	lastFlush time.Time
+	// rolled tells that segments were created since the last flush, the
+	// directory is flushed with them.
+	rolled bool
+	// onFlush observes how long the flushes take, when set.
+	onFlush func(elapsed time.Duration)
+	// onStorageError is told the IO errors of the log, set before the log is
+	// shared.
+	onStorageError func(err error)
+	// closed is set once the files are closed, like when the log is moved.
+	closed bool
+
+	// remoteStorage is the remote tier, set when the broker has one.
+	remoteStorage RemoteStorageManager
+	// remoteSegments are the segments copied to the remote tier, by offset,
+	// listed in the RemoteLogSegmentsFile. The first ones may still be on
+	// the log directory too.
+	remoteSegments []RemoteLogSegmentMetadata
+
+	logger *slog.Logger
+}
+
+// Recovery tells Open how far to trust the segments on disk.
+type Recovery struct {
+	// Clean is set after a clean shutdown, the segments are trusted then
+	// unless their indexes don't look right.
+	Clean bool
+	// RecoveryPoint is the offset the log was flushed up to, the segments
+	// after it are recovered after an unclean shutdown.
+	RecoveryPoint int64
+	// LogStartOffset is the log start offset checkpointed, which DeleteRecords
+	// may have moved past the first segment.
+	LogStartOffset int64
+	// Logger tells what was repaired, slog.Default when nil.
+	Logger *slog.Logger
+}
+
+// Open opens the log of dir, creating it when missing. The segments that
+// may have been written partially are recovered: their batches are checked,
+// the log is truncated at the first invalid one and their indexes are
+// rebuilt.
+func Open(dir string, config Config, recovery Recovery) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	// the segments deleted or being compacted before a crash are gone
+	// anyway, the compacted ones being swapped in replace their segments
+	if err := removeFiles(dir, DeletedFileSuffix, CleanedFileSuffix); err != nil {
+		return nil, err
+	}
+
+	if err := completeSwaps(dir, config); err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+
+	offsets, err := segmentOffsets(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(offsets) == 0 {
+		offsets = []int64{0}
+	}
+
+	logger := recovery.Logger
+
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	l := &Log{dir: dir, config: config, logger: logger.With("dir", dir)}
+
+	for _, offset := range offsets {
+		s, err := openSegment(dir, offset, config)
+
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("log: %w", err)
+		}
+
+		l.segments = append(l.segments, s)
+	}
+
+	if err = l.recover(recovery, l.logger); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("log: %w", err)
+	}
+
+	if topic, partition, err := ParseDirName(filepath.Base(dir)); err == nil {
+		if l.remoteSegments, err = readRemoteSegments(dir, TopicPartition{Topic: topic, Partition: partition}); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	firstOffset := l.segments[0].baseOffset
+
+	if len(l.remoteSegments) > 0 {
+		firstOffset = min(firstOffset, l.remoteSegments[0].StartOffset)
+	}
+
+	l.logStartOffset = min(max(firstOffset, recovery.LogStartOffset), l.activeSegment().nextOffset)
+	l.recoveryPoint = l.activeSegment().nextOffset
+	l.lastFlush = time.Now()
+	// the brokers don't replicate, the offsets on disk are committed
+	l.highWatermark = l.activeSegment().nextOffset
+
+	return l, nil
+}
+
+// recover loads the segments, recovering the ones after the recovery point
+// and the ones whose indexes are missing or corrupt. Once a segment is
+// truncated, the ones after it are deleted.
+func (l *Log) recover(recovery Recovery, logger *slog.Logger) error {
+	for i := 0; i < len(l.segments); i++ {
+		s := l.segments[i]
+		unflushed := !recovery.Clean && (i == len(l.segments)-1 || l.segments[i+1].baseOffset > recovery.RecoveryPoint)
+
+		if !unflushed {
+			err := s.load()
+
+			if err == nil {
+				continue
+			}
+
+			logger.Warn("rebuilding the indexes of a segment", "base_offset", s.baseOffset, "reason", err)
+		}
+
+		repair, err := s.recover(l.config)
+
+		if err != nil {
+			return err
+		}
+
+		logger.Info("recovered segment", "base_offset", s.baseOffset, "next_offset", s.nextOffset, "size", s.size)
+
+		if repair.truncatedBytes == 0 {
+			continue
+		}
+
+		logger.Warn("truncated segment",
+			"base_offset", s.baseOffset, "truncated_bytes", repair.truncatedBytes, "reason", repair.cause,
+		)
+
+		for _, deleted := range l.segments[i+1:] {
+			logger.Warn("deleted segment after a truncation", "base_offset", deleted.baseOffset, "size", deleted.size)
+
+			if err = deleted.delete(); err != nil {
+				return err
+			}
+		}
+
+		l.segments = l.segments[:i+1]
+	}
+
+	return nil
+}
+
+// segmentOffsets returns the base offsets of the segments of dir, in order.
+func segmentOffsets(dir string) ([]int64, error) {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var offsets []int64
+
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), LogFileSuffix)
+
+		if !found || entry.IsDir() {
+			continue
+		}
+
+		if offset, err := strconv.ParseInt(name, 10, 64); err == nil {
+			offsets = append(offsets, offset)
+		}
+	}
+
+	slices.Sort(offsets)
+
+	return offsets, nil
+}
+
+func (l *Log) Dir() string {
+	return l.dir
+}
+
+func (l *Log) Config() Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.config
+}
+
+// SetConfig changes the configs, like when the configs of the topic change,
+// for the next batches.
+func (l *Log) SetConfig(config Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.config = config
+}
+
+func (l *Log) activeSegment() *segment {
+	return l.segments[len(l.segments)-1]
+}
+
+func (l *Log) LogStartOffset() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.logStartOffset
+}
+
+// LogEndOffset is the offset of the next batch appended.
+func (l *Log) LogEndOffset() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.activeSegment().nextOffset
+}
+
+func (l *Log) HighWatermark() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.highWatermark
+}
+
+// UpdateHighWatermark moves the high watermark to offset, kept between the
+// log start and end offsets, and returns it.
+func (l *Log) UpdateHighWatermark(offset int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.highWatermark = min(max(offset, l.logStartOffset), l.activeSegment().nextOffset)
+
+	return l.highWatermark
+}
+
+// Size is the size of the segments.
+func (l *Log) Size() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.size()
+}
+
+func (l *Log) size() int64 {
+	var size int64
+
+	for _, s := range l.segments {
+		size += s.size
+	}
+
+	return size
+}
+
+// NumberOfSegments is the number of segments, the active one included.
+func (l *Log) NumberOfSegments() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.segments)
+}
+
+// Append appends the batches of records, as sent by the producers, giving
+// them the offsets following the log end offset and leaderEpoch. The
+// batches are checked whole before any is written. The log is flushed once
+// flush.messages are appended since the last flush.
+func (l *Log) Append(records []byte, leaderEpoch int32) (_ *AppendInfo, err error) {
+	defer l.report(&err)
+
+	var batches [][]byte
+	var headers []*record.Batch
+
+	for data := records; len(data) > 0; {
+		batch, err := record.ReadBatch(bytes.NewReader(data))
+
+		if err != nil {
+			return nil, fmt.Errorf("log: %w", err)
+		}
+
+		if len(batch.Records) == 0 {
+			return nil, ErrEmptyBatch
+		}
+
+		batches = append(batches, data[:batch.Size()])
+		headers = append(headers, batch)
+		data = data[batch.Size():]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info := &AppendInfo{FirstOffset: l.activeSegment().nextOffset, MaxTimestamp: -1}
+
+	for i, data := range batches {
+		header := headers[i]
+		// the base offset and the leader epoch aren't covered by the CRC
+		data = slices.Clone(data)
+		header.BaseOffset = l.activeSegment().nextOffset
+		header.PartitionLeaderEpoch = leaderEpoch
+		binary.BigEndian.PutUint64(data, uint64(header.BaseOffset))
+		binary.BigEndian.PutUint32(data[12:], uint32(leaderEpoch))
+
+		if l.activeSegment().shouldRoll(len(data), header.LastOffset(), time.Now(), l.config) {
+			if err := l.roll(); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := l.activeSegment().append(data, header, l.config); err != nil {
+			return nil, fmt.Errorf("log: %w", err)
+		}
+
+		info.LastOffset = header.LastOffset()
+
+		if header.MaxTimestamp > info.MaxTimestamp {
+			info.MaxTimestamp, info.OffsetOfMaxTimestamp = header.MaxTimestamp, header.LastOffset()
+		}
+	}
+
+	if l.activeSegment().nextOffset-l.recoveryPoint >= l.config.FlushMessages {
+		if err := l.flush(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+// Roll starts a new segment at the log end offset.
+func (l *Log) Roll() (err error) {
+	defer l.report(&err)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.activeSegment().size == 0 {
+		return nil
+	}
+
+	return l.roll()
+}
+
+func (l *Log) roll() error {
+	active := l.activeSegment()
+
+	if err := active.onRoll(); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+
+	s, err := openSegment(l.dir, active.nextOffset, l.config)
+
+	if err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+
+	l.segments = append(l.segments, s)
+	l.rolled = true
+
+	return nil
+}
+
+// Read returns whole batches from the one holding offset, until they take
+// more than maxBytes, at least one batch though. The batches may start
+// before offset. The offsets before the local segments are read from the
+// remote tier, without holding the log.
+func (l *Log) Read(offset int64, maxBytes int, isolation Isolation) (_ *ReadInfo, err error) {
+	defer l.report(&err)
+
+	l.mu.RLock()
+	metadata, remote := l.remoteSegment(offset)
+
+	if !remote {
+		defer l.mu.RUnlock()
+		return l.read(offset, maxBytes, isolation)
+	}
+
+	info := l.readInfo()
+	storage := l.remoteStorage
+	l.mu.RUnlock()
+
+	if info.Records, err = readRemote(storage, metadata, offset, maxBytes); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// readInfo returns the offsets of the log, without batches.
+func (l *Log) readInfo() *ReadInfo {
+	return &ReadInfo{
+		HighWatermark:  l.highWatermark,
+		LogStartOffset: l.logStartOffset,
+		LogEndOffset:   l.activeSegment().nextOffset,
+	}
+}
+
+// read reads the local segments.
+func (l *Log) read(offset int64, maxBytes int, isolation Isolation) (*ReadInfo, error) {
+	info := l.readInfo()
+	maxOffset := info.LogEndOffset
+
+	if isolation == FetchHighWatermark {
+		maxOffset = info.HighWatermark
+	}
+
+	if offset < info.LogStartOffset || offset > info.LogEndOffset {
+		return nil, fmt.Errorf("%w: %d not in [%d, %d]", ErrOffsetOutOfRange, offset, info.LogStartOffset, info.LogEndOffset)
+	}
+
+	for i := l.segmentIndex(offset); i < len(l.segments) && offset < maxOffset; i++ {
+		s := l.segments[i]
+		position, _, err := s.find(max(offset, s.baseOffset))
+
+		if errors.Is(err, io.EOF) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("log: %w", err)
+		}
+
+		maxPosition := s.size
+
+		if maxOffset < s.nextOffset {
+			if maxPosition, _, err = s.find(maxOffset); err != nil {
+				return nil, fmt.Errorf("log: %w", err)
+			}
+		}
+
+		if info.Records, err = s.read(position, maxPosition, maxBytes); err != nil {
+			return nil, fmt.Errorf("log: %w", err)
+		}
+
+		break
+	}
+
+	return info, nil
+}
+
+// segmentIndex returns the index of the segment holding offset, the last one
+// whose base offset isn't after it.
+func (l *Log) segmentIndex(offset int64) int {
+	i, found := slices.BinarySearchFunc(l.segments, offset, func(s *segment, offset int64) int {
+		return int(min(max(s.baseOffset-offset, -1), 1))
+	})
+
+	if found {
+		return i
+	}
+
+	return max(i-1, 0)
+}
+
+// OffsetForTimestamp returns the first offset whose timestamp is timestamp
+// or later, and that timestamp. It isn't found when every timestamp is
+// before. The segments before the local ones are searched on the remote
+// tier, without holding the log.
+func (l *Log) OffsetForTimestamp(timestamp int64) (_ int64, _ int64, _ bool, err error) {
+	defer l.report(&err)
+
+	l.mu.RLock()
+	storage, logStartOffset := l.remoteStorage, l.logStartOffset
+	var remoteSegments []RemoteLogSegmentMetadata
+
+	for _, rs := range l.remoteSegments {
+		if storage != nil && rs.StartOffset < l.segments[0].baseOffset && rs.EndOffset >= logStartOffset && rs.MaxTimestamp >= timestamp {
+			remoteSegments = append(remoteSegments, rs)
+		}
+	}
+
+	l.mu.RUnlock()
+
+	for _, rs := range remoteSegments {
+		offset, recordTimestamp, found, err := findRemoteTimestamp(storage, rs, timestamp, max(logStartOffset, rs.StartOffset))
+
+		if err != nil || found {
+			return offset, recordTimestamp, found, err
+		}
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.offsetForTimestamp(timestamp)
+}
+
+// offsetForTimestamp searches the local segments.
+func (l *Log) offsetForTimestamp(timestamp int64) (int64, int64, bool, error) {
+	for _, s := range l.segments {
+		if s.maxTimestamp < timestamp || s.nextOffset <= l.logStartOffset {
+			continue
+		}
+
+		offset, recordTimestamp, err := s.findTimestamp(timestamp, max(l.logStartOffset, s.baseOffset))
+
+		if errors.Is(err, io.EOF) {
+			continue
+		}
+
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("log: %w", err)
+		}
+
+		return offset, recordTimestamp, true, nil
+	}
+
+	return 0, 0, false, nil
+}
+
+// RecoveryPoint is the offset the log was flushed up to, the offsets after
+// it may be lost on a crash.
+func (l *Log) RecoveryPoint() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.recoveryPoint
+}
+
+// Flush writes the segments after the recovery point and their indexes to
+// the disk, moving the recovery point to the log end offset.
+func (l *Log) Flush() (err error) {
+	defer l.report(&err)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.flush(time.Now())
+}
+
+// FlushIfNeeded flushes the log when it has records not flushed yet and was
+// last flushed flush.ms before now. It tells whether the log was flushed.
+func (l *Log) FlushIfNeeded(now time.Time) (_ bool, err error) {
+	defer l.report(&err)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.activeSegment().nextOffset == l.recoveryPoint || now.Sub(l.lastFlush) < l.config.FlushMs {
+		return false, nil
+	}
+
+	return true, l.flush(now)
+}
+
+// SetFlushObserver sets the function told how long the flushes take.
+func (l *Log) SetFlushObserver(onFlush func(elapsed time.Duration)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.onFlush = onFlush
+}
+
+func (l *Log) flush(now time.Time) error {
+	start := time.Now()
+
+	for _, s := range l.segments[l.segmentIndex(l.recoveryPoint):] {
+		if err := s.flush(); err != nil {
+			return fmt.Errorf("log: %w", err)
+		}
+	}
+
+	// the entries of the new segment files are durable once the directory is
+	if l.rolled {
+		if err := syncDir(l.dir); err != nil {
+			return fmt.Errorf("log: %w", err)
+		}
+
+		l.rolled = false
+	}
+
+	l.recoveryPoint = l.activeSegment().nextOffset
+	l.lastFlush = now
+
+	if l.onFlush != nil {
+		l.onFlush(time.Since(start))
+	}
+
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.close()
+}
+
+func (l *Log) close() error {
+	var err error
+
+	for _, s := range l.segments {
+		err = errors.Join(err, s.close())
+	}
+
+	l.closed = true
+
+	return err
+}
+
+// parentDir is the log directory of the log.
+func (l *Log) parentDir() string {
+	return filepath.Dir(l.dir)
+}
+
+// report tells onStorageError about *err when it comes from the files of
+// the log. The methods defer it before locking the log, so that it runs
+// once the log is unlocked.
+func (l *Log) report(err *error) {
+	if *err == nil || l.onStorageError == nil || !isStorageError(*err) {
+		return
+	}
+
+	l.mu.RLock()
+	closed := l.closed
+	l.mu.RUnlock()
+
+	// the files of a closed log fail on purpose
+	if !closed {
+		l.onStorageError(*err)
+	}
+}
+
+// isStorageError tells whether err comes from the file system, unlike the
+// errors of invalid records or offsets.
+func isStorageError(err error) bool {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+
+	return !errors.Is(err, fs.ErrClosed) &&
+		(errors.As(err, &pathErr) || errors.As(err, &linkErr) || errors.As(err, &syscallErr))
+}
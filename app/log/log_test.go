@@ -0,0 +1,376 @@
+package log_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/config"
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+// encodeBatch encodes a batch of count records at timestamp, the offsets are
+// assigned by the log.
+func encodeBatch(t testing.TB, timestamp int64, count int) []byte {
+	t.Helper()
+
+	records := make([]record.Record, count)
+
+	for i := range records {
+		records[i] = record.Record{Key: []byte(fmt.Sprint(i)), Value: bytes.Repeat([]byte{'v'}, 100)}
+	}
+
+	data, err := record.NewBatch(0, timestamp, records...).Encode()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return data
+}
+
+// readOffsets returns the offsets of the records of the batches of data.
+func readOffsets(t testing.TB, data []byte) []int64 {
+	t.Helper()
+
+	var offsets []int64
+	reader := bytes.NewReader(data)
+
+	for {
+		batch, err := record.ReadBatch(reader)
+
+		if errors.Is(err, io.EOF) {
+			return offsets
+		}
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		for _, rec := range batch.Records {
+			offsets = append(offsets, batch.BaseOffset+int64(rec.OffsetDelta))
+		}
+	}
+}
+
+func now() int64 {
+	return time.Now().UnixMilli()
+}
+
+func openLog(t testing.TB, dir string, config log.Config) *log.Log {
+	t.Helper()
+
+	l, err := log.Open(dir, config, log.Recovery{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+
+	return l
+}
+
+func TestAppendAndRead(t *testing.T) {
+	l := openLog(t, t.TempDir(), log.DefaultConfig)
+
+	for i := range 3 {
+		info, err := l.Append(encodeBatch(t, now(), 2), 5)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if info.FirstOffset != int64(2*i) || info.LastOffset != int64(2*i+1) {
+			t.Fatalf("expected offsets %d to %d, result: %+v", 2*i, 2*i+1, info)
+		}
+	}
+
+	if l.LogEndOffset() != 6 {
+		t.Fatalf("expected: 6, result: %d", l.LogEndOffset())
+	}
+
+	info, err := l.Read(3, 1, log.FetchLogEnd)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if offsets := readOffsets(t, info.Records); len(offsets) != 2 || offsets[0] != 2 {
+		t.Fatalf("expected the batch holding offset 3 only, result: %v", offsets)
+	}
+
+	batch, _ := record.DecodeBatch(info.Records)
+
+	if batch.PartitionLeaderEpoch != 5 {
+		t.Fatalf("expected: 5, result: %d", batch.PartitionLeaderEpoch)
+	}
+
+	if info, _ = l.Read(2, 1<<20, log.FetchLogEnd); len(readOffsets(t, info.Records)) != 4 {
+		t.Fatalf("expected the offsets 2 to 5, result: %v", readOffsets(t, info.Records))
+	}
+
+	if info, _ = l.Read(6, 1<<20, log.FetchLogEnd); len(info.Records) != 0 || info.LogEndOffset != 6 {
+		t.Fatalf("expected no records at the log end, result: %+v", info)
+	}
+
+	if _, err = l.Read(7, 1<<20, log.FetchLogEnd); !errors.Is(err, log.ErrOffsetOutOfRange) {
+		t.Fatalf("expected: %v, result: %v", log.ErrOffsetOutOfRange, err)
+	}
+}
+
+func TestReadUpToHighWatermark(t *testing.T) {
+	l := openLog(t, t.TempDir(), log.DefaultConfig)
+
+	l.Append(encodeBatch(t, now(), 2), 0)
+	l.Append(encodeBatch(t, now(), 2), 0)
+
+	if hw := l.UpdateHighWatermark(2); hw != 2 {
+		t.Fatalf("expected: 2, result: %d", hw)
+	}
+
+	info, _ := l.Read(0, 1<<20, log.FetchHighWatermark)
+
+	if offsets := readOffsets(t, info.Records); len(offsets) != 2 {
+		t.Fatalf("expected the offsets below the high watermark, result: %v", offsets)
+	}
+
+	if hw := l.UpdateHighWatermark(10); hw != 4 {
+		t.Fatalf("expected the log end offset, result: %d", hw)
+	}
+}
+
+func TestRollAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	config := log.DefaultConfig
+	config.SegmentBytes = 1024
+	config.IndexIntervalBytes = 1
+	l := openLog(t, dir, config)
+	batch := encodeBatch(t, now(), 3)
+
+	for range 10 {
+		if _, err := l.Append(batch, 0); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// every segment takes two batches of 3 records
+	if l.NumberOfSegments() != 5 {
+		t.Fatalf("expected: 5, result: %d", l.NumberOfSegments())
+	}
+
+	for _, suffix := range []string{log.LogFileSuffix, log.IndexFileSuffix, log.TimeIndexFileSuffix} {
+		if _, err := os.Stat(filepath.Join(dir, "00000000000000000006"+suffix)); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	l.Close()
+	l = openLog(t, dir, config)
+
+	if l.LogEndOffset() != 30 || l.LogStartOffset() != 0 || l.Size() != int64(10*len(batch)) {
+		t.Fatalf("unexpected offsets after reopening: %d %d %d", l.LogStartOffset(), l.LogEndOffset(), l.Size())
+	}
+
+	info, err := l.Read(13, 1<<20, log.FetchLogEnd)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if offsets := readOffsets(t, info.Records); len(offsets) != 6 || offsets[0] != 12 {
+		t.Fatalf("expected the segment starting at 12, result: %v", offsets)
+	}
+
+	if info, _ := l.Append(batch, 0); info.FirstOffset != 30 {
+		t.Fatalf("expected: 30, result: %d", info.FirstOffset)
+	}
+}
+
+func TestRollByTime(t *testing.T) {
+	config := log.DefaultConfig
+	config.SegmentMs = time.Hour
+	l := openLog(t, t.TempDir(), config)
+
+	l.Append(encodeBatch(t, time.Now().Add(-2*time.Hour).UnixMilli(), 1), 0)
+	l.Append(encodeBatch(t, now(), 1), 0)
+	l.Append(encodeBatch(t, now(), 1), 0)
+
+	if l.NumberOfSegments() != 2 {
+		t.Fatalf("expected: 2, result: %d", l.NumberOfSegments())
+	}
+}
+
+func TestOffsetForTimestamp(t *testing.T) {
+	config := log.DefaultConfig
+	config.SegmentBytes = 1024
+	config.IndexIntervalBytes = 1
+	l := openLog(t, t.TempDir(), config)
+
+	base := now()
+
+	for i := range 10 {
+		l.Append(encodeBatch(t, base+int64(1000*(i+1)), 3), 0)
+	}
+
+	cases := []struct {
+		timestamp int64
+		offset    int64
+		found     bool
+	}{
+		{0, 0, true},
+		{1000, 0, true},
+		{4500, 12, true},
+		{10000, 27, true},
+		{10001, 0, false},
+	}
+
+	for _, c := range cases {
+		offset, timestamp, found, err := l.OffsetForTimestamp(base + c.timestamp)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if found != c.found || (found && (offset != c.offset || timestamp < base+c.timestamp)) {
+			t.Fatalf("timestamp %d, expected: %d %t, result: %d %d %t", c.timestamp, c.offset, c.found, offset, timestamp, found)
+		}
+	}
+}
+
+func TestAppendInvalidRecords(t *testing.T) {
+	l := openLog(t, t.TempDir(), log.DefaultConfig)
+	batch := encodeBatch(t, now(), 2)
+	batch[len(batch)-1]++
+
+	if _, err := l.Append(batch, 0); !errors.Is(err, record.ErrCorruptBatch) {
+		t.Fatalf("expected: %v, result: %v", record.ErrCorruptBatch, err)
+	}
+
+	empty, _ := record.NewBatch(0, 0).Encode()
+
+	if _, err := l.Append(empty, 0); !errors.Is(err, log.ErrEmptyBatch) {
+		t.Fatalf("expected: %v, result: %v", log.ErrEmptyBatch, err)
+	}
+
+	if l.LogEndOffset() != 0 || l.Size() != 0 {
+		t.Fatalf("expected an empty log, result: %d bytes", l.Size())
+	}
+}
+
+func TestDirName(t *testing.T) {
+	topic, partition, err := log.ParseDirName(log.DirName("my-topic", 12))
+
+	if err != nil || topic != "my-topic" || partition != 12 {
+		t.Fatalf("expected my-topic 12, result: %s %d %v", topic, partition, err)
+	}
+
+	if _, _, err = log.ParseDirName("topic"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	broker, err := log.BrokerConfig(config.Properties{"log.roll.hours": "1", "log.segment.bytes": "2048"})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	topic, err := broker.WithTopicConfigs(map[string]string{"segment.bytes": "1024"})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if topic.SegmentMs != time.Hour || topic.SegmentBytes != 1024 || broker.SegmentBytes != 2048 {
+		t.Fatalf("unexpected configs: %+v %+v", broker, topic)
+	}
+
+	broker, _ = log.BrokerConfig(config.Properties{"log.retention.hours": "-1", "log.retention.check.interval.ms": "1000"})
+	topic, _ = broker.WithTopicConfigs(map[string]string{"retention.ms": "60000", "log.retention.check.interval.ms": "5"})
+
+	if broker.RetentionMs >= 0 || topic.RetentionMs != time.Minute || topic.RetentionCheckInterval != time.Second {
+		t.Fatalf("unexpected retention configs: %+v %+v", broker, topic)
+	}
+
+	topic, _ = broker.WithTopicConfigs(map[string]string{"cleanup.policy": "compact, delete", "min.cleanable.dirty.ratio": "0.1"})
+
+	if !topic.CleanupPolicy.Compact() || !topic.CleanupPolicy.Delete() || topic.MinCleanableDirtyRatio != 0.1 {
+		t.Fatalf("unexpected compaction configs: %+v", topic)
+	}
+
+	broker, _ = log.BrokerConfig(config.Properties{"log.flush.scheduler.interval.ms": "1000", "log.flush.interval.messages": "9223372036854775807"})
+	topic, _ = broker.WithTopicConfigs(map[string]string{"flush.messages": "10"})
+
+	if broker.FlushMs != time.Second || broker.FlushSchedulerInterval != time.Second || topic.FlushMessages != 10 {
+		t.Fatalf("unexpected flush configs: %+v %+v", broker, topic)
+	}
+
+	if broker, _ = log.BrokerConfig(config.Properties{"log.flush.interval.ms": "9223372036854775807"}); broker.FlushMs <= 0 {
+		t.Fatalf("expected flush.ms capped, result: %s", broker.FlushMs)
+	}
+
+	broker, _ = log.BrokerConfig(config.Properties{"remote.log.storage.system.enable": "true", "log.local.retention.ms": "1000"})
+	topic, _ = broker.WithTopicConfigs(map[string]string{"remote.storage.enable": "true", "local.retention.bytes": "2048"})
+
+	if !broker.RemoteLogStorageSystemEnable || broker.RemoteStorageEnable || !topic.RemoteStorageEnable ||
+		topic.LocalRetentionMs != time.Second || topic.LocalRetentionBytes != 2048 || broker.LocalRetentionBytes != -2 {
+		t.Fatalf("unexpected tiered storage configs: %+v %+v", broker, topic)
+	}
+
+	if _, err = broker.WithTopicConfigs(map[string]string{"cleanup.policy": "archive"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if _, err = broker.WithTopicConfigs(map[string]string{"segment.ms": "soon"}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestFlushMessages(t *testing.T) {
+	config := log.DefaultConfig
+	config.FlushMessages = 5
+	l := openLog(t, t.TempDir(), config)
+	var flushes int
+	l.SetFlushObserver(func(time.Duration) { flushes++ })
+
+	l.Append(encodeBatch(t, now(), 3), 0)
+
+	if l.RecoveryPoint() != 0 {
+		t.Fatalf("expected the log left unflushed, result: %d", l.RecoveryPoint())
+	}
+
+	l.Append(encodeBatch(t, now(), 3), 0)
+
+	if l.RecoveryPoint() != 6 || flushes != 1 {
+		t.Fatalf("expected the log flushed once, result: %d after %d flushes", l.RecoveryPoint(), flushes)
+	}
+}
+
+func TestFlushIfNeeded(t *testing.T) {
+	config := log.DefaultConfig
+	config.FlushMs = time.Hour
+	l := openLog(t, t.TempDir(), config)
+
+	l.Append(encodeBatch(t, now(), 3), 0)
+
+	if flushed, err := l.FlushIfNeeded(time.Now()); flushed || err != nil {
+		t.Fatalf("expected the log left unflushed, result: %v %v", flushed, err)
+	}
+
+	if flushed, err := l.FlushIfNeeded(time.Now().Add(2 * time.Hour)); !flushed || err != nil || l.RecoveryPoint() != 3 {
+		t.Fatalf("expected the log flushed, result: %v %v", flushed, err)
+	}
+
+	// there is nothing left to flush
+	if flushed, _ := l.FlushIfNeeded(time.Now().Add(4 * time.Hour)); flushed {
+		t.Fatal("expected the log left unflushed")
+	}
+}
@@ -0,0 +1,774 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metadataTopic is the topic of the KRaft metadata log, which lives in a log
+// directory but isn't managed with the partition logs.
+const metadataTopic = "__cluster_metadata"
+
+var (
+	// ErrLogDirNotFound is returned for a directory that isn't one of the
+	// log.dirs.
+	ErrLogDirNotFound = errors.New("log: log dir not found")
+	// ErrLogDirOffline is returned for a directory taken offline after an IO
+	// error, or when every directory is.
+	ErrLogDirOffline = errors.New("log: log dir offline")
+	// ErrLogNotFound is returned for a partition without log on the broker.
+	ErrLogNotFound = errors.New("log: log not found")
+)
+
+// logDir is one of the log.dirs.
+type logDir struct {
+	path string
+	// err is the IO error the directory was taken offline for, its logs
+	// aren't served anymore.
+	err error
+}
+
+// Manager keeps the partition logs of the log directories, the log.dirs, as
+// JBOD: every log lives on one of them, and a directory failing is taken
+// offline without the others. It recovers the logs on open, unless the
+// broker was shut down cleanly, flushes them, checkpoints their recovery
+// points and log start offsets, enforces their retention, compacts them,
+// moves them between the directories and copies them to the remote tier.
+type Manager struct {
+	config Config
+	logger *slog.Logger
+
+	mu   sync.RWMutex
+	dirs []*logDir
+	logs map[TopicPartition]*Log
+	// offlineLogs are the logs of the directories taken offline, by
+	// directory.
+	offlineLogs map[TopicPartition]string
+	// futureLogs are the copies of the logs being moved to another
+	// directory, preferredDirs the directories asked for the logs not created
+	// yet.
+	futureLogs    map[TopicPartition]*Log
+	preferredDirs map[TopicPartition]string
+	onFlush       func(elapsed time.Duration)
+	// remoteStorage is the remote tier of the logs, when enabled.
+	remoteStorage RemoteStorageManager
+
+	// checkpointMu serializes the writes of the checkpoint files.
+	checkpointMu sync.Mutex
+
+	cleaner *cleaner
+	moves   *mover
+}
+
+// OpenManager opens the logs of the directories dirs, creating them when
+// missing. The logs are opened with config, the configs of their topics are
+// set afterwards. The directories failing to open are left offline, it
+// fails when all do.
+func OpenManager(dirs []string, config Config, logger *slog.Logger) (*Manager, error) {
+	if len(dirs) == 0 {
+		return nil, errors.New("log: no log dirs")
+	}
+
+	m := &Manager{
+		config:        config,
+		logger:        logger,
+		logs:          make(map[TopicPartition]*Log),
+		offlineLogs:   make(map[TopicPartition]string),
+		futureLogs:    make(map[TopicPartition]*Log),
+		preferredDirs: make(map[TopicPartition]string),
+	}
+
+	cleanerCheckpoints := make(map[TopicPartition]int64)
+
+	for _, path := range dirs {
+		path, err := filepath.Abs(path)
+
+		if err != nil {
+			m.closeLogs()
+			return nil, fmt.Errorf("log: %w", err)
+		}
+
+		dir := &logDir{path: path}
+		m.dirs = append(m.dirs, dir)
+
+		if err = m.loadDir(dir, cleanerCheckpoints); isStorageError(err) {
+			m.logger.Error("took the log dir offline", "log_dir", path, "error", err)
+			dir.err = err
+		} else if err != nil {
+			m.closeLogs()
+			return nil, err
+		}
+	}
+
+	m.cleaner = newCleaner(m, cleanerCheckpoints)
+	m.moves = newMover(m)
+
+	if err := m.checkpoint(); err != nil {
+		m.logger.Error("couldn't checkpoint the logs", "error", err)
+	}
+
+	if len(m.onlineDirs()) == 0 {
+		m.closeLogs()
+		return nil, fmt.Errorf("%w: every log dir is", ErrLogDirOffline)
+	}
+
+	m.logger.Info("loaded logs", "logs", len(m.logs), "log_dirs", len(m.dirs))
+
+	return m, nil
+}
+
+// loadDir opens the logs of dir, adding its cleaner checkpoints to
+// cleanerCheckpoints.
+func (m *Manager) loadDir(dir *logDir, cleanerCheckpoints map[TopicPartition]int64) error {
+	logger := m.logger.With("log_dir", dir.path)
+
+	if err := os.MkdirAll(dir.path, 0o755); err != nil {
+		return err
+	}
+
+	markerPath := filepath.Join(dir.path, CleanShutdownFile)
+	_, err := os.Stat(markerPath)
+	clean := err == nil
+
+	recoveryPoints, err := readCheckpoint(filepath.Join(dir.path, RecoveryPointCheckpointFile))
+
+	if err != nil {
+		logger.Warn("recovering every log without recovery points", "error", err)
+		recoveryPoints, clean = make(map[TopicPartition]int64), false
+	}
+
+	logStartOffsets, err := readCheckpoint(filepath.Join(dir.path, LogStartOffsetCheckpointFile))
+
+	if err != nil {
+		logger.Warn("starting the logs at their first segment", "error", err)
+		logStartOffsets = make(map[TopicPartition]int64)
+	}
+
+	checkpoints, err := readCheckpoint(filepath.Join(dir.path, CleanerOffsetCheckpointFile))
+
+	if err != nil {
+		logger.Warn("compacting the logs from their start", "error", err)
+	}
+
+	if clean {
+		logger.Info("skipping the recovery after a clean shutdown")
+	} else {
+		logger.Warn("recovering the logs after an unclean shutdown")
+	}
+
+	entries, err := os.ReadDir(dir.path)
+
+	if err != nil {
+		return err
+	}
+
+	logs := make(map[TopicPartition]*Log)
+
+	closeLogs := func() {
+		for _, l := range logs {
+			l.Close()
+		}
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		// the moves interrupted start over when asked again
+		if strings.HasSuffix(entry.Name(), FutureDirSuffix) || strings.HasSuffix(entry.Name(), DeleteDirSuffix) {
+			logger.Info("removing the log of an interrupted move", "dir", entry.Name())
+
+			if err = os.RemoveAll(filepath.Join(dir.path, entry.Name())); err != nil {
+				closeLogs()
+				return err
+			}
+
+			continue
+		}
+
+		topic, partition, err := ParseDirName(entry.Name())
+
+		if err != nil || topic == metadataTopic {
+			continue
+		}
+
+		tp := TopicPartition{Topic: topic, Partition: partition}
+
+		if _, found := m.logs[tp]; found {
+			closeLogs()
+			return fmt.Errorf("log: %s is in two log dirs", tp)
+		}
+
+		l, err := Open(filepath.Join(dir.path, entry.Name()), m.config, Recovery{
+			Clean:          clean,
+			RecoveryPoint:  recoveryPoints[tp],
+			LogStartOffset: logStartOffsets[tp],
+			Logger:         logger,
+		})
+
+		if err != nil {
+			closeLogs()
+			return err
+		}
+
+		logs[tp] = l
+	}
+
+	// a crash from now on leaves the logs to recover
+	if err = os.Remove(markerPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		closeLogs()
+		return err
+	}
+
+	for tp, l := range logs {
+		m.addLog(tp, l)
+
+		if offset, found := checkpoints[tp]; found {
+			cleanerCheckpoints[tp] = offset
+		}
+	}
+
+	return nil
+}
+
+// addLog serves l as the log of tp, with the observers and the remote tier
+// of the manager.
+func (m *Manager) addLog(tp TopicPartition, l *Log) {
+	l.onFlush = m.onFlush
+	l.remoteStorage = m.remoteStorage
+	l.onStorageError = func(err error) {
+		m.failDir(l.parentDir(), err)
+	}
+
+	m.logs[tp] = l
+}
+
+// Dirs returns the paths of the log directories, in the order of log.dirs.
+func (m *Manager) Dirs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	paths := make([]string, len(m.dirs))
+
+	for i, dir := range m.dirs {
+		paths[i] = dir.path
+	}
+
+	return paths
+}
+
+func (m *Manager) onlineDirs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var paths []string
+
+	for _, dir := range m.dirs {
+		if dir.err == nil {
+			paths = append(paths, dir.path)
+		}
+	}
+
+	return paths
+}
+
+// dir returns the log directory at path, nil when it isn't one.
+func (m *Manager) dir(path string) *logDir {
+	i := slices.IndexFunc(m.dirs, func(dir *logDir) bool { return dir.path == path })
+
+	if i < 0 {
+		return nil
+	}
+
+	return m.dirs[i]
+}
+
+// failDir takes the log directory at path offline after err, closing its
+// logs. The logs of the other directories are still served.
+func (m *Manager) failDir(path string, err error) {
+	m.mu.Lock()
+
+	dir := m.dir(path)
+
+	if dir == nil || dir.err != nil {
+		m.mu.Unlock()
+		return
+	}
+
+	dir.err = err
+
+	var closing []*Log
+
+	for tp, l := range m.logs {
+		if l.parentDir() == path {
+			delete(m.logs, tp)
+			m.offlineLogs[tp] = path
+			closing = append(closing, l)
+		}
+	}
+
+	// the moves from or to the directory are aborted
+	for tp, future := range m.futureLogs {
+		if _, found := m.logs[tp]; !found || future.parentDir() == path {
+			delete(m.futureLogs, tp)
+			closing = append(closing, future)
+		}
+	}
+
+	m.mu.Unlock()
+
+	m.logger.Error("took the log dir offline", "log_dir", path, "logs", len(closing), "error", err)
+
+	for _, l := range closing {
+		l.Close()
+	}
+}
+
+// Config is the broker config the logs are opened with.
+func (m *Manager) Config() Config {
+	return m.config
+}
+
+// Log returns the log of tp, if any.
+func (m *Manager) Log(tp TopicPartition) (*Log, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	l, found := m.logs[tp]
+	return l, found
+}
+
+// Offline tells whether the log of tp is on a log directory taken offline.
+func (m *Manager) Offline(tp TopicPartition) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, found := m.offlineLogs[tp]
+	return found
+}
+
+// Logs returns a copy of the logs by partition.
+func (m *Manager) Logs() map[TopicPartition]*Log {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	logs := make(map[TopicPartition]*Log, len(m.logs))
+
+	for tp, l := range m.logs {
+		logs[tp] = l
+	}
+
+	return logs
+}
+
+// LogDir describes a log directory.
+type LogDir struct {
+	Path string
+	// Err is the IO error the directory was taken offline for, nil when it
+	// is online.
+	Err error
+	// Logs are the logs of the directory, FutureLogs the logs being moved to
+	// it.
+	Logs       map[TopicPartition]*Log
+	FutureLogs map[TopicPartition]*Log
+}
+
+// LogDirs describes the log directories, in the order of log.dirs.
+func (m *Manager) LogDirs() []LogDir {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dirs := make([]LogDir, len(m.dirs))
+
+	for i, dir := range m.dirs {
+		dirs[i] = LogDir{
+			Path:       dir.path,
+			Err:        dir.err,
+			Logs:       make(map[TopicPartition]*Log),
+			FutureLogs: make(map[TopicPartition]*Log),
+		}
+	}
+
+	for i, dir := range m.dirs {
+		for tp, l := range m.logs {
+			if l.parentDir() == dir.path {
+				dirs[i].Logs[tp] = l
+			}
+		}
+
+		for tp, l := range m.futureLogs {
+			if l.parentDir() == dir.path {
+				dirs[i].FutureLogs[tp] = l
+			}
+		}
+	}
+
+	return dirs
+}
+
+// GetOrCreate returns the log of tp, creating it with config when missing:
+// on the directory AlterLogDir asked for, otherwise on the online one
+// holding the fewest logs.
+func (m *Manager) GetOrCreate(tp TopicPartition, config Config) (*Log, error) {
+	l, path, err := m.getOrCreate(tp, config)
+
+	if isStorageError(err) {
+		m.failDir(path, err)
+	}
+
+	return l, err
+}
+
+func (m *Manager) getOrCreate(tp TopicPartition, config Config) (*Log, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, found := m.logs[tp]; found {
+		return l, "", nil
+	}
+
+	if path, found := m.offlineLogs[tp]; found {
+		return nil, "", fmt.Errorf("%w: %s holds %s", ErrLogDirOffline, path, tp)
+	}
+
+	path, err := m.nextDir(tp)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	l, err := Open(filepath.Join(path, tp.String()), config, Recovery{Clean: true, Logger: m.logger})
+
+	if err != nil {
+		return nil, path, err
+	}
+
+	m.addLog(tp, l)
+	delete(m.preferredDirs, tp)
+	m.logger.Info("created log", "topic", tp.Topic, "partition", tp.Partition, "log_dir", path)
+
+	return l, path, nil
+}
+
+// nextDir returns the directory of a new log of tp: the one preferred, or
+// the online one holding the fewest logs, counting the future ones.
+func (m *Manager) nextDir(tp TopicPartition) (string, error) {
+	if path, found := m.preferredDirs[tp]; found {
+		if dir := m.dir(path); dir != nil && dir.err == nil {
+			return path, nil
+		}
+	}
+
+	counts := make(map[string]int)
+
+	for _, l := range m.logs {
+		counts[l.parentDir()]++
+	}
+
+	for _, l := range m.futureLogs {
+		counts[l.parentDir()]++
+	}
+
+	var next *logDir
+
+	for _, dir := range m.dirs {
+		if dir.err == nil && (next == nil || counts[dir.path] < counts[next.path]) {
+			next = dir
+		}
+	}
+
+	if next == nil {
+		return "", fmt.Errorf("%w: every log dir is", ErrLogDirOffline)
+	}
+
+	return next.path, nil
+}
+
+// SetFlushObserver sets the function told how long the flushes of the logs
+// take, like a metric.
+func (m *Manager) SetFlushObserver(onFlush func(elapsed time.Duration)) {
+	m.mu.Lock()
+	m.onFlush = onFlush
+	m.mu.Unlock()
+
+	for _, l := range m.Logs() {
+		l.SetFlushObserver(onFlush)
+	}
+}
+
+// EnableRemoteStorage sets storage as the remote tier of the logs, the ones
+// with remote.storage.enable are copied to it by CopyToRemote.
+func (m *Manager) EnableRemoteStorage(storage RemoteStorageManager) {
+	m.mu.Lock()
+	m.remoteStorage = storage
+	m.mu.Unlock()
+
+	for _, l := range m.Logs() {
+		l.setRemoteStorage(storage)
+	}
+}
+
+// CopyToRemote copies the segments of the tiered logs to the remote tier, see
+// Log.CopyToRemote, and returns the number of segments copied.
+func (m *Manager) CopyToRemote() int {
+	var copied int
+
+	for tp, l := range m.Logs() {
+		count, err := l.CopyToRemote()
+		copied += count
+
+		if err != nil {
+			m.logger.Error("couldn't copy segments to the remote storage", "topic", tp.Topic, "partition", tp.Partition, "error", err)
+		}
+	}
+
+	return copied
+}
+
+// RunRemoteLogManager copies the segments to the remote tier every
+// RemoteLogManagerTaskInterval until ctx is done. The remote segments expire
+// with the retention, see DeleteOldSegments.
+func (m *Manager) RunRemoteLogManager(ctx context.Context) {
+	ticker := time.NewTicker(m.config.RemoteLogManagerTaskInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.CopyToRemote()
+		}
+	}
+}
+
+// CheckpointRecoveryPoints writes the recovery points of the logs.
+func (m *Manager) CheckpointRecoveryPoints() error {
+	recoveryPoints := make(map[TopicPartition]int64)
+
+	for tp, l := range m.Logs() {
+		recoveryPoints[tp] = l.RecoveryPoint()
+	}
+
+	return m.writeCheckpoints(RecoveryPointCheckpointFile, recoveryPoints)
+}
+
+// CheckpointLogStartOffsets writes the log start offsets of the logs.
+func (m *Manager) CheckpointLogStartOffsets() error {
+	logStartOffsets := make(map[TopicPartition]int64)
+
+	for tp, l := range m.Logs() {
+		logStartOffsets[tp] = l.LogStartOffset()
+	}
+
+	return m.writeCheckpoints(LogStartOffsetCheckpointFile, logStartOffsets)
+}
+
+// writeCheckpoints writes offsets to the checkpoint file name of every
+// online directory, each one holding the offsets of its logs. The
+// directories failing to are taken offline.
+func (m *Manager) writeCheckpoints(name string, offsets map[TopicPartition]int64) error {
+	m.checkpointMu.Lock()
+	defer m.checkpointMu.Unlock()
+
+	logs := m.Logs()
+	var err error
+
+	for _, path := range m.onlineDirs() {
+		dirOffsets := make(map[TopicPartition]int64)
+
+		for tp, offset := range offsets {
+			if l, found := logs[tp]; found && l.parentDir() == path {
+				dirOffsets[tp] = offset
+			}
+		}
+
+		if writeErr := writeCheckpoint(filepath.Join(path, name), dirOffsets); writeErr != nil {
+			m.failDir(path, writeErr)
+			err = errors.Join(err, fmt.Errorf("log: %w", writeErr))
+		}
+	}
+
+	return err
+}
+
+func (m *Manager) checkpoint() error {
+	if err := m.CheckpointRecoveryPoints(); err != nil {
+		return err
+	}
+
+	return m.CheckpointLogStartOffsets()
+}
+
+// DeleteOldSegments enforces the retention of every log at now, see
+// Log.DeleteOldSegments, and returns the number of segments deleted.
+func (m *Manager) DeleteOldSegments(now time.Time) int {
+	var deleted int
+
+	for tp, l := range m.Logs() {
+		count, err := l.DeleteOldSegments(now)
+		deleted += count
+
+		if err != nil {
+			m.logger.Error("couldn't enforce the retention", "topic", tp.Topic, "partition", tp.Partition, "error", err)
+		}
+	}
+
+	if deleted == 0 {
+		return 0
+	}
+
+	m.logger.Info("deleted old segments", "segments", deleted)
+
+	if err := m.CheckpointLogStartOffsets(); err != nil {
+		m.logger.Error("couldn't checkpoint the log start offsets", "error", err)
+	}
+
+	return deleted
+}
+
+// RunRetention deletes the old segments every interval, the broker
+// log.retention.check.interval.ms, until ctx is done.
+func (m *Manager) RunRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.DeleteOldSegments(now)
+		}
+	}
+}
+
+// FlushDirtyLogs flushes the logs last flushed flush.ms before now, see
+// Log.FlushIfNeeded, and returns the number of logs flushed.
+func (m *Manager) FlushDirtyLogs(now time.Time) int {
+	var flushed int
+
+	for tp, l := range m.Logs() {
+		ok, err := l.FlushIfNeeded(now)
+
+		if err != nil {
+			m.logger.Error("couldn't flush the log", "topic", tp.Topic, "partition", tp.Partition, "error", err)
+			continue
+		}
+
+		if ok {
+			flushed++
+		}
+	}
+
+	return flushed
+}
+
+// RunFlusher flushes the logs past their flush.ms every
+// FlushSchedulerInterval, and checkpoints their recovery points and log start
+// offsets every FlushOffsetCheckpointInterval and
+// FlushStartOffsetCheckpointInterval, until ctx is done.
+func (m *Manager) RunFlusher(ctx context.Context) {
+	flush := time.NewTicker(m.config.FlushSchedulerInterval)
+	defer flush.Stop()
+
+	recoveryPoints := time.NewTicker(m.config.FlushOffsetCheckpointInterval)
+	defer recoveryPoints.Stop()
+
+	logStartOffsets := time.NewTicker(m.config.FlushStartOffsetCheckpointInterval)
+	defer logStartOffsets.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-flush.C:
+			m.FlushDirtyLogs(now)
+		case <-recoveryPoints.C:
+			if err := m.CheckpointRecoveryPoints(); err != nil {
+				m.logger.Error("couldn't checkpoint the recovery points", "error", err)
+			}
+		case <-logStartOffsets.C:
+			if err := m.CheckpointLogStartOffsets(); err != nil {
+				m.logger.Error("couldn't checkpoint the log start offsets", "error", err)
+			}
+		}
+	}
+}
+
+// StartCleaner starts compacting the logs with the compact cleanup policy in
+// the background, on CleanerThreads goroutines, until Close.
+func (m *Manager) StartCleaner() {
+	if !m.config.CleanerEnable {
+		m.logger.Info("the cleaner is disabled")
+		return
+	}
+
+	m.cleaner.start()
+}
+
+// Compact compacts the dirtiest log at now, over its min.cleanable.dirty.ratio,
+// like the cleaner threads do. It returns nil stats when no log needs it.
+func (m *Manager) Compact(now time.Time) (*CleanerStats, error) {
+	return m.cleaner.cleanDirtiest(context.Background(), newOffsetMap(m.config.CleanerDedupeBufferSize), now)
+}
+
+// Close stops the cleaner and the moves, flushes and closes the logs, then
+// marks the shutdown of the online directories as clean so that the next
+// open skips their recovery.
+func (m *Manager) Close() error {
+	m.cleaner.stop()
+	m.moves.stop()
+
+	var err error
+
+	for tp, l := range m.Logs() {
+		if flushErr := l.Flush(); flushErr != nil {
+			err = errors.Join(err, fmt.Errorf("log: flushing %s: %w", tp, flushErr))
+		}
+	}
+
+	err = errors.Join(err, m.checkpoint(), m.cleaner.checkpoint(), m.closeLogs())
+
+	// the directories taken offline meanwhile are recovered
+	for _, path := range m.onlineDirs() {
+		if markErr := writeFileAtomically(filepath.Join(path, CleanShutdownFile), nil); markErr != nil {
+			err = errors.Join(err, fmt.Errorf("log: %w", markErr))
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.logger.Info("closed logs cleanly")
+
+	return nil
+}
+
+func (m *Manager) closeLogs() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var err error
+
+	for _, l := range m.logs {
+		err = errors.Join(err, l.Close())
+	}
+
+	for _, l := range m.futureLogs {
+		err = errors.Join(err, l.Close())
+	}
+
+	return err
+}
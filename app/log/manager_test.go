@@ -0,0 +1,295 @@
+package log_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+)
+
+var foo0 = log.TopicPartition{Topic: "foo", Partition: 0}
+
+func openManager(t testing.TB, dir string, config log.Config) (*log.Manager, *bytes.Buffer) {
+	t.Helper()
+
+	output := new(bytes.Buffer)
+	m, err := log.OpenManager([]string{dir}, config, slog.New(slog.NewTextHandler(output, nil)))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return m, output
+}
+
+// writeLog appends batches of 3 records to foo-0, on segments of two
+// batches, and leaves it like a crash would: flushed up to the recovery
+// point but without clean shutdown.
+func writeLog(t testing.TB, dir string, config log.Config, batches int) int {
+	t.Helper()
+
+	m, _ := openManager(t, dir, config)
+	l, err := m.GetOrCreate(foo0, config)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	batch := encodeBatch(t, now(), 3)
+
+	for range batches {
+		l.Append(batch, 0)
+	}
+
+	l.Flush()
+	m.CheckpointRecoveryPoints()
+	l.Close()
+
+	return len(batch)
+}
+
+func segmentConfig() log.Config {
+	config := log.DefaultConfig
+	config.SegmentBytes = 1024
+	config.IndexIntervalBytes = 1
+
+	return config
+}
+
+func TestRecoverTornTail(t *testing.T) {
+	dir := t.TempDir()
+	writeLog(t, dir, segmentConfig(), 5)
+
+	segment := filepath.Join(dir, "foo-0", "00000000000000000012.log")
+	torn := encodeBatch(t, now(), 3)
+	file, _ := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0)
+	file.Write(torn[:len(torn)/2])
+	file.Close()
+
+	m, output := openManager(t, dir, segmentConfig())
+	defer m.Close()
+
+	l, _ := m.Log(foo0)
+
+	if l.LogEndOffset() != 15 {
+		t.Fatalf("expected: 15, result: %d", l.LogEndOffset())
+	}
+
+	if !strings.Contains(output.String(), "truncated segment") || !strings.Contains(output.String(), "truncated_bytes="+strconv.Itoa(len(torn)/2)) {
+		t.Fatalf("expected the truncation to be logged, result: %s", output)
+	}
+
+	if info, _ := l.Append(torn, 0); info.FirstOffset != 15 {
+		t.Fatalf("expected: 15, result: %d", info.FirstOffset)
+	}
+}
+
+func TestRecoverCorruptBatch(t *testing.T) {
+	dir := t.TempDir()
+	config := segmentConfig()
+	size := writeLog(t, dir, config, 6)
+
+	// the recovery point is before the corruption
+	checkpoint := filepath.Join(dir, log.RecoveryPointCheckpointFile)
+	os.WriteFile(checkpoint, []byte("0\n1\nfoo 0 6\n"), 0o644)
+
+	segment := filepath.Join(dir, "foo-0", "00000000000000000006.log")
+	data, _ := os.ReadFile(segment)
+	data[size+100]++
+	os.WriteFile(segment, data, 0o644)
+
+	m, output := openManager(t, dir, config)
+	defer m.Close()
+
+	l, _ := m.Log(foo0)
+
+	if l.LogEndOffset() != 9 || l.NumberOfSegments() != 2 {
+		t.Fatalf("expected the log to end at 9 on 2 segments, result: %d on %d", l.LogEndOffset(), l.NumberOfSegments())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "foo-0", "00000000000000000012.index")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the segment after the corruption to be deleted, result: %v", err)
+	}
+
+	if !strings.Contains(output.String(), "deleted segment after a truncation") {
+		t.Fatalf("expected the deletion to be logged, result: %s", output)
+	}
+}
+
+func TestCleanShutdown(t *testing.T) {
+	dir := t.TempDir()
+	config := segmentConfig()
+	m, _ := openManager(t, dir, config)
+	l, _ := m.GetOrCreate(foo0, config)
+
+	for range 5 {
+		l.Append(encodeBatch(t, now(), 3), 0)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, log.CleanShutdownFile)); err != nil {
+		t.Fatalf("expected the clean shutdown marker, result: %v", err)
+	}
+
+	// a missing index is rebuilt even after a clean shutdown
+	os.Remove(filepath.Join(dir, "foo-0", "00000000000000000006.index"))
+
+	m, output := openManager(t, dir, config)
+	defer m.Close()
+
+	// only the segment missing its index is recovered
+	if strings.Count(output.String(), "recovered segment") != 1 {
+		t.Fatalf("expected the recovery to be skipped, result: %s", output)
+	}
+
+	if !strings.Contains(output.String(), "rebuilding the indexes of a segment") {
+		t.Fatalf("expected the index to be rebuilt, result: %s", output)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, log.CleanShutdownFile)); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the marker to be removed, result: %v", err)
+	}
+
+	l, _ = m.Log(foo0)
+	info, err := l.Read(7, 1<<20, log.FetchLogEnd)
+
+	if err != nil || len(readOffsets(t, info.Records)) != 6 || l.LogEndOffset() != 15 {
+		t.Fatalf("unexpected log after reopening: %v %v", readOffsets(t, info.Records), err)
+	}
+}
+
+func TestFlushDirtyLogs(t *testing.T) {
+	dir := t.TempDir()
+	config := segmentConfig()
+	config.FlushMs = time.Hour
+	m, _ := openManager(t, dir, config)
+	defer m.Close()
+
+	var flushes int
+	m.SetFlushObserver(func(time.Duration) { flushes++ })
+
+	for _, tp := range []log.TopicPartition{foo0, {Topic: "foo", Partition: 1}} {
+		l, _ := m.GetOrCreate(tp, config)
+		l.Append(encodeBatch(t, now(), 3), 0)
+	}
+
+	if flushed := m.FlushDirtyLogs(time.Now()); flushed != 0 {
+		t.Fatalf("expected: 0, result: %d", flushed)
+	}
+
+	if flushed := m.FlushDirtyLogs(time.Now().Add(2 * time.Hour)); flushed != 2 || flushes != 2 {
+		t.Fatalf("expected the 2 logs flushed, result: %d after %d flushes", flushed, flushes)
+	}
+
+	if err := m.CheckpointRecoveryPoints(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, log.RecoveryPointCheckpointFile))
+
+	if expected := "0\n2\nfoo 0 3\nfoo 1 3\n"; string(content) != expected {
+		t.Fatalf("expected: %q, result: %q", expected, content)
+	}
+}
+
+func openJBOD(t testing.TB, config log.Config, dirs ...string) *log.Manager {
+	t.Helper()
+
+	m, err := log.OpenManager(dirs, config, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return m
+}
+
+func TestLogDirPlacement(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	m := openJBOD(t, segmentConfig(), dirs...)
+	defer m.Close()
+
+	// the logs go to the directory holding the fewest, the first one on ties
+	for i, expected := range []string{dirs[0], dirs[1], dirs[0]} {
+		l, err := m.GetOrCreate(log.TopicPartition{Topic: "foo", Partition: int32(i)}, segmentConfig())
+
+		if err != nil || filepath.Dir(l.Dir()) != expected {
+			t.Fatalf("expected foo-%d on %s, result: %s %v", i, expected, l.Dir(), err)
+		}
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	m = openJBOD(t, segmentConfig(), dirs...)
+	defer m.Close()
+
+	if logs := m.LogDirs(); len(logs[0].Logs) != 2 || len(logs[1].Logs) != 1 {
+		t.Fatalf("expected the logs reopened from both directories, result: %+v", logs)
+	}
+}
+
+func TestLogDirFailure(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	config := segmentConfig()
+	m := openJBOD(t, config, dirs...)
+	foo1 := log.TopicPartition{Topic: "foo", Partition: 1}
+
+	failing, _ := m.GetOrCreate(foo0, config)
+	healthy, _ := m.GetOrCreate(foo1, config)
+	failing.Append(encodeBatch(t, now(), 3), 0)
+	healthy.Append(encodeBatch(t, now(), 3), 0)
+
+	// the disk of the first directory loses the partition directory
+	os.RemoveAll(failing.Dir())
+
+	if err := failing.Roll(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if _, found := m.Log(foo0); found || !m.Offline(foo0) {
+		t.Fatal("expected the log of the failed directory offline")
+	}
+
+	if logDirs := m.LogDirs(); logDirs[0].Err == nil || logDirs[1].Err != nil {
+		t.Fatalf("expected only the first directory offline, result: %+v", logDirs)
+	}
+
+	if _, err := healthy.Append(encodeBatch(t, now(), 3), 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if l, err := m.GetOrCreate(log.TopicPartition{Topic: "bar", Partition: 0}, config); err != nil || filepath.Dir(l.Dir()) != dirs[1] {
+		t.Fatalf("expected the new log on the online directory, result: %v", err)
+	}
+
+	if _, err := m.GetOrCreate(foo0, config); !errors.Is(err, log.ErrLogDirOffline) {
+		t.Fatalf("expected: %v, result: %v", log.ErrLogDirOffline, err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the directory offline is recovered on the next start
+	if _, err := os.Stat(filepath.Join(dirs[0], log.CleanShutdownFile)); err == nil {
+		t.Fatal("unexpected clean shutdown marker on the failed directory")
+	}
+
+	if _, err := os.Stat(filepath.Join(dirs[1], log.CleanShutdownFile)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
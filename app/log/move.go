@@ -0,0 +1,378 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+// The directories of the logs being moved to another log directory and of
+// the logs moved, named after the partition directory and a unique id, like
+// foo-0.5c0ba5ba8b3f4dc9a6f0e3c4b1d2a7e8-future.
+const (
+	FutureDirSuffix = "-future"
+	DeleteDirSuffix = "-delete"
+)
+
+// moveBatchBytes are the bytes copied at once to a future log.
+const moveBatchBytes = 1 << 20
+
+// errMoveAborted stops the copy to a future log replaced or dropped.
+var errMoveAborted = errors.New("log: move aborted")
+
+// AlterLogDir moves the log of tp to the log directory at path, online: the
+// log is copied to a future log there, which replaces it once caught up. A
+// move to another directory in progress is aborted. For a log not created
+// yet, the directory is remembered and ErrLogNotFound returned.
+func (m *Manager) AlterLogDir(tp TopicPartition, path string) error {
+	path, err := filepath.Abs(path)
+
+	if err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+
+	if err = m.alterLogDir(tp, path); isStorageError(err) {
+		m.failDir(path, err)
+	}
+
+	return err
+}
+
+func (m *Manager) alterLogDir(tp TopicPartition, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if dir := m.dir(path); dir == nil {
+		return fmt.Errorf("%w: %s", ErrLogDirNotFound, path)
+	} else if dir.err != nil {
+		return fmt.Errorf("%w: %s", ErrLogDirOffline, path)
+	}
+
+	if offlinePath, found := m.offlineLogs[tp]; found {
+		return fmt.Errorf("%w: %s holds %s", ErrLogDirOffline, offlinePath, tp)
+	}
+
+	l, found := m.logs[tp]
+
+	if !found {
+		m.preferredDirs[tp] = path
+		return fmt.Errorf("%w: %s", ErrLogNotFound, tp)
+	}
+
+	if future, found := m.futureLogs[tp]; found {
+		if future.parentDir() == path {
+			return nil
+		}
+
+		m.abortMove(tp, future)
+	}
+
+	if l.parentDir() == path {
+		return nil
+	}
+
+	future, err := Open(filepath.Join(path, futureDirName(tp)), l.Config(), Recovery{Clean: true, Logger: m.logger})
+
+	if err != nil {
+		return err
+	}
+
+	m.futureLogs[tp] = future
+	m.moves.start(tp, l, future)
+	m.logger.Info("moving log", "topic", tp.Topic, "partition", tp.Partition, "log_dir", path)
+
+	return nil
+}
+
+func futureDirName(tp TopicPartition) string {
+	return tp.String() + "." + uniqueId() + FutureDirSuffix
+}
+
+func deleteDirName(tp TopicPartition) string {
+	return tp.String() + "." + uniqueId() + DeleteDirSuffix
+}
+
+func uniqueId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// moving tells whether future is still the future log of tp.
+func (m *Manager) moving(tp TopicPartition, future *Log) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.futureLogs[tp] == future
+}
+
+// abortMove drops future, the future log of tp, and its files. The caller
+// holds m.mu.
+func (m *Manager) abortMove(tp TopicPartition, future *Log) {
+	if m.futureLogs[tp] == future {
+		delete(m.futureLogs, tp)
+	}
+
+	future.Close()
+
+	if err := os.RemoveAll(future.dir); err != nil {
+		m.logger.Warn("couldn't remove the future log", "dir", future.dir, "error", err)
+	}
+}
+
+// replaceWithFuture serves future as the log of tp once it copied the last
+// batches of l, the appends to l wait meanwhile, then deletes l. An IO error
+// on the files of either log takes its log directory offline.
+func (m *Manager) replaceWithFuture(tp TopicPartition, l *Log, future *Log) error {
+	path, err := m.replaceLog(tp, l, future)
+
+	if path != "" && isStorageError(err) {
+		m.failDir(path, err)
+	}
+
+	return err
+}
+
+// replaceLog is replaceWithFuture under m.mu. On error, it returns the path
+// of the log directory whose files failed, if known.
+func (m *Manager) replaceLog(tp TopicPartition, l *Log, future *Log) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.logs[tp] != l || m.futureLogs[tp] != future {
+		return "", errMoveAborted
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for caughtUp := false; !caughtUp; {
+		var err error
+
+		if caughtUp, err = future.copyFrom(l, moveBatchBytes); err != nil {
+			return "", err
+		}
+	}
+
+	future.mu.Lock()
+	err := future.flush(time.Now())
+	future.mu.Unlock()
+
+	if err == nil {
+		err = future.Close()
+	}
+
+	if err != nil {
+		return future.parentDir(), err
+	}
+
+	path := filepath.Join(future.parentDir(), tp.String())
+
+	if err = os.Rename(future.dir, path); err != nil {
+		return future.parentDir(), err
+	}
+
+	// the segments on the remote tier stay there
+	if len(l.remoteSegments) > 0 {
+		if err = writeRemoteSegments(path, l.remoteSegments); err != nil {
+			os.RemoveAll(path)
+			return future.parentDir(), err
+		}
+	}
+
+	moved, err := Open(path, l.config, Recovery{Clean: true, LogStartOffset: l.logStartOffset, Logger: m.logger})
+
+	if err != nil {
+		os.RemoveAll(path)
+		return future.parentDir(), err
+	}
+
+	deleted := filepath.Join(l.parentDir(), deleteDirName(tp))
+
+	if err = os.Rename(l.dir, deleted); err != nil {
+		moved.Close()
+		os.RemoveAll(path)
+		return l.parentDir(), err
+	}
+
+	for _, dir := range []string{l.parentDir(), moved.parentDir()} {
+		if err = syncDir(dir); err != nil {
+			m.logger.Warn("couldn't flush the log dir", "log_dir", dir, "error", err)
+		}
+	}
+
+	l.close()
+	m.addLog(tp, moved)
+	delete(m.futureLogs, tp)
+
+	// the reads in progress may still be reading the files
+	time.AfterFunc(l.config.FileDeleteDelay, func() {
+		if err := os.RemoveAll(deleted); err != nil {
+			m.logger.Error("couldn't delete the moved log", "dir", deleted, "error", err)
+		}
+	})
+
+	return "", nil
+}
+
+// copyFrom appends the batches of source from the log end offset of l, or
+// the log start offset of source when after, up to maxBytes. The batches
+// keep their offsets. It tells whether l caught up with source, which the
+// caller holds locked.
+func (l *Log) copyFrom(source *Log, maxBytes int) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, err := source.read(max(l.activeSegment().nextOffset, source.logStartOffset), maxBytes, FetchLogEnd)
+
+	if err != nil {
+		return false, err
+	}
+
+	for data := info.Records; len(data) > 0; {
+		header, err := record.ReadBatch(bytes.NewReader(data))
+
+		if err != nil {
+			return false, fmt.Errorf("log: %w", err)
+		}
+
+		batch := data[:header.Size()]
+		data = data[header.Size():]
+
+		// the batch holding the log start offset may hold offsets copied
+		if header.BaseOffset < l.activeSegment().nextOffset {
+			continue
+		}
+
+		// the offsets before the first local segment of source, deleted or on
+		// the remote tier, aren't copied
+		if len(l.segments) == 1 && l.activeSegment().size == 0 && header.BaseOffset > l.activeSegment().baseOffset {
+			if err = l.startAt(header.BaseOffset); err != nil {
+				return false, err
+			}
+		}
+
+		// the segments are rolled as they were, by the time of the batches
+		if l.activeSegment().shouldRoll(len(batch), header.LastOffset(), time.UnixMilli(header.MaxTimestamp), l.config) {
+			if err = l.roll(); err != nil {
+				return false, err
+			}
+		}
+
+		if err = l.activeSegment().append(batch, header, l.config); err != nil {
+			return false, fmt.Errorf("log: %w", err)
+		}
+	}
+
+	return l.activeSegment().nextOffset >= source.activeSegment().nextOffset, nil
+}
+
+// startAt replaces the only segment of l, empty, with one starting at
+// offset.
+func (l *Log) startAt(offset int64) error {
+	s, err := openSegment(l.dir, offset, l.config)
+
+	if err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+
+	if err = l.segments[0].delete(); err != nil {
+		s.delete()
+		return fmt.Errorf("log: %w", err)
+	}
+
+	l.segments = []*segment{s}
+	l.logStartOffset, l.recoveryPoint, l.highWatermark = offset, offset, offset
+	l.rolled = true
+
+	return nil
+}
+
+// mover copies the logs being moved to their future logs, a goroutine per
+// log, until stop.
+type mover struct {
+	manager *Manager
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newMover(m *Manager) *mover {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &mover{manager: m, ctx: ctx, cancel: cancel}
+}
+
+func (mv *mover) start(tp TopicPartition, l *Log, future *Log) {
+	mv.wg.Add(1)
+
+	go func() {
+		defer mv.wg.Done()
+		mv.move(tp, l, future)
+	}()
+}
+
+// stop interrupts the moves, the future logs are removed on the next open.
+func (mv *mover) stop() {
+	mv.cancel()
+	mv.wg.Wait()
+}
+
+func (mv *mover) move(tp TopicPartition, l *Log, future *Log) {
+	m := mv.manager
+	logger := m.logger.With("topic", tp.Topic, "partition", tp.Partition, "log_dir", future.parentDir())
+	err := mv.copy(tp, l, future)
+
+	if err == nil {
+		err = m.replaceWithFuture(tp, l, future)
+	}
+
+	switch {
+	case err == nil:
+		logger.Info("moved log")
+	case errors.Is(err, errMoveAborted) || mv.ctx.Err() != nil:
+	default:
+		// the move is dropped, an IO error on replacing the log took its log
+		// directory offline already
+		logger.Error("couldn't move log", "error", err)
+
+		m.mu.Lock()
+
+		if m.futureLogs[tp] == future {
+			m.abortMove(tp, future)
+		}
+
+		m.mu.Unlock()
+	}
+}
+
+// copy copies the batches of l to future until it caught up.
+func (mv *mover) copy(tp TopicPartition, l *Log, future *Log) error {
+	for {
+		if err := mv.ctx.Err(); err != nil {
+			return err
+		}
+
+		if !mv.manager.moving(tp, future) {
+			return errMoveAborted
+		}
+
+		l.mu.RLock()
+		caughtUp, err := future.copyFrom(l, moveBatchBytes)
+		l.mu.RUnlock()
+
+		if err != nil || caughtUp {
+			return err
+		}
+	}
+}
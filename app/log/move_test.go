@@ -0,0 +1,194 @@
+package log_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+)
+
+// waitForLogDir waits for the log of tp to be on dir.
+func waitForLogDir(t testing.TB, m *log.Manager, tp log.TopicPartition, dir string) *log.Log {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if l, found := m.Log(tp); found && filepath.Dir(l.Dir()) == dir {
+			return l
+		}
+	}
+
+	t.Fatalf("expected %s moved to %s", tp, dir)
+	return nil
+}
+
+func TestAlterLogDir(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	config := retentionConfig()
+	m := openJBOD(t, config, dirs...)
+	defer m.Close()
+
+	l, _ := m.GetOrCreate(foo0, config)
+
+	for range 5 {
+		l.Append(encodeBatch(t, now(), 3), 0)
+	}
+
+	commit(l)
+	l.DeleteRecordsBefore(4)
+
+	if err := m.AlterLogDir(foo0, dirs[1]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	moved := waitForLogDir(t, m, foo0, dirs[1])
+
+	if moved.LogStartOffset() != 4 || moved.LogEndOffset() != 15 || moved.NumberOfSegments() != 2 {
+		t.Fatalf("unexpected log: %d to %d on %d segments", moved.LogStartOffset(), moved.LogEndOffset(), moved.NumberOfSegments())
+	}
+
+	info, err := moved.Read(4, 1<<20, log.FetchLogEnd)
+
+	if offsets := readOffsets(t, info.Records); err != nil || len(offsets) != 6 || offsets[0] != 3 {
+		t.Fatalf("expected the offsets kept, result: %v %v", offsets, err)
+	}
+
+	if info, _ := moved.Append(encodeBatch(t, now(), 3), 0); info.FirstOffset != 15 {
+		t.Fatalf("expected: 15, result: %d", info.FirstOffset)
+	}
+
+	if _, err = os.Stat(filepath.Join(dirs[0], "foo-0")); err == nil {
+		t.Fatal("expected the log removed from the first directory")
+	}
+
+	if logDirs := m.LogDirs(); len(logDirs[0].Logs) != 0 || len(logDirs[1].Logs) != 1 || len(logDirs[1].FutureLogs) != 0 {
+		t.Fatalf("unexpected log dirs: %+v", logDirs)
+	}
+}
+
+func TestAlterLogDirErrors(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	m := openJBOD(t, segmentConfig(), dirs...)
+	defer m.Close()
+
+	if err := m.AlterLogDir(foo0, t.TempDir()); !errors.Is(err, log.ErrLogDirNotFound) {
+		t.Fatalf("expected: %v, result: %v", log.ErrLogDirNotFound, err)
+	}
+
+	// the log not created yet goes to the directory asked for
+	if err := m.AlterLogDir(foo0, dirs[1]); !errors.Is(err, log.ErrLogNotFound) {
+		t.Fatalf("expected: %v, result: %v", log.ErrLogNotFound, err)
+	}
+
+	if l, _ := m.GetOrCreate(foo0, segmentConfig()); filepath.Dir(l.Dir()) != dirs[1] {
+		t.Fatalf("expected the log on %s, result: %s", dirs[1], l.Dir())
+	}
+
+	if err := m.AlterLogDir(foo0, dirs[1]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestInterruptedMove(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	writeLog(t, dirs[0], segmentConfig(), 3)
+	future := filepath.Join(dirs[1], "foo-0.0123456789abcdef0123456789abcdef"+log.FutureDirSuffix)
+	os.MkdirAll(future, 0o755)
+
+	m := openJBOD(t, segmentConfig(), dirs...)
+	defer m.Close()
+
+	if l, found := m.Log(foo0); !found || filepath.Dir(l.Dir()) != dirs[0] {
+		t.Fatal("expected the log on the first directory")
+	}
+
+	if _, err := os.Stat(future); err == nil {
+		t.Fatal("expected the future log of the interrupted move removed")
+	}
+}
+
+func TestAlterLogDirFailure(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	config := retentionConfig()
+	m := openJBOD(t, config, dirs...)
+	defer m.Close()
+
+	l, err := m.GetOrCreate(foo0, config)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	appendBatch(t, l, encodeBatch(t, now(), 3))
+
+	// the future log can't be renamed over the stray partition directory
+	if err = os.MkdirAll(filepath.Join(dirs[1], "foo-0", "stray"), 0o755); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = m.AlterLogDir(foo0, dirs[1]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); m.LogDirs()[1].Err == nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the second directory offline")
+		}
+	}
+
+	if l, found := m.Log(foo0); !found || filepath.Dir(l.Dir()) != dirs[0] {
+		t.Fatal("expected the log kept on the first directory")
+	}
+
+	if logDirs := m.LogDirs(); logDirs[0].Err != nil || len(logDirs[1].FutureLogs) != 0 {
+		t.Fatalf("unexpected log dirs: %+v", logDirs)
+	}
+}
+
+func TestAlterLogDirWhileAppending(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	config := segmentConfig()
+	m := openJBOD(t, config, dirs...)
+	defer m.Close()
+
+	m.GetOrCreate(foo0, config)
+	batch := encodeBatch(t, now(), 3)
+	done := make(chan struct{})
+
+	// the appends to the log replaced fail, they go to the log moved then
+	go func() {
+		defer close(done)
+
+		for appended := 0; appended < 200; {
+			l, _ := m.Log(foo0)
+
+			if _, err := l.Append(batch, 0); err == nil {
+				appended++
+			}
+		}
+	}()
+
+	if err := m.AlterLogDir(foo0, dirs[1]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	<-done
+	l := waitForLogDir(t, m, foo0, dirs[1])
+
+	if l.LogEndOffset() != 600 {
+		t.Fatalf("expected: 600, result: %d", l.LogEndOffset())
+	}
+
+	for offset := int64(0); offset < 600; {
+		info, err := l.Read(offset, 1<<20, log.FetchLogEnd)
+		offsets := readOffsets(t, info.Records)
+
+		if err != nil || len(offsets) == 0 || offsets[0] != offset {
+			t.Fatalf("expected the records from %d, result: %v %v", offset, offsets, err)
+		}
+
+		offset = offsets[len(offsets)-1] + 1
+	}
+}
@@ -0,0 +1,268 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RemoteLogSegmentsFile lists, in the directory of a log, the segments
+// copied to the remote tier.
+const RemoteLogSegmentsFile = "remote-log-segments"
+
+// ErrRemoteStorage wraps the errors of the remote tier, which don't take the
+// log directories offline.
+var ErrRemoteStorage = errors.New("log: remote storage error")
+
+// RemoteLogSegmentId identifies a copy of a segment on the remote tier, a
+// segment copied again gets a new id.
+type RemoteLogSegmentId struct {
+	TopicPartition TopicPartition
+	Id             string
+}
+
+// RemoteLogSegmentMetadata describes a segment copied to the remote tier.
+type RemoteLogSegmentMetadata struct {
+	Id          RemoteLogSegmentId
+	StartOffset int64
+	// EndOffset is the last offset of the segment.
+	EndOffset    int64
+	MaxTimestamp int64
+	SegmentSize  int64
+}
+
+// LogSegmentData are the paths of the files of a segment being copied to the
+// remote tier.
+type LogSegmentData struct {
+	LogSegment  string
+	OffsetIndex string
+	TimeIndex   string
+}
+
+// IndexType is an index of a segment, on the remote tier.
+type IndexType int8
+
+const (
+	OffsetIndexType IndexType = iota
+	TimeIndexType
+)
+
+// RemoteStorageManager keeps the segments of the remote tier, like the plugins
+// of the tiered storage of Kafka (KIP-405). The log keeps which segments were
+// copied, the storage only holds their files.
+type RemoteStorageManager interface {
+	// CopyLogSegmentData copies the files of a segment, which no longer
+	// changes.
+	CopyLogSegmentData(metadata RemoteLogSegmentMetadata, data LogSegmentData) error
+	// FetchLogSegment reads the segment from startPosition.
+	FetchLogSegment(metadata RemoteLogSegmentMetadata, startPosition int64) (io.ReadCloser, error)
+	// FetchIndex reads an index of the segment.
+	FetchIndex(metadata RemoteLogSegmentMetadata, indexType IndexType) (io.ReadCloser, error)
+	// DeleteLogSegmentData deletes the files of the segment, the ones already
+	// deleted included.
+	DeleteLogSegmentData(metadata RemoteLogSegmentMetadata) error
+}
+
+// remoteError wraps an error of the remote storage in ErrRemoteStorage, its
+// file system errors are no longer told apart from the others.
+func remoteError(err error) error {
+	return fmt.Errorf("%w: %v", ErrRemoteStorage, err)
+}
+
+// FileRemoteStorage is a RemoteStorageManager keeping the segments on a
+// directory, like a mount of a cheaper volume. The files of a segment are
+// copied to the directory of its partition, named after its base offset and
+// its id, like foo-0/00000000000000000042.5c0ba5ba8b3f4dc9a6f0e3c4b1d2a7e8.log.
+type FileRemoteStorage struct {
+	dir string
+}
+
+// NewFileRemoteStorage returns the storage on dir, creating it when missing.
+func NewFileRemoteStorage(dir string) (*FileRemoteStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileRemoteStorage{dir: dir}, nil
+}
+
+func (s *FileRemoteStorage) path(metadata RemoteLogSegmentMetadata, suffix string) string {
+	name := filenamePrefix(metadata.StartOffset) + "." + metadata.Id.Id + suffix
+
+	return filepath.Join(s.dir, metadata.Id.TopicPartition.String(), name)
+}
+
+// CopyLogSegmentData copies the files through temporary files, the .log last,
+// so that a segment whose .log is there is whole.
+func (s *FileRemoteStorage) CopyLogSegmentData(metadata RemoteLogSegmentMetadata, data LogSegmentData) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, metadata.Id.TopicPartition.String()), 0o755); err != nil {
+		return err
+	}
+
+	for _, file := range []struct{ from, suffix string }{
+		{data.OffsetIndex, IndexFileSuffix},
+		{data.TimeIndex, TimeIndexFileSuffix},
+		{data.LogSegment, LogFileSuffix},
+	} {
+		if err := copyFile(file.from, s.path(metadata, file.suffix)); err != nil {
+			s.DeleteLogSegmentData(metadata)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(from string, to string) error {
+	source, err := os.Open(from)
+
+	if err != nil {
+		return err
+	}
+
+	defer source.Close()
+
+	tmp := to + ".tmp"
+	target, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(target, source); err == nil {
+		err = target.Sync()
+	}
+
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, to)
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return syncDir(filepath.Dir(to))
+}
+
+func (s *FileRemoteStorage) FetchLogSegment(metadata RemoteLogSegmentMetadata, startPosition int64) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(metadata, LogFileSuffix))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = file.Seek(startPosition, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (s *FileRemoteStorage) FetchIndex(metadata RemoteLogSegmentMetadata, indexType IndexType) (io.ReadCloser, error) {
+	switch indexType {
+	case OffsetIndexType:
+		return os.Open(s.path(metadata, IndexFileSuffix))
+	case TimeIndexType:
+		return os.Open(s.path(metadata, TimeIndexFileSuffix))
+	default:
+		return nil, fmt.Errorf("log: unknown index type %d", indexType)
+	}
+}
+
+// DeleteLogSegmentData removes the .log first, the segment is gone then.
+func (s *FileRemoteStorage) DeleteLogSegmentData(metadata RemoteLogSegmentMetadata) error {
+	var err error
+
+	for _, suffix := range []string{LogFileSuffix, IndexFileSuffix, TimeIndexFileSuffix} {
+		if removeErr := os.Remove(s.path(metadata, suffix)); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+			err = errors.Join(err, removeErr)
+		}
+	}
+
+	return err
+}
+
+// readRemoteSegments reads the RemoteLogSegmentsFile of dir, like a
+// checkpoint file: the version, the number of segments and the segments as
+// `id start_offset end_offset max_timestamp size` lines. A missing file has
+// no segments.
+func readRemoteSegments(dir string, tp TopicPartition) ([]RemoteLogSegmentMetadata, error) {
+	path := filepath.Join(dir, RemoteLogSegmentsFile)
+	file, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	var lines []string
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(lines) < 2 || lines[0] != strconv.Itoa(checkpointVersion) {
+		return nil, fmt.Errorf("log: malformed %s", path)
+	}
+
+	if count, err := strconv.Atoi(lines[1]); err != nil || count != len(lines)-2 {
+		return nil, fmt.Errorf("log: malformed %s", path)
+	}
+
+	segments := make([]RemoteLogSegmentMetadata, 0, len(lines)-2)
+
+	for _, line := range lines[2:] {
+		fields := strings.Fields(line)
+
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("log: malformed %s entry %q", path, line)
+		}
+
+		metadata := RemoteLogSegmentMetadata{Id: RemoteLogSegmentId{TopicPartition: tp, Id: fields[0]}}
+
+		for i, value := range []*int64{&metadata.StartOffset, &metadata.EndOffset, &metadata.MaxTimestamp, &metadata.SegmentSize} {
+			if *value, err = strconv.ParseInt(fields[i+1], 10, 64); err != nil {
+				return nil, fmt.Errorf("log: malformed %s entry %q", path, line)
+			}
+		}
+
+		segments = append(segments, metadata)
+	}
+
+	return segments, nil
+}
+
+// writeRemoteSegments replaces the RemoteLogSegmentsFile of dir with
+// segments.
+func writeRemoteSegments(dir string, segments []RemoteLogSegmentMetadata) error {
+	var content strings.Builder
+	fmt.Fprintf(&content, "%d\n%d\n", checkpointVersion, len(segments))
+
+	for _, s := range segments {
+		fmt.Fprintf(&content, "%s %d %d %d %d\n", s.Id.Id, s.StartOffset, s.EndOffset, s.MaxTimestamp, s.SegmentSize)
+	}
+
+	return writeFileAtomically(filepath.Join(dir, RemoteLogSegmentsFile), []byte(content.String()))
+}
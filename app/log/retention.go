@@ -0,0 +1,250 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// retentionPolicy deletes the segments for which breached is true.
+type retentionPolicy struct {
+	reason   string
+	breached func(s *segment, upperBound int64) bool
+}
+
+// DeleteOldSegments deletes the segments breaching the retention at now: the
+// ones whose greatest timestamp is older than RetentionMs, the oldest ones
+// while the log is over RetentionBytes, with the delete cleanup policy, and
+// the ones before the log start offset. Only the segments below the high
+// watermark are deleted, the active segment is rolled first when it goes
+// too. For a tiered log, the local segments copied to the remote tier are
+// deleted after LocalRetentionMs and LocalRetentionBytes instead, and the
+// remote segments breaching the retention are. It returns the number of
+// segments deleted.
+func (l *Log) DeleteOldSegments(now time.Time) (_ int, err error) {
+	defer l.report(&err)
+
+	l.mu.Lock()
+
+	policies := []retentionPolicy{
+		{"retention.ms", l.retentionMsBreached(now)},
+		{"retention.bytes", l.retentionBytesBreached()},
+		{"log start offset", l.logStartOffsetBreached},
+	}
+
+	if l.tiered() {
+		policies = []retentionPolicy{
+			{"local.retention.ms", l.localRetentionMsBreached(now)},
+			{"local.retention.bytes", l.localRetentionBytesBreached()},
+			{"log start offset", l.logStartOffsetBreached},
+		}
+	}
+
+	var deleted int
+
+	for _, policy := range policies {
+		count, err := l.deleteSegments(policy.reason, policy.breached)
+		deleted += count
+
+		if err != nil {
+			l.mu.Unlock()
+			return deleted, err
+		}
+	}
+
+	var expired []RemoteLogSegmentMetadata
+
+	if l.tiered() {
+		expired, err = l.expireRemoteSegments(now)
+	}
+
+	storage := l.remoteStorage
+	l.mu.Unlock()
+
+	if err != nil {
+		return deleted, err
+	}
+
+	// the reads in progress of the remote segments fail
+	return deleted + len(expired), deleteRemoteSegments(storage, expired)
+}
+
+func (l *Log) retentionMsBreached(now time.Time) func(*segment, int64) bool {
+	return func(s *segment, _ int64) bool {
+		return l.config.CleanupPolicy.Delete() && l.config.RetentionMs >= 0 && now.UnixMilli()-s.maxTimestamp > l.config.RetentionMs.Milliseconds()
+	}
+}
+
+func (l *Log) retentionBytesBreached() func(*segment, int64) bool {
+	excess := l.size() - l.config.RetentionBytes
+
+	return func(s *segment, _ int64) bool {
+		if !l.config.CleanupPolicy.Delete() || l.config.RetentionBytes < 0 || excess < s.size {
+			return false
+		}
+
+		excess -= s.size
+		return true
+	}
+}
+
+// localRetentionMsBreached and localRetentionBytesBreached are the
+// retention of the local segments of a tiered log, which only deletes the
+// segments copied to the remote tier.
+func (l *Log) localRetentionMsBreached(now time.Time) func(*segment, int64) bool {
+	return func(s *segment, upperBound int64) bool {
+		retention := l.config.localRetentionMs()
+
+		return l.config.CleanupPolicy.Delete() && l.copiedToRemote(upperBound) &&
+			retention >= 0 && now.UnixMilli()-s.maxTimestamp > retention.Milliseconds()
+	}
+}
+
+func (l *Log) localRetentionBytesBreached() func(*segment, int64) bool {
+	excess := l.size() - l.config.localRetentionBytes()
+
+	return func(s *segment, upperBound int64) bool {
+		if !l.config.CleanupPolicy.Delete() || !l.copiedToRemote(upperBound) || l.config.localRetentionBytes() < 0 || excess < s.size {
+			return false
+		}
+
+		excess -= s.size
+		return true
+	}
+}
+
+func (l *Log) logStartOffsetBreached(_ *segment, upperBound int64) bool {
+	return upperBound <= l.logStartOffset
+}
+
+// deleteSegments deletes the oldest segments for which breached is true,
+// until one isn't or holds offsets from the high watermark. breached is
+// given the offset the next segment starts at.
+func (l *Log) deleteSegments(reason string, breached func(s *segment, upperBound int64) bool) (int, error) {
+	count := 0
+
+	for i, s := range l.segments {
+		upperBound := s.nextOffset
+
+		if i+1 < len(l.segments) {
+			upperBound = l.segments[i+1].baseOffset
+		}
+
+		if upperBound > l.highWatermark || s.size == 0 || !breached(s, upperBound) {
+			break
+		}
+
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	// a log keeps a segment, the new active one starts at the log end
+	if count == len(l.segments) {
+		if err := l.roll(); err != nil {
+			return 0, err
+		}
+	}
+
+	deleted := l.segments[:count]
+	l.segments = slices.Clone(l.segments[count:])
+
+	// the segments deleted from a tiered log are still read from the remote tier
+	if !l.tiered() {
+		l.logStartOffset = max(l.logStartOffset, l.segments[0].baseOffset)
+	}
+
+	l.recoveryPoint = max(l.recoveryPoint, l.segments[0].baseOffset)
+
+	var err error
+
+	for _, s := range deleted {
+		l.logger.Info("deleting segment",
+			"base_offset", s.baseOffset, "next_offset", s.nextOffset, "size", s.size, "reason", reason,
+		)
+
+		if markErr := s.markDeleted(); markErr != nil {
+			err = errors.Join(err, fmt.Errorf("log: %w", markErr))
+		}
+
+		l.scheduleDelete(s, l.config.FileDeleteDelay)
+	}
+
+	return count, err
+}
+
+// scheduleDelete removes the files of a deleted segment after delay, the
+// reads in progress may still be reading it until then.
+func (l *Log) scheduleDelete(s *segment, delay time.Duration) {
+	remove := func() {
+		if err := s.delete(); err != nil {
+			l.logger.Error("couldn't delete segment", "base_offset", s.baseOffset, "error", err)
+		}
+	}
+
+	if delay <= 0 {
+		remove()
+		return
+	}
+
+	time.AfterFunc(delay, remove)
+}
+
+// DeleteRecordsBefore moves the log start offset to offset, the high
+// watermark when offset is -1, like DeleteRecords does: the records before
+// it are no longer read and the segments holding only them are deleted, the
+// remote ones by the next DeleteOldSegments. It returns the log start
+// offset, ErrOffsetOutOfRange when offset is after the high watermark.
+func (l *Log) DeleteRecordsBefore(offset int64) (_ int64, err error) {
+	defer l.report(&err)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if offset == -1 {
+		offset = l.highWatermark
+	}
+
+	if offset < 0 || offset > l.highWatermark {
+		return 0, fmt.Errorf("%w: %d not in [0, %d]", ErrOffsetOutOfRange, offset, l.highWatermark)
+	}
+
+	if offset > l.logStartOffset {
+		l.logStartOffset = offset
+		l.logger.Info("moved the log start offset", "log_start_offset", offset)
+	}
+
+	if _, err := l.deleteSegments("log start offset", l.logStartOffsetBreached); err != nil {
+		return l.logStartOffset, err
+	}
+
+	return l.logStartOffset, nil
+}
+
+// removeFiles removes the files of dir ending with one of the suffixes.
+func removeFiles(dir string, suffixes ...string) error {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !slices.ContainsFunc(suffixes, func(suffix string) bool { return strings.HasSuffix(entry.Name(), suffix) }) {
+			continue
+		}
+
+		if err = os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
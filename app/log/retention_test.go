@@ -0,0 +1,165 @@
+package log_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+)
+
+func retentionConfig() log.Config {
+	config := segmentConfig()
+	config.FileDeleteDelay = 0
+
+	return config
+}
+
+// appendBatch appends the encoded batch to l.
+func appendBatch(t testing.TB, l *log.Log, batch []byte) {
+	t.Helper()
+
+	if _, err := l.Append(batch, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// commit moves the high watermark to the log end, as the produce requests
+// do once the records are appended.
+func commit(l *log.Log) {
+	l.UpdateHighWatermark(l.LogEndOffset())
+}
+
+func TestRetentionBytes(t *testing.T) {
+	dir := t.TempDir()
+	config := retentionConfig()
+	batch := encodeBatch(t, now(), 3)
+	config.RetentionBytes = int64(5 * len(batch))
+	l := openLog(t, dir, config)
+
+	for range 10 {
+		appendBatch(t, l, batch)
+	}
+
+	commit(l)
+
+	// the log keeps the 3 newest segments, under 5 batches
+	if deleted, err := l.DeleteOldSegments(time.Now()); err != nil || deleted != 2 {
+		t.Fatalf("expected 2 segments deleted, result: %d %v", deleted, err)
+	}
+
+	if l.LogStartOffset() != 12 || l.NumberOfSegments() != 3 || l.LogEndOffset() != 30 {
+		t.Fatalf("unexpected log: %d to %d on %d segments", l.LogStartOffset(), l.LogEndOffset(), l.NumberOfSegments())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "00000000000000000006.log")); err == nil {
+		t.Fatal("expected the segment files to be removed")
+	}
+
+	if _, err := l.Read(6, 1<<20, log.FetchLogEnd); !errors.Is(err, log.ErrOffsetOutOfRange) {
+		t.Fatalf("expected: %v, result: %v", log.ErrOffsetOutOfRange, err)
+	}
+}
+
+func TestRetentionMs(t *testing.T) {
+	config := retentionConfig()
+	config.RetentionMs = time.Hour
+	l := openLog(t, t.TempDir(), config)
+	old := encodeBatch(t, time.Now().Add(-2*time.Hour).UnixMilli(), 3)
+
+	for range 4 {
+		appendBatch(t, l, old)
+	}
+
+	appendBatch(t, l, encodeBatch(t, now(), 3))
+	commit(l)
+
+	if deleted, err := l.DeleteOldSegments(time.Now()); err != nil || deleted != 2 || l.LogStartOffset() != 12 {
+		t.Fatalf("expected the 2 old segments deleted, result: %d, starting at %d, %v", deleted, l.LogStartOffset(), err)
+	}
+
+	// once every segment expired, the log starts over on a new segment
+	if deleted, err := l.DeleteOldSegments(time.Now().Add(2 * time.Hour)); err != nil || deleted != 1 {
+		t.Fatalf("expected: 1, result: %d %v", deleted, err)
+	}
+
+	if l.LogStartOffset() != 15 || l.LogEndOffset() != 15 || l.NumberOfSegments() != 1 {
+		t.Fatalf("expected an empty log at 15, result: %d to %d", l.LogStartOffset(), l.LogEndOffset())
+	}
+
+	if info, err := l.Append(old, 0); err != nil || info.FirstOffset != 15 {
+		t.Fatalf("expected: 15, result: %+v %v", info, err)
+	}
+}
+
+func TestRetentionBelowHighWatermark(t *testing.T) {
+	config := retentionConfig()
+	config.RetentionBytes = 0
+	l := openLog(t, t.TempDir(), config)
+
+	for range 6 {
+		appendBatch(t, l, encodeBatch(t, now(), 3))
+	}
+
+	l.UpdateHighWatermark(7)
+
+	if deleted, err := l.DeleteOldSegments(time.Now()); err != nil || deleted != 1 || l.LogStartOffset() != 6 {
+		t.Fatalf("expected the segment below the high watermark deleted, result: %d %v", deleted, err)
+	}
+}
+
+func TestDeleteRecordsBefore(t *testing.T) {
+	dir := t.TempDir()
+	config := retentionConfig()
+	config.FileDeleteDelay = time.Hour
+	m, _ := openManager(t, dir, config)
+	l, err := m.GetOrCreate(foo0, config)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for range 10 {
+		appendBatch(t, l, encodeBatch(t, now(), 3))
+	}
+
+	commit(l)
+
+	if lowWatermark, err := l.DeleteRecordsBefore(13); err != nil || lowWatermark != 13 {
+		t.Fatalf("expected: 13, result: %d %v", lowWatermark, err)
+	}
+
+	if l.NumberOfSegments() != 3 {
+		t.Fatalf("expected the 2 segments before 12 deleted, result: %d segments", l.NumberOfSegments())
+	}
+
+	// the files are kept for the reads in progress
+	if _, err := os.Stat(filepath.Join(dir, "foo-0", "00000000000000000000.log"+log.DeletedFileSuffix)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := l.DeleteRecordsBefore(31); !errors.Is(err, log.ErrOffsetOutOfRange) {
+		t.Fatalf("expected: %v, result: %v", log.ErrOffsetOutOfRange, err)
+	}
+
+	if info, err := l.Read(13, 1<<20, log.FetchLogEnd); err != nil || readOffsets(t, info.Records)[0] != 12 {
+		t.Fatalf("expected the batch holding 13, result: %v", err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	m, _ = openManager(t, dir, config)
+	defer m.Close()
+
+	if l, found := m.Log(foo0); !found || l.LogStartOffset() != 13 {
+		t.Fatalf("expected the log start offset checkpointed, result: %v", l)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "foo-0", "00000000000000000000.log"+log.DeletedFileSuffix)); err == nil {
+		t.Fatal("expected the deleted files to be removed on open")
+	}
+}
@@ -0,0 +1,521 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+// The files of a segment are named after its base offset, zero padded to
+// 20 digits, with these suffixes.
+const (
+	LogFileSuffix       = ".log"
+	IndexFileSuffix     = ".index"
+	TimeIndexFileSuffix = ".timeindex"
+	// DeletedFileSuffix is appended to the files of the segments waiting to
+	// be removed.
+	DeletedFileSuffix = ".deleted"
+	// CleanedFileSuffix is appended to the files of a segment being written
+	// by the cleaner.
+	CleanedFileSuffix = ".cleaned"
+	// SwapFileSuffix is appended to the files of a cleaned segment while it
+	// replaces the segments it was cleaned from.
+	SwapFileSuffix = ".swap"
+)
+
+// filenamePrefix is the name of the files of the segment starting at offset.
+func filenamePrefix(offset int64) string {
+	return fmt.Sprintf("%020d", offset)
+}
+
+// segment is a .log file holding the batches from baseOffset to nextOffset,
+// with its indexes.
+type segment struct {
+	baseOffset int64
+	path       string
+	file       *os.File
+	size       int64
+
+	offsetIndex *offsetIndex
+	timeIndex   *timeIndex
+
+	nextOffset int64
+	// maxTimestamp is the greatest timestamp of the segment, -1 when empty.
+	maxTimestamp         int64
+	offsetOfMaxTimestamp int64
+	// firstTimestamp is the timestamp of the first batch, which segment.ms
+	// counts from, -1 when empty.
+	firstTimestamp int64
+	// bytesSinceIndexEntry are the bytes appended since the last entry of
+	// the offset index.
+	bytesSinceIndexEntry int
+}
+
+// openSegment opens the segment of dir starting at baseOffset, creating its
+// files when missing. It is read by load or recover before use.
+func openSegment(dir string, baseOffset int64, config Config) (*segment, error) {
+	return openSegmentWithSuffix(dir, baseOffset, "", config)
+}
+
+// openSegmentWithSuffix opens a segment whose files have suffix appended.
+func openSegmentWithSuffix(dir string, baseOffset int64, suffix string, config Config) (s *segment, err error) {
+	prefix := filepath.Join(dir, filenamePrefix(baseOffset))
+	s = &segment{
+		baseOffset:     baseOffset,
+		path:           prefix + LogFileSuffix + suffix,
+		nextOffset:     baseOffset,
+		maxTimestamp:   -1,
+		firstTimestamp: -1,
+	}
+
+	if s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+
+	info, err := s.file.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.size = info.Size()
+
+	if s.offsetIndex, err = openOffsetIndex(prefix+IndexFileSuffix+suffix, baseOffset, config.SegmentIndexBytes); err != nil {
+		return nil, err
+	}
+
+	if s.timeIndex, err = openTimeIndex(prefix+TimeIndexFileSuffix+suffix, baseOffset, config.SegmentIndexBytes); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load trusts the segment and its indexes, it only reads the batches after
+// the last entry of the offset index, the ones the indexes don't tell about.
+// It fails when the indexes don't look right, the segment is recovered then.
+func (s *segment) load() error {
+	if s.size > 0 && (s.offsetIndex.created || s.timeIndex.created) {
+		return errors.New("missing index")
+	}
+
+	if err := s.offsetIndex.sanityCheck(s.size); err != nil {
+		return err
+	}
+
+	if entry, found := s.timeIndex.last(); found {
+		s.maxTimestamp, s.offsetOfMaxTimestamp = entry.timestamp, entry.offset
+	}
+
+	if s.size > 0 {
+		header, err := s.readHeader(0)
+
+		if err != nil {
+			return err
+		}
+
+		s.firstTimestamp = header.MaxTimestamp
+	}
+
+	var position int64
+
+	if entry, found := s.offsetIndex.last(); found {
+		position = entry.position
+	}
+
+	for position < s.size {
+		header, err := s.readHeader(position)
+
+		if err != nil {
+			return err
+		}
+
+		s.updateMaxTimestamp(header)
+		s.nextOffset = header.NextOffset()
+		position += int64(header.Size())
+	}
+
+	if entry, found := s.offsetIndex.last(); found {
+		s.bytesSinceIndexEntry = int(s.size - entry.position)
+	} else {
+		s.bytesSinceIndexEntry = int(s.size)
+	}
+
+	return s.timeIndex.sanityCheck(s.nextOffset)
+}
+
+// repair is what recover repaired on a segment.
+type repair struct {
+	// truncatedBytes were cut from the end of the segment because of cause.
+	truncatedBytes int64
+	cause          error
+}
+
+// recover checks every batch of the segment, truncating it at the first
+// invalid one, and rebuilds its indexes.
+func (s *segment) recover(config Config) (repair repair, err error) {
+	if err = s.offsetIndex.reset(); err != nil {
+		return repair, err
+	}
+
+	if err = s.timeIndex.reset(); err != nil {
+		return repair, err
+	}
+
+	s.nextOffset, s.maxTimestamp, s.firstTimestamp, s.bytesSinceIndexEntry = s.baseOffset, -1, -1, 0
+
+	var position int64
+
+	for position < s.size {
+		header, err := s.readBatch(position)
+
+		if err == nil && header.BaseOffset < s.nextOffset {
+			err = fmt.Errorf("%s at %d: %w: offset %d after %d", s.path, position, record.ErrCorruptBatch, header.BaseOffset, s.nextOffset)
+		}
+
+		if errors.Is(err, record.ErrCorruptBatch) || errors.Is(err, record.ErrUnsupportedMagic) || errors.Is(err, io.ErrUnexpectedEOF) {
+			repair.cause = err
+			break
+		}
+
+		if err != nil {
+			return repair, err
+		}
+
+		if err = s.index(header, position, config); err != nil {
+			return repair, err
+		}
+
+		position += int64(header.Size())
+	}
+
+	if repair.truncatedBytes = s.size - position; repair.truncatedBytes > 0 {
+		if err = s.file.Truncate(position); err != nil {
+			return repair, err
+		}
+
+		s.size = position
+	}
+
+	return repair, nil
+}
+
+// readBatch reads the batch at position, checking its length and CRC, and
+// returns its header.
+func (s *segment) readBatch(position int64) (*record.Batch, error) {
+	header, err := s.readHeader(position)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, header.Size())
+
+	if _, err = s.file.ReadAt(data, position); err != nil {
+		return nil, err
+	}
+
+	if header, err = record.CheckBatch(data); err != nil {
+		return nil, fmt.Errorf("%s at %d: %w", s.path, position, err)
+	}
+
+	return header, nil
+}
+
+// forEachBatch calls fn with the position and the header of every batch of
+// the segment, in order, until fn fails.
+func (s *segment) forEachBatch(fn func(position int64, header *record.Batch) error) error {
+	for position := int64(0); position < s.size; {
+		header, err := s.readHeader(position)
+
+		if err != nil {
+			return err
+		}
+
+		if err = fn(position, header); err != nil {
+			return err
+		}
+
+		position += int64(header.Size())
+	}
+
+	return nil
+}
+
+// readData returns the whole batch at position, whose header was read.
+func (s *segment) readData(position int64, header *record.Batch) ([]byte, error) {
+	data := make([]byte, header.Size())
+
+	if _, err := s.file.ReadAt(data, position); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *segment) updateMaxTimestamp(header *record.Batch) {
+	if header.MaxTimestamp > s.maxTimestamp {
+		s.maxTimestamp, s.offsetOfMaxTimestamp = header.MaxTimestamp, header.LastOffset()
+	}
+}
+
+// readHeader reads the header of the batch at position, io.EOF at the end
+// of the segment.
+func (s *segment) readHeader(position int64) (*record.Batch, error) {
+	if position >= s.size {
+		return nil, io.EOF
+	}
+
+	data := make([]byte, record.BatchHeaderSize)
+
+	if _, err := s.file.ReadAt(data, position); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s at %d: %w", s.path, position, io.ErrUnexpectedEOF)
+		}
+
+		return nil, err
+	}
+
+	header, err := record.DecodeHeader(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s at %d: %w", s.path, position, err)
+	}
+
+	if position+int64(header.Size()) > s.size {
+		return nil, fmt.Errorf("%s at %d: %w", s.path, position, io.ErrUnexpectedEOF)
+	}
+
+	return header, nil
+}
+
+// append writes the batch encoded as data, whose offsets are assigned.
+func (s *segment) append(data []byte, header *record.Batch, config Config) error {
+	position := s.size
+
+	if _, err := s.file.Write(data); err != nil {
+		return err
+	}
+
+	s.size += int64(len(data))
+
+	return s.index(header, position, config)
+}
+
+// index accounts for the batch at position, appending the index entries
+// every IndexIntervalBytes.
+func (s *segment) index(header *record.Batch, position int64, config Config) error {
+	s.nextOffset = header.NextOffset()
+	s.updateMaxTimestamp(header)
+
+	if s.firstTimestamp < 0 {
+		s.firstTimestamp = header.MaxTimestamp
+	}
+
+	if s.bytesSinceIndexEntry > config.IndexIntervalBytes {
+		if err := s.offsetIndex.append(header.LastOffset(), position); err != nil {
+			return err
+		}
+
+		if err := s.timeIndex.maybeAppend(s.maxTimestamp, s.offsetOfMaxTimestamp); err != nil {
+			return err
+		}
+
+		s.bytesSinceIndexEntry = 0
+	}
+
+	s.bytesSinceIndexEntry += header.Size()
+
+	return nil
+}
+
+// shouldRoll tells whether a batch of size bytes ending at lastOffset goes
+// to a new segment.
+func (s *segment) shouldRoll(size int, lastOffset int64, now time.Time, config Config) bool {
+	if s.size == 0 {
+		return false
+	}
+
+	return s.size+int64(size) > config.SegmentBytes ||
+		(s.firstTimestamp >= 0 && now.UnixMilli()-s.firstTimestamp >= config.SegmentMs.Milliseconds()) ||
+		s.offsetIndex.isFull() ||
+		s.timeIndex.isFull() ||
+		lastOffset-s.baseOffset > math.MaxInt32
+}
+
+// onRoll indexes the greatest timestamp of the segment, which no longer
+// receives batches.
+func (s *segment) onRoll() error {
+	if s.maxTimestamp < 0 {
+		return nil
+	}
+
+	return s.timeIndex.maybeAppend(s.maxTimestamp, s.offsetOfMaxTimestamp)
+}
+
+// find returns the position and header of the batch holding offset, io.EOF
+// when the segment ends before it.
+func (s *segment) find(offset int64) (int64, *record.Batch, error) {
+	position := s.offsetIndex.lookup(offset)
+
+	for {
+		header, err := s.readHeader(position)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if header.LastOffset() >= offset {
+			return position, header, nil
+		}
+
+		position += int64(header.Size())
+	}
+}
+
+// read returns the whole batches from position, up to maxPosition, until
+// they take more than maxBytes. The first batch is returned whatever its
+// size so that the readers make progress.
+func (s *segment) read(position int64, maxPosition int64, maxBytes int) ([]byte, error) {
+	end := position
+
+	for end < maxPosition {
+		header, err := s.readHeader(end)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if end > position && end-position+int64(header.Size()) > int64(maxBytes) {
+			break
+		}
+
+		end += int64(header.Size())
+	}
+
+	data := make([]byte, end-position)
+
+	if _, err := s.file.ReadAt(data, position); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// findTimestamp returns the first offset from startOffset whose timestamp is
+// timestamp or later, io.EOF when there is none on the segment.
+func (s *segment) findTimestamp(timestamp int64, startOffset int64) (int64, int64, error) {
+	from := startOffset
+
+	if offset, found := s.timeIndex.lookup(timestamp); found {
+		from = max(from, offset)
+	}
+
+	position := s.offsetIndex.lookup(from)
+
+	for {
+		header, err := s.readHeader(position)
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if header.MaxTimestamp >= timestamp && header.LastOffset() >= startOffset {
+			data := make([]byte, header.Size())
+
+			if _, err = s.file.ReadAt(data, position); err != nil {
+				return 0, 0, err
+			}
+
+			batch, err := record.DecodeBatch(data)
+
+			if err != nil {
+				return 0, 0, fmt.Errorf("%s at %d: %w", s.path, position, err)
+			}
+
+			for i := range batch.Records {
+				offset := batch.BaseOffset + int64(batch.Records[i].OffsetDelta)
+
+				if recordTimestamp := batch.Timestamp(&batch.Records[i]); offset >= startOffset && recordTimestamp >= timestamp {
+					return offset, recordTimestamp, nil
+				}
+			}
+		}
+
+		position += int64(header.Size())
+	}
+}
+
+func (s *segment) flush() error {
+	for _, file := range []*os.File{s.file, s.offsetIndex.file, s.timeIndex.file} {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markDeleted appends DeletedFileSuffix to the files of the segment, which
+// stay open for the reads in progress until delete.
+func (s *segment) markDeleted() error {
+	return s.changeSuffix("", DeletedFileSuffix)
+}
+
+// changeSuffix renames the files of the segment, replacing their suffix.
+func (s *segment) changeSuffix(from string, to string) error {
+	paths := []*string{&s.path, &s.offsetIndex.path, &s.timeIndex.path}
+
+	for _, path := range paths {
+		renamed := strings.TrimSuffix(*path, from) + to
+
+		if err := os.Rename(*path, renamed); err != nil {
+			return err
+		}
+
+		*path = renamed
+	}
+
+	return nil
+}
+
+// delete closes the segment and removes its files.
+func (s *segment) delete() error {
+	err := s.close()
+
+	for _, path := range []string{s.path, s.offsetIndex.path, s.timeIndex.path} {
+		if removeErr := os.Remove(path); !errors.Is(removeErr, fs.ErrNotExist) {
+			err = errors.Join(err, removeErr)
+		}
+	}
+
+	return err
+}
+
+func (s *segment) close() error {
+	err := s.file.Close()
+
+	if s.offsetIndex != nil {
+		err = errors.Join(err, s.offsetIndex.close())
+	}
+
+	if s.timeIndex != nil {
+		err = errors.Join(err, s.timeIndex.close())
+	}
+
+	return err
+}
@@ -0,0 +1,393 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+// The tiered storage keeps the old segments of the logs with
+// remote.storage.enable on the remote tier, like KIP-405: the segments rolled
+// and committed are copied there, then deleted from the log directory after
+// local.retention.ms or local.retention.bytes, while retention.ms and
+// retention.bytes apply to the log as a whole. The reads before the first
+// local segment are served by the remote tier.
+
+// tiered tells whether the segments of the log are copied to the remote tier.
+// The compacted logs aren't, their segments change.
+func (l *Log) tiered() bool {
+	return l.remoteStorage != nil && l.config.RemoteStorageEnable && !l.config.CleanupPolicy.Compact()
+}
+
+// topicPartition is the partition of the log, after the name of its
+// directory.
+func (l *Log) topicPartition() TopicPartition {
+	topic, partition, _ := ParseDirName(filepath.Base(l.dir))
+
+	return TopicPartition{Topic: topic, Partition: partition}
+}
+
+// setRemoteStorage sets the remote tier of the log.
+func (l *Log) setRemoteStorage(storage RemoteStorageManager) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.remoteStorage = storage
+}
+
+// RemoteSegments returns the segments copied to the remote tier, by offset.
+func (l *Log) RemoteSegments() []RemoteLogSegmentMetadata {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return slices.Clone(l.remoteSegments)
+}
+
+// copiedToRemote tells whether the offsets before upperBound are on the
+// remote tier.
+func (l *Log) copiedToRemote(upperBound int64) bool {
+	return len(l.remoteSegments) > 0 && upperBound-1 <= l.remoteSegments[len(l.remoteSegments)-1].EndOffset
+}
+
+// CopyToRemote copies to the remote tier, in order, the segments rolled whose
+// offsets are below the high watermark and not copied yet. The log isn't
+// locked during the copies. It returns the number of segments copied.
+func (l *Log) CopyToRemote() (copied int, err error) {
+	defer l.report(&err)
+
+	for {
+		metadata, data, found, err := l.nextSegmentToCopy()
+
+		if err != nil || !found {
+			return copied, err
+		}
+
+		l.mu.RLock()
+		storage := l.remoteStorage
+		l.mu.RUnlock()
+
+		if err = storage.CopyLogSegmentData(metadata, data); err != nil {
+			return copied, remoteError(err)
+		}
+
+		if added, err := l.addRemoteSegment(metadata); !added {
+			// the log was moved or the segment deleted meanwhile
+			if deleteErr := storage.DeleteLogSegmentData(metadata); deleteErr != nil {
+				l.logger.Warn("couldn't delete a remote segment", "id", metadata.Id.Id, "error", deleteErr)
+			}
+
+			return copied, err
+		}
+
+		l.logger.Info("copied segment to the remote storage",
+			"base_offset", metadata.StartOffset, "end_offset", metadata.EndOffset, "size", metadata.SegmentSize,
+		)
+
+		copied++
+	}
+}
+
+// nextSegmentToCopy returns the next segment to copy to the remote tier,
+// flushed, and its files.
+func (l *Log) nextSegmentToCopy() (RemoteLogSegmentMetadata, LogSegmentData, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.tiered() || l.closed {
+		return RemoteLogSegmentMetadata{}, LogSegmentData{}, false, nil
+	}
+
+	for _, s := range l.segments[:len(l.segments)-1] {
+		if s.size == 0 || s.nextOffset <= l.logStartOffset || l.copiedToRemote(s.nextOffset) {
+			continue
+		}
+
+		if s.nextOffset > l.highWatermark {
+			break
+		}
+
+		if err := s.flush(); err != nil {
+			return RemoteLogSegmentMetadata{}, LogSegmentData{}, false, fmt.Errorf("log: %w", err)
+		}
+
+		metadata := RemoteLogSegmentMetadata{
+			Id:           RemoteLogSegmentId{TopicPartition: l.topicPartition(), Id: uniqueId()},
+			StartOffset:  s.baseOffset,
+			EndOffset:    s.nextOffset - 1,
+			MaxTimestamp: s.maxTimestamp,
+			SegmentSize:  s.size,
+		}
+
+		return metadata, LogSegmentData{s.path, s.offsetIndex.path, s.timeIndex.path}, true, nil
+	}
+
+	return RemoteLogSegmentMetadata{}, LogSegmentData{}, false, nil
+}
+
+// addRemoteSegment records the segment copied, unless the log changed during
+// the copy.
+func (l *Log) addRemoteSegment(metadata RemoteLogSegmentMetadata) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed || metadata.EndOffset < l.logStartOffset || l.copiedToRemote(metadata.EndOffset+1) {
+		return false, nil
+	}
+
+	segments := append(slices.Clone(l.remoteSegments), metadata)
+
+	if err := writeRemoteSegments(l.dir, segments); err != nil {
+		return false, fmt.Errorf("log: %w", err)
+	}
+
+	l.remoteSegments = segments
+
+	return true, nil
+}
+
+// expireRemoteSegments drops the oldest remote segments breaching the
+// retention at now: the ones whose greatest timestamp is older than
+// RetentionMs, the ones taking the log over RetentionBytes and the ones
+// before the log start offset. The log start offset moves past them. The
+// caller holds the log and deletes their files.
+func (l *Log) expireRemoteSegments(now time.Time) ([]RemoteLogSegmentMetadata, error) {
+	size := l.size()
+
+	// the segments on both tiers count once
+	for _, s := range l.segments {
+		if l.copiedToRemote(s.nextOffset) {
+			size -= s.size
+		}
+	}
+
+	for _, rs := range l.remoteSegments {
+		size += rs.SegmentSize
+	}
+
+	excess := size - l.config.RetentionBytes
+	count := 0
+
+	for _, rs := range l.remoteSegments {
+		breached := rs.EndOffset < l.logStartOffset ||
+			(l.config.RetentionMs >= 0 && now.UnixMilli()-rs.MaxTimestamp > l.config.RetentionMs.Milliseconds()) ||
+			(l.config.RetentionBytes >= 0 && excess >= rs.SegmentSize)
+
+		if !breached {
+			break
+		}
+
+		excess -= rs.SegmentSize
+		count++
+	}
+
+	if count == 0 {
+		return nil, nil
+	}
+
+	remaining := slices.Clone(l.remoteSegments[count:])
+
+	if err := writeRemoteSegments(l.dir, remaining); err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+
+	expired := l.remoteSegments[:count]
+	l.remoteSegments = remaining
+	firstOffset := l.segments[0].baseOffset
+
+	if len(remaining) > 0 {
+		firstOffset = min(firstOffset, remaining[0].StartOffset)
+	}
+
+	l.logStartOffset = min(max(l.logStartOffset, firstOffset), l.activeSegment().nextOffset)
+
+	for _, rs := range expired {
+		l.logger.Info("deleting remote segment",
+			"base_offset", rs.StartOffset, "end_offset", rs.EndOffset, "size", rs.SegmentSize,
+		)
+	}
+
+	return expired, nil
+}
+
+// deleteRemoteSegments deletes the files of the remote segments expired.
+func deleteRemoteSegments(storage RemoteStorageManager, segments []RemoteLogSegmentMetadata) error {
+	var err error
+
+	for _, rs := range segments {
+		if deleteErr := storage.DeleteLogSegmentData(rs); deleteErr != nil {
+			err = errors.Join(err, remoteError(deleteErr))
+		}
+	}
+
+	return err
+}
+
+// remoteSegment returns the remote segment to read offset from, when it is
+// before the local segments.
+func (l *Log) remoteSegment(offset int64) (RemoteLogSegmentMetadata, bool) {
+	if l.remoteStorage == nil || offset < l.logStartOffset || offset >= l.segments[0].baseOffset {
+		return RemoteLogSegmentMetadata{}, false
+	}
+
+	i, _ := slices.BinarySearchFunc(l.remoteSegments, offset, func(rs RemoteLogSegmentMetadata, offset int64) int {
+		return int(min(max(rs.EndOffset-offset, -1), 1))
+	})
+
+	if i == len(l.remoteSegments) {
+		return RemoteLogSegmentMetadata{}, false
+	}
+
+	return l.remoteSegments[i], true
+}
+
+// readRemote returns whole batches of a remote segment from the one holding
+// offset, until they take more than maxBytes, at least one batch though.
+func readRemote(storage RemoteStorageManager, metadata RemoteLogSegmentMetadata, offset int64, maxBytes int) ([]byte, error) {
+	index, err := fetchOffsetIndex(storage, metadata)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var records []byte
+
+	err = forEachRemoteBatch(storage, metadata, index.lookup(offset), func(header *record.Batch, data []byte) bool {
+		if header.LastOffset() < offset {
+			return true
+		}
+
+		if len(records) > 0 && len(records)+len(data) > maxBytes {
+			return false
+		}
+
+		records = append(records, data...)
+
+		return true
+	})
+
+	return records, err
+}
+
+// findRemoteTimestamp returns the first offset of a remote segment from
+// startOffset whose timestamp is timestamp or later, and that timestamp.
+func findRemoteTimestamp(storage RemoteStorageManager, metadata RemoteLogSegmentMetadata, timestamp int64, startOffset int64) (int64, int64, bool, error) {
+	from := startOffset
+	reader, err := storage.FetchIndex(metadata, TimeIndexType)
+
+	if err != nil {
+		return 0, 0, false, remoteError(err)
+	}
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+
+	if err != nil {
+		return 0, 0, false, remoteError(err)
+	}
+
+	timeIndex := &timeIndex{entries: parseTimeEntries(data, metadata.StartOffset)}
+
+	if offset, found := timeIndex.lookup(timestamp); found {
+		from = max(from, offset)
+	}
+
+	index, err := fetchOffsetIndex(storage, metadata)
+
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	var offset, recordTimestamp int64
+	var found bool
+	var decodeErr error
+
+	err = forEachRemoteBatch(storage, metadata, index.lookup(from), func(header *record.Batch, data []byte) bool {
+		if header.MaxTimestamp < timestamp || header.LastOffset() < startOffset {
+			return true
+		}
+
+		var batch *record.Batch
+
+		if batch, decodeErr = record.DecodeBatch(data); decodeErr != nil {
+			decodeErr = fmt.Errorf("log: remote segment %s: %w", metadata.Id.Id, decodeErr)
+			return false
+		}
+
+		for i := range batch.Records {
+			offset = batch.BaseOffset + int64(batch.Records[i].OffsetDelta)
+
+			if recordTimestamp = batch.Timestamp(&batch.Records[i]); offset >= startOffset && recordTimestamp >= timestamp {
+				found = true
+				return false
+			}
+		}
+
+		return true
+	})
+
+	return offset, recordTimestamp, found, errors.Join(err, decodeErr)
+}
+
+func fetchOffsetIndex(storage RemoteStorageManager, metadata RemoteLogSegmentMetadata) (*offsetIndex, error) {
+	reader, err := storage.FetchIndex(metadata, OffsetIndexType)
+
+	if err != nil {
+		return nil, remoteError(err)
+	}
+
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+
+	if err != nil {
+		return nil, remoteError(err)
+	}
+
+	return &offsetIndex{baseOffset: metadata.StartOffset, entries: parseOffsetEntries(data, metadata.StartOffset)}, nil
+}
+
+// forEachRemoteBatch calls fn with the header and the data of every batch of
+// a remote segment from position, in order, until fn returns false.
+func forEachRemoteBatch(storage RemoteStorageManager, metadata RemoteLogSegmentMetadata, position int64, fn func(header *record.Batch, data []byte) bool) error {
+	reader, err := storage.FetchLogSegment(metadata, position)
+
+	if err != nil {
+		return remoteError(err)
+	}
+
+	defer reader.Close()
+
+	buffered := bufio.NewReader(reader)
+
+	for {
+		data := make([]byte, record.BatchHeaderSize)
+
+		if _, err = io.ReadFull(buffered, data); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return remoteError(err)
+		}
+
+		header, err := record.DecodeHeader(data)
+
+		if err != nil {
+			return fmt.Errorf("log: remote segment %s: %w", metadata.Id.Id, err)
+		}
+
+		data = append(data, make([]byte, header.Size()-len(data))...)
+
+		if _, err = io.ReadFull(buffered, data[record.BatchHeaderSize:]); err != nil {
+			return remoteError(err)
+		}
+
+		if !fn(header, data) {
+			return nil
+		}
+	}
+}
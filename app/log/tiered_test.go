@@ -0,0 +1,252 @@
+package log_test
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+)
+
+func tieredConfig() log.Config {
+	config := retentionConfig()
+	config.RemoteStorageEnable = true
+
+	return config
+}
+
+// openTiered returns the log of foo0 on a manager whose remote tier is a
+// directory, which it returns too.
+func openTiered(t testing.TB, config log.Config) (*log.Manager, *log.Log, string) {
+	t.Helper()
+
+	m, _ := openManager(t, t.TempDir(), config)
+	t.Cleanup(func() { m.Close() })
+
+	remoteDir := t.TempDir()
+	storage, err := log.NewFileRemoteStorage(remoteDir)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	m.EnableRemoteStorage(storage)
+	l, err := m.GetOrCreate(foo0, config)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return m, l, remoteDir
+}
+
+func countFiles(t testing.TB, pattern string) int {
+	t.Helper()
+
+	matches, err := filepath.Glob(pattern)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return len(matches)
+}
+
+func TestCopyToRemote(t *testing.T) {
+	m, l, remoteDir := openTiered(t, tieredConfig())
+
+	for range 10 {
+		l.Append(encodeBatch(t, now(), 3), 0)
+	}
+
+	// only the segments rolled and committed are copied
+	l.UpdateHighWatermark(15)
+
+	if copied := m.CopyToRemote(); copied != 2 {
+		t.Fatalf("expected 2 segments copied, result: %d", copied)
+	}
+
+	commit(l)
+
+	if copied := m.CopyToRemote(); copied != 2 {
+		t.Fatalf("expected 2 segments copied, result: %d", copied)
+	}
+
+	if copied := m.CopyToRemote(); copied != 0 {
+		t.Fatalf("expected the segments copied once, result: %d", copied)
+	}
+
+	for _, suffix := range []string{log.LogFileSuffix, log.IndexFileSuffix, log.TimeIndexFileSuffix} {
+		if count := countFiles(t, filepath.Join(remoteDir, "foo-0", "*"+suffix)); count != 4 {
+			t.Fatalf("expected 4 %s files, result: %d", suffix, count)
+		}
+	}
+
+	segments := l.RemoteSegments()
+
+	if len(segments) != 4 || segments[0].StartOffset != 0 || segments[3].StartOffset != 18 || segments[3].EndOffset != 23 {
+		t.Fatalf("unexpected remote segments: %+v", segments)
+	}
+
+	// the local segments are kept within local.retention
+	if l.NumberOfSegments() != 5 || l.LogStartOffset() != 0 {
+		t.Fatalf("unexpected log: %d segments from %d", l.NumberOfSegments(), l.LogStartOffset())
+	}
+
+	dir := l.Dir()
+	m.Close()
+	reopened := openLog(t, dir, tieredConfig())
+
+	if result := reopened.RemoteSegments(); !slices.Equal(result, segments) {
+		t.Fatalf("expected: %+v, result: %+v", segments, result)
+	}
+}
+
+func TestReadFromRemote(t *testing.T) {
+	config := tieredConfig()
+	config.LocalRetentionBytes = 0
+	m, l, _ := openTiered(t, config)
+	timestamp := now()
+
+	for i := range 10 {
+		l.Append(encodeBatch(t, timestamp+int64(i), 3), 0)
+	}
+
+	commit(l)
+	m.CopyToRemote()
+
+	if deleted, err := l.DeleteOldSegments(time.Now()); err != nil || deleted != 4 {
+		t.Fatalf("expected 4 segments deleted, result: %d %v", deleted, err)
+	}
+
+	if count := countFiles(t, filepath.Join(l.Dir(), "*"+log.LogFileSuffix)); count != 1 {
+		t.Fatalf("expected the local copies deleted, result: %d segments", count)
+	}
+
+	// the log still starts at 0, the first segments are read from the remote tier
+	if l.LogStartOffset() != 0 || l.NumberOfSegments() != 1 {
+		t.Fatalf("unexpected log: %d segments from %d", l.NumberOfSegments(), l.LogStartOffset())
+	}
+
+	for _, test := range []struct {
+		offset   int64
+		maxBytes int
+		expected []int64
+	}{
+		{0, 1, []int64{0, 1, 2}},
+		{7, 1 << 20, []int64{6, 7, 8, 9, 10, 11}},
+		{24, 1 << 20, []int64{24, 25, 26, 27, 28, 29}},
+	} {
+		info, err := l.Read(test.offset, test.maxBytes, log.FetchHighWatermark)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if result := readOffsets(t, info.Records); !slices.Equal(result, test.expected) {
+			t.Fatalf("%d, expected: %v, result: %v", test.offset, test.expected, result)
+		}
+
+		if info.LogStartOffset != 0 || info.HighWatermark != 30 {
+			t.Fatalf("unexpected offsets: %+v", info)
+		}
+	}
+
+	if offset, _, found, err := l.OffsetForTimestamp(timestamp + 3); err != nil || !found || offset != 9 {
+		t.Fatalf("expected: 9, result: %d %t %v", offset, found, err)
+	}
+}
+
+func TestRemoteRetention(t *testing.T) {
+	config := tieredConfig()
+	config.RetentionMs = time.Hour
+	m, l, remoteDir := openTiered(t, config)
+	old := time.Now().Add(-2 * time.Hour).UnixMilli()
+
+	for i := range 10 {
+		timestamp := now()
+
+		if i < 4 {
+			timestamp = old
+		}
+
+		l.Append(encodeBatch(t, timestamp, 3), 0)
+	}
+
+	commit(l)
+	m.CopyToRemote()
+
+	// the two old segments go from both tiers
+	if deleted := m.DeleteOldSegments(time.Now()); deleted != 4 {
+		t.Fatalf("expected 4 segments deleted, result: %d", deleted)
+	}
+
+	if l.LogStartOffset() != 12 || l.NumberOfSegments() != 3 || len(l.RemoteSegments()) != 2 {
+		t.Fatalf("unexpected log: %d segments from %d, %d remote", l.NumberOfSegments(), l.LogStartOffset(), len(l.RemoteSegments()))
+	}
+
+	if count := countFiles(t, filepath.Join(remoteDir, "foo-0", "*")); count != 6 {
+		t.Fatalf("expected the files of 2 remote segments, result: %d", count)
+	}
+
+	if _, err := l.Read(6, 1<<20, log.FetchHighWatermark); !errors.Is(err, log.ErrOffsetOutOfRange) {
+		t.Fatalf("expected: %v, result: %v", log.ErrOffsetOutOfRange, err)
+	}
+
+	// the records deleted go from the log directory at once, from the
+	// remote tier on the next check
+	l.DeleteRecordsBefore(20)
+
+	if l.NumberOfSegments() != 2 || len(l.RemoteSegments()) != 2 {
+		t.Fatalf("unexpected log: %d segments, %d remote", l.NumberOfSegments(), len(l.RemoteSegments()))
+	}
+
+	if deleted, err := l.DeleteOldSegments(time.Now()); err != nil || deleted != 1 {
+		t.Fatalf("expected 1 segment deleted, result: %d %v", deleted, err)
+	}
+
+	if segments := l.RemoteSegments(); len(segments) != 1 || segments[0].StartOffset != 18 {
+		t.Fatalf("unexpected remote segments: %+v", segments)
+	}
+}
+
+func TestAlterLogDirOfTieredLog(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	config := tieredConfig()
+	config.LocalRetentionBytes = 0
+	m := openJBOD(t, config, dirs...)
+	defer m.Close()
+
+	storage, _ := log.NewFileRemoteStorage(t.TempDir())
+	m.EnableRemoteStorage(storage)
+	l, _ := m.GetOrCreate(foo0, config)
+
+	for range 10 {
+		l.Append(encodeBatch(t, now(), 3), 0)
+	}
+
+	commit(l)
+	m.CopyToRemote()
+	l.DeleteOldSegments(time.Now())
+
+	if err := m.AlterLogDir(foo0, dirs[1]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the local segments are moved, the remote ones stay listed
+	moved := waitForLogDir(t, m, foo0, dirs[1])
+
+	if moved.LogStartOffset() != 0 || moved.NumberOfSegments() != 1 || len(moved.RemoteSegments()) != 4 {
+		t.Fatalf("unexpected log: %d segments from %d, %d remote", moved.NumberOfSegments(), moved.LogStartOffset(), len(moved.RemoteSegments()))
+	}
+
+	for _, offset := range []int64{0, 24} {
+		info, err := moved.Read(offset, 1, log.FetchHighWatermark)
+
+		if offsets := readOffsets(t, info.Records); err != nil || len(offsets) != 3 || offsets[0] != offset {
+			t.Fatalf("%d, unexpected offsets: %v %v", offset, offsets, err)
+		}
+	}
+}
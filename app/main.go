@@ -1,28 +1,371 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/config"
 	"github.com/codecrafters-io/kafka-starter-go/app/handlers"
+	"github.com/codecrafters-io/kafka-starter-go/app/log"
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+	"github.com/codecrafters-io/kafka-starter-go/app/metrics"
+	"github.com/codecrafters-io/kafka-starter-go/app/quota"
 	"github.com/codecrafters-io/kafka-starter-go/app/server"
 )
 
 func main() {
 	kafkaServer := server.NewKafkaServer()
+	quotas := quota.NewManager(quota.DefaultConfig)
+	registry := metrics.NewRegistry()
+
+	configureLogging(kafkaServer)
+
+	properties := loadProperties(kafkaServer)
+	publisher := newMetadataPublisher(kafkaServer, properties)
+	logs := openLogs(kafkaServer, properties)
+
+	go closeOnSignal(kafkaServer, logs)
+	go logs.RunRetention(context.Background(), logs.Config().RetentionCheckInterval)
+	go logs.RunFlusher(context.Background())
+	logs.StartCleaner()
+
+	if logs.Config().RemoteLogStorageSystemEnable {
+		enableRemoteStorage(kafkaServer, properties, logs)
+	}
+
+	publisher.Subscribe(func(image *metadata.Image) {
+		applyTopicConfigs(kafkaServer.Logger(), logs, image)
+	})
+	applyTopicConfigs(kafkaServer.Logger(), logs, publisher.Image())
+
+	brokerMetrics := server.NewBrokerMetrics(registry)
+	kafkaServer.EnableMetrics(brokerMetrics)
+	logs.SetFlushObserver(brokerMetrics.RecordLogFlush)
+	brokerMetrics.CollectLogs(func() []server.LogStats {
+		return logStats(logs)
+	})
+
+	// the http endpoints are optional and unauthenticated: the metrics on
+	// /metrics, like KAFKA_METRICS_ADDR=:9404, and the log level on /loglevel,
+	// which anyone reaching it can change, on an address of its own like
+	// KAFKA_LOG_LEVEL_ADDR=127.0.0.1:9405
+	if addr := os.Getenv("KAFKA_METRICS_ADDR"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry.Handler())
+
+		go func() {
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				kafkaServer.Logger().Error("couldn't serve metrics", "error", err)
+			}
+		}()
+	}
+
+	if addr := os.Getenv("KAFKA_LOG_LEVEL_ADDR"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/loglevel", server.LogLevelHandler(kafkaServer.LogLevel()))
+
+		go func() {
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				kafkaServer.Logger().Error("couldn't serve the log level", "error", err)
+			}
+		}()
+	}
+
+	kafkaServer.Use(
+		server.Recovery(kafkaServer.Logger()),
+		server.Logging(kafkaServer.Logger()),
+		server.Quotas(quotas),
+	)
+
+	server.AddTyped(
+		kafkaServer.
+			Handler(server.ApiVersions).
+			Version(0, 2).
+			Opts().
+			RequestHeaderVersion(1).
+			And(),
+		handlers.ApiVersionsHandler,
+	)
+
+	server.Handle(
+		kafkaServer,
+		server.ApiVersions,
+		server.ApiVersionRange{Min: 3, Max: 4},
+		handlers.ApiVersionsHandler,
+	)
+
+	server.AddTyped(
+		kafkaServer.
+			Handler(server.DescribeTopicPartitions).
+			Version(0, 0).
+			Opts().
+			ResponseHeaderVersion(1).
+			And(),
+		handlers.NewDescribeTopicPartitionsHandler(publisher),
+	)
+
+	server.HandleFlexible(
+		kafkaServer,
+		server.Fetch,
+		server.ApiVersionRange{Min: 4, Max: 11},
+		server.ApiVersionRange{Min: 12, Max: 16},
+		handlers.NewFetchHandler(publisher, logs),
+	)
+
+	server.HandleFlexible(
+		kafkaServer,
+		server.DeleteRecords,
+		server.ApiVersionRange{Min: 0, Max: 1},
+		server.ApiVersionRange{Min: 2, Max: 2},
+		handlers.NewDeleteRecordsHandler(publisher, logs),
+	)
+
+	server.HandleFlexible(
+		kafkaServer,
+		server.AlterReplicaLogDirs,
+		server.ApiVersionRange{Min: 0, Max: 1},
+		server.ApiVersionRange{Min: 2, Max: 2},
+		handlers.NewAlterReplicaLogDirsHandler(publisher, logs),
+	)
+
+	server.HandleFlexible(
+		kafkaServer,
+		server.DescribeLogDirs,
+		server.ApiVersionRange{Min: 0, Max: 1},
+		server.ApiVersionRange{Min: 2, Max: 4},
+		handlers.NewDescribeLogDirsHandler(logs),
+	)
+
+	server.HandleFlexible(
+		kafkaServer,
+		server.DescribeClientQuotas,
+		server.ApiVersionRange{Min: 0, Max: 0},
+		server.ApiVersionRange{Min: 1, Max: 1},
+		handlers.NewDescribeClientQuotasHandler(quotas),
+	)
+
+	server.HandleFlexible(
+		kafkaServer,
+		server.AlterClientQuotas,
+		server.ApiVersionRange{Min: 0, Max: 0},
+		server.ApiVersionRange{Min: 1, Max: 1},
+		handlers.NewAlterClientQuotasHandler(quotas),
+	)
+
+	connectionConfig, err := server.BrokerConnectionConfig(properties)
+
+	if err != nil {
+		panic(err)
+	}
+
+	kafkaServer.SetConnectionConfig(connectionConfig)
+
+	listeners, err := server.BrokerListenersConfig(properties)
+
+	if err != nil {
+		panic(err)
+	}
+
+	if err = kafkaServer.ListenAndServeListeners(listeners); err != nil {
+		panic(err)
+	}
+}
+
+// configureLogging reads the level, like KAFKA_LOG_LEVEL=debug, and the
+// format, text or json, like KAFKA_LOG_FORMAT=json, of the server logs.
+func configureLogging(kafkaServer *server.KafkaServer) {
+	format := server.LogText
+
+	if value := os.Getenv("KAFKA_LOG_FORMAT"); value != "" {
+		var err error
+
+		if format, err = server.ParseLogFormat(value); err != nil {
+			panic(err)
+		}
+	}
+
+	if value := os.Getenv("KAFKA_LOG_LEVEL"); value != "" {
+		if err := kafkaServer.LogLevel().UnmarshalText([]byte(value)); err != nil {
+			panic(err)
+		}
+	}
+
+	logger := server.NewLogger(os.Stdout, format, kafkaServer.LogLevel())
+
+	kafkaServer.SetLogger(logger)
+	slog.SetDefault(logger)
+}
+
+// loadProperties reads the server.properties given as first argument, the
+// defaults apply when there is none.
+func loadProperties(kafkaServer *server.KafkaServer) config.Properties {
+	if len(os.Args) < 2 {
+		return config.Properties{}
+	}
+
+	properties, err := config.Load(os.Args[1])
+
+	if err != nil {
+		panic(err)
+	}
+
+	kafkaServer.Logger().Info("loaded properties", "path", os.Args[1])
+
+	return properties
+}
+
+// newMetadataPublisher returns the backend of the cluster metadata: the
+// static file of metadata.static.file when set, the local controller of a
+// node with the controller role, or else the metadata log written by the
+// controllers, which is followed for changes.
+func newMetadataPublisher(kafkaServer *server.KafkaServer, properties config.Properties) metadata.Publisher {
+	logger := kafkaServer.Logger()
+
+	if path := properties.String("metadata.static.file", ""); path != "" {
+		publisher, err := metadata.LoadStaticFile(path)
+
+		if err != nil {
+			panic(err)
+		}
+
+		logMetadata(logger, "loaded static cluster metadata", publisher.Image(), "path", path)
+
+		return publisher
+	}
+
+	logDir := properties.MetadataLogDir()
 
-	kafkaServer.
-		Handler(server.ApiVersions).
-		Version(0, 4).Add(handlers.ApiVersionsHandler)
+	if slices.Contains(properties.List("process.roles"), "controller") {
+		controller, err := metadata.NewLocalController(logDir)
+
+		if err != nil {
+			panic(err)
+		}
+
+		logMetadata(logger, "started local controller", controller.Image(), "metadata_log_dir", logDir)
+
+		return controller
+	}
+
+	publisher, err := metadata.NewKRaftPublisher(logDir)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.Warn("no cluster metadata log", "metadata_log_dir", logDir)
+		return metadata.NewStaticPublisher(metadata.NewImage())
+	}
 
-	kafkaServer.
-		Handler(server.DescribeTopicPartitions).
-		Version(0, 0).
-		Opts().
-		ResponseHeaderVersion(1).
-		And().
-		Add(handlers.DescribeTopicPartitionsHandler)
+	if err != nil {
+		panic(err)
+	}
+
+	logMetadata(logger, "loaded cluster metadata", publisher.Image(), "metadata_log_dir", logDir)
+
+	go publisher.Run(context.Background(), time.Second, func(err error) {
+		logger.Error("couldn't follow the cluster metadata log", "error", err)
+	})
+
+	return publisher
+}
+
+func logMetadata(logger *slog.Logger, msg string, image *metadata.Image, args ...any) {
+	logger.Info(msg, append(args, "offset", image.Offset, "topics", len(image.Topics))...)
+}
+
+// openLogs opens the partition logs of the log.dirs, recovering them after
+// an unclean shutdown.
+func openLogs(kafkaServer *server.KafkaServer, properties config.Properties) *log.Manager {
+	logConfig, err := log.BrokerConfig(properties)
+
+	if err != nil {
+		panic(err)
+	}
 
-	err := kafkaServer.ListenAndServe(":9092")
+	logs, err := log.OpenManager(properties.LogDirs(), logConfig, kafkaServer.Logger())
 
 	if err != nil {
 		panic(err)
 	}
+
+	return logs
+}
+
+// enableRemoteStorage copies the segments of the topics with
+// remote.storage.enable to the remote tier in the background. The tier is
+// the directory of rsm.config.dir, after the remote.log.storage.manager
+// prefix of Kafka.
+func enableRemoteStorage(kafkaServer *server.KafkaServer, properties config.Properties, logs *log.Manager) {
+	dir := properties.String("rsm.config.dir", "")
+
+	if dir == "" {
+		panic(errors.New("remote.log.storage.system.enable needs rsm.config.dir"))
+	}
+
+	storage, err := log.NewFileRemoteStorage(dir)
+
+	if err != nil {
+		panic(err)
+	}
+
+	logs.EnableRemoteStorage(storage)
+	kafkaServer.Logger().Info("enabled the remote storage", "dir", dir)
+
+	go logs.RunRemoteLogManager(context.Background())
+}
+
+// logStats returns the metrics of the partition logs, read on every scrape.
+func logStats(logs *log.Manager) []server.LogStats {
+	var stats []server.LogStats
+
+	for tp, l := range logs.Logs() {
+		stats = append(stats, server.LogStats{
+			Topic:       tp.Topic,
+			Partition:   tp.Partition,
+			Size:        l.Size(),
+			StartOffset: l.LogStartOffset(),
+			EndOffset:   l.LogEndOffset(),
+			Segments:    l.NumberOfSegments(),
+		})
+	}
+
+	return stats
+}
+
+// applyTopicConfigs sets the configs of the topics of image on their logs,
+// over the broker defaults.
+func applyTopicConfigs(logger *slog.Logger, logs *log.Manager, image *metadata.Image) {
+	for tp, l := range logs.Logs() {
+		configs := image.Configs[metadata.ConfigResource{Type: metadata.TopicResource, Name: tp.Topic}]
+		config, err := logs.Config().WithTopicConfigs(configs)
+
+		if err != nil {
+			logger.Warn("ignoring invalid topic configs", "topic", tp.Topic, "error", err)
+			continue
+		}
+
+		l.SetConfig(config)
+	}
+}
+
+// closeOnSignal closes the logs cleanly when the broker is asked to stop, so
+// that they aren't recovered on the next start.
+func closeOnSignal(kafkaServer *server.KafkaServer, logs *log.Manager) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	<-ctx.Done()
+
+	if err := logs.Close(); err != nil {
+		kafkaServer.Logger().Error("couldn't close the logs", "error", err)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
 }
@@ -0,0 +1,105 @@
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LocalController is the controller of a single node cluster, running in the
+// broker process. It appends the records to the metadata log, so that they
+// are replayed on restart, and publishes their image.
+type LocalController struct {
+	*publisher
+
+	mu sync.Mutex
+	// segment is the segment appended to, empty for a controller keeping
+	// the records in memory.
+	segment string
+}
+
+// NewLocalController replays the metadata log of the metadata.log.dir
+// logDir, creating it when missing. A batch cut short at the end of the log,
+// by a crash while appending, is truncated. The controller keeps the records
+// in memory when logDir is empty.
+func NewLocalController(logDir string) (*LocalController, error) {
+	if logDir == "" {
+		return &LocalController{publisher: newPublisher(NewImage())}, nil
+	}
+
+	dir := filepath.Join(logDir, ClusterMetadataDir)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	image := NewImage()
+	tail := &logTail{dir: dir}
+
+	if _, err := tail.read(image); err != nil {
+		return nil, err
+	}
+
+	if tail.segment == "" {
+		tail.segment = filepath.Join(dir, fmt.Sprintf("%020d.log", 0))
+	} else if err := os.Truncate(tail.segment, tail.position); err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	return &LocalController{publisher: newPublisher(image), segment: tail.segment}, nil
+}
+
+// Append commits records as one batch, following the offset of the latest
+// image, and returns the image publishing them.
+func (c *LocalController) Append(records ...Record) (*Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	image := c.Image().Clone()
+	baseOffset := image.Offset + 1
+
+	if c.segment != "" {
+		if err := c.write(baseOffset, records); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, record := range records {
+		image.Apply(record)
+		image.Offset++
+	}
+
+	c.publish(image)
+
+	return image, nil
+}
+
+func (c *LocalController) write(baseOffset int64, records []Record) error {
+	batch, err := EncodeBatch(baseOffset, time.Now().UnixMilli(), records...)
+
+	if err != nil {
+		return fmt.Errorf("metadata: %w", err)
+	}
+
+	file, err := os.OpenFile(c.segment, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+
+	if err != nil {
+		return fmt.Errorf("metadata: %w", err)
+	}
+
+	if _, err = file.Write(batch); err == nil {
+		err = file.Sync()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("metadata: %s: %w", c.segment, err)
+	}
+
+	return nil
+}
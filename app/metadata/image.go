@@ -0,0 +1,340 @@
+// Package metadata keeps the topics, partitions and brokers of the cluster,
+// as replayed from the records of the KRaft __cluster_metadata log.
+//
+// The handlers read immutable images from a Publisher, whose backends are a
+// static file, the metadata log of remote controllers or the local
+// controller of a combined node.
+package metadata
+
+import (
+	"slices"
+	"strings"
+)
+
+type Partition struct {
+	Index                  int32
+	Leader                 int32
+	LeaderEpoch            int32
+	PartitionEpoch         int32
+	LeaderRecoveryState    int8
+	Replicas               []int32
+	Isr                    []int32
+	RemovingReplicas       []int32
+	AddingReplicas         []int32
+	EligibleLeaderReplicas []int32
+	LastKnownElr           []int32
+	// Directories are the log directories of the replicas, on their order.
+	Directories []Uuid
+}
+
+type Topic struct {
+	Id         Uuid
+	Name       string
+	Partitions map[int32]*Partition
+}
+
+// SortedPartitions returns the partitions ordered by index.
+func (t *Topic) SortedPartitions() []*Partition {
+	partitions := make([]*Partition, 0, len(t.Partitions))
+
+	for _, partition := range t.Partitions {
+		partitions = append(partitions, partition)
+	}
+
+	slices.SortFunc(partitions, func(a, b *Partition) int {
+		return int(a.Index) - int(b.Index)
+	})
+
+	return partitions
+}
+
+type Broker struct {
+	Id                   int32
+	Epoch                int64
+	IncarnationId        Uuid
+	EndPoints            []BrokerEndpoint
+	Features             []BrokerFeature
+	Rack                 string
+	Fenced               bool
+	InControlledShutdown bool
+	LogDirs              []Uuid
+}
+
+type ConfigResource struct {
+	Type int8
+	Name string
+}
+
+// Image is the state of the cluster metadata after applying the records of
+// the log up to Offset.
+//
+// The images returned by a Publisher are snapshots shared by every request,
+// they must not be changed: Clone one to Apply records to it.
+type Image struct {
+	Topics   map[Uuid]*Topic
+	Brokers  map[int32]*Broker
+	Features map[string]int16
+	Configs  map[ConfigResource]map[string]string
+	// Offset is the offset of the last applied record, -1 before any. It is
+	// the version of the image, the later images have greater offsets.
+	Offset int64
+
+	topicIds map[string]Uuid
+}
+
+func NewImage() *Image {
+	return &Image{
+		Topics:   make(map[Uuid]*Topic),
+		Brokers:  make(map[int32]*Broker),
+		Features: make(map[string]int16),
+		Configs:  make(map[ConfigResource]map[string]string),
+		Offset:   -1,
+		topicIds: make(map[string]Uuid),
+	}
+}
+
+// Clone returns a copy of the image that records can be applied to without
+// changing i. The slices of the partitions and brokers are shared, Apply
+// replaces them instead of changing them.
+func (i *Image) Clone() *Image {
+	clone := &Image{
+		Topics:   make(map[Uuid]*Topic, len(i.Topics)),
+		Brokers:  make(map[int32]*Broker, len(i.Brokers)),
+		Features: make(map[string]int16, len(i.Features)),
+		Configs:  make(map[ConfigResource]map[string]string, len(i.Configs)),
+		Offset:   i.Offset,
+		topicIds: make(map[string]Uuid, len(i.topicIds)),
+	}
+
+	for id, topic := range i.Topics {
+		topicClone := &Topic{Id: topic.Id, Name: topic.Name, Partitions: make(map[int32]*Partition, len(topic.Partitions))}
+
+		for index, partition := range topic.Partitions {
+			partitionClone := *partition
+			topicClone.Partitions[index] = &partitionClone
+		}
+
+		clone.Topics[id] = topicClone
+	}
+
+	for id, broker := range i.Brokers {
+		brokerClone := *broker
+		clone.Brokers[id] = &brokerClone
+	}
+
+	for name, level := range i.Features {
+		clone.Features[name] = level
+	}
+
+	for resource, configs := range i.Configs {
+		configsClone := make(map[string]string, len(configs))
+
+		for name, value := range configs {
+			configsClone[name] = value
+		}
+
+		clone.Configs[resource] = configsClone
+	}
+
+	for name, id := range i.topicIds {
+		clone.topicIds[name] = id
+	}
+
+	return clone
+}
+
+func (i *Image) Topic(name string) (*Topic, bool) {
+	id, found := i.topicIds[name]
+
+	if !found {
+		return nil, false
+	}
+
+	return i.Topics[id], true
+}
+
+func (i *Image) TopicById(id Uuid) (*Topic, bool) {
+	topic, found := i.Topics[id]
+	return topic, found
+}
+
+// SortedTopics returns the topics ordered by name.
+func (i *Image) SortedTopics() []*Topic {
+	topics := make([]*Topic, 0, len(i.Topics))
+
+	for _, topic := range i.Topics {
+		topics = append(topics, topic)
+	}
+
+	slices.SortFunc(topics, func(a, b *Topic) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return topics
+}
+
+func (i *Image) partition(topicId Uuid, index int32) (*Partition, bool) {
+	topic, found := i.Topics[topicId]
+
+	if !found {
+		return nil, false
+	}
+
+	partition, found := topic.Partitions[index]
+	return partition, found
+}
+
+// Apply changes the image with record, the records about unknown topics,
+// partitions or brokers are ignored.
+func (i *Image) Apply(record Record) {
+	switch record := record.(type) {
+	case *TopicRecord:
+		i.Topics[record.TopicId] = &Topic{
+			Id:         record.TopicId,
+			Name:       record.Name,
+			Partitions: make(map[int32]*Partition),
+		}
+		i.topicIds[record.Name] = record.TopicId
+	case *RemoveTopicRecord:
+		if topic, found := i.Topics[record.TopicId]; found {
+			delete(i.topicIds, topic.Name)
+			delete(i.Topics, record.TopicId)
+			delete(i.Configs, ConfigResource{Type: TopicResource, Name: topic.Name})
+		}
+	case *PartitionRecord:
+		if topic, found := i.Topics[record.TopicId]; found {
+			topic.Partitions[record.PartitionId] = &Partition{
+				Index:                  record.PartitionId,
+				Leader:                 record.Leader,
+				LeaderEpoch:            record.LeaderEpoch,
+				PartitionEpoch:         record.PartitionEpoch,
+				LeaderRecoveryState:    record.LeaderRecoveryState,
+				Replicas:               record.Replicas,
+				Isr:                    record.Isr,
+				RemovingReplicas:       record.RemovingReplicas,
+				AddingReplicas:         record.AddingReplicas,
+				EligibleLeaderReplicas: record.EligibleLeaderReplicas,
+				LastKnownElr:           record.LastKnownElr,
+				Directories:            record.Directories,
+			}
+		}
+	case *PartitionChangeRecord:
+		if partition, found := i.partition(record.TopicId, record.PartitionId); found {
+			partition.apply(record)
+		}
+	case *RegisterBrokerRecord:
+		i.Brokers[record.BrokerId] = &Broker{
+			Id:                   record.BrokerId,
+			Epoch:                record.BrokerEpoch,
+			IncarnationId:        record.IncarnationId,
+			EndPoints:            record.EndPoints,
+			Features:             record.Features,
+			Rack:                 record.Rack,
+			Fenced:               record.Fenced,
+			InControlledShutdown: record.InControlledShutdown,
+			LogDirs:              record.LogDirs,
+		}
+	case *UnregisterBrokerRecord:
+		delete(i.Brokers, record.BrokerId)
+	case *FenceBrokerRecord:
+		if broker, found := i.Brokers[record.Id]; found {
+			broker.Fenced = true
+		}
+	case *UnfenceBrokerRecord:
+		if broker, found := i.Brokers[record.Id]; found {
+			broker.Fenced = false
+		}
+	case *BrokerRegistrationChangeRecord:
+		if broker, found := i.Brokers[record.BrokerId]; found {
+			broker.apply(record)
+		}
+	case *FeatureLevelRecord:
+		if record.FeatureLevel == 0 {
+			delete(i.Features, record.Name)
+		} else {
+			i.Features[record.Name] = record.FeatureLevel
+		}
+	case *ConfigRecord:
+		i.applyConfig(record)
+	}
+}
+
+func (i *Image) applyConfig(record *ConfigRecord) {
+	resource := ConfigResource{Type: record.ResourceType, Name: record.ResourceName}
+	configs := i.Configs[resource]
+
+	if record.Value == "" {
+		delete(configs, record.Name)
+
+		if len(configs) == 0 {
+			delete(i.Configs, resource)
+		}
+
+		return
+	}
+
+	if configs == nil {
+		configs = make(map[string]string)
+		i.Configs[resource] = configs
+	}
+
+	configs[record.Name] = record.Value
+}
+
+func (p *Partition) apply(record *PartitionChangeRecord) {
+	if record.Isr != nil {
+		p.Isr = record.Isr
+	}
+
+	if record.Leader != NoLeaderChange {
+		p.Leader = record.Leader
+		p.LeaderEpoch++
+	}
+
+	if record.Replicas != nil {
+		p.Replicas = record.Replicas
+	}
+
+	if record.RemovingReplicas != nil {
+		p.RemovingReplicas = record.RemovingReplicas
+	}
+
+	if record.AddingReplicas != nil {
+		p.AddingReplicas = record.AddingReplicas
+	}
+
+	if record.LeaderRecoveryState >= 0 {
+		p.LeaderRecoveryState = record.LeaderRecoveryState
+	}
+
+	if record.EligibleLeaderReplicas != nil {
+		p.EligibleLeaderReplicas = record.EligibleLeaderReplicas
+	}
+
+	if record.LastKnownElr != nil {
+		p.LastKnownElr = record.LastKnownElr
+	}
+
+	if record.Directories != nil {
+		p.Directories = record.Directories
+	}
+
+	p.PartitionEpoch++
+}
+
+func (b *Broker) apply(record *BrokerRegistrationChangeRecord) {
+	switch record.Fenced {
+	case BrokerFenced:
+		b.Fenced = true
+	case BrokerUnfenced:
+		b.Fenced = false
+	}
+
+	if record.InControlledShutdown != 0 {
+		b.InControlledShutdown = true
+	}
+
+	if record.LogDirs != nil {
+		b.LogDirs = record.LogDirs
+	}
+}
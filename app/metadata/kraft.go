@@ -0,0 +1,224 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+// ClusterMetadataDir is the directory of the metadata log inside the
+// metadata.log.dir, the partition 0 of the __cluster_metadata topic.
+const ClusterMetadataDir = "__cluster_metadata-0"
+
+// Replay applies the records of the batches of r, skipping the control
+// batches written by the raft layer.
+func (i *Image) Replay(r io.Reader) error {
+	for {
+		batch, err := record.ReadBatch(r)
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err = i.applyBatch(batch); err != nil {
+			return err
+		}
+	}
+}
+
+func (i *Image) applyBatch(batch *record.Batch) error {
+	if batch.IsControl() {
+		i.Offset = batch.LastOffset()
+		return nil
+	}
+
+	for _, rec := range batch.Records {
+		metadataRecord, err := DecodeRecord(rec.Value)
+
+		if err != nil {
+			return fmt.Errorf("offset %d: %w", batch.BaseOffset+int64(rec.OffsetDelta), err)
+		}
+
+		i.Apply(metadataRecord)
+		i.Offset = batch.BaseOffset + int64(rec.OffsetDelta)
+	}
+
+	return nil
+}
+
+// segments returns the log segments of dir ordered by base offset, their
+// names are the zero padded base offset so the order of the names is enough.
+func segments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	slices.Sort(files)
+
+	return files, nil
+}
+
+// logTail is the position of a reader of the metadata log, it resumes
+// where the previous read stopped.
+type logTail struct {
+	dir string
+	// segment is the segment being read, position its offset in bytes
+	// after the last complete batch.
+	segment  string
+	position int64
+}
+
+// read applies to image the batches appended since the previous read. The
+// controller may be appending to the last segment, so a batch cut short at
+// its end is left for the next read. It reports whether any batch was read.
+func (t *logTail) read(image *Image) (bool, error) {
+	files, err := segments(t.dir)
+
+	if err != nil {
+		return false, fmt.Errorf("metadata: %w", err)
+	}
+
+	read := false
+
+	for i, file := range files {
+		if file < t.segment {
+			continue
+		}
+
+		if file != t.segment {
+			t.segment, t.position = file, 0
+		}
+
+		data, err := os.ReadFile(file)
+
+		if err != nil {
+			return read, fmt.Errorf("metadata: %w", err)
+		}
+
+		if t.position > int64(len(data)) {
+			return read, fmt.Errorf("metadata: %s was truncated", file)
+		}
+
+		reader := bytes.NewReader(data[t.position:])
+
+		for {
+			batch, err := record.ReadBatch(reader)
+
+			if errors.Is(err, io.EOF) || (errors.Is(err, io.ErrUnexpectedEOF) && i == len(files)-1) {
+				break
+			}
+
+			if err == nil {
+				err = image.applyBatch(batch)
+			}
+
+			if err != nil {
+				return read, fmt.Errorf("metadata: %s: %w", file, err)
+			}
+
+			t.position = int64(len(data) - reader.Len())
+			read = true
+		}
+	}
+
+	return read, nil
+}
+
+// LoadClusterMetadata replays the metadata log of the metadata.log.dir
+// logDir.
+func LoadClusterMetadata(logDir string) (*Image, error) {
+	image := NewImage()
+	tail := &logTail{dir: filepath.Join(logDir, ClusterMetadataDir)}
+
+	if _, err := tail.read(image); err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// KRaftPublisher publishes the images of the metadata log a controller
+// appends to, following the log with Run.
+type KRaftPublisher struct {
+	*publisher
+
+	tail *logTail
+}
+
+// NewKRaftPublisher replays the metadata log of the metadata.log.dir logDir.
+func NewKRaftPublisher(logDir string) (*KRaftPublisher, error) {
+	image := NewImage()
+	tail := &logTail{dir: filepath.Join(logDir, ClusterMetadataDir)}
+
+	if _, err := tail.read(image); err != nil {
+		return nil, err
+	}
+
+	return &KRaftPublisher{publisher: newPublisher(image), tail: tail}, nil
+}
+
+// Poll publishes a new image when batches were appended to the log since the
+// previous poll.
+func (p *KRaftPublisher) Poll() error {
+	image := p.Image().Clone()
+	read, err := p.tail.read(image)
+
+	if read {
+		p.publish(image)
+	}
+
+	return err
+}
+
+// Run polls the log every interval until ctx is done, the errors are given
+// to onError and the next polls retry.
+func (p *KRaftPublisher) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Poll(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// EncodeBatch encodes records as a batch of the metadata log starting at
+// baseOffset, like the controller appends them.
+func EncodeBatch(baseOffset int64, timestamp int64, records ...Record) ([]byte, error) {
+	batchRecords := make([]record.Record, 0, len(records))
+
+	for _, metadataRecord := range records {
+		batchRecords = append(batchRecords, record.Record{Value: EncodeRecord(metadataRecord)})
+	}
+
+	return record.NewBatch(baseOffset, timestamp, batchRecords...).Encode()
+}
@@ -0,0 +1,334 @@
+package metadata_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/metadata"
+)
+
+var topicId = metadata.Uuid{0x71, 0xa5, 0x9a, 0x51, 0x82, 0x70, 0x41, 0x75, 0x90, 0xd4, 0x97, 0xa9, 0x91, 0x2b, 0x6f, 0x19}
+
+func TestDecodeFeatureLevelRecord(t *testing.T) {
+	value := []byte{
+		0x01, 0x0c, 0x00, // frame version, type and version
+		0x11, 'm', 'e', 't', 'a', 'd', 'a', 't', 'a', '.', 'v', 'e', 'r', 's', 'i', 'o', 'n',
+		0x00, 0x14, // feature level
+		0x00, // tagged fields
+	}
+
+	result, err := metadata.DecodeRecord(value)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := &metadata.FeatureLevelRecord{Name: "metadata.version", FeatureLevel: 20}
+
+	if !reflect.DeepEqual(expected, result) {
+		t.Fatalf("expected: %+v, result: %+v", expected, result)
+	}
+}
+
+func TestDecodePartitionRecordV1(t *testing.T) {
+	value := []byte{0x01, 0x03, 0x01, 0x00, 0x00, 0x00, 0x01}
+	value = append(value, topicId[:]...)
+	value = append(value,
+		0x02, 0x00, 0x00, 0x00, 0x01, // replicas
+		0x02, 0x00, 0x00, 0x00, 0x01, // isr
+		0x01, 0x01, // removing and adding replicas
+		0x00, 0x00, 0x00, 0x01, // leader
+		0x00, 0x00, 0x00, 0x00, // leader epoch
+		0x00, 0x00, 0x00, 0x00, // partition epoch
+		0x01, // directories
+		0x00, // tagged fields
+	)
+
+	result, err := metadata.DecodeRecord(value)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	partition := result.(*metadata.PartitionRecord)
+
+	if partition.PartitionId != 1 || partition.TopicId != topicId || partition.Leader != 1 || !slices.Equal(partition.Isr, []int32{1}) {
+		t.Fatalf("unexpected partition: %+v", partition)
+	}
+}
+
+func testRecords() []metadata.Record {
+	return []metadata.Record{
+		&metadata.FeatureLevelRecord{Name: "metadata.version", FeatureLevel: 20},
+		&metadata.RegisterBrokerRecord{
+			BrokerId:    1,
+			BrokerEpoch: 5,
+			EndPoints:   []metadata.BrokerEndpoint{{Name: "PLAINTEXT", Host: "localhost", Port: 9092}},
+			Features:    []metadata.BrokerFeature{{Name: "metadata.version", MinSupportedVersion: 1, MaxSupportedVersion: 20}},
+			Rack:        "a",
+			Fenced:      true,
+			LogDirs:     []metadata.Uuid{{1}},
+		},
+		&metadata.UnfenceBrokerRecord{Id: 1, Epoch: 5},
+		&metadata.TopicRecord{Name: "foo", TopicId: topicId},
+		&metadata.PartitionRecord{
+			PartitionId:            0,
+			TopicId:                topicId,
+			Replicas:               []int32{1, 2},
+			Isr:                    []int32{1, 2},
+			RemovingReplicas:       []int32{},
+			AddingReplicas:         []int32{},
+			Leader:                 1,
+			Directories:            []metadata.Uuid{{1}, {2}},
+			EligibleLeaderReplicas: []int32{},
+			LastKnownElr:           []int32{3},
+		},
+		&metadata.PartitionRecord{
+			PartitionId:      1,
+			TopicId:          topicId,
+			Replicas:         []int32{2},
+			Isr:              []int32{2},
+			RemovingReplicas: []int32{},
+			AddingReplicas:   []int32{},
+			Leader:           2,
+			Directories:      []metadata.Uuid{},
+		},
+		&metadata.PartitionChangeRecord{
+			PartitionId:         0,
+			TopicId:             topicId,
+			Isr:                 []int32{2},
+			Leader:              2,
+			LeaderRecoveryState: -1,
+		},
+		&metadata.ConfigRecord{ResourceType: metadata.TopicResource, ResourceName: "foo", Name: "cleanup.policy", Value: "compact"},
+		&metadata.TopicRecord{Name: "bar", TopicId: metadata.Uuid{2}},
+		&metadata.RemoveTopicRecord{TopicId: metadata.Uuid{2}},
+	}
+}
+
+func TestDecodeCorruptLengths(t *testing.T) {
+	huge := binary.AppendUvarint(nil, 1<<62)
+
+	// the tagged fields of a FeatureLevelRecord
+	featureLevel := []byte{0x01, 0x0c, 0x00, 0x01, 0x00, 0x14}
+	// the replicas of a PartitionRecord
+	partition := append([]byte{0x01, 0x03, 0x01, 0x00, 0x00, 0x00, 0x01}, topicId[:]...)
+
+	for _, value := range [][]byte{append(featureLevel, huge...), append(partition, huge...)} {
+		if _, err := metadata.DecodeRecord(value); err == nil {
+			t.Fatalf("value: %x, expected an error", value)
+		}
+	}
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	for _, expected := range testRecords() {
+		result, err := metadata.DecodeRecord(metadata.EncodeRecord(expected))
+
+		if err != nil {
+			t.Fatalf("unexpected error on %T: %s", expected, err)
+		}
+
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("expected: %+v, result: %+v", expected, result)
+		}
+	}
+}
+
+func TestLoadClusterMetadata(t *testing.T) {
+	logDir := t.TempDir()
+	dir := filepath.Join(logDir, metadata.ClusterMetadataDir)
+	os.MkdirAll(dir, 0o755)
+
+	records := testRecords()
+	first, _ := metadata.EncodeBatch(0, 0, records[:4]...)
+	second, _ := metadata.EncodeBatch(4, 0, records[4:]...)
+	torn, _ := metadata.EncodeBatch(int64(len(records)), 0, &metadata.RemoveTopicRecord{TopicId: topicId})
+
+	os.WriteFile(filepath.Join(dir, "00000000000000000000.log"), first, 0o644)
+	os.WriteFile(filepath.Join(dir, "00000000000000000004.log"), append(second, torn[:20]...), 0o644)
+
+	image, err := metadata.LoadClusterMetadata(logDir)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if image.Offset != int64(len(records)-1) {
+		t.Fatalf("expected: %d, result: %d", len(records)-1, image.Offset)
+	}
+
+	topic, found := image.Topic("foo")
+
+	if !found || topic.Id != topicId || len(topic.Partitions) != 2 {
+		t.Fatalf("expected the topic foo with 2 partitions, result: %+v", topic)
+	}
+
+	if _, found = image.Topic("bar"); found {
+		t.Fatal("expected the topic bar to be removed")
+	}
+
+	partition := topic.SortedPartitions()[0]
+
+	if partition.Leader != 2 || partition.LeaderEpoch != 1 || partition.PartitionEpoch != 1 || !slices.Equal(partition.Isr, []int32{2}) {
+		t.Fatalf("expected the partition change to be applied, result: %+v", partition)
+	}
+
+	if broker := image.Brokers[1]; broker == nil || broker.Fenced || broker.EndPoints[0].Port != 9092 {
+		t.Fatalf("expected the unfenced broker 1, result: %+v", broker)
+	}
+
+	if image.Features["metadata.version"] != 20 || image.Configs[metadata.ConfigResource{Type: metadata.TopicResource, Name: "foo"}]["cleanup.policy"] != "compact" {
+		t.Fatalf("unexpected features or configs: %v %v", image.Features, image.Configs)
+	}
+}
+
+func TestLoadMissingClusterMetadata(t *testing.T) {
+	if _, err := metadata.LoadClusterMetadata(t.TempDir()); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected: %v, result: %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestUuid(t *testing.T) {
+	result, err := metadata.ParseUuid(topicId.String())
+
+	if err != nil || result != topicId {
+		t.Fatalf("expected: %s, result: %s %v", topicId, result, err)
+	}
+}
+
+func TestImageClone(t *testing.T) {
+	image := metadata.NewImage()
+
+	for _, record := range testRecords()[:6] {
+		image.Apply(record)
+	}
+
+	clone := image.Clone()
+	clone.Apply(&metadata.PartitionChangeRecord{TopicId: topicId, Leader: 2, LeaderRecoveryState: -1})
+	clone.Apply(&metadata.FenceBrokerRecord{Id: 1})
+	clone.Apply(&metadata.RemoveTopicRecord{TopicId: topicId})
+
+	topic, found := image.Topic("foo")
+
+	if !found || topic.Partitions[0].Leader != 1 || image.Brokers[1].Fenced {
+		t.Fatalf("expected the image to be left unchanged, result: %+v", topic)
+	}
+
+	if _, found = clone.Topic("foo"); found || !clone.Brokers[1].Fenced {
+		t.Fatal("expected the records to be applied to the clone")
+	}
+}
+
+func TestKRaftPublisher(t *testing.T) {
+	logDir := t.TempDir()
+	dir := filepath.Join(logDir, metadata.ClusterMetadataDir)
+	segment := filepath.Join(dir, "00000000000000000000.log")
+	os.MkdirAll(dir, 0o755)
+
+	records := testRecords()
+	first, _ := metadata.EncodeBatch(0, 0, records[:4]...)
+	second, _ := metadata.EncodeBatch(4, 0, records[4:]...)
+	os.WriteFile(segment, append(first, second[:30]...), 0o644)
+
+	publisher, err := metadata.NewKRaftPublisher(logDir)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var published []*metadata.Image
+	publisher.Subscribe(func(image *metadata.Image) { published = append(published, image) })
+	initial := publisher.Image()
+
+	if err = publisher.Poll(); err != nil || len(published) != 0 {
+		t.Fatalf("expected no image without new batches, result: %d %v", len(published), err)
+	}
+
+	os.WriteFile(segment, append(first, second...), 0o644)
+
+	if err = publisher.Poll(); err != nil || len(published) != 1 {
+		t.Fatalf("expected a new image, result: %d %v", len(published), err)
+	}
+
+	if _, found := initial.Topic("foo"); !found || len(initial.Topics[topicId].Partitions) != 0 {
+		t.Fatalf("expected the initial image to be left unchanged, result: %+v", initial.Topics)
+	}
+
+	if image := publisher.Image(); image != published[0] || image.Offset != int64(len(records)-1) {
+		t.Fatalf("expected the image up to %d, result: %d", len(records)-1, image.Offset)
+	}
+}
+
+func TestLocalController(t *testing.T) {
+	logDir := t.TempDir()
+	controller, err := metadata.NewLocalController(logDir)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	records := testRecords()
+	controller.Append(records[:4]...)
+	image, err := controller.Append(records[4:]...)
+
+	if err != nil || image != controller.Image() || image.Offset != int64(len(records)-1) {
+		t.Fatalf("expected the image up to %d, result: %+v %v", len(records)-1, image, err)
+	}
+
+	segment := filepath.Join(logDir, metadata.ClusterMetadataDir, "00000000000000000000.log")
+	data, _ := os.ReadFile(segment)
+	os.WriteFile(segment, append(data, 0, 0, 0), 0o644)
+
+	if controller, err = metadata.NewLocalController(logDir); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if reloaded := controller.Image(); !reflect.DeepEqual(image.Topics, reloaded.Topics) || reloaded.Offset != image.Offset {
+		t.Fatalf("expected: %+v, result: %+v", image, reloaded)
+	}
+
+	if truncated, _ := os.ReadFile(segment); len(truncated) != len(data) {
+		t.Fatalf("expected the torn batch to be truncated, result: %d bytes", len(truncated))
+	}
+}
+
+func TestParseStaticFile(t *testing.T) {
+	image, err := metadata.ParseStaticFile(strings.NewReader(`{
+		"brokers": [{"id": 3, "host": "localhost", "port": 9092}],
+		"topics": [
+			{"name": "foo", "partitions": 2, "configs": {"cleanup.policy": "compact"}},
+			{"name": "bar", "id": "caWaUYJwQXWQ1JepkStvGQ", "partitions": 1, "replicas": [1, 3]}
+		],
+		"features": {"metadata.version": 20}
+	}`))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	foo, found := image.Topic("foo")
+
+	if !found || len(foo.Partitions) != 2 || foo.Partitions[1].Leader != 3 {
+		t.Fatalf("expected the topic foo led by broker 3, result: %+v", foo)
+	}
+
+	if bar, found := image.Topic("bar"); !found || bar.Id != topicId || !slices.Equal(bar.Partitions[0].Replicas, []int32{1, 3}) {
+		t.Fatalf("expected the topic bar, result: %+v", bar)
+	}
+
+	if image.Brokers[3] == nil || image.Features["metadata.version"] != 20 || image.Offset != 7 {
+		t.Fatalf("unexpected brokers, features or offset: %v %v %d", image.Brokers, image.Features, image.Offset)
+	}
+
+	if _, err = metadata.ParseStaticFile(strings.NewReader(`{"topics": [{"name": "foo"}]}`)); err == nil {
+		t.Fatal("expected an error for a topic without partitions")
+	}
+}
@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Publisher publishes the images of the cluster metadata, a handler reads
+// one Image per request so it answers from a consistent snapshot.
+type Publisher interface {
+	// Image returns the latest image, it must not be changed.
+	Image() *Image
+	// Subscribe calls fn with every image published afterwards, until the
+	// returned function is called.
+	Subscribe(fn func(*Image)) (unsubscribe func())
+}
+
+// publisher keeps the latest image for the backends.
+type publisher struct {
+	image atomic.Pointer[Image]
+
+	mu          sync.Mutex
+	subscribers map[int]func(*Image)
+	next        int
+}
+
+func newPublisher(image *Image) *publisher {
+	p := &publisher{subscribers: make(map[int]func(*Image))}
+	p.image.Store(image)
+
+	return p
+}
+
+func (p *publisher) Image() *Image {
+	return p.image.Load()
+}
+
+func (p *publisher) Subscribe(fn func(*Image)) func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := p.next
+	p.subscribers[id] = fn
+	p.next++
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		delete(p.subscribers, id)
+	}
+}
+
+// publish replaces the latest image, the subscribers are called in order by
+// the goroutine publishing.
+func (p *publisher) publish(image *Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.image.Store(image)
+
+	for id := range p.next {
+		if fn, found := p.subscribers[id]; found {
+			fn(image)
+		}
+	}
+}
+
+// StaticPublisher publishes a single image, for brokers whose metadata
+// doesn't change like the ones described by a static file.
+type StaticPublisher struct {
+	*publisher
+}
+
+func NewStaticPublisher(image *Image) *StaticPublisher {
+	return &StaticPublisher{newPublisher(image)}
+}
@@ -0,0 +1,177 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// reader decodes the flexible encoding of the metadata records, once a read
+// fails the next ones are skipped and err keeps the failure.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if n < 0 || n > len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	value := r.data[:n]
+	r.data = r.data[n:]
+
+	return value
+}
+
+func (r *reader) int8() int8 {
+	if value := r.next(1); value != nil {
+		return int8(value[0])
+	}
+	return 0
+}
+
+func (r *reader) bool() bool {
+	return r.int8() != 0
+}
+
+func (r *reader) int16() int16 {
+	return int16(r.uint16())
+}
+
+func (r *reader) uint16() uint16 {
+	if value := r.next(2); value != nil {
+		return binary.BigEndian.Uint16(value)
+	}
+	return 0
+}
+
+func (r *reader) int32() int32 {
+	if value := r.next(4); value != nil {
+		return int32(binary.BigEndian.Uint32(value))
+	}
+	return 0
+}
+
+func (r *reader) int64() int64 {
+	if value := r.next(8); value != nil {
+		return int64(binary.BigEndian.Uint64(value))
+	}
+	return 0
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	value, n := binary.Uvarint(r.data)
+
+	if n <= 0 {
+		r.err = errors.New("invalid unsigned varint")
+		return 0
+	}
+
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *reader) uuid() (id Uuid) {
+	copy(id[:], r.next(len(id)))
+	return id
+}
+
+// compactLength reads the length of a compact string or array, -1 is null.
+func (r *reader) compactLength() int {
+	return int(r.uvarint()) - 1
+}
+
+// string reads a compact string, null is read as empty.
+func (r *reader) string() string {
+	length := r.compactLength()
+
+	if length < 0 {
+		return ""
+	}
+
+	return string(r.next(length))
+}
+
+func (r *reader) int32s() []int32 {
+	length := r.compactLength()
+
+	if length < 0 {
+		return nil
+	}
+
+	values := make([]int32, 0, min(length, len(r.data)/4))
+
+	// a corrupt length stops at the end of the data
+	for range length {
+		if values = append(values, r.int32()); r.err != nil {
+			return nil
+		}
+	}
+
+	return values
+}
+
+func (r *reader) uuids() []Uuid {
+	length := r.compactLength()
+
+	if length < 0 {
+		return nil
+	}
+
+	values := make([]Uuid, 0, min(length, len(r.data)/16))
+
+	// a corrupt length stops at the end of the data
+	for range length {
+		if values = append(values, r.uuid()); r.err != nil {
+			return nil
+		}
+	}
+
+	return values
+}
+
+// array reads a compact array calling element for each of its elements.
+func (r *reader) array(element func()) {
+	for range max(r.compactLength(), 0) {
+		if r.err != nil {
+			return
+		}
+		element()
+	}
+}
+
+// taggedFields reads the tagged fields ending every structure, field is
+// called with a reader of the known ones and the others are skipped.
+func (r *reader) taggedFields(field func(tag uint64, r *reader)) {
+	for range r.uvarint() {
+		tag := r.uvarint()
+		data := r.next(int(r.uvarint()))
+
+		if r.err != nil {
+			return
+		}
+
+		if field == nil {
+			continue
+		}
+
+		fieldReader := &reader{data: data}
+		field(tag, fieldReader)
+
+		if fieldReader.err != nil {
+			r.err = fmt.Errorf("tagged field %d: %w", tag, fieldReader.err)
+			return
+		}
+	}
+}
@@ -0,0 +1,626 @@
+package metadata
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Uuid is a topic, directory or incarnation id.
+type Uuid [16]byte
+
+var ZeroUuid Uuid
+
+// LostDirectory is the directory of the replicas whose log directory went
+// offline.
+var LostDirectory = Uuid{15: 1}
+
+// String encodes the id as Kafka does, in URL safe base64 without padding.
+func (u Uuid) String() string {
+	return base64.RawURLEncoding.EncodeToString(u[:])
+}
+
+func ParseUuid(id string) (Uuid, error) {
+	var uuid Uuid
+	decoded, err := base64.RawURLEncoding.DecodeString(id)
+
+	if err != nil || len(decoded) != len(uuid) {
+		return uuid, fmt.Errorf("metadata: invalid uuid %q", id)
+	}
+
+	copy(uuid[:], decoded)
+	return uuid, nil
+}
+
+type RecordType uint16
+
+const (
+	RegisterBrokerRecordType           RecordType = 0
+	UnregisterBrokerRecordType         RecordType = 1
+	TopicRecordType                    RecordType = 2
+	PartitionRecordType                RecordType = 3
+	ConfigRecordType                   RecordType = 4
+	PartitionChangeRecordType          RecordType = 5
+	FenceBrokerRecordType              RecordType = 7
+	UnfenceBrokerRecordType            RecordType = 8
+	RemoveTopicRecordType              RecordType = 9
+	FeatureLevelRecordType             RecordType = 12
+	BrokerRegistrationChangeRecordType RecordType = 17
+)
+
+// frameVersion is the version of the header of every metadata record.
+const frameVersion = 1
+
+// Record is a metadata record, the value of the records of the
+// __cluster_metadata log.
+type Record interface {
+	Type() RecordType
+	// version is the version the record is encoded with.
+	version() int16
+	decode(r *reader, version int16)
+	encode(w *writer, version int16)
+}
+
+var ErrInvalidRecord = errors.New("metadata: invalid record")
+
+// UnknownRecord is a record of a type the image doesn't use, like the
+// producer ids or the ACLs.
+type UnknownRecord struct {
+	RecordType RecordType
+	Version    int16
+}
+
+func (r *UnknownRecord) Type() RecordType      { return r.RecordType }
+func (r *UnknownRecord) version() int16        { return r.Version }
+func (r *UnknownRecord) decode(*reader, int16) {}
+func (r *UnknownRecord) encode(*writer, int16) {}
+
+func newRecord(recordType RecordType) Record {
+	switch recordType {
+	case RegisterBrokerRecordType:
+		return new(RegisterBrokerRecord)
+	case UnregisterBrokerRecordType:
+		return new(UnregisterBrokerRecord)
+	case TopicRecordType:
+		return new(TopicRecord)
+	case PartitionRecordType:
+		return new(PartitionRecord)
+	case ConfigRecordType:
+		return new(ConfigRecord)
+	case PartitionChangeRecordType:
+		return new(PartitionChangeRecord)
+	case FenceBrokerRecordType:
+		return new(FenceBrokerRecord)
+	case UnfenceBrokerRecordType:
+		return new(UnfenceBrokerRecord)
+	case RemoveTopicRecordType:
+		return new(RemoveTopicRecord)
+	case FeatureLevelRecordType:
+		return new(FeatureLevelRecord)
+	case BrokerRegistrationChangeRecordType:
+		return new(BrokerRegistrationChangeRecord)
+	default:
+		return nil
+	}
+}
+
+// DecodeRecord decodes the value of a record of the metadata log.
+func DecodeRecord(value []byte) (Record, error) {
+	r := &reader{data: value}
+	frame := r.uvarint()
+	recordType := RecordType(r.uvarint())
+	version := int16(r.uvarint())
+
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRecord, r.err)
+	}
+
+	if frame != frameVersion {
+		return nil, fmt.Errorf("%w: unsupported frame version %d", ErrInvalidRecord, frame)
+	}
+
+	record := newRecord(recordType)
+
+	if record == nil {
+		return &UnknownRecord{RecordType: recordType, Version: version}, nil
+	}
+
+	record.decode(r, version)
+
+	if r.err == nil && len(r.data) > 0 {
+		r.err = fmt.Errorf("%d bytes left", len(r.data))
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("%w: record type %d v%d: %w", ErrInvalidRecord, recordType, version, r.err)
+	}
+
+	return record, nil
+}
+
+// EncodeRecord encodes record as the value of a record of the metadata log.
+func EncodeRecord(record Record) []byte {
+	w := new(writer)
+	w.uvarint(frameVersion)
+	w.uvarint(uint64(record.Type()))
+	w.uvarint(uint64(record.version()))
+	record.encode(w, record.version())
+
+	return w.data
+}
+
+type BrokerEndpoint struct {
+	Name             string
+	Host             string
+	Port             uint16
+	SecurityProtocol int16
+}
+
+type BrokerFeature struct {
+	Name                string
+	MinSupportedVersion int16
+	MaxSupportedVersion int16
+}
+
+type RegisterBrokerRecord struct {
+	BrokerId             int32
+	IsMigratingZkBroker  bool
+	IncarnationId        Uuid
+	BrokerEpoch          int64
+	EndPoints            []BrokerEndpoint
+	Features             []BrokerFeature
+	Rack                 string
+	Fenced               bool
+	InControlledShutdown bool
+	LogDirs              []Uuid
+}
+
+func (*RegisterBrokerRecord) Type() RecordType { return RegisterBrokerRecordType }
+func (*RegisterBrokerRecord) version() int16   { return 3 }
+
+func (rec *RegisterBrokerRecord) decode(r *reader, version int16) {
+	rec.BrokerId = r.int32()
+
+	if version >= 2 {
+		rec.IsMigratingZkBroker = r.bool()
+	}
+
+	rec.IncarnationId = r.uuid()
+	rec.BrokerEpoch = r.int64()
+	r.array(func() {
+		endpoint := BrokerEndpoint{Name: r.string(), Host: r.string(), Port: r.uint16(), SecurityProtocol: r.int16()}
+		r.taggedFields(nil)
+		rec.EndPoints = append(rec.EndPoints, endpoint)
+	})
+	r.array(func() {
+		feature := BrokerFeature{Name: r.string(), MinSupportedVersion: r.int16(), MaxSupportedVersion: r.int16()}
+		r.taggedFields(nil)
+		rec.Features = append(rec.Features, feature)
+	})
+	rec.Rack = r.string()
+	rec.Fenced = r.bool()
+
+	if version >= 1 {
+		rec.InControlledShutdown = r.bool()
+	}
+
+	if version >= 3 {
+		rec.LogDirs = r.uuids()
+	}
+
+	r.taggedFields(nil)
+}
+
+func (rec *RegisterBrokerRecord) encode(w *writer, version int16) {
+	w.int32(rec.BrokerId)
+
+	if version >= 2 {
+		w.bool(rec.IsMigratingZkBroker)
+	}
+
+	w.uuid(rec.IncarnationId)
+	w.int64(rec.BrokerEpoch)
+	w.array(len(rec.EndPoints), func(i int) {
+		endpoint := rec.EndPoints[i]
+		w.string(endpoint.Name)
+		w.string(endpoint.Host)
+		w.uint16(endpoint.Port)
+		w.int16(endpoint.SecurityProtocol)
+		w.taggedFields()
+	})
+	w.array(len(rec.Features), func(i int) {
+		feature := rec.Features[i]
+		w.string(feature.Name)
+		w.int16(feature.MinSupportedVersion)
+		w.int16(feature.MaxSupportedVersion)
+		w.taggedFields()
+	})
+	w.nullableString(rec.Rack)
+	w.bool(rec.Fenced)
+
+	if version >= 1 {
+		w.bool(rec.InControlledShutdown)
+	}
+
+	if version >= 3 {
+		w.uuids(rec.LogDirs)
+	}
+
+	w.taggedFields()
+}
+
+type UnregisterBrokerRecord struct {
+	BrokerId    int32
+	BrokerEpoch int64
+}
+
+func (*UnregisterBrokerRecord) Type() RecordType { return UnregisterBrokerRecordType }
+func (*UnregisterBrokerRecord) version() int16   { return 0 }
+
+func (rec *UnregisterBrokerRecord) decode(r *reader, _ int16) {
+	rec.BrokerId = r.int32()
+	rec.BrokerEpoch = r.int64()
+	r.taggedFields(nil)
+}
+
+func (rec *UnregisterBrokerRecord) encode(w *writer, _ int16) {
+	w.int32(rec.BrokerId)
+	w.int64(rec.BrokerEpoch)
+	w.taggedFields()
+}
+
+type TopicRecord struct {
+	Name    string
+	TopicId Uuid
+}
+
+func (*TopicRecord) Type() RecordType { return TopicRecordType }
+func (*TopicRecord) version() int16   { return 0 }
+
+func (rec *TopicRecord) decode(r *reader, _ int16) {
+	rec.Name = r.string()
+	rec.TopicId = r.uuid()
+	r.taggedFields(nil)
+}
+
+func (rec *TopicRecord) encode(w *writer, _ int16) {
+	w.string(rec.Name)
+	w.uuid(rec.TopicId)
+	w.taggedFields()
+}
+
+// The leader recovery states of a partition.
+const (
+	LeaderRecovered  int8 = 0
+	LeaderRecovering int8 = 1
+)
+
+type PartitionRecord struct {
+	PartitionId            int32
+	TopicId                Uuid
+	Replicas               []int32
+	Isr                    []int32
+	RemovingReplicas       []int32
+	AddingReplicas         []int32
+	Leader                 int32
+	LeaderRecoveryState    int8
+	LeaderEpoch            int32
+	PartitionEpoch         int32
+	Directories            []Uuid
+	EligibleLeaderReplicas []int32
+	LastKnownElr           []int32
+}
+
+func (*PartitionRecord) Type() RecordType { return PartitionRecordType }
+func (*PartitionRecord) version() int16   { return 2 }
+
+func (rec *PartitionRecord) decode(r *reader, version int16) {
+	rec.PartitionId = r.int32()
+	rec.TopicId = r.uuid()
+	rec.Replicas = r.int32s()
+	rec.Isr = r.int32s()
+	rec.RemovingReplicas = r.int32s()
+	rec.AddingReplicas = r.int32s()
+	rec.Leader = r.int32()
+	rec.LeaderEpoch = r.int32()
+	rec.PartitionEpoch = r.int32()
+
+	if version >= 1 {
+		rec.Directories = r.uuids()
+	}
+
+	r.taggedFields(func(tag uint64, r *reader) {
+		switch tag {
+		case 0:
+			rec.LeaderRecoveryState = r.int8()
+		case 1:
+			rec.EligibleLeaderReplicas = r.int32s()
+		case 2:
+			rec.LastKnownElr = r.int32s()
+		}
+	})
+}
+
+func (rec *PartitionRecord) encode(w *writer, version int16) {
+	w.int32(rec.PartitionId)
+	w.uuid(rec.TopicId)
+	w.int32s(rec.Replicas)
+	w.int32s(rec.Isr)
+	w.int32s(rec.RemovingReplicas)
+	w.int32s(rec.AddingReplicas)
+	w.int32(rec.Leader)
+	w.int32(rec.LeaderEpoch)
+	w.int32(rec.PartitionEpoch)
+
+	if version >= 1 {
+		w.uuids(rec.Directories)
+	}
+
+	var fields []taggedField
+
+	if rec.LeaderRecoveryState != LeaderRecovered {
+		fields = append(fields, tagged(0, func(w *writer) { w.int8(rec.LeaderRecoveryState) }))
+	}
+
+	if version >= 2 && rec.EligibleLeaderReplicas != nil {
+		fields = append(fields, tagged(1, func(w *writer) { w.int32s(rec.EligibleLeaderReplicas) }))
+	}
+
+	if version >= 2 && rec.LastKnownElr != nil {
+		fields = append(fields, tagged(2, func(w *writer) { w.int32s(rec.LastKnownElr) }))
+	}
+
+	w.taggedFields(fields...)
+}
+
+// The resource types of ConfigRecord.
+const (
+	TopicResource  int8 = 2
+	BrokerResource int8 = 4
+)
+
+type ConfigRecord struct {
+	ResourceType int8
+	ResourceName string
+	Name         string
+	// Value is empty when the config is deleted.
+	Value string
+}
+
+func (*ConfigRecord) Type() RecordType { return ConfigRecordType }
+func (*ConfigRecord) version() int16   { return 0 }
+
+func (rec *ConfigRecord) decode(r *reader, _ int16) {
+	rec.ResourceType = r.int8()
+	rec.ResourceName = r.string()
+	rec.Name = r.string()
+	rec.Value = r.string()
+	r.taggedFields(nil)
+}
+
+func (rec *ConfigRecord) encode(w *writer, _ int16) {
+	w.int8(rec.ResourceType)
+	w.string(rec.ResourceName)
+	w.string(rec.Name)
+	w.nullableString(rec.Value)
+	w.taggedFields()
+}
+
+// NoLeaderChange is the Leader of the PartitionChangeRecords that keep it.
+const NoLeaderChange int32 = -2
+
+// PartitionChangeRecord changes the fields of a partition, the nil ones are
+// kept.
+type PartitionChangeRecord struct {
+	PartitionId            int32
+	TopicId                Uuid
+	Isr                    []int32
+	Leader                 int32
+	Replicas               []int32
+	RemovingReplicas       []int32
+	AddingReplicas         []int32
+	LeaderRecoveryState    int8
+	EligibleLeaderReplicas []int32
+	LastKnownElr           []int32
+	Directories            []Uuid
+}
+
+func (*PartitionChangeRecord) Type() RecordType { return PartitionChangeRecordType }
+func (*PartitionChangeRecord) version() int16   { return 2 }
+
+func (rec *PartitionChangeRecord) decode(r *reader, _ int16) {
+	rec.PartitionId = r.int32()
+	rec.TopicId = r.uuid()
+	rec.Leader = NoLeaderChange
+	rec.LeaderRecoveryState = -1
+
+	r.taggedFields(func(tag uint64, r *reader) {
+		switch tag {
+		case 0:
+			rec.Isr = r.int32s()
+		case 1:
+			rec.Leader = r.int32()
+		case 2:
+			rec.Replicas = r.int32s()
+		case 3:
+			rec.RemovingReplicas = r.int32s()
+		case 4:
+			rec.AddingReplicas = r.int32s()
+		case 5:
+			rec.LeaderRecoveryState = r.int8()
+		case 6:
+			rec.EligibleLeaderReplicas = r.int32s()
+		case 7:
+			rec.LastKnownElr = r.int32s()
+		case 8:
+			rec.Directories = r.uuids()
+		}
+	})
+}
+
+func (rec *PartitionChangeRecord) encode(w *writer, _ int16) {
+	w.int32(rec.PartitionId)
+	w.uuid(rec.TopicId)
+
+	var fields []taggedField
+
+	for tag, values := range map[uint64][]int32{
+		0: rec.Isr,
+		2: rec.Replicas,
+		3: rec.RemovingReplicas,
+		4: rec.AddingReplicas,
+		6: rec.EligibleLeaderReplicas,
+		7: rec.LastKnownElr,
+	} {
+		if values != nil {
+			fields = append(fields, tagged(tag, func(w *writer) { w.int32s(values) }))
+		}
+	}
+
+	if rec.Leader != NoLeaderChange {
+		fields = append(fields, tagged(1, func(w *writer) { w.int32(rec.Leader) }))
+	}
+
+	if rec.LeaderRecoveryState >= 0 {
+		fields = append(fields, tagged(5, func(w *writer) { w.int8(rec.LeaderRecoveryState) }))
+	}
+
+	if rec.Directories != nil {
+		fields = append(fields, tagged(8, func(w *writer) { w.uuids(rec.Directories) }))
+	}
+
+	w.taggedFields(fields...)
+}
+
+type FenceBrokerRecord struct {
+	Id    int32
+	Epoch int64
+}
+
+func (*FenceBrokerRecord) Type() RecordType { return FenceBrokerRecordType }
+func (*FenceBrokerRecord) version() int16   { return 0 }
+
+func (rec *FenceBrokerRecord) decode(r *reader, _ int16) {
+	rec.Id = r.int32()
+	rec.Epoch = r.int64()
+	r.taggedFields(nil)
+}
+
+func (rec *FenceBrokerRecord) encode(w *writer, _ int16) {
+	w.int32(rec.Id)
+	w.int64(rec.Epoch)
+	w.taggedFields()
+}
+
+type UnfenceBrokerRecord struct {
+	Id    int32
+	Epoch int64
+}
+
+func (*UnfenceBrokerRecord) Type() RecordType { return UnfenceBrokerRecordType }
+func (*UnfenceBrokerRecord) version() int16   { return 0 }
+
+func (rec *UnfenceBrokerRecord) decode(r *reader, _ int16) {
+	rec.Id = r.int32()
+	rec.Epoch = r.int64()
+	r.taggedFields(nil)
+}
+
+func (rec *UnfenceBrokerRecord) encode(w *writer, _ int16) {
+	w.int32(rec.Id)
+	w.int64(rec.Epoch)
+	w.taggedFields()
+}
+
+type RemoveTopicRecord struct {
+	TopicId Uuid
+}
+
+func (*RemoveTopicRecord) Type() RecordType { return RemoveTopicRecordType }
+func (*RemoveTopicRecord) version() int16   { return 0 }
+
+func (rec *RemoveTopicRecord) decode(r *reader, _ int16) {
+	rec.TopicId = r.uuid()
+	r.taggedFields(nil)
+}
+
+func (rec *RemoveTopicRecord) encode(w *writer, _ int16) {
+	w.uuid(rec.TopicId)
+	w.taggedFields()
+}
+
+type FeatureLevelRecord struct {
+	Name         string
+	FeatureLevel int16
+}
+
+func (*FeatureLevelRecord) Type() RecordType { return FeatureLevelRecordType }
+func (*FeatureLevelRecord) version() int16   { return 0 }
+
+func (rec *FeatureLevelRecord) decode(r *reader, _ int16) {
+	rec.Name = r.string()
+	rec.FeatureLevel = r.int16()
+	r.taggedFields(nil)
+}
+
+func (rec *FeatureLevelRecord) encode(w *writer, _ int16) {
+	w.string(rec.Name)
+	w.int16(rec.FeatureLevel)
+	w.taggedFields()
+}
+
+// The Fenced values of BrokerRegistrationChangeRecord.
+const (
+	BrokerUnfenced  int8 = -1
+	BrokerFenceKept int8 = 0
+	BrokerFenced    int8 = 1
+)
+
+type BrokerRegistrationChangeRecord struct {
+	BrokerId    int32
+	BrokerEpoch int64
+	Fenced      int8
+	// InControlledShutdown is 1 once the broker starts shutting down, 0 keeps it.
+	InControlledShutdown int8
+	LogDirs              []Uuid
+}
+
+func (*BrokerRegistrationChangeRecord) Type() RecordType { return BrokerRegistrationChangeRecordType }
+func (*BrokerRegistrationChangeRecord) version() int16   { return 2 }
+
+func (rec *BrokerRegistrationChangeRecord) decode(r *reader, _ int16) {
+	rec.BrokerId = r.int32()
+	rec.BrokerEpoch = r.int64()
+
+	r.taggedFields(func(tag uint64, r *reader) {
+		switch tag {
+		case 0:
+			rec.Fenced = r.int8()
+		case 1:
+			rec.InControlledShutdown = r.int8()
+		case 2:
+			rec.LogDirs = r.uuids()
+		}
+	})
+}
+
+func (rec *BrokerRegistrationChangeRecord) encode(w *writer, _ int16) {
+	w.int32(rec.BrokerId)
+	w.int64(rec.BrokerEpoch)
+
+	var fields []taggedField
+
+	if rec.Fenced != BrokerFenceKept {
+		fields = append(fields, tagged(0, func(w *writer) { w.int8(rec.Fenced) }))
+	}
+
+	if rec.InControlledShutdown != 0 {
+		fields = append(fields, tagged(1, func(w *writer) { w.int8(rec.InControlledShutdown) }))
+	}
+
+	if rec.LogDirs != nil {
+		fields = append(fields, tagged(2, func(w *writer) { w.uuids(rec.LogDirs) }))
+	}
+
+	w.taggedFields(fields...)
+}
@@ -0,0 +1,178 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// StaticFile describes the cluster metadata in JSON, for brokers running
+// without controller:
+//
+//	{
+//	  "brokers": [{"id": 1, "host": "localhost", "port": 9092}],
+//	  "topics": [{"name": "foo", "partitions": 3, "replicas": [1]}],
+//	  "features": {"metadata.version": 20}
+//	}
+type StaticFile struct {
+	Brokers  []StaticBroker   `json:"brokers"`
+	Topics   []StaticTopic    `json:"topics"`
+	Features map[string]int16 `json:"features"`
+}
+
+type StaticBroker struct {
+	Id       int32  `json:"id"`
+	Host     string `json:"host"`
+	Port     uint16 `json:"port"`
+	Listener string `json:"listener"`
+	Rack     string `json:"rack"`
+}
+
+type StaticTopic struct {
+	Name string `json:"name"`
+	// Id is the topic id in base64, derived from the name when empty so
+	// that it is the same across restarts.
+	Id         string `json:"id"`
+	Partitions int32  `json:"partitions"`
+	// Replicas are the replicas of every partition, the first one leads.
+	// The first broker, or broker 1 without brokers, by default.
+	Replicas []int32           `json:"replicas"`
+	Configs  map[string]string `json:"configs"`
+}
+
+// Records returns the records building the metadata of the file.
+func (f *StaticFile) Records() ([]Record, error) {
+	var records []Record
+
+	for name, level := range f.Features {
+		records = append(records, &FeatureLevelRecord{Name: name, FeatureLevel: level})
+	}
+
+	defaultReplicas := []int32{1}
+
+	for i, broker := range f.Brokers {
+		if i == 0 {
+			defaultReplicas = []int32{broker.Id}
+		}
+
+		listener := broker.Listener
+
+		if listener == "" {
+			listener = "PLAINTEXT"
+		}
+
+		records = append(records, &RegisterBrokerRecord{
+			BrokerId:  broker.Id,
+			EndPoints: []BrokerEndpoint{{Name: listener, Host: broker.Host, Port: broker.Port}},
+			Features:  []BrokerFeature{},
+			Rack:      broker.Rack,
+			LogDirs:   []Uuid{},
+		})
+	}
+
+	for _, topic := range f.Topics {
+		topicRecords, err := topic.records(defaultReplicas)
+
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, topicRecords...)
+	}
+
+	return records, nil
+}
+
+func (t *StaticTopic) records(defaultReplicas []int32) ([]Record, error) {
+	if t.Name == "" || t.Partitions <= 0 {
+		return nil, fmt.Errorf("metadata: invalid static topic %q with %d partitions", t.Name, t.Partitions)
+	}
+
+	var id Uuid
+	sum := sha256.Sum256([]byte(t.Name))
+	copy(id[:], sum[:])
+
+	if t.Id != "" {
+		var err error
+
+		if id, err = ParseUuid(t.Id); err != nil {
+			return nil, fmt.Errorf("metadata: static topic %s: %w", t.Name, err)
+		}
+	}
+
+	replicas := t.Replicas
+
+	if len(replicas) == 0 {
+		replicas = defaultReplicas
+	}
+
+	records := []Record{&TopicRecord{Name: t.Name, TopicId: id}}
+
+	for index := range t.Partitions {
+		records = append(records, &PartitionRecord{
+			PartitionId:      index,
+			TopicId:          id,
+			Replicas:         replicas,
+			Isr:              replicas,
+			RemovingReplicas: []int32{},
+			AddingReplicas:   []int32{},
+			Leader:           replicas[0],
+			Directories:      []Uuid{},
+		})
+	}
+
+	for name, value := range t.Configs {
+		records = append(records, &ConfigRecord{ResourceType: TopicResource, ResourceName: t.Name, Name: name, Value: value})
+	}
+
+	return records, nil
+}
+
+// ParseStaticFile builds the image described by the JSON of r, its offset is
+// the one of its last record.
+func ParseStaticFile(r io.Reader) (*Image, error) {
+	var file StaticFile
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("metadata: static file: %w", err)
+	}
+
+	records, err := file.Records()
+
+	if err != nil {
+		return nil, err
+	}
+
+	image := NewImage()
+
+	for _, record := range records {
+		image.Apply(record)
+		image.Offset++
+	}
+
+	return image, nil
+}
+
+// LoadStaticFile publishes the metadata of the static file at path.
+func LoadStaticFile(path string) (*StaticPublisher, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	defer file.Close()
+
+	image, err := ParseStaticFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStaticPublisher(image), nil
+}
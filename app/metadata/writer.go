@@ -0,0 +1,114 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"slices"
+)
+
+// writer encodes the flexible encoding of the metadata records.
+type writer struct {
+	data []byte
+}
+
+func (w *writer) int8(value int8) {
+	w.data = append(w.data, byte(value))
+}
+
+func (w *writer) bool(value bool) {
+	if value {
+		w.int8(1)
+	} else {
+		w.int8(0)
+	}
+}
+
+func (w *writer) int16(value int16) {
+	w.uint16(uint16(value))
+}
+
+func (w *writer) uint16(value uint16) {
+	w.data = binary.BigEndian.AppendUint16(w.data, value)
+}
+
+func (w *writer) int32(value int32) {
+	w.data = binary.BigEndian.AppendUint32(w.data, uint32(value))
+}
+
+func (w *writer) int64(value int64) {
+	w.data = binary.BigEndian.AppendUint64(w.data, uint64(value))
+}
+
+func (w *writer) uvarint(value uint64) {
+	w.data = binary.AppendUvarint(w.data, value)
+}
+
+func (w *writer) uuid(id Uuid) {
+	w.data = append(w.data, id[:]...)
+}
+
+func (w *writer) string(value string) {
+	w.uvarint(uint64(len(value)) + 1)
+	w.data = append(w.data, value...)
+}
+
+// nullableString writes an empty value as null.
+func (w *writer) nullableString(value string) {
+	if value == "" {
+		w.uvarint(0)
+		return
+	}
+
+	w.string(value)
+}
+
+func (w *writer) int32s(values []int32) {
+	w.uvarint(uint64(len(values)) + 1)
+
+	for _, value := range values {
+		w.int32(value)
+	}
+}
+
+func (w *writer) uuids(values []Uuid) {
+	w.uvarint(uint64(len(values)) + 1)
+
+	for _, value := range values {
+		w.uuid(value)
+	}
+}
+
+// array writes a compact array of length elements calling element for each.
+func (w *writer) array(length int, element func(i int)) {
+	w.uvarint(uint64(length) + 1)
+
+	for i := range length {
+		element(i)
+	}
+}
+
+type taggedField struct {
+	tag  uint64
+	data []byte
+}
+
+func tagged(tag uint64, write func(w *writer)) taggedField {
+	w := new(writer)
+	write(w)
+
+	return taggedField{tag: tag, data: w.data}
+}
+
+// taggedFields writes the fields ordered by tag, as the protocol requires.
+func (w *writer) taggedFields(fields ...taggedField) {
+	slices.SortFunc(fields, func(a, b taggedField) int {
+		return int(a.tag) - int(b.tag)
+	})
+
+	w.uvarint(uint64(len(fields)))
+
+	for _, field := range fields {
+		w.uvarint(field.tag)
+		w.uvarint(uint64(len(field.data)))
+		w.data = append(w.data, field.data...)
+	}
+}
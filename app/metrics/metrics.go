@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// value is a float64 updated atomically.
+type value struct {
+	bits atomic.Uint64
+}
+
+func (v *value) load() float64 {
+	return math.Float64frombits(v.bits.Load())
+}
+
+func (v *value) store(f float64) {
+	v.bits.Store(math.Float64bits(f))
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := v.bits.Load()
+
+		if v.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+type Counter struct {
+	value value
+}
+
+// Add increases the counter, negative deltas are ignored as counters only go up.
+func (c *Counter) Add(delta float64) {
+	if delta > 0 {
+		c.value.add(delta)
+	}
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Value() float64 {
+	return c.value.load()
+}
+
+type Gauge struct {
+	value value
+}
+
+func (g *Gauge) Set(f float64) {
+	g.value.store(f)
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.value.add(delta)
+}
+
+func (g *Gauge) Value() float64 {
+	return g.value.load()
+}
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histograms.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     value
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(f float64) {
+	if i := sort.SearchFloat64s(h.buckets, f); i < len(h.buckets) {
+		h.counts[i].Add(1)
+	}
+
+	h.count.Add(1)
+	h.sum.add(f)
+}
+
+// vec keeps the series of a metric by their label values.
+type vec[T any] struct {
+	mutex       sync.RWMutex
+	labels      []string
+	series      map[string]*T
+	labelValues map[string][]string
+	newSeries   func() *T
+}
+
+func newVec[T any](labels []string, newSeries func() *T) *vec[T] {
+	return &vec[T]{
+		labels:      labels,
+		series:      make(map[string]*T),
+		labelValues: make(map[string][]string),
+		newSeries:   newSeries,
+	}
+}
+
+// With returns the series of the label values, given in the order of the
+// labels of the metric, creating it on first use.
+func (v *vec[T]) With(labelValues ...string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic("metrics: expected " + strings.Join(v.labels, ",") + " label values")
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	v.mutex.RLock()
+	series, found := v.series[key]
+	v.mutex.RUnlock()
+
+	if found {
+		return series
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if series, found = v.series[key]; !found {
+		series = v.newSeries()
+		v.series[key] = series
+		v.labelValues[key] = append([]string(nil), labelValues...)
+	}
+
+	return series
+}
+
+// Delete removes the series of the label values, like the ones of a deleted
+// partition.
+func (v *vec[T]) Delete(labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	delete(v.series, key)
+	delete(v.labelValues, key)
+}
+
+// each calls fn for every series, ordered by their label values.
+func (v *vec[T]) each(fn func(labelValues []string, series *T)) {
+	v.mutex.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	v.mutex.RUnlock()
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v.mutex.RLock()
+		series, found := v.series[key]
+		labelValues := v.labelValues[key]
+		v.mutex.RUnlock()
+
+		if found {
+			fn(labelValues, series)
+		}
+	}
+}
+
+type CounterVec struct {
+	*vec[Counter]
+}
+
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+type HistogramVec struct {
+	*vec[Histogram]
+}
@@ -0,0 +1,55 @@
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/metrics"
+)
+
+func TestWriteTo(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	requests := registry.Counter("requests_total", "Requests received.", "api_key")
+	requests.With("18").Inc()
+	requests.With("18").Add(2)
+	requests.With("75").Inc()
+	requests.With("75").Add(-1)
+
+	registry.Gauge("log_size_bytes", "Size of the \"log\".", "topic").With("a\"b\\c\n").Set(1.5)
+	registry.GaugeFunc("connections_active", "Open connections.", func() float64 { return 4 })
+
+	latency := registry.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "api_key")
+	latency.With("18").Observe(0.05)
+	latency.With("18").Observe(0.5)
+	latency.With("18").Observe(2)
+
+	result := new(bytes.Buffer)
+
+	if _, err := registry.WriteTo(result); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := `# HELP connections_active Open connections.
+# TYPE connections_active gauge
+connections_active 4
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{api_key="18",le="0.1"} 1
+latency_seconds_bucket{api_key="18",le="1"} 2
+latency_seconds_bucket{api_key="18",le="+Inf"} 3
+latency_seconds_sum{api_key="18"} 2.55
+latency_seconds_count{api_key="18"} 3
+# HELP log_size_bytes Size of the "log".
+# TYPE log_size_bytes gauge
+log_size_bytes{topic="a\"b\\c\n"} 1.5
+# HELP requests_total Requests received.
+# TYPE requests_total counter
+requests_total{api_key="18"} 3
+requests_total{api_key="75"} 1
+`
+
+	if result.String() != expected {
+		t.Fatalf("expected:\n%s\nresult:\n%s", expected, result)
+	}
+}
@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+type metric struct {
+	name       string
+	help       string
+	metricType metricType
+	labels     []string
+	// write writes the samples of the metric on the text format
+	write func(w *bufio.Writer, m *metric)
+}
+
+// Registry keeps the metrics of the broker and writes them on the
+// Prometheus text format.
+type Registry struct {
+	mutex      sync.RWMutex
+	metrics    map[string]*metric
+	collectors []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]*metric),
+	}
+}
+
+func (r *Registry) register(m *metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, found := r.metrics[m.name]; found {
+		panic("metrics: " + m.name + " is already registered")
+	}
+
+	r.metrics[m.name] = m
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	counters := CounterVec{newVec(labels, func() *Counter { return new(Counter) })}
+
+	r.register(&metric{
+		name:       name,
+		help:       help,
+		metricType: counterType,
+		labels:     labels,
+		write: func(w *bufio.Writer, m *metric) {
+			counters.each(func(labelValues []string, counter *Counter) {
+				writeSample(w, m.name, m.labels, labelValues, counter.Value())
+			})
+		},
+	})
+
+	return &counters
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	gauges := GaugeVec{newVec(labels, func() *Gauge { return new(Gauge) })}
+
+	r.register(&metric{
+		name:       name,
+		help:       help,
+		metricType: gaugeType,
+		labels:     labels,
+		write: func(w *bufio.Writer, m *metric) {
+			gauges.each(func(labelValues []string, gauge *Gauge) {
+				writeSample(w, m.name, m.labels, labelValues, gauge.Value())
+			})
+		},
+	})
+
+	return &gauges
+}
+
+// Histogram registers a histogram with the bucket upper bounds, sorted,
+// DefaultBuckets when nil.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+
+	histograms := HistogramVec{newVec(labels, func() *Histogram { return newHistogram(buckets) })}
+
+	r.register(&metric{
+		name:       name,
+		help:       help,
+		metricType: histogramType,
+		labels:     labels,
+		write: func(w *bufio.Writer, m *metric) {
+			bucketLabels := append(append([]string(nil), m.labels...), "le")
+
+			histograms.each(func(labelValues []string, histogram *Histogram) {
+				bucketValues := append(append([]string(nil), labelValues...), "")
+				cumulative := uint64(0)
+
+				for i, bound := range histogram.buckets {
+					cumulative += histogram.counts[i].Load()
+					bucketValues[len(labelValues)] = formatFloat(bound)
+					writeSample(w, m.name+"_bucket", bucketLabels, bucketValues, float64(cumulative))
+				}
+
+				count := histogram.count.Load()
+				bucketValues[len(labelValues)] = "+Inf"
+				writeSample(w, m.name+"_bucket", bucketLabels, bucketValues, float64(count))
+				writeSample(w, m.name+"_sum", m.labels, labelValues, histogram.sum.load())
+				writeSample(w, m.name+"_count", m.labels, labelValues, float64(count))
+			})
+		},
+	})
+
+	return &histograms
+}
+
+// OnCollect registers fn, called on every scrape before the metrics are
+// written, to update the metrics read from elsewhere.
+func (r *Registry) OnCollect(fn func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.collectors = append(r.collectors, fn)
+}
+
+// GaugeFunc registers a gauge whose value is read from fn on every scrape.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(&metric{
+		name:       name,
+		help:       help,
+		metricType: gaugeType,
+		write: func(w *bufio.Writer, m *metric) {
+			writeSample(w, m.name, nil, nil, fn())
+		},
+	})
+}
+
+// CounterFunc registers a counter whose value is read from fn on every scrape.
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(&metric{
+		name:       name,
+		help:       help,
+		metricType: counterType,
+		write: func(w *bufio.Writer, m *metric) {
+			writeSample(w, m.name, nil, nil, fn())
+		},
+	})
+}
+
+// WriteTo writes every metric, ordered by name, on the Prometheus text format.
+func (r *Registry) WriteTo(writer io.Writer) (int64, error) {
+	r.mutex.RLock()
+	collectors := r.collectors
+	r.mutex.RUnlock()
+
+	for _, collect := range collectors {
+		collect()
+	}
+
+	r.mutex.RLock()
+	metrics := make([]*metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+
+	counter := &countingWriter{writer: writer}
+	w := bufio.NewWriter(counter)
+
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.metricType)
+		m.write(w, m)
+	}
+
+	err := w.Flush()
+
+	return counter.written, err
+}
+
+// Handler serves the metrics for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.writer.Write(p)
+	cw.written += int64(n)
+	return n, err
+}
+
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, value float64) {
+	w.WriteString(name)
+
+	if len(labels) > 0 {
+		w.WriteByte('{')
+
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+
+			w.WriteString(label)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabelValue(labelValues[i]))
+			w.WriteByte('"')
+		}
+
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(labelValue string) string {
+	return labelValueEscaper.Replace(labelValue)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
@@ -0,0 +1,257 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// The quota keys of the client quota configs.
+const (
+	ProducerByteRate  = "producer_byte_rate"
+	ConsumerByteRate  = "consumer_byte_rate"
+	RequestPercentage = "request_percentage"
+)
+
+// Keys are the quota keys the Manager enforces.
+var Keys = []string{ProducerByteRate, ConsumerByteRate, RequestPercentage}
+
+// The entity types of the client quotas.
+const (
+	UserEntity     = "user"
+	ClientIdEntity = "client-id"
+)
+
+// Default is the name of the default entities, as kafka writes them on the
+// config paths.
+const Default = "<default>"
+
+// Entity is who a quota applies to, a component with an empty name is left
+// out of the entity and one named Default matches the users or clients
+// without a quota of their own.
+type Entity struct {
+	User     string
+	ClientId string
+}
+
+func (e Entity) String() string {
+	return fmt.Sprintf("user=%q,client-id=%q", e.User, e.ClientId)
+}
+
+var ErrUnknownKey = errors.New("quota: unknown quota key")
+var ErrInvalidValue = errors.New("quota: quota values must be positive")
+var ErrEmptyEntity = errors.New("quota: entity has no component")
+
+type Config struct {
+	// Samples is the quota.window.num, the number of samples kept on the rates.
+	Samples int
+	// WindowSize is the quota.window.size.seconds, the time of each sample.
+	WindowSize time.Duration
+}
+
+var DefaultConfig = Config{
+	Samples:    11,
+	WindowSize: time.Second,
+}
+
+// Manager keeps the client quotas and measures the usage of the clients
+// against them, like the ClientQuotaManager of the brokers. The quotas are
+// only kept in memory: the ones set by AlterClientQuotas are lost when the
+// broker restarts, Kafka keeps them in the cluster metadata.
+type Manager struct {
+	mutex  sync.Mutex
+	config Config
+	quotas map[Entity]map[string]float64
+	rates  map[rateKey]*rate
+}
+
+type rateKey struct {
+	key    string
+	entity Entity
+}
+
+func NewManager(config Config) *Manager {
+	return &Manager{
+		config: config,
+		quotas: make(map[Entity]map[string]float64),
+		rates:  make(map[rateKey]*rate),
+	}
+}
+
+func validKey(key string) bool {
+	for _, known := range Keys {
+		if key == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Set sets the quota of the entity for key.
+func (m *Manager) Set(entity Entity, key string, value float64) error {
+	if entity == (Entity{}) {
+		return ErrEmptyEntity
+	}
+
+	if !validKey(key) {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
+
+	if value <= 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("%w: %s=%f", ErrInvalidValue, key, value)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.quotas[entity] == nil {
+		m.quotas[entity] = make(map[string]float64)
+	}
+
+	m.quotas[entity][key] = value
+
+	return nil
+}
+
+// Remove removes the quota of the entity for key.
+func (m *Manager) Remove(entity Entity, key string) error {
+	if !validKey(key) {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.quotas[entity], key)
+
+	if len(m.quotas[entity]) == 0 {
+		delete(m.quotas, entity)
+	}
+
+	return nil
+}
+
+// Quotas returns the quotas set on the entities matched by filter.
+func (m *Manager) Quotas(filter func(Entity) bool) map[Entity]map[string]float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	quotas := make(map[Entity]map[string]float64)
+
+	for entity, values := range m.quotas {
+		if !filter(entity) {
+			continue
+		}
+
+		quotas[entity] = make(map[string]float64, len(values))
+
+		for key, value := range values {
+			quotas[entity][key] = value
+		}
+	}
+
+	return quotas
+}
+
+// resolve finds the quota of key for the client, following the precedence
+// of the brokers: user and client-id, user, then client-id alone, the
+// specific entities before the default ones. The rate is kept per entity
+// found, with the default names replaced by the client ones, so clients
+// sharing a quota share its usage.
+func (m *Manager) resolve(user, clientId, key string) (rateKey, float64, bool) {
+	candidates := []Entity{
+		{User: user, ClientId: clientId},
+		{User: user, ClientId: Default},
+		{User: user},
+		{User: Default, ClientId: clientId},
+		{User: Default, ClientId: Default},
+		{User: Default},
+		{ClientId: clientId},
+		{ClientId: Default},
+	}
+
+	for _, candidate := range candidates {
+		value, found := m.quotas[candidate][key]
+
+		if !found {
+			continue
+		}
+
+		entity := candidate
+
+		if entity.User != "" {
+			entity.User = user
+		}
+
+		if entity.ClientId != "" {
+			entity.ClientId = clientId
+		}
+
+		return rateKey{key: key, entity: entity}, value, true
+	}
+
+	return rateKey{}, 0, false
+}
+
+// Record adds value to the usage of the client for key, returning for how
+// long the client must be throttled to get back under its quota.
+func (m *Manager) Record(user, clientId, key string, value float64, now time.Time) time.Duration {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	rateKey, bound, found := m.resolve(user, clientId, key)
+
+	if !found {
+		return 0
+	}
+
+	r, found := m.rates[rateKey]
+
+	if !found {
+		r = newRate(m.config)
+		m.rates[rateKey] = r
+	}
+
+	r.record(value, now)
+
+	return m.throttleTime(r, bound, now)
+}
+
+// ThrottleTime returns for how long the client must be throttled for key,
+// without recording any usage.
+func (m *Manager) ThrottleTime(user, clientId, key string, now time.Time) time.Duration {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	rateKey, bound, found := m.resolve(user, clientId, key)
+
+	if !found {
+		return 0
+	}
+
+	r, found := m.rates[rateKey]
+
+	if !found {
+		return 0
+	}
+
+	return m.throttleTime(r, bound, now)
+}
+
+// throttleTime is the time the rate needs to go back to bound, capped to
+// the quota window.
+func (m *Manager) throttleTime(r *rate, bound float64, now time.Time) time.Duration {
+	observed := r.measure(now)
+
+	if observed <= bound {
+		return 0
+	}
+
+	window := time.Duration(m.config.Samples) * m.config.WindowSize
+	throttle := time.Duration((observed - bound) / bound * float64(r.windowSize(now)))
+
+	return min(throttle, window)
+}
@@ -0,0 +1,81 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{Samples: 3, WindowSize: time.Second}
+
+func TestThrottleTime(t *testing.T) {
+	manager := NewManager(testConfig)
+	manager.Set(Entity{User: "alice"}, ProducerByteRate, 100)
+
+	now := time.Now()
+
+	if throttle := manager.Record("alice", "producer-1", ProducerByteRate, 100, now); throttle != 0 {
+		t.Fatalf("expected: 0, result: %s", throttle)
+	}
+
+	// 300 bytes over the minimum window of 2s is 150 bytes/s, half over the quota
+	if throttle := manager.Record("alice", "producer-2", ProducerByteRate, 200, now); throttle != time.Second {
+		t.Fatalf("expected: 1s, result: %s", throttle)
+	}
+
+	if throttle := manager.ThrottleTime("alice", "producer-1", ProducerByteRate, now.Add(4*time.Second)); throttle != 0 {
+		t.Fatalf("expected the samples to expire, result: %s", throttle)
+	}
+
+	if throttle := manager.Record("bob", "producer-1", ProducerByteRate, 1000, now); throttle != 0 {
+		t.Fatalf("expected bob to have no quota, result: %s", throttle)
+	}
+}
+
+func TestQuotaPrecedence(t *testing.T) {
+	manager := NewManager(testConfig)
+	manager.Set(Entity{User: Default}, ConsumerByteRate, 100)
+	manager.Set(Entity{User: "alice", ClientId: "consumer-1"}, ConsumerByteRate, 1000)
+	manager.Set(Entity{ClientId: Default}, ConsumerByteRate, 1)
+
+	now := time.Now()
+
+	// alice and bob have their own rate on the default user quota
+	if throttle := manager.Record("alice", "consumer-2", ConsumerByteRate, 200, now); throttle != 0 {
+		t.Fatalf("expected: 0, result: %s", throttle)
+	}
+
+	if throttle := manager.Record("bob", "consumer-2", ConsumerByteRate, 200, now); throttle != 0 {
+		t.Fatalf("expected: 0, result: %s", throttle)
+	}
+
+	if throttle := manager.Record("alice", "consumer-1", ConsumerByteRate, 2000, now); throttle != 0 {
+		t.Fatalf("expected the user and client-id quota, result: %s", throttle)
+	}
+
+	if throttle := manager.Record("", "consumer-3", ConsumerByteRate, 2, now); throttle != 0 {
+		t.Fatalf("expected the default user quota, result: %s", throttle)
+	}
+
+	manager.Remove(Entity{User: Default}, ConsumerByteRate)
+
+	if throttle := manager.Record("", "consumer-3", ConsumerByteRate, 2, now); throttle == 0 {
+		t.Fatal("expected the default client-id quota to throttle")
+	}
+}
+
+func TestSetValidation(t *testing.T) {
+	manager := NewManager(testConfig)
+
+	if err := manager.Set(Entity{}, ProducerByteRate, 1); !errors.Is(err, ErrEmptyEntity) {
+		t.Fatalf("expected: %v, result: %v", ErrEmptyEntity, err)
+	}
+
+	if err := manager.Set(Entity{User: "alice"}, "consumer_rate", 1); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected: %v, result: %v", ErrUnknownKey, err)
+	}
+
+	if err := manager.Set(Entity{User: "alice"}, RequestPercentage, -1); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("expected: %v, result: %v", ErrInvalidValue, err)
+	}
+}
@@ -0,0 +1,69 @@
+package quota
+
+import "time"
+
+type sample struct {
+	start time.Time
+	value float64
+}
+
+// rate is the sampled rate of the quotas, it keeps the values of the last
+// config.Samples windows of config.WindowSize.
+type rate struct {
+	config  Config
+	samples []sample
+}
+
+func newRate(config Config) *rate {
+	return &rate{config: config}
+}
+
+func (r *rate) purge(now time.Time) {
+	expired := 0
+
+	for _, sample := range r.samples {
+		if now.Sub(sample.start) < time.Duration(r.config.Samples)*r.config.WindowSize {
+			break
+		}
+		expired++
+	}
+
+	r.samples = r.samples[expired:]
+}
+
+func (r *rate) record(value float64, now time.Time) {
+	r.purge(now)
+
+	if last := len(r.samples) - 1; last >= 0 && now.Sub(r.samples[last].start) < r.config.WindowSize {
+		r.samples[last].value += value
+		return
+	}
+
+	r.samples = append(r.samples, sample{start: now, value: value})
+}
+
+// windowSize is the time the samples cover, at least all the windows but
+// the current one, so a burst on a new rate is not measured over a tiny
+// window.
+func (r *rate) windowSize(now time.Time) time.Duration {
+	minimum := time.Duration(max(r.config.Samples-1, 1)) * r.config.WindowSize
+
+	if len(r.samples) == 0 {
+		return minimum
+	}
+
+	return max(now.Sub(r.samples[0].start), minimum)
+}
+
+// measure returns the rate per second.
+func (r *rate) measure(now time.Time) float64 {
+	r.purge(now)
+
+	total := 0.0
+
+	for _, sample := range r.samples {
+		total += sample.value
+	}
+
+	return total / r.windowSize(now).Seconds()
+}
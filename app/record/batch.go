@@ -0,0 +1,567 @@
+// Package record reads and writes the record batches (magic v2) stored on
+// the logs and carried by Produce and Fetch.
+package record
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	Magic int8 = 2
+	// LogOverhead is the size of the base offset and the batch length, the
+	// batch length counts the bytes after them.
+	LogOverhead = 12
+	// BatchHeaderSize is the size of a batch without records.
+	BatchHeaderSize = 61
+	// crcOffset is where the CRC starts, it covers the bytes after it.
+	crcOffset = 17
+)
+
+type Compression int8
+
+const (
+	NoCompression Compression = iota
+	Gzip
+	Snappy
+	Lz4
+	Zstd
+)
+
+// The attributes of a batch.
+const (
+	CompressionMask   int16 = 0x07
+	TimestampTypeMask int16 = 0x08
+	TransactionalFlag int16 = 0x10
+	ControlFlag       int16 = 0x20
+	DeleteHorizonFlag int16 = 0x40
+)
+
+// The types of the control records, the markers ending a transaction.
+const (
+	ControlAbort  int16 = 0
+	ControlCommit int16 = 1
+)
+
+// NoProducerId is the producer id of batches sent without idempotence,
+// their producer epoch and base sequence are -1 too.
+const NoProducerId int64 = -1
+
+var ErrCorruptBatch = errors.New("record: corrupt batch")
+var ErrUnsupportedMagic = errors.New("record: unsupported magic")
+var ErrUnsupportedCompression = errors.New("record: unsupported compression")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Record is a record of a batch, a nil Key or Value is null.
+type Record struct {
+	Attributes     int8
+	TimestampDelta int64
+	OffsetDelta    int32
+	Key            []byte
+	Value          []byte
+	Headers        []Header
+}
+
+type Batch struct {
+	BaseOffset           int64
+	BatchLength          int32
+	PartitionLeaderEpoch int32
+	Magic                int8
+	CRC                  uint32
+	Attributes           int16
+	LastOffsetDelta      int32
+	BaseTimestamp        int64
+	MaxTimestamp         int64
+	ProducerId           int64
+	ProducerEpoch        int16
+	BaseSequence         int32
+	Records              []Record
+}
+
+// NewBatch returns a batch without producer holding records, their offset
+// deltas follow their order and their timestamps are baseTimestamp plus
+// their TimestampDelta.
+func NewBatch(baseOffset int64, baseTimestamp int64, records ...Record) *Batch {
+	batch := &Batch{
+		BaseOffset:      baseOffset,
+		Magic:           Magic,
+		LastOffsetDelta: int32(max(len(records)-1, 0)),
+		BaseTimestamp:   baseTimestamp,
+		MaxTimestamp:    baseTimestamp,
+		ProducerId:      NoProducerId,
+		ProducerEpoch:   -1,
+		BaseSequence:    -1,
+		Records:         records,
+	}
+
+	for i := range batch.Records {
+		batch.Records[i].OffsetDelta = int32(i)
+		batch.MaxTimestamp = max(batch.MaxTimestamp, baseTimestamp+batch.Records[i].TimestampDelta)
+	}
+
+	return batch
+}
+
+func (b *Batch) Compression() Compression {
+	return Compression(b.Attributes & CompressionMask)
+}
+
+func (b *Batch) IsControl() bool {
+	return b.Attributes&ControlFlag != 0
+}
+
+func (b *Batch) IsTransactional() bool {
+	return b.Attributes&TransactionalFlag != 0
+}
+
+// DeleteHorizon is the time the tombstones and the transaction markers of a
+// compacted batch can be removed from, held by BaseTimestamp once set.
+func (b *Batch) DeleteHorizon() (int64, bool) {
+	if b.Attributes&DeleteHorizonFlag == 0 {
+		return 0, false
+	}
+
+	return b.BaseTimestamp, true
+}
+
+func (b *Batch) LastOffset() int64 {
+	return b.BaseOffset + int64(b.LastOffsetDelta)
+}
+
+// NextOffset is the offset following the batch on the log.
+func (b *Batch) NextOffset() int64 {
+	return b.LastOffset() + 1
+}
+
+// Size is the size of the encoded batch, once read or encoded.
+func (b *Batch) Size() int {
+	return LogOverhead + int(b.BatchLength)
+}
+
+// ReadBatch reads the next batch of r. It returns io.EOF when r has no
+// more bytes and io.ErrUnexpectedEOF when the batch is cut short, like the
+// torn tail of a log.
+func ReadBatch(r io.Reader) (*Batch, error) {
+	prefix := make([]byte, LogOverhead)
+
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	batchLength := int32(binary.BigEndian.Uint32(prefix[8:]))
+
+	if batchLength < BatchHeaderSize-LogOverhead {
+		return nil, fmt.Errorf("%w: batch length %d", ErrCorruptBatch, batchLength)
+	}
+
+	data := make([]byte, LogOverhead+int(batchLength))
+	copy(data, prefix)
+
+	if _, err := io.ReadFull(r, data[LogOverhead:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return DecodeBatch(data)
+}
+
+// DecodeBatch decodes a whole batch, checking its CRC.
+func DecodeBatch(data []byte) (*Batch, error) {
+	d := &decoder{data: data}
+	batch := &Batch{
+		BaseOffset:           d.int64(),
+		BatchLength:          d.int32(),
+		PartitionLeaderEpoch: d.int32(),
+		Magic:                d.int8(),
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptBatch, d.err)
+	}
+
+	if batch.Magic != Magic {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedMagic, batch.Magic)
+	}
+
+	if int(batch.BatchLength) != len(data)-LogOverhead {
+		return nil, fmt.Errorf("%w: batch length %d on %d bytes", ErrCorruptBatch, batch.BatchLength, len(data))
+	}
+
+	batch.CRC = d.uint32()
+
+	if crc := crc32.Checksum(data[crcOffset+4:], castagnoli); crc != batch.CRC {
+		return nil, fmt.Errorf("%w: crc %08x, computed %08x", ErrCorruptBatch, batch.CRC, crc)
+	}
+
+	batch.Attributes = d.int16()
+	batch.LastOffsetDelta = d.int32()
+	batch.BaseTimestamp = d.int64()
+	batch.MaxTimestamp = d.int64()
+	batch.ProducerId = d.int64()
+	batch.ProducerEpoch = d.int16()
+	batch.BaseSequence = d.int32()
+	count := d.int32()
+
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptBatch, d.err)
+	}
+
+	records, err := decompress(batch.Compression(), d.data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d = &decoder{data: records}
+
+	for range count {
+		if record := d.record(); d.err == nil {
+			batch.Records = append(batch.Records, record)
+		}
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptBatch, d.err)
+	}
+
+	return batch, nil
+}
+
+// DecodeHeader decodes the fields preceding the records of the batch at the
+// start of data, which holds at least BatchHeaderSize bytes. The CRC isn't
+// checked and Records is left empty, which is enough to walk a log.
+func DecodeHeader(data []byte) (*Batch, error) {
+	d := &decoder{data: data}
+	batch := &Batch{
+		BaseOffset:           d.int64(),
+		BatchLength:          d.int32(),
+		PartitionLeaderEpoch: d.int32(),
+		Magic:                d.int8(),
+		CRC:                  d.uint32(),
+		Attributes:           d.int16(),
+		LastOffsetDelta:      d.int32(),
+		BaseTimestamp:        d.int64(),
+		MaxTimestamp:         d.int64(),
+		ProducerId:           d.int64(),
+		ProducerEpoch:        d.int16(),
+		BaseSequence:         d.int32(),
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptBatch, d.err)
+	}
+
+	if batch.Magic != Magic {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedMagic, batch.Magic)
+	}
+
+	if batch.BatchLength < BatchHeaderSize-LogOverhead {
+		return nil, fmt.Errorf("%w: batch length %d", ErrCorruptBatch, batch.BatchLength)
+	}
+
+	return batch, nil
+}
+
+// CheckBatch checks the length and the CRC of the whole batch data, and
+// returns its header. Unlike DecodeBatch, it doesn't decompress the records
+// so it accepts every compression.
+func CheckBatch(data []byte) (*Batch, error) {
+	if len(data) < BatchHeaderSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrCorruptBatch, len(data))
+	}
+
+	batch, err := DecodeHeader(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if batch.Size() != len(data) {
+		return nil, fmt.Errorf("%w: batch length %d on %d bytes", ErrCorruptBatch, batch.BatchLength, len(data))
+	}
+
+	if crc := crc32.Checksum(data[crcOffset+4:], castagnoli); crc != batch.CRC {
+		return nil, fmt.Errorf("%w: crc %08x, computed %08x", ErrCorruptBatch, batch.CRC, crc)
+	}
+
+	return batch, nil
+}
+
+// NewEndTxnMarker returns the control batch ending a transaction of the
+// producer, controlType is ControlAbort or ControlCommit.
+func NewEndTxnMarker(
+	baseOffset int64,
+	timestamp int64,
+	producerId int64,
+	producerEpoch int16,
+	controlType int16,
+	coordinatorEpoch int32,
+) *Batch {
+	key := binary.BigEndian.AppendUint16(make([]byte, 2), uint16(controlType))
+	value := binary.BigEndian.AppendUint32(make([]byte, 2), uint32(coordinatorEpoch))
+
+	batch := NewBatch(baseOffset, timestamp, Record{Key: key, Value: value})
+	batch.Attributes = TransactionalFlag | ControlFlag
+	batch.ProducerId = producerId
+	batch.ProducerEpoch = producerEpoch
+
+	return batch
+}
+
+// ControlType returns the type of a control record, read from its key: the
+// version then the type.
+func (r *Record) ControlType() (int16, error) {
+	if len(r.Key) < 4 {
+		return 0, fmt.Errorf("%w: control record key of %d bytes", ErrCorruptBatch, len(r.Key))
+	}
+
+	return int16(binary.BigEndian.Uint16(r.Key[2:])), nil
+}
+
+// Timestamp returns the timestamp of a record of the batch, the batch
+// MaxTimestamp when the broker set it at append time.
+func (b *Batch) Timestamp(record *Record) int64 {
+	if b.Attributes&TimestampTypeMask != 0 {
+		return b.MaxTimestamp
+	}
+
+	return b.BaseTimestamp + record.TimestampDelta
+}
+
+// Encode encodes the batch, setting its BatchLength and CRC.
+func (b *Batch) Encode() ([]byte, error) {
+	var records []byte
+
+	for _, record := range b.Records {
+		records = appendRecord(records, &record)
+	}
+
+	records, err := compress(b.Compression(), records)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, BatchHeaderSize+len(records))
+	data = binary.BigEndian.AppendUint64(data, uint64(b.BaseOffset))
+	data = binary.BigEndian.AppendUint32(data, 0)
+	data = binary.BigEndian.AppendUint32(data, uint32(b.PartitionLeaderEpoch))
+	data = append(data, byte(Magic))
+	data = binary.BigEndian.AppendUint32(data, 0)
+	data = binary.BigEndian.AppendUint16(data, uint16(b.Attributes))
+	data = binary.BigEndian.AppendUint32(data, uint32(b.LastOffsetDelta))
+	data = binary.BigEndian.AppendUint64(data, uint64(b.BaseTimestamp))
+	data = binary.BigEndian.AppendUint64(data, uint64(b.MaxTimestamp))
+	data = binary.BigEndian.AppendUint64(data, uint64(b.ProducerId))
+	data = binary.BigEndian.AppendUint16(data, uint16(b.ProducerEpoch))
+	data = binary.BigEndian.AppendUint32(data, uint32(b.BaseSequence))
+	data = binary.BigEndian.AppendUint32(data, uint32(len(b.Records)))
+	data = append(data, records...)
+
+	b.Magic = Magic
+	b.BatchLength = int32(len(data) - LogOverhead)
+	binary.BigEndian.PutUint32(data[8:], uint32(b.BatchLength))
+
+	b.CRC = crc32.Checksum(data[crcOffset+4:], castagnoli)
+	binary.BigEndian.PutUint32(data[crcOffset:], b.CRC)
+
+	return data, nil
+}
+
+func appendRecord(data []byte, record *Record) []byte {
+	body := []byte{byte(record.Attributes)}
+	body = binary.AppendVarint(body, record.TimestampDelta)
+	body = binary.AppendVarint(body, int64(record.OffsetDelta))
+	body = appendVarBytes(body, record.Key)
+	body = appendVarBytes(body, record.Value)
+	body = binary.AppendVarint(body, int64(len(record.Headers)))
+
+	for _, header := range record.Headers {
+		body = appendVarBytes(body, []byte(header.Key))
+		body = appendVarBytes(body, header.Value)
+	}
+
+	data = binary.AppendVarint(data, int64(len(body)))
+	return append(data, body...)
+}
+
+func appendVarBytes(data []byte, value []byte) []byte {
+	if value == nil {
+		return binary.AppendVarint(data, -1)
+	}
+
+	data = binary.AppendVarint(data, int64(len(value)))
+	return append(data, value...)
+}
+
+func compress(compression Compression, records []byte) ([]byte, error) {
+	switch compression {
+	case NoCompression:
+		return records, nil
+	case Gzip:
+		buffer := new(bytes.Buffer)
+		writer := gzip.NewWriter(buffer)
+
+		if _, err := writer.Write(records); err != nil {
+			return nil, err
+		}
+
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+
+		return buffer.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedCompression, compression)
+	}
+}
+
+func decompress(compression Compression, records []byte) ([]byte, error) {
+	switch compression {
+	case NoCompression:
+		return records, nil
+	case Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(records))
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCorruptBatch, err)
+		}
+
+		defer reader.Close()
+
+		decompressed, err := io.ReadAll(reader)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCorruptBatch, err)
+		}
+
+		return decompressed, nil
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedCompression, compression)
+	}
+}
+
+// decoder reads big endian numbers and varints off data, once a read fails
+// the next ones are skipped and err keeps the failure.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n < 0 || n > len(d.data) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	value := d.data[:n]
+	d.data = d.data[n:]
+
+	return value
+}
+
+func (d *decoder) int8() int8 {
+	if value := d.next(1); value != nil {
+		return int8(value[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if value := d.next(2); value != nil {
+		return int16(binary.BigEndian.Uint16(value))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	return int32(d.uint32())
+}
+
+func (d *decoder) uint32() uint32 {
+	if value := d.next(4); value != nil {
+		return binary.BigEndian.Uint32(value)
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if value := d.next(8); value != nil {
+		return int64(binary.BigEndian.Uint64(value))
+	}
+	return 0
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	value, n := binary.Varint(d.data)
+
+	if n <= 0 {
+		d.err = errors.New("invalid varint")
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return value
+}
+
+// varBytes reads bytes prefixed by their varint length, -1 is null.
+func (d *decoder) varBytes() []byte {
+	length := d.varint()
+
+	if length < 0 {
+		return nil
+	}
+
+	return bytes.Clone(d.next(int(length)))
+}
+
+func (d *decoder) record() (record Record) {
+	length := d.varint()
+	body := d.next(int(length))
+
+	if d.err != nil {
+		return record
+	}
+
+	rd := &decoder{data: body}
+	record.Attributes = rd.int8()
+	record.TimestampDelta = rd.varint()
+	record.OffsetDelta = int32(rd.varint())
+	record.Key = rd.varBytes()
+	record.Value = rd.varBytes()
+
+	for range rd.varint() {
+		header := Header{Key: string(rd.varBytes())}
+		header.Value = rd.varBytes()
+		record.Headers = append(record.Headers, header)
+	}
+
+	if rd.err == nil && len(rd.data) > 0 {
+		rd.err = fmt.Errorf("%d bytes left after the record", len(rd.data))
+	}
+
+	d.err = rd.err
+
+	return record
+}
@@ -0,0 +1,144 @@
+package record_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/record"
+)
+
+func testBatch() *record.Batch {
+	return record.NewBatch(10, 1_700_000_000_000,
+		record.Record{Key: []byte("a"), Value: []byte("1")},
+		record.Record{
+			TimestampDelta: 5,
+			Key:            nil,
+			Value:          []byte{},
+			Headers:        []record.Header{{Key: "h", Value: []byte("v")}},
+		},
+	)
+}
+
+func TestBatchRoundTrip(t *testing.T) {
+	for _, compression := range []record.Compression{record.NoCompression, record.Gzip} {
+		expected := testBatch()
+		expected.Attributes = int16(compression)
+
+		data, err := expected.Encode()
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		result, err := record.ReadBatch(bytes.NewReader(data))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("expected: %+v, result: %+v", expected, result)
+		}
+
+		if result.LastOffset() != 11 || result.MaxTimestamp != 1_700_000_000_005 || result.Size() != len(data) {
+			t.Fatalf("unexpected batch fields: %+v", result)
+		}
+	}
+}
+
+func TestEncodeEmptyBatch(t *testing.T) {
+	data, err := record.NewBatch(0, 0).Encode()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(data) != record.BatchHeaderSize {
+		t.Fatalf("expected: %d, result: %d", record.BatchHeaderSize, len(data))
+	}
+}
+
+func TestReadCorruptBatch(t *testing.T) {
+	data, _ := testBatch().Encode()
+	data[len(data)-1] ^= 0xff
+
+	if _, err := record.ReadBatch(bytes.NewReader(data)); !errors.Is(err, record.ErrCorruptBatch) {
+		t.Fatalf("expected: %v, result: %v", record.ErrCorruptBatch, err)
+	}
+}
+
+func TestReadTornBatch(t *testing.T) {
+	data, _ := testBatch().Encode()
+
+	if _, err := record.ReadBatch(bytes.NewReader(data[:len(data)-3])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected: %v, result: %v", io.ErrUnexpectedEOF, err)
+	}
+
+	if _, err := record.ReadBatch(bytes.NewReader(nil)); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected: %v, result: %v", io.EOF, err)
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	batch := testBatch()
+	data, _ := batch.Encode()
+	result, err := record.DecodeHeader(data[:record.BatchHeaderSize])
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	batch.Records = nil
+
+	if !reflect.DeepEqual(batch, result) {
+		t.Fatalf("expected: %+v, result: %+v", batch, result)
+	}
+
+	if _, err = record.DecodeHeader(data[:20]); !errors.Is(err, record.ErrCorruptBatch) {
+		t.Fatalf("expected: %v, result: %v", record.ErrCorruptBatch, err)
+	}
+}
+
+func TestCheckBatch(t *testing.T) {
+	data, _ := testBatch().Encode()
+
+	if result, err := record.CheckBatch(data); err != nil || result.LastOffset() != 11 {
+		t.Fatalf("unexpected batch: %+v %v", result, err)
+	}
+
+	// the attributes are covered by the CRC
+	corrupt := bytes.Clone(data)
+	corrupt[22] = byte(record.Zstd)
+
+	if _, err := record.CheckBatch(corrupt); !errors.Is(err, record.ErrCorruptBatch) {
+		t.Fatalf("expected: %v, result: %v", record.ErrCorruptBatch, err)
+	}
+
+	if _, err := record.CheckBatch(data[:len(data)-1]); !errors.Is(err, record.ErrCorruptBatch) {
+		t.Fatalf("expected: %v, result: %v", record.ErrCorruptBatch, err)
+	}
+}
+
+func TestEndTxnMarker(t *testing.T) {
+	data, _ := record.NewEndTxnMarker(5, 1_700_000_000_000, 42, 3, record.ControlCommit, 7).Encode()
+	batch, err := record.DecodeBatch(data)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !batch.IsControl() || !batch.IsTransactional() || batch.ProducerId != 42 || batch.ProducerEpoch != 3 {
+		t.Fatalf("unexpected marker: %+v", batch)
+	}
+
+	if controlType, err := batch.Records[0].ControlType(); err != nil || controlType != record.ControlCommit {
+		t.Fatalf("expected: %d, result: %d %v", record.ControlCommit, controlType, err)
+	}
+
+	if _, found := batch.DeleteHorizon(); found {
+		t.Fatal("expected no delete horizon")
+	}
+}
@@ -0,0 +1,141 @@
+package sasl
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"sync"
+)
+
+var ErrUnknownUser = errors.New("sasl: unknown user")
+
+// CredentialStore holds the credentials the sessions authenticate against.
+type CredentialStore interface {
+	// VerifyPassword checks the password of the user, it is used by PLAIN.
+	VerifyPassword(username, password string) error
+	// ScramCredential returns the credential of the user for the SCRAM mechanism.
+	ScramCredential(mechanism, username string) (ScramCredential, error)
+}
+
+// ScramCredential is what a server keeps of a SCRAM password, see RFC 5802.
+type ScramCredential struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// DefaultScramIterations is the iteration count of the credentials created
+// by MemoryCredentialStore, the minimum kafka accepts.
+const DefaultScramIterations = 4096
+
+func NewScramCredential(mechanism, password string, salt []byte, iterations int) (ScramCredential, error) {
+	hash, err := scramHash(mechanism)
+
+	if err != nil {
+		return ScramCredential{}, err
+	}
+
+	saltedPassword := pbkdf2([]byte(password), salt, iterations, hash)
+	clientKey := hmacSum(hash, saltedPassword, []byte("Client Key"))
+
+	return ScramCredential{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  hashSum(hash, clientKey),
+		ServerKey:  hmacSum(hash, saltedPassword, []byte("Server Key")),
+	}, nil
+}
+
+type memoryUser struct {
+	passwordHash [sha256.Size]byte
+	scram        map[string]ScramCredential
+}
+
+// MemoryCredentialStore keeps the credentials in memory, deriving the SCRAM
+// ones when the password is set.
+type MemoryCredentialStore struct {
+	mutex sync.RWMutex
+	users map[string]memoryUser
+}
+
+func NewMemoryCredentialStore() *MemoryCredentialStore {
+	return &MemoryCredentialStore{
+		users: make(map[string]memoryUser),
+	}
+}
+
+func (s *MemoryCredentialStore) SetPassword(username, password string) error {
+	user := memoryUser{
+		passwordHash: sha256.Sum256([]byte(password)),
+		scram:        make(map[string]ScramCredential),
+	}
+
+	for _, mechanism := range []string{ScramSha256, ScramSha512} {
+		salt := make([]byte, 16)
+
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+
+		credential, err := NewScramCredential(mechanism, password, salt, DefaultScramIterations)
+
+		if err != nil {
+			return err
+		}
+
+		user.scram[mechanism] = credential
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.users[username] = user
+
+	return nil
+}
+
+func (s *MemoryCredentialStore) DeleteUser(username string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.users, username)
+}
+
+func (s *MemoryCredentialStore) VerifyPassword(username, password string) error {
+	s.mutex.RLock()
+	user, found := s.users[username]
+	s.mutex.RUnlock()
+
+	if !found {
+		return ErrUnknownUser
+	}
+
+	passwordHash := sha256.Sum256([]byte(password))
+
+	if subtle.ConstantTimeCompare(passwordHash[:], user.passwordHash[:]) != 1 {
+		return ErrAuthenticationFailed
+	}
+
+	return nil
+}
+
+func (s *MemoryCredentialStore) ScramCredential(mechanism, username string) (ScramCredential, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	user, found := s.users[username]
+
+	if !found {
+		return ScramCredential{}, ErrUnknownUser
+	}
+
+	credential, found := user.scram[mechanism]
+
+	if !found {
+		return ScramCredential{}, ErrUnsupportedMechanism
+	}
+
+	return credential, nil
+}
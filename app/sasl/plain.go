@@ -0,0 +1,44 @@
+package sasl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// plainSession implements PLAIN, see RFC 4616. The client sends a single
+// `authzid NUL authcid NUL password` message.
+type plainSession struct {
+	store    CredentialStore
+	username string
+}
+
+func (s *plainSession) Next(message []byte) ([]byte, bool, error) {
+	parts := bytes.Split(message, []byte{0})
+
+	if len(parts) != 3 {
+		return nil, false, fmt.Errorf("%w: PLAIN expects authzid, authcid and password", ErrInvalidMessage)
+	}
+
+	authorizationId, username, password := string(parts[0]), string(parts[1]), string(parts[2])
+
+	if username == "" || password == "" {
+		return nil, false, fmt.Errorf("%w: PLAIN username and password can't be empty", ErrInvalidMessage)
+	}
+
+	if authorizationId != "" && authorizationId != username {
+		return nil, false, fmt.Errorf("%w: authorization id must be the same as the username", ErrAuthenticationFailed)
+	}
+
+	if err := s.store.VerifyPassword(username, password); err != nil {
+		return nil, false, errors.Join(ErrAuthenticationFailed, err)
+	}
+
+	s.username = username
+
+	return nil, true, nil
+}
+
+func (s *plainSession) Username() string {
+	return s.username
+}
@@ -0,0 +1,42 @@
+package sasl
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The mechanism names sent on SaslHandshake.
+const (
+	Plain       = "PLAIN"
+	ScramSha256 = "SCRAM-SHA-256"
+	ScramSha512 = "SCRAM-SHA-512"
+)
+
+// Mechanisms are the mechanisms supported by NewSession.
+var Mechanisms = []string{Plain, ScramSha256, ScramSha512}
+
+var ErrAuthenticationFailed = errors.New("sasl: authentication failed")
+var ErrUnsupportedMechanism = errors.New("sasl: unsupported mechanism")
+var ErrInvalidMessage = errors.New("sasl: invalid message")
+
+// Session is the server side of one authentication exchange.
+type Session interface {
+	// Next handles a message of the client, returning the message to send
+	// back and whether the client is authenticated.
+	Next(message []byte) (response []byte, done bool, err error)
+	// Username returns the authenticated user once the exchange is done.
+	Username() string
+}
+
+// NewSession starts the server side of an exchange with the mechanism,
+// checking the client credentials against store.
+func NewSession(mechanism string, store CredentialStore) (Session, error) {
+	switch mechanism {
+	case Plain:
+		return &plainSession{store: store}, nil
+	case ScramSha256, ScramSha512:
+		return newScramSession(mechanism, store, newNonce), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMechanism, mechanism)
+	}
+}
@@ -0,0 +1,185 @@
+package sasl
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+type testCredentialStore struct {
+	password   string
+	salt       []byte
+	iterations int
+}
+
+func (s *testCredentialStore) VerifyPassword(username, password string) error {
+	if username != "user" {
+		return ErrUnknownUser
+	}
+
+	if password != s.password {
+		return ErrAuthenticationFailed
+	}
+
+	return nil
+}
+
+func (s *testCredentialStore) ScramCredential(mechanism, username string) (ScramCredential, error) {
+	if username != "user" {
+		return ScramCredential{}, ErrUnknownUser
+	}
+
+	return NewScramCredential(mechanism, s.password, s.salt, s.iterations)
+}
+
+func TestPlain(t *testing.T) {
+	store := &testCredentialStore{password: "pencil"}
+
+	testCases := []struct {
+		message string
+		err     error
+	}{
+		{message: "\x00user\x00pencil"},
+		{message: "user\x00user\x00pencil"},
+		{message: "\x00user\x00pen", err: ErrAuthenticationFailed},
+		{message: "\x00bob\x00pencil", err: ErrAuthenticationFailed},
+		{message: "admin\x00user\x00pencil", err: ErrAuthenticationFailed},
+		{message: "user\x00pencil", err: ErrInvalidMessage},
+	}
+
+	for _, testCase := range testCases {
+		session, _ := NewSession(Plain, store)
+		_, done, err := session.Next([]byte(testCase.message))
+
+		if !errors.Is(err, testCase.err) {
+			t.Fatalf("message: %q, expected: %v, result: %v", testCase.message, testCase.err, err)
+		}
+
+		if done != (testCase.err == nil) {
+			t.Fatalf("message: %q, expected done: %t", testCase.message, testCase.err == nil)
+		}
+
+		if done && session.Username() != "user" {
+			t.Fatalf("expected: user, result: %s", session.Username())
+		}
+	}
+}
+
+// TestScramSha256 runs the example exchange of RFC 7677.
+func TestScramSha256(t *testing.T) {
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	store := &testCredentialStore{password: "pencil", salt: salt, iterations: 4096}
+
+	exchange := []struct {
+		client string
+		server string
+	}{
+		{
+			client: "n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+			server: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		},
+		{
+			client: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			server: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+	}
+
+	session := newScramSession(ScramSha256, store, func() string { return "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0" })
+
+	for i, step := range exchange {
+		response, done, err := session.Next([]byte(step.client))
+
+		if err != nil {
+			t.Fatalf("step %d, unexpected error: %s", i, err)
+		}
+
+		if string(response) != step.server {
+			t.Fatalf("step %d, expected: %s, result: %s", i, step.server, response)
+		}
+
+		if done != (i == len(exchange)-1) {
+			t.Fatalf("step %d, unexpected done: %t", i, done)
+		}
+	}
+
+	if session.Username() != "user" {
+		t.Fatalf("expected: user, result: %s", session.Username())
+	}
+}
+
+func TestScramWrongProof(t *testing.T) {
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	store := &testCredentialStore{password: "pencil", salt: salt, iterations: 4096}
+
+	session := newScramSession(ScramSha256, store, func() string { return "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0" })
+
+	if _, _, err := session.Next([]byte("n,,n=user,r=rOprNGfwEbeRWgbNEkqO")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, done, err := session.Next([]byte(
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=AAAAAapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+	))
+
+	if done || !errors.Is(err, ErrAuthenticationFailed) {
+		t.Fatalf("expected: %v, result: %v", ErrAuthenticationFailed, err)
+	}
+}
+
+func TestMemoryCredentialStore(t *testing.T) {
+	store := NewMemoryCredentialStore()
+
+	if err := store.SetPassword("alice", "secret"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := store.VerifyPassword("alice", "secret"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := store.VerifyPassword("alice", "wrong"); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Fatalf("expected: %v, result: %v", ErrAuthenticationFailed, err)
+	}
+
+	for _, mechanism := range []string{ScramSha256, ScramSha512} {
+		stored, err := store.ScramCredential(mechanism, "alice")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		expected, _ := NewScramCredential(mechanism, "secret", stored.Salt, stored.Iterations)
+
+		if string(expected.StoredKey) != string(stored.StoredKey) || string(expected.ServerKey) != string(stored.ServerKey) {
+			t.Fatalf("mechanism: %s, credential doesn't match the password", mechanism)
+		}
+	}
+
+	store.DeleteUser("alice")
+
+	if _, err := store.ScramCredential(ScramSha256, "alice"); !errors.Is(err, ErrUnknownUser) {
+		t.Fatalf("expected: %v, result: %v", ErrUnknownUser, err)
+	}
+}
+
+func TestScramChannelBindingMismatch(t *testing.T) {
+	salt, _ := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	store := &testCredentialStore{password: "pencil", salt: salt, iterations: 4096}
+
+	for _, channelBinding := range []string{"eSws", "cD10bHMtdW5pcXVlLCw=", ""} {
+		session := newScramSession(ScramSha256, store, func() string { return "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0" })
+
+		if _, _, err := session.Next([]byte("n,,n=user,r=rOprNGfwEbeRWgbNEkqO")); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		// the proof is the one of RFC 7677, valid for c=biws only
+		_, done, err := session.Next([]byte(
+			"c=" + channelBinding + ",r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		))
+
+		if done || !errors.Is(err, ErrAuthenticationFailed) {
+			t.Fatalf("c=%s, expected: %v, result: %v", channelBinding, ErrAuthenticationFailed, err)
+		}
+	}
+}
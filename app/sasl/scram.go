@@ -0,0 +1,252 @@
+package sasl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+func scramHash(mechanism string) (func() hash.Hash, error) {
+	switch mechanism {
+	case ScramSha256:
+		return sha256.New, nil
+	case ScramSha512:
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMechanism, mechanism)
+	}
+}
+
+func hmacSum(hash func() hash.Hash, key, message []byte) []byte {
+	mac := hmac.New(hash, key)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+func hashSum(hash func() hash.Hash, message []byte) []byte {
+	h := hash()
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// pbkdf2 is the Hi function of RFC 5802, PBKDF2 with a single block.
+func pbkdf2(password, salt []byte, iterations int, hash func() hash.Hash) []byte {
+	u := hmacSum(hash, password, append(append([]byte{}, salt...), 0, 0, 0, 1))
+	result := append([]byte{}, u...)
+
+	for range iterations - 1 {
+		u = hmacSum(hash, password, u)
+
+		for i := range result {
+			result[i] ^= u[i]
+		}
+	}
+
+	return result
+}
+
+func newNonce() string {
+	nonce := make([]byte, 24)
+	rand.Read(nonce)
+	return base64.RawStdEncoding.EncodeToString(nonce)
+}
+
+type scramState int
+
+const (
+	scramReceiveClientFirst scramState = iota
+	scramReceiveClientFinal
+	scramDone
+)
+
+// scramSession implements the server side of SCRAM-SHA-256 and
+// SCRAM-SHA-512, see RFC 5802 and RFC 7677.
+type scramSession struct {
+	mechanism   string
+	hash        func() hash.Hash
+	store       CredentialStore
+	nonce       func() string
+	state       scramState
+	username    string
+	credential  ScramCredential
+	clientFirst string
+	serverFirst string
+	gs2Header   string
+	fullNonce   string
+}
+
+func newScramSession(mechanism string, store CredentialStore, nonce func() string) *scramSession {
+	hash, _ := scramHash(mechanism)
+
+	return &scramSession{
+		mechanism: mechanism,
+		hash:      hash,
+		store:     store,
+		nonce:     nonce,
+	}
+}
+
+func (s *scramSession) Next(message []byte) ([]byte, bool, error) {
+	switch s.state {
+	case scramReceiveClientFirst:
+		response, err := s.handleClientFirst(string(message))
+		return response, false, err
+	case scramReceiveClientFinal:
+		response, err := s.handleClientFinal(string(message))
+		return response, err == nil, err
+	default:
+		return nil, false, fmt.Errorf("%w: the exchange is already done", ErrInvalidMessage)
+	}
+}
+
+func (s *scramSession) Username() string {
+	return s.username
+}
+
+// scramAttributes parses the `key=value` attributes of a SCRAM message.
+func scramAttributes(message string) (keys []string, values map[string]string, err error) {
+	values = make(map[string]string)
+
+	for _, attribute := range strings.Split(message, ",") {
+		key, value, found := strings.Cut(attribute, "=")
+
+		if !found {
+			return nil, nil, fmt.Errorf("%w: invalid SCRAM attribute %q", ErrInvalidMessage, attribute)
+		}
+
+		keys = append(keys, key)
+		values[key] = value
+	}
+
+	return keys, values, nil
+}
+
+// scramUsername decodes the saslname escapes, `=2C` for commas and `=3D`
+// for equal signs.
+func scramUsername(saslName string) (string, error) {
+	var username strings.Builder
+
+	for i := 0; i < len(saslName); i++ {
+		if saslName[i] != '=' {
+			username.WriteByte(saslName[i])
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(saslName[i:], "=2C"):
+			username.WriteByte(',')
+		case strings.HasPrefix(saslName[i:], "=3D"):
+			username.WriteByte('=')
+		default:
+			return "", fmt.Errorf("%w: invalid username %q", ErrInvalidMessage, saslName)
+		}
+		i += 2
+	}
+
+	return username.String(), nil
+}
+
+func (s *scramSession) handleClientFirst(message string) ([]byte, error) {
+	// gs2 header: channel binding flag and authorization id
+	flag, rest, found := strings.Cut(message, ",")
+
+	if !found || (flag != "n" && flag != "y") {
+		return nil, fmt.Errorf("%w: channel binding is not supported", ErrInvalidMessage)
+	}
+
+	authorizationId, clientFirstBare, found := strings.Cut(rest, ",")
+
+	if !found {
+		return nil, fmt.Errorf("%w: invalid SCRAM gs2 header", ErrInvalidMessage)
+	}
+
+	keys, values, err := scramAttributes(clientFirstBare)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) < 2 || keys[0] != "n" || keys[1] != "r" || values["r"] == "" {
+		return nil, fmt.Errorf("%w: SCRAM client first message must start with n and r", ErrInvalidMessage)
+	}
+
+	if s.username, err = scramUsername(values["n"]); err != nil {
+		return nil, err
+	}
+
+	if authorizationId != "" && authorizationId != "a="+values["n"] {
+		return nil, fmt.Errorf("%w: authorization id must be the same as the username", ErrAuthenticationFailed)
+	}
+
+	if s.credential, err = s.store.ScramCredential(s.mechanism, s.username); err != nil {
+		return nil, errors.Join(ErrAuthenticationFailed, err)
+	}
+
+	s.clientFirst = clientFirstBare
+	s.gs2Header = flag + "," + authorizationId + ","
+	s.fullNonce = values["r"] + s.nonce()
+	s.serverFirst = "r=" + s.fullNonce +
+		",s=" + base64.StdEncoding.EncodeToString(s.credential.Salt) +
+		",i=" + strconv.Itoa(s.credential.Iterations)
+	s.state = scramReceiveClientFinal
+
+	return []byte(s.serverFirst), nil
+}
+
+func (s *scramSession) handleClientFinal(message string) ([]byte, error) {
+	s.state = scramDone
+
+	withoutProof, proofAttribute, found := strings.Cut(message, ",p=")
+
+	if !found {
+		return nil, fmt.Errorf("%w: SCRAM client final message has no proof", ErrInvalidMessage)
+	}
+
+	_, values, err := scramAttributes(withoutProof)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// without channel binding, c is the gs2 header of client first
+	if values["c"] != base64.StdEncoding.EncodeToString([]byte(s.gs2Header)) {
+		return nil, fmt.Errorf("%w: SCRAM channel binding mismatch", ErrAuthenticationFailed)
+	}
+
+	if values["r"] != s.fullNonce {
+		return nil, fmt.Errorf("%w: SCRAM nonce mismatch", ErrAuthenticationFailed)
+	}
+
+	proof, err := base64.StdEncoding.DecodeString(proofAttribute)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid SCRAM proof", ErrInvalidMessage)
+	}
+
+	authMessage := []byte(s.clientFirst + "," + s.serverFirst + "," + withoutProof)
+	clientSignature := hmacSum(s.hash, s.credential.StoredKey, authMessage)
+
+	if len(proof) != len(clientSignature) {
+		return nil, fmt.Errorf("%w: invalid SCRAM proof", ErrAuthenticationFailed)
+	}
+
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+
+	if !hmac.Equal(hashSum(s.hash, clientKey), s.credential.StoredKey) {
+		return nil, fmt.Errorf("%w: invalid SCRAM proof", ErrAuthenticationFailed)
+	}
+
+	serverSignature := hmacSum(s.hash, s.credential.ServerKey, authMessage)
+
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)), nil
+}
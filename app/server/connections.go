@@ -0,0 +1,243 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ConnectionConfig struct {
+	// MaxConnections is the max.connections of the broker, zero is unlimited.
+	MaxConnections int
+	// MaxConnectionsPerIp is the max.connections.per.ip, zero is unlimited.
+	MaxConnectionsPerIp int
+	// MaxConnectionsPerIpOverrides replaces MaxConnectionsPerIp for some IP
+	// addresses, see ParseMaxConnectionsPerIpOverrides.
+	MaxConnectionsPerIpOverrides map[string]int
+	// MaxConnectionCreationRate is the max.connection.creation.rate, new
+	// connections over it wait before being accepted. Zero is unlimited.
+	MaxConnectionCreationRate float64
+	// MaxIdle is the connections.max.idle.ms, connections without requests
+	// for longer are closed. Zero keeps them open.
+	MaxIdle time.Duration
+	// ReadTimeout bounds the time to read a request once its first byte
+	// arrived and WriteTimeout the time to write a response, zero disables them.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// ParseMaxConnectionsPerIpOverrides parses the max.connections.per.ip.overrides,
+// a comma separated list of `ip:count` pairs.
+func ParseMaxConnectionsPerIpOverrides(overrides string) (map[string]int, error) {
+	parsed := make(map[string]int)
+
+	for _, override := range strings.Split(overrides, ",") {
+		override = strings.TrimSpace(override)
+
+		if override == "" {
+			continue
+		}
+
+		separator := strings.LastIndexByte(override, ':')
+
+		if separator < 0 {
+			return nil, fmt.Errorf("server: invalid max.connections.per.ip.overrides entry %q", override)
+		}
+
+		ip := net.ParseIP(strings.Trim(override[:separator], "[]"))
+		count, err := strconv.Atoi(override[separator+1:])
+
+		if ip == nil || err != nil || count < 0 {
+			return nil, fmt.Errorf("server: invalid max.connections.per.ip.overrides entry %q", override)
+		}
+
+		parsed[ip.String()] = count
+	}
+
+	return parsed, nil
+}
+
+var ErrTooManyConnections = errors.New("server: too many connections")
+var ErrTooManyConnectionsPerIp = errors.New("server: too many connections from the same ip")
+var errIdleConnection = errors.New("server: connection idle for longer than connections.max.idle.ms")
+
+type ConnectionStats struct {
+	Active   int
+	Accepted int64
+	Rejected int64
+	// IdleClosed counts the connections closed by MaxIdle.
+	IdleClosed int64
+}
+
+// connectionLimiter counts the open connections of the server, refusing the
+// ones over the limits of its ConnectionConfig.
+type connectionLimiter struct {
+	mutex      sync.Mutex
+	config     ConnectionConfig
+	throttler  *RateThrottler
+	active     int
+	perIp      map[string]int
+	accepted   atomic.Int64
+	rejected   atomic.Int64
+	idleClosed atomic.Int64
+}
+
+func newConnectionLimiter() *connectionLimiter {
+	return &connectionLimiter{
+		perIp: make(map[string]int),
+	}
+}
+
+func (cl *connectionLimiter) setConfig(config ConnectionConfig) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.config = config
+	cl.throttler = nil
+
+	if config.MaxConnectionCreationRate > 0 {
+		cl.throttler = NewRateThrottler(config.MaxConnectionCreationRate, max(1, int(config.MaxConnectionCreationRate)))
+	}
+}
+
+func (cl *connectionLimiter) currentConfig() ConnectionConfig {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	return cl.config
+}
+
+// creationDelay returns for how long the next connection must wait to keep
+// the creation rate.
+func (cl *connectionLimiter) creationDelay() time.Duration {
+	cl.mutex.Lock()
+	throttler := cl.throttler
+	cl.mutex.Unlock()
+
+	if throttler == nil {
+		return 0
+	}
+
+	return throttler.Throttle(nil)
+}
+
+// maxConnectionsPerIp returns the limit of ip and whether it is enforced,
+// an override of zero refuses every connection of the ip.
+func (cl *connectionLimiter) maxConnectionsPerIp(ip string) (int, bool) {
+	if count, found := cl.config.MaxConnectionsPerIpOverrides[ip]; found {
+		return count, true
+	}
+
+	return cl.config.MaxConnectionsPerIp, cl.config.MaxConnectionsPerIp > 0
+}
+
+// acquire counts a new connection from ip, failing when it goes over a limit.
+func (cl *connectionLimiter) acquire(ip string) error {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	if cl.config.MaxConnections > 0 && cl.active >= cl.config.MaxConnections {
+		cl.rejected.Add(1)
+		return fmt.Errorf("%w: the limit is %d", ErrTooManyConnections, cl.config.MaxConnections)
+	}
+
+	if limit, enforced := cl.maxConnectionsPerIp(ip); enforced && cl.perIp[ip] >= limit {
+		cl.rejected.Add(1)
+		return fmt.Errorf("%w: the limit of %s is %d", ErrTooManyConnectionsPerIp, ip, limit)
+	}
+
+	cl.active++
+	cl.perIp[ip]++
+	cl.accepted.Add(1)
+
+	return nil
+}
+
+func (cl *connectionLimiter) release(ip string) {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	cl.active--
+	cl.perIp[ip]--
+
+	if cl.perIp[ip] <= 0 {
+		delete(cl.perIp, ip)
+	}
+}
+
+func (cl *connectionLimiter) stats() ConnectionStats {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	return ConnectionStats{
+		Active:     cl.active,
+		Accepted:   cl.accepted.Load(),
+		Rejected:   cl.rejected.Load(),
+		IdleClosed: cl.idleClosed.Load(),
+	}
+}
+
+// SetConnectionConfig sets the limits and timeouts of the connections, the
+// open connections are kept even if they are over the new limits.
+func (ks *KafkaServer) SetConnectionConfig(config ConnectionConfig) {
+	ks.connections.setConfig(config)
+}
+
+func (ks *KafkaServer) ConnectionStats() ConnectionStats {
+	return ks.connections.stats()
+}
+
+func remoteIp(connection net.Conn) string {
+	host, _, err := net.SplitHostPort(connection.RemoteAddr().String())
+
+	if err != nil {
+		return connection.RemoteAddr().String()
+	}
+
+	return host
+}
+
+// deadlineReader sets the read deadline of the connection before each read,
+// the first read of a request waits up to idle and the next ones up to
+// timeout.
+type deadlineReader struct {
+	connection net.Conn
+	idle       time.Duration
+	timeout    time.Duration
+	started    bool
+}
+
+func (dr *deadlineReader) Read(p []byte) (n int, err error) {
+	timeout := dr.timeout
+
+	if !dr.started {
+		timeout = dr.idle
+	}
+
+	deadline := time.Time{}
+
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	if err = dr.connection.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	n, err = dr.connection.Read(p)
+
+	var netError net.Error
+
+	if !dr.started && errors.As(err, &netError) && netError.Timeout() {
+		return n, fmt.Errorf("%w: %w", errIdleConnection, err)
+	}
+
+	dr.started = dr.started || n > 0
+
+	return n, err
+}
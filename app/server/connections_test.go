@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseMaxConnectionsPerIpOverrides(t *testing.T) {
+	result, err := ParseMaxConnectionsPerIpOverrides("127.0.0.1:10, [::1]:0,192.168.0.7:200")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]int{"127.0.0.1": 10, "::1": 0, "192.168.0.7": 200}
+
+	if len(result) != len(expected) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+
+	for ip, count := range expected {
+		if result[ip] != count {
+			t.Fatalf("expected: %v, result: %v", expected, result)
+		}
+	}
+
+	for _, overrides := range []string{"127.0.0.1", "localhost:10", "127.0.0.1:-1"} {
+		if _, err := ParseMaxConnectionsPerIpOverrides(overrides); err == nil {
+			t.Fatalf("overrides: %q, expected an error", overrides)
+		}
+	}
+}
+
+func serveTestListener(t *testing.T, ks *KafkaServer) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go ks.ServeListener(DefaultListenerName, listener)
+
+	return listener.Addr().String()
+}
+
+func dialTest(t *testing.T, addr string) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestMaxConnectionsPerIp(t *testing.T) {
+	ks := newTestServer(t)
+	Handle(ks, ApiVersions, ApiVersionRange{0, 4}, handleVersions)
+	ks.SetConnectionConfig(ConnectionConfig{MaxConnectionsPerIp: 1})
+
+	addr := serveTestListener(t, ks)
+
+	if _, err := roundTrip(dialTest(t, addr), ApiVersions, 4, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := roundTrip(dialTest(t, addr), ApiVersions, 4, nil); err == nil {
+		t.Fatal("the second connection of the ip should be rejected")
+	}
+
+	ks.SetConnectionConfig(ConnectionConfig{
+		MaxConnectionsPerIp:          1,
+		MaxConnectionsPerIpOverrides: map[string]int{"127.0.0.1": 2},
+	})
+
+	if _, err := roundTrip(dialTest(t, addr), ApiVersions, 4, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if stats := ks.ConnectionStats(); stats.Active != 2 || stats.Rejected != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestIdleConnectionsAreClosed(t *testing.T) {
+	ks := newTestServer(t)
+	Handle(ks, ApiVersions, ApiVersionRange{0, 4}, handleVersions)
+	ks.SetConnectionConfig(ConnectionConfig{MaxIdle: 50 * time.Millisecond})
+
+	conn := dialTest(t, serveTestListener(t, ks))
+
+	if _, err := roundTrip(conn, ApiVersions, 4, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := roundTrip(conn, ApiVersions, 4, nil); err == nil {
+		t.Fatal("the idle connection should be closed")
+	}
+
+	if stats := ks.ConnectionStats(); stats.Active != 0 || stats.IdleClosed != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
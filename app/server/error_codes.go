@@ -0,0 +1,334 @@
+package server
+
+import "fmt"
+
+// The error codes of the kafka protocol, see
+// https://kafka.apache.org/protocol.html#protocol_error_codes
+const (
+	ErrUnknownServerError                 ErrorCode = -1
+	ErrNone                               ErrorCode = 0
+	ErrOffsetOutOfRange                   ErrorCode = 1
+	ErrCorruptMessage                     ErrorCode = 2
+	ErrUnknownTopicOrPartition            ErrorCode = 3
+	ErrInvalidFetchSize                   ErrorCode = 4
+	ErrLeaderNotAvailable                 ErrorCode = 5
+	ErrNotLeaderOrFollower                ErrorCode = 6
+	ErrRequestTimedOut                    ErrorCode = 7
+	ErrBrokerNotAvailable                 ErrorCode = 8
+	ErrReplicaNotAvailable                ErrorCode = 9
+	ErrMessageTooLarge                    ErrorCode = 10
+	ErrStaleControllerEpoch               ErrorCode = 11
+	ErrOffsetMetadataTooLarge             ErrorCode = 12
+	ErrNetwork                            ErrorCode = 13
+	ErrCoordinatorLoadInProgress          ErrorCode = 14
+	ErrCoordinatorNotAvailable            ErrorCode = 15
+	ErrNotCoordinator                     ErrorCode = 16
+	ErrInvalidTopic                       ErrorCode = 17
+	ErrRecordListTooLarge                 ErrorCode = 18
+	ErrNotEnoughReplicas                  ErrorCode = 19
+	ErrNotEnoughReplicasAfterAppend       ErrorCode = 20
+	ErrInvalidRequiredAcks                ErrorCode = 21
+	ErrIllegalGeneration                  ErrorCode = 22
+	ErrInconsistentGroupProtocol          ErrorCode = 23
+	ErrInvalidGroupId                     ErrorCode = 24
+	ErrUnknownMemberId                    ErrorCode = 25
+	ErrInvalidSessionTimeout              ErrorCode = 26
+	ErrRebalanceInProgress                ErrorCode = 27
+	ErrInvalidCommitOffsetSize            ErrorCode = 28
+	ErrTopicAuthorizationFailed           ErrorCode = 29
+	ErrGroupAuthorizationFailed           ErrorCode = 30
+	ErrClusterAuthorizationFailed         ErrorCode = 31
+	ErrInvalidTimestamp                   ErrorCode = 32
+	ErrUnsupportedSaslMechanism           ErrorCode = 33
+	ErrIllegalSaslState                   ErrorCode = 34
+	ErrUnsupportedVersion                 ErrorCode = 35
+	ErrTopicAlreadyExists                 ErrorCode = 36
+	ErrInvalidPartitions                  ErrorCode = 37
+	ErrInvalidReplicationFactor           ErrorCode = 38
+	ErrInvalidReplicaAssignment           ErrorCode = 39
+	ErrInvalidConfig                      ErrorCode = 40
+	ErrNotController                      ErrorCode = 41
+	ErrInvalidRequest                     ErrorCode = 42
+	ErrUnsupportedForMessageFormat        ErrorCode = 43
+	ErrPolicyViolation                    ErrorCode = 44
+	ErrOutOfOrderSequenceNumber           ErrorCode = 45
+	ErrDuplicateSequenceNumber            ErrorCode = 46
+	ErrInvalidProducerEpoch               ErrorCode = 47
+	ErrInvalidTxnState                    ErrorCode = 48
+	ErrInvalidProducerIdMapping           ErrorCode = 49
+	ErrInvalidTransactionTimeout          ErrorCode = 50
+	ErrConcurrentTransactions             ErrorCode = 51
+	ErrTransactionCoordinatorFenced       ErrorCode = 52
+	ErrTransactionalIdAuthorizationFailed ErrorCode = 53
+	ErrSecurityDisabled                   ErrorCode = 54
+	ErrOperationNotAttempted              ErrorCode = 55
+	ErrKafkaStorageError                  ErrorCode = 56
+	ErrLogDirNotFound                     ErrorCode = 57
+	ErrSaslAuthenticationFailed           ErrorCode = 58
+	ErrUnknownProducerId                  ErrorCode = 59
+	ErrReassignmentInProgress             ErrorCode = 60
+	ErrDelegationTokenAuthDisabled        ErrorCode = 61
+	ErrDelegationTokenNotFound            ErrorCode = 62
+	ErrDelegationTokenOwnerMismatch       ErrorCode = 63
+	ErrDelegationTokenRequestNotAllowed   ErrorCode = 64
+	ErrDelegationTokenAuthorizationFailed ErrorCode = 65
+	ErrDelegationTokenExpired             ErrorCode = 66
+	ErrInvalidPrincipalType               ErrorCode = 67
+	ErrNonEmptyGroup                      ErrorCode = 68
+	ErrGroupIdNotFound                    ErrorCode = 69
+	ErrFetchSessionIdNotFound             ErrorCode = 70
+	ErrInvalidFetchSessionEpoch           ErrorCode = 71
+	ErrListenerNotFound                   ErrorCode = 72
+	ErrTopicDeletionDisabled              ErrorCode = 73
+	ErrFencedLeaderEpoch                  ErrorCode = 74
+	ErrUnknownLeaderEpoch                 ErrorCode = 75
+	ErrUnsupportedCompressionType         ErrorCode = 76
+	ErrStaleBrokerEpoch                   ErrorCode = 77
+	ErrOffsetNotAvailable                 ErrorCode = 78
+	ErrMemberIdRequired                   ErrorCode = 79
+	ErrPreferredLeaderNotAvailable        ErrorCode = 80
+	ErrGroupMaxSizeReached                ErrorCode = 81
+	ErrFencedInstanceId                   ErrorCode = 82
+	ErrEligibleLeadersNotAvailable        ErrorCode = 83
+	ErrElectionNotNeeded                  ErrorCode = 84
+	ErrNoReassignmentInProgress           ErrorCode = 85
+	ErrGroupSubscribedToTopic             ErrorCode = 86
+	ErrInvalidRecord                      ErrorCode = 87
+	ErrUnstableOffsetCommit               ErrorCode = 88
+	ErrThrottlingQuotaExceeded            ErrorCode = 89
+	ErrProducerFenced                     ErrorCode = 90
+	ErrResourceNotFound                   ErrorCode = 91
+	ErrDuplicateResource                  ErrorCode = 92
+	ErrUnacceptableCredential             ErrorCode = 93
+	ErrInconsistentVoterSet               ErrorCode = 94
+	ErrInvalidUpdateVersion               ErrorCode = 95
+	ErrFeatureUpdateFailed                ErrorCode = 96
+	ErrPrincipalDeserializationFailure    ErrorCode = 97
+	ErrSnapshotNotFound                   ErrorCode = 98
+	ErrPositionOutOfRange                 ErrorCode = 99
+	ErrUnknownTopicId                     ErrorCode = 100
+	ErrDuplicateBrokerRegistration        ErrorCode = 101
+	ErrBrokerIdNotRegistered              ErrorCode = 102
+	ErrInconsistentTopicId                ErrorCode = 103
+	ErrInconsistentClusterId              ErrorCode = 104
+	ErrTransactionalIdNotFound            ErrorCode = 105
+	ErrFetchSessionTopicIdError           ErrorCode = 106
+	ErrIneligibleReplica                  ErrorCode = 107
+	ErrNewLeaderElected                   ErrorCode = 108
+	ErrOffsetMovedToTieredStorage         ErrorCode = 109
+	ErrFencedMemberEpoch                  ErrorCode = 110
+	ErrUnreleasedInstanceId               ErrorCode = 111
+	ErrUnsupportedAssignor                ErrorCode = 112
+	ErrStaleMemberEpoch                   ErrorCode = 113
+	ErrMismatchedEndpointType             ErrorCode = 114
+	ErrUnsupportedEndpointType            ErrorCode = 115
+	ErrUnknownControllerId                ErrorCode = 116
+	ErrUnknownSubscriptionId              ErrorCode = 117
+	ErrTelemetryTooLarge                  ErrorCode = 118
+	ErrInvalidRegistration                ErrorCode = 119
+	ErrTransactionAbortable               ErrorCode = 120
+	ErrInvalidRecordState                 ErrorCode = 121
+	ErrShareSessionNotFound               ErrorCode = 122
+	ErrInvalidShareSessionEpoch           ErrorCode = 123
+	ErrFencedStateEpoch                   ErrorCode = 124
+	ErrInvalidVoterKey                    ErrorCode = 125
+	ErrDuplicateVoter                     ErrorCode = 126
+	ErrVoterNotFound                      ErrorCode = 127
+	ErrInvalidRegularExpression           ErrorCode = 128
+	ErrRebootstrapRequired                ErrorCode = 129
+)
+
+type errorCodeInfo struct {
+	name            string
+	message         string
+	retriable       bool
+	invalidMetadata bool
+}
+
+var errorCodes = map[ErrorCode]errorCodeInfo{
+	ErrUnknownServerError:                 {"UNKNOWN_SERVER_ERROR", "The server experienced an unexpected error when processing the request.", false, false},
+	ErrNone:                               {"NONE", "", false, false},
+	ErrOffsetOutOfRange:                   {"OFFSET_OUT_OF_RANGE", "The requested offset is not within the range of offsets maintained by the server.", false, false},
+	ErrCorruptMessage:                     {"CORRUPT_MESSAGE", "This message has failed its CRC checksum, exceeds the valid size, has a null key for a compacted topic, or is otherwise corrupt.", true, false},
+	ErrUnknownTopicOrPartition:            {"UNKNOWN_TOPIC_OR_PARTITION", "This server does not host this topic-partition.", true, true},
+	ErrInvalidFetchSize:                   {"INVALID_FETCH_SIZE", "The requested fetch size is invalid.", false, false},
+	ErrLeaderNotAvailable:                 {"LEADER_NOT_AVAILABLE", "There is no leader for this topic-partition as we are in the middle of a leadership election.", true, true},
+	ErrNotLeaderOrFollower:                {"NOT_LEADER_OR_FOLLOWER", "For requests intended only for the leader, this error indicates that the broker is not the current leader. For requests intended for any replica, this error indicates that the broker is not a replica of the topic partition.", true, true},
+	ErrRequestTimedOut:                    {"REQUEST_TIMED_OUT", "The request timed out.", true, false},
+	ErrBrokerNotAvailable:                 {"BROKER_NOT_AVAILABLE", "The broker is not available.", false, false},
+	ErrReplicaNotAvailable:                {"REPLICA_NOT_AVAILABLE", "The replica is not available for the requested topic-partition. Produce/Fetch requests and other requests intended only for the leader or follower return NOT_LEADER_OR_FOLLOWER if the broker is not a replica of the topic-partition.", true, true},
+	ErrMessageTooLarge:                    {"MESSAGE_TOO_LARGE", "The request included a message larger than the max message size the server will accept.", false, false},
+	ErrStaleControllerEpoch:               {"STALE_CONTROLLER_EPOCH", "The controller moved to another broker.", false, false},
+	ErrOffsetMetadataTooLarge:             {"OFFSET_METADATA_TOO_LARGE", "The metadata field of the offset request was too large.", false, false},
+	ErrNetwork:                            {"NETWORK_EXCEPTION", "The server disconnected before a response was received.", true, true},
+	ErrCoordinatorLoadInProgress:          {"COORDINATOR_LOAD_IN_PROGRESS", "The coordinator is loading and hence can't process requests.", true, false},
+	ErrCoordinatorNotAvailable:            {"COORDINATOR_NOT_AVAILABLE", "The coordinator is not available.", true, false},
+	ErrNotCoordinator:                     {"NOT_COORDINATOR", "This is not the correct coordinator.", true, false},
+	ErrInvalidTopic:                       {"INVALID_TOPIC_EXCEPTION", "The request attempted to perform an operation on an invalid topic.", false, false},
+	ErrRecordListTooLarge:                 {"RECORD_LIST_TOO_LARGE", "The request included message batch larger than the configured segment size on the server.", false, false},
+	ErrNotEnoughReplicas:                  {"NOT_ENOUGH_REPLICAS", "Messages are rejected since there are fewer in-sync replicas than required.", true, false},
+	ErrNotEnoughReplicasAfterAppend:       {"NOT_ENOUGH_REPLICAS_AFTER_APPEND", "Messages are written to the log, but to fewer in-sync replicas than required.", true, false},
+	ErrInvalidRequiredAcks:                {"INVALID_REQUIRED_ACKS", "Produce request specified an invalid value for required acks.", false, false},
+	ErrIllegalGeneration:                  {"ILLEGAL_GENERATION", "Specified group generation id is not valid.", false, false},
+	ErrInconsistentGroupProtocol:          {"INCONSISTENT_GROUP_PROTOCOL", "The group member's supported protocols are incompatible with those of existing members or first group member tried to join with empty protocol type or empty protocol list.", false, false},
+	ErrInvalidGroupId:                     {"INVALID_GROUP_ID", "The configured groupId is invalid.", false, false},
+	ErrUnknownMemberId:                    {"UNKNOWN_MEMBER_ID", "The coordinator is not aware of this member.", false, false},
+	ErrInvalidSessionTimeout:              {"INVALID_SESSION_TIMEOUT", "The session timeout is not within the range allowed by the broker (as configured by group.min.session.timeout.ms and group.max.session.timeout.ms).", false, false},
+	ErrRebalanceInProgress:                {"REBALANCE_IN_PROGRESS", "The group is rebalancing, so a rejoin is needed.", false, false},
+	ErrInvalidCommitOffsetSize:            {"INVALID_COMMIT_OFFSET_SIZE", "The committing offset data size is not valid.", false, false},
+	ErrTopicAuthorizationFailed:           {"TOPIC_AUTHORIZATION_FAILED", "Topic authorization failed.", false, false},
+	ErrGroupAuthorizationFailed:           {"GROUP_AUTHORIZATION_FAILED", "Group authorization failed.", false, false},
+	ErrClusterAuthorizationFailed:         {"CLUSTER_AUTHORIZATION_FAILED", "Cluster authorization failed.", false, false},
+	ErrInvalidTimestamp:                   {"INVALID_TIMESTAMP", "The timestamp of the message is out of acceptable range.", false, false},
+	ErrUnsupportedSaslMechanism:           {"UNSUPPORTED_SASL_MECHANISM", "The broker does not support the requested SASL mechanism.", false, false},
+	ErrIllegalSaslState:                   {"ILLEGAL_SASL_STATE", "Request is not valid given the current SASL state.", false, false},
+	ErrUnsupportedVersion:                 {"UNSUPPORTED_VERSION", "The version of API is not supported.", false, false},
+	ErrTopicAlreadyExists:                 {"TOPIC_ALREADY_EXISTS", "Topic with this name already exists.", false, false},
+	ErrInvalidPartitions:                  {"INVALID_PARTITIONS", "Number of partitions is below 1.", false, false},
+	ErrInvalidReplicationFactor:           {"INVALID_REPLICATION_FACTOR", "Replication factor is below 1 or larger than the number of available brokers.", false, false},
+	ErrInvalidReplicaAssignment:           {"INVALID_REPLICA_ASSIGNMENT", "Replica assignment is invalid.", false, false},
+	ErrInvalidConfig:                      {"INVALID_CONFIG", "Configuration is invalid.", false, false},
+	ErrNotController:                      {"NOT_CONTROLLER", "This is not the correct controller for this cluster.", true, false},
+	ErrInvalidRequest:                     {"INVALID_REQUEST", "This most likely occurs because of a request being malformed by the client library or the message was sent to an incompatible broker. See the broker logs for more details.", false, false},
+	ErrUnsupportedForMessageFormat:        {"UNSUPPORTED_FOR_MESSAGE_FORMAT", "The message format version on the broker does not support the request.", false, false},
+	ErrPolicyViolation:                    {"POLICY_VIOLATION", "Request parameters do not satisfy the configured policy.", false, false},
+	ErrOutOfOrderSequenceNumber:           {"OUT_OF_ORDER_SEQUENCE_NUMBER", "The broker received an out of order sequence number.", false, false},
+	ErrDuplicateSequenceNumber:            {"DUPLICATE_SEQUENCE_NUMBER", "The broker received a duplicate sequence number.", false, false},
+	ErrInvalidProducerEpoch:               {"INVALID_PRODUCER_EPOCH", "Producer attempted to produce with an old epoch.", false, false},
+	ErrInvalidTxnState:                    {"INVALID_TXN_STATE", "The producer attempted a transactional operation in an invalid state.", false, false},
+	ErrInvalidProducerIdMapping:           {"INVALID_PRODUCER_ID_MAPPING", "The producer attempted to use a producer id which is not currently assigned to its transactional id.", false, false},
+	ErrInvalidTransactionTimeout:          {"INVALID_TRANSACTION_TIMEOUT", "The transaction timeout is larger than the maximum value allowed by the broker (as configured by transaction.max.timeout.ms).", false, false},
+	ErrConcurrentTransactions:             {"CONCURRENT_TRANSACTIONS", "The producer attempted to update a transaction while another concurrent operation on the same transaction was ongoing.", true, false},
+	ErrTransactionCoordinatorFenced:       {"TRANSACTION_COORDINATOR_FENCED", "Indicates that the transaction coordinator sending a WriteTxnMarker is no longer the current coordinator for a given producer.", false, false},
+	ErrTransactionalIdAuthorizationFailed: {"TRANSACTIONAL_ID_AUTHORIZATION_FAILED", "Transactional Id authorization failed.", false, false},
+	ErrSecurityDisabled:                   {"SECURITY_DISABLED", "Security features are disabled.", false, false},
+	ErrOperationNotAttempted:              {"OPERATION_NOT_ATTEMPTED", "The broker did not attempt to execute this operation. This may happen for batched RPCs where some operations in the batch failed, causing the broker to respond without trying the rest.", false, false},
+	ErrKafkaStorageError:                  {"KAFKA_STORAGE_ERROR", "Disk error when trying to access log file on the disk.", true, true},
+	ErrLogDirNotFound:                     {"LOG_DIR_NOT_FOUND", "The user-specified log directory is not found in the broker config.", false, false},
+	ErrSaslAuthenticationFailed:           {"SASL_AUTHENTICATION_FAILED", "SASL Authentication failed.", false, false},
+	ErrUnknownProducerId:                  {"UNKNOWN_PRODUCER_ID", "This exception is raised by the broker if it could not locate the producer metadata associated with the producerId in question. This could happen if, for instance, the producer's records were deleted because their retention time had elapsed. Once the last records of the producerId are removed, the producer's metadata is removed from the broker, and future appends by the producer will return this exception.", false, false},
+	ErrReassignmentInProgress:             {"REASSIGNMENT_IN_PROGRESS", "A partition reassignment is in progress.", false, false},
+	ErrDelegationTokenAuthDisabled:        {"DELEGATION_TOKEN_AUTH_DISABLED", "Delegation Token feature is not enabled.", false, false},
+	ErrDelegationTokenNotFound:            {"DELEGATION_TOKEN_NOT_FOUND", "Delegation Token is not found on server.", false, false},
+	ErrDelegationTokenOwnerMismatch:       {"DELEGATION_TOKEN_OWNER_MISMATCH", "Specified Principal is not valid Owner/Renewer.", false, false},
+	ErrDelegationTokenRequestNotAllowed:   {"DELEGATION_TOKEN_REQUEST_NOT_ALLOWED", "Delegation Token requests are not allowed on PLAINTEXT/1-way SSL channels and on delegation token authenticated channels.", false, false},
+	ErrDelegationTokenAuthorizationFailed: {"DELEGATION_TOKEN_AUTHORIZATION_FAILED", "Delegation Token authorization failed.", false, false},
+	ErrDelegationTokenExpired:             {"DELEGATION_TOKEN_EXPIRED", "Delegation Token is expired.", false, false},
+	ErrInvalidPrincipalType:               {"INVALID_PRINCIPAL_TYPE", "Supplied principalType is not supported.", false, false},
+	ErrNonEmptyGroup:                      {"NON_EMPTY_GROUP", "The group is not empty.", false, false},
+	ErrGroupIdNotFound:                    {"GROUP_ID_NOT_FOUND", "The group id does not exist.", false, false},
+	ErrFetchSessionIdNotFound:             {"FETCH_SESSION_ID_NOT_FOUND", "The fetch session ID was not found.", true, false},
+	ErrInvalidFetchSessionEpoch:           {"INVALID_FETCH_SESSION_EPOCH", "The fetch session epoch is invalid.", true, false},
+	ErrListenerNotFound:                   {"LISTENER_NOT_FOUND", "There is no listener on the leader broker that matches the listener on which metadata request was processed.", true, true},
+	ErrTopicDeletionDisabled:              {"TOPIC_DELETION_DISABLED", "Topic deletion is disabled.", false, false},
+	ErrFencedLeaderEpoch:                  {"FENCED_LEADER_EPOCH", "The leader epoch in the request is older than the epoch on the broker.", true, true},
+	ErrUnknownLeaderEpoch:                 {"UNKNOWN_LEADER_EPOCH", "The leader epoch in the request is newer than the epoch on the broker.", true, false},
+	ErrUnsupportedCompressionType:         {"UNSUPPORTED_COMPRESSION_TYPE", "The requesting client does not support the compression type of given partition.", false, false},
+	ErrStaleBrokerEpoch:                   {"STALE_BROKER_EPOCH", "Broker epoch has changed.", false, false},
+	ErrOffsetNotAvailable:                 {"OFFSET_NOT_AVAILABLE", "The leader high watermark has not caught up from a recent leader election so the offsets cannot be guaranteed to be monotonically increasing.", true, false},
+	ErrMemberIdRequired:                   {"MEMBER_ID_REQUIRED", "The group member needs to have a valid member id before actually entering a consumer group.", false, false},
+	ErrPreferredLeaderNotAvailable:        {"PREFERRED_LEADER_NOT_AVAILABLE", "The preferred leader was not available.", true, true},
+	ErrGroupMaxSizeReached:                {"GROUP_MAX_SIZE_REACHED", "The group has reached its maximum size.", false, false},
+	ErrFencedInstanceId:                   {"FENCED_INSTANCE_ID", "The broker rejected this static consumer since another consumer with the same group.instance.id has registered with a different member.id.", false, false},
+	ErrEligibleLeadersNotAvailable:        {"ELIGIBLE_LEADERS_NOT_AVAILABLE", "Eligible topic partition leaders are not available.", true, true},
+	ErrElectionNotNeeded:                  {"ELECTION_NOT_NEEDED", "Leader election not needed for topic partition.", true, true},
+	ErrNoReassignmentInProgress:           {"NO_REASSIGNMENT_IN_PROGRESS", "No partition reassignment is in progress.", false, false},
+	ErrGroupSubscribedToTopic:             {"GROUP_SUBSCRIBED_TO_TOPIC", "Deleting offsets of a topic is forbidden while the consumer group is actively subscribed to it.", false, false},
+	ErrInvalidRecord:                      {"INVALID_RECORD", "This record has failed the validation on broker and hence will be rejected.", false, false},
+	ErrUnstableOffsetCommit:               {"UNSTABLE_OFFSET_COMMIT", "There are unstable offsets that need to be cleared.", true, false},
+	ErrThrottlingQuotaExceeded:            {"THROTTLING_QUOTA_EXCEEDED", "The throttling quota has been exceeded.", true, false},
+	ErrProducerFenced:                     {"PRODUCER_FENCED", "There is a newer producer with the same transactionalId which fences the current one.", false, false},
+	ErrResourceNotFound:                   {"RESOURCE_NOT_FOUND", "A request illegally referred to a resource that does not exist.", false, false},
+	ErrDuplicateResource:                  {"DUPLICATE_RESOURCE", "A request illegally referred to the same resource twice.", false, false},
+	ErrUnacceptableCredential:             {"UNACCEPTABLE_CREDENTIAL", "Requested credential would not meet criteria for acceptability.", false, false},
+	ErrInconsistentVoterSet:               {"INCONSISTENT_VOTER_SET", "Indicates that the either the sender or recipient of a voter-only request is not one of the expected voters.", false, false},
+	ErrInvalidUpdateVersion:               {"INVALID_UPDATE_VERSION", "The given update version was invalid.", false, false},
+	ErrFeatureUpdateFailed:                {"FEATURE_UPDATE_FAILED", "Unable to update finalized features due to an unexpected server error.", false, false},
+	ErrPrincipalDeserializationFailure:    {"PRINCIPAL_DESERIALIZATION_FAILURE", "Request principal deserialization failed during forwarding. This indicates an internal error on the broker cluster security setup.", false, false},
+	ErrSnapshotNotFound:                   {"SNAPSHOT_NOT_FOUND", "Requested snapshot was not found.", false, false},
+	ErrPositionOutOfRange:                 {"POSITION_OUT_OF_RANGE", "Requested position is not greater than or equal to zero, and less than the size of the snapshot.", false, false},
+	ErrUnknownTopicId:                     {"UNKNOWN_TOPIC_ID", "This server does not host this topic ID.", true, true},
+	ErrDuplicateBrokerRegistration:        {"DUPLICATE_BROKER_REGISTRATION", "This broker ID is already in use.", false, false},
+	ErrBrokerIdNotRegistered:              {"BROKER_ID_NOT_REGISTERED", "The given broker ID was not registered.", false, false},
+	ErrInconsistentTopicId:                {"INCONSISTENT_TOPIC_ID", "The log's topic ID did not match the topic ID in the request.", true, true},
+	ErrInconsistentClusterId:              {"INCONSISTENT_CLUSTER_ID", "The clusterId in the request does not match that found on the server.", false, false},
+	ErrTransactionalIdNotFound:            {"TRANSACTIONAL_ID_NOT_FOUND", "The transactionalId could not be found.", false, false},
+	ErrFetchSessionTopicIdError:           {"FETCH_SESSION_TOPIC_ID_ERROR", "The fetch session encountered inconsistent topic ID usage.", true, false},
+	ErrIneligibleReplica:                  {"INELIGIBLE_REPLICA", "The new ISR contains at least one ineligible replica.", false, false},
+	ErrNewLeaderElected:                   {"NEW_LEADER_ELECTED", "The AlterPartition request successfully updated the partition state but the leader has changed.", false, false},
+	ErrOffsetMovedToTieredStorage:         {"OFFSET_MOVED_TO_TIERED_STORAGE", "The requested offset is moved to tiered storage.", false, false},
+	ErrFencedMemberEpoch:                  {"FENCED_MEMBER_EPOCH", "The member epoch is fenced by the group coordinator. The member must abandon all its partitions and rejoin.", false, false},
+	ErrUnreleasedInstanceId:               {"UNRELEASED_INSTANCE_ID", "The instance ID is still used by another member in the consumer group. That member must leave first.", false, false},
+	ErrUnsupportedAssignor:                {"UNSUPPORTED_ASSIGNOR", "The assignor or its version range is not supported by the consumer group.", false, false},
+	ErrStaleMemberEpoch:                   {"STALE_MEMBER_EPOCH", "The member epoch is stale. The member must retry after receiving its updated member epoch via the ConsumerGroupHeartbeat API.", false, false},
+	ErrMismatchedEndpointType:             {"MISMATCHED_ENDPOINT_TYPE", "The request was sent to an endpoint of the wrong type.", false, false},
+	ErrUnsupportedEndpointType:            {"UNSUPPORTED_ENDPOINT_TYPE", "This endpoint type is not supported yet.", false, false},
+	ErrUnknownControllerId:                {"UNKNOWN_CONTROLLER_ID", "This controller ID is not known.", false, false},
+	ErrUnknownSubscriptionId:              {"UNKNOWN_SUBSCRIPTION_ID", "Client sent a push telemetry request with an invalid or outdated subscription ID.", false, false},
+	ErrTelemetryTooLarge:                  {"TELEMETRY_TOO_LARGE", "Client sent a push telemetry request larger than the maximum size the broker will accept.", false, false},
+	ErrInvalidRegistration:                {"INVALID_REGISTRATION", "The controller has considered the broker registration to be invalid.", false, false},
+	ErrTransactionAbortable:               {"TRANSACTION_ABORTABLE", "The server encountered an error with the transaction. The client can abort the transaction to continue using this transactional ID.", false, false},
+	ErrInvalidRecordState:                 {"INVALID_RECORD_STATE", "The record state is invalid. The acknowledgement of delivery could not be completed.", false, false},
+	ErrShareSessionNotFound:               {"SHARE_SESSION_NOT_FOUND", "The share session was not found.", true, false},
+	ErrInvalidShareSessionEpoch:           {"INVALID_SHARE_SESSION_EPOCH", "The share session epoch is invalid.", true, false},
+	ErrFencedStateEpoch:                   {"FENCED_STATE_EPOCH", "The share coordinator rejected the request because the share-group state epoch did not match.", false, false},
+	ErrInvalidVoterKey:                    {"INVALID_VOTER_KEY", "The voter key doesn't match the receiving replica's key.", false, false},
+	ErrDuplicateVoter:                     {"DUPLICATE_VOTER", "The voter is already part of the set of voters.", false, false},
+	ErrVoterNotFound:                      {"VOTER_NOT_FOUND", "The voter is not part of the set of voters.", false, false},
+	ErrInvalidRegularExpression:           {"INVALID_REGULAR_EXPRESSION", "The regular expression is not valid.", false, false},
+	ErrRebootstrapRequired:                {"REBOOTSTRAP_REQUIRED", "Client metadata is stale. The client should rebootstrap to obtain new metadata.", false, false},
+}
+
+func (e ErrorCode) info() errorCodeInfo {
+	if info, found := errorCodes[e]; found {
+		return info
+	}
+
+	return errorCodeInfo{
+		name:    "UNKNOWN_ERROR_CODE",
+		message: "The error code is unknown to this broker.",
+	}
+}
+
+// Name returns the protocol name of the error code, like NOT_LEADER_OR_FOLLOWER.
+func (e ErrorCode) Name() string {
+	return e.info().name
+}
+
+// Message returns the human readable description of the error code.
+func (e ErrorCode) Message() string {
+	return e.info().message
+}
+
+// Retriable reports whether the request may succeed if sent again.
+func (e ErrorCode) Retriable() bool {
+	return e.info().retriable
+}
+
+// InvalidMetadata reports whether the client should refresh its metadata
+// before retrying, like when the partition leader moved.
+func (e ErrorCode) InvalidMetadata() bool {
+	return e.info().invalidMetadata
+}
+
+func (e ErrorCode) String() string {
+	return fmt.Sprintf("%s(%d)", e.Name(), int16(e))
+}
+
+func (e ErrorCode) Error() string {
+	if e.Message() == "" {
+		return e.String()
+	}
+
+	return e.String() + ": " + e.Message()
+}
+
+// Err returns nil for ErrNone and the error code itself otherwise, handy
+// for checking the error codes of responses.
+func (e ErrorCode) Err() error {
+	if e == ErrNone {
+		return nil
+	}
+
+	return e
+}
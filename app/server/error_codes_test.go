@@ -0,0 +1,60 @@
+package server_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+var testErrorCodeCases = []struct {
+	errorCode       server.ErrorCode
+	name            string
+	retriable       bool
+	invalidMetadata bool
+}{
+	{server.ErrNone, "NONE", false, false},
+	{server.ErrUnknownServerError, "UNKNOWN_SERVER_ERROR", false, false},
+	{server.ErrNotLeaderOrFollower, "NOT_LEADER_OR_FOLLOWER", true, true},
+	{server.ErrRequestTimedOut, "REQUEST_TIMED_OUT", true, false},
+	{server.ErrTopicAlreadyExists, "TOPIC_ALREADY_EXISTS", false, false},
+	{server.ErrKafkaStorageError, "KAFKA_STORAGE_ERROR", true, true},
+	{server.ErrorCode(10000), "UNKNOWN_ERROR_CODE", false, false},
+}
+
+func TestErrorCodeCatalog(t *testing.T) {
+	for _, testCase := range testErrorCodeCases {
+		errorCode := testCase.errorCode
+
+		if errorCode.Name() != testCase.name {
+			t.Errorf("expected: %s, result: %s", testCase.name, errorCode.Name())
+		}
+
+		if errorCode.Retriable() != testCase.retriable {
+			t.Errorf("%s retriable expected: %t, result: %t", errorCode, testCase.retriable, errorCode.Retriable())
+		}
+
+		if errorCode.InvalidMetadata() != testCase.invalidMetadata {
+			t.Errorf("%s invalid metadata expected: %t, result: %t", errorCode, testCase.invalidMetadata, errorCode.InvalidMetadata())
+		}
+	}
+}
+
+func TestErrorCodeIsError(t *testing.T) {
+	err := fmt.Errorf("produce: %w", server.ErrNotLeaderOrFollower)
+
+	var errorCode server.ErrorCode
+	if !errors.As(err, &errorCode) || errorCode != server.ErrNotLeaderOrFollower {
+		t.Fatalf("expected: %s, result: %v", server.ErrNotLeaderOrFollower, err)
+	}
+
+	expected := "UNKNOWN_TOPIC_OR_PARTITION(3): This server does not host this topic-partition."
+	if result := server.ErrUnknownTopicOrPartition.Error(); result != expected {
+		t.Fatalf("expected: %s, result: %s", expected, result)
+	}
+
+	if server.ErrNone.Err() != nil {
+		t.Fatalf("expected: <nil>, result: %v", server.ErrNone.Err())
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/encoding/kafka"
+)
+
+// Error makes a handler failure be answered with a specific ErrorCode.
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+func NewError(code ErrorCode, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server: %s: %v", e.Code, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type errorMapping struct {
+	target error
+	code   ErrorCode
+}
+
+var defaultErrorMappings = []errorMapping{
+	{ErrUnauthenticated, ErrSaslAuthenticationFailed},
+	{ErrUnauthorized, ErrClusterAuthorizationFailed},
+	{context.DeadlineExceeded, ErrRequestTimedOut},
+	{io.ErrUnexpectedEOF, ErrInvalidRequest},
+}
+
+// MapError answers the requests failing with errors matching target, as
+// reported by errors.Is, with code. Mappings added later take precedence.
+func (ks *KafkaServer) MapError(target error, code ErrorCode) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	ks.errorMappings = append([]errorMapping{{target, code}}, ks.errorMappings...)
+}
+
+// ErrorCodeOf returns the ErrorCode a request failing with err is answered with.
+func (ks *KafkaServer) ErrorCodeOf(err error) ErrorCode {
+	var kafkaError *Error
+	if errors.As(err, &kafkaError) {
+		return kafkaError.Code
+	}
+
+	var errorCode ErrorCode
+	if errors.As(err, &errorCode) {
+		return errorCode
+	}
+
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	for _, mapping := range ks.errorMappings {
+		if errors.Is(err, mapping.target) {
+			return mapping.code
+		}
+	}
+
+	for _, mapping := range defaultErrorMappings {
+		if errors.Is(err, mapping.target) {
+			return mapping.code
+		}
+	}
+
+	return ErrUnknownServerError
+}
+
+// ErrorResponseFunc builds the response sent when a request fails, it must
+// have the shape of the api response on the given version.
+type ErrorResponseFunc func(req *Request, version ApiVersion, code ErrorCode) (any, error)
+
+// ErrorResponder is implemented by request types that know how to build the
+// error response for themselves, usually to repeat the requested topics and
+// partitions with the error code set on each of them.
+type ErrorResponder[Resp any] interface {
+	ErrorResponse(ctx context.Context, version ApiVersion, code ErrorCode) *Resp
+}
+
+// deriveErrorResponse builds error responses from the request when it
+// implements ErrorResponder, otherwise it sets code on every ErrorCode field
+// of an empty response.
+func deriveErrorResponse[Req, Resp any]() ErrorResponseFunc {
+	return func(req *Request, version ApiVersion, code ErrorCode) (any, error) {
+		request := new(Req)
+
+		if responder, ok := any(request).(ErrorResponder[Resp]); ok {
+			// a request that can't be decoded still gets a response, just
+			// without the entries it asked for
+			if body, err := req.body(); err == nil {
+				kafka.NewDecoder(body).DecodeWithOpts(request, &kafka.DecoderOpts{
+					Version: int(version),
+				})
+			}
+
+			return responder.ErrorResponse(req.Context(), version, code), nil
+		}
+
+		response := new(Resp)
+		SetErrorCodes(response, code)
+
+		return response, nil
+	}
+}
+
+var errorCodeType = reflect.TypeFor[ErrorCode]()
+
+// SetErrorCodes sets code on every ErrorCode field reachable from v,
+// including the ones on slice elements, like topic and partition entries.
+func SetErrorCodes(v any, code ErrorCode) {
+	setErrorCodes(reflect.ValueOf(v), code)
+}
+
+func setErrorCodes(v reflect.Value, code ErrorCode) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			setErrorCodes(v.Elem(), code)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			setErrorCodes(v.Index(i), code)
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Field(i)
+
+			if !field.CanSet() {
+				continue
+			}
+
+			if field.Type() == errorCodeType {
+				field.Set(reflect.ValueOf(code))
+				continue
+			}
+
+			setErrorCodes(field, code)
+		}
+	}
+}
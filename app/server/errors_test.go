@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var errNotLeader = errors.New("not the leader")
+
+var testErrorCodeOfCases = []struct {
+	err      error
+	expected ErrorCode
+}{
+	{
+		err:      errors.New("unknown"),
+		expected: ErrUnknownServerError,
+	},
+	{
+		err:      fmt.Errorf("wrapped: %w", NewError(ErrUnknownTopicOrPartition, nil)),
+		expected: ErrUnknownTopicOrPartition,
+	},
+	{
+		err:      errors.Join(ErrUnauthorized, errors.New("denied")),
+		expected: ErrClusterAuthorizationFailed,
+	},
+	{
+		err:      fmt.Errorf("fetch: %w", errNotLeader),
+		expected: ErrNotLeaderOrFollower,
+	},
+	{
+		err:      fmt.Errorf("fetch: %w", ErrFencedLeaderEpoch),
+		expected: ErrFencedLeaderEpoch,
+	},
+}
+
+func TestErrorCodeOf(t *testing.T) {
+	ks := NewKafkaServer()
+	ks.MapError(errNotLeader, ErrNotLeaderOrFollower)
+
+	for _, testCase := range testErrorCodeOfCases {
+		if result := ks.ErrorCodeOf(testCase.err); result != testCase.expected {
+			t.Errorf("error: %v, expected: %d, result: %d", testCase.err, testCase.expected, result)
+		}
+	}
+}
+
+type partitionsResponse struct {
+	ErrorCode ErrorCode `kafka:"0"`
+	Topics    []struct {
+		ErrorCode  ErrorCode `kafka:"0"`
+		Partitions []struct {
+			ErrorCode ErrorCode `kafka:"0"`
+		} `kafka:"1"`
+	} `kafka:"1"`
+}
+
+func TestSetErrorCodes(t *testing.T) {
+	response := new(partitionsResponse)
+	response.Topics = make([]struct {
+		ErrorCode  ErrorCode `kafka:"0"`
+		Partitions []struct {
+			ErrorCode ErrorCode `kafka:"0"`
+		} `kafka:"1"`
+	}, 1)
+	response.Topics[0].Partitions = make([]struct {
+		ErrorCode ErrorCode `kafka:"0"`
+	}, 2)
+
+	SetErrorCodes(response, ErrUnknownTopicOrPartition)
+
+	if response.ErrorCode != ErrUnknownTopicOrPartition || response.Topics[0].ErrorCode != ErrUnknownTopicOrPartition {
+		t.Fatalf("expected: %d, result: %v", ErrUnknownTopicOrPartition, response)
+	}
+
+	for _, partition := range response.Topics[0].Partitions {
+		if partition.ErrorCode != ErrUnknownTopicOrPartition {
+			t.Fatalf("expected: %d, result: %v", ErrUnknownTopicOrPartition, response)
+		}
+	}
+}
+
+type topicsRequest struct {
+	Names []string `kafka:"0"`
+}
+
+type topicsResponse struct {
+	Topics []topicError `kafka:"0"`
+}
+
+type topicError struct {
+	Name      string    `kafka:"0"`
+	ErrorCode ErrorCode `kafka:"1"`
+}
+
+func (r topicsRequest) ErrorResponse(_ context.Context, _ ApiVersion, errorCode ErrorCode) *topicsResponse {
+	response := new(topicsResponse)
+
+	for _, name := range r.Names {
+		response.Topics = append(response.Topics, topicError{name, errorCode})
+	}
+
+	return response
+}
+
+func TestDeriveErrorResponse(t *testing.T) {
+	req := &Request{
+		message:    []byte{0, 0, 0, 1, 0, 3, 'f', 'o', 'o'},
+		bodyOffset: 0,
+	}
+
+	response, err := deriveErrorResponse[topicsRequest, topicsResponse]()(req, 0, ErrUnknownTopicOrPartition)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := &topicsResponse{Topics: []topicError{{"foo", ErrUnknownTopicOrPartition}}}
+
+	if !reflect.DeepEqual(expected, response) {
+		t.Fatalf("expected: %v, result: %v", expected, response)
+	}
+
+	response, _ = deriveErrorResponse[echoRequest, partitionsResponse]()(req, 0, ErrUnsupportedVersion)
+
+	if response.(*partitionsResponse).ErrorCode != ErrUnsupportedVersion {
+		t.Fatalf("expected: %d, result: %v", ErrUnsupportedVersion, response)
+	}
+}
@@ -0,0 +1,334 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type SecurityProtocol string
+
+const (
+	Plaintext     SecurityProtocol = "PLAINTEXT"
+	SSL           SecurityProtocol = "SSL"
+	SASLPlaintext SecurityProtocol = "SASL_PLAINTEXT"
+	SASLSSL       SecurityProtocol = "SASL_SSL"
+)
+
+// DefaultSecurityProtocolMap maps every security protocol to the listener
+// with the same name, as the listener.security.protocol.map default.
+const DefaultSecurityProtocolMap = "PLAINTEXT:PLAINTEXT,SSL:SSL,SASL_PLAINTEXT:SASL_PLAINTEXT,SASL_SSL:SASL_SSL"
+
+func ParseSecurityProtocol(protocol string) (SecurityProtocol, error) {
+	switch SecurityProtocol(protocol) {
+	case Plaintext, SSL, SASLPlaintext, SASLSSL:
+		return SecurityProtocol(protocol), nil
+	default:
+		return "", fmt.Errorf("server: invalid security protocol %q", protocol)
+	}
+}
+
+// ParseSecurityProtocolMap parses the listener.security.protocol.map, a
+// comma separated list of `LISTENER_NAME:SECURITY_PROTOCOL` pairs.
+func ParseSecurityProtocolMap(protocolMap string) (map[string]SecurityProtocol, error) {
+	protocols := make(map[string]SecurityProtocol)
+
+	for _, entry := range strings.Split(protocolMap, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		name, protocol, found := strings.Cut(entry, ":")
+
+		if !found {
+			return nil, fmt.Errorf("server: invalid listener.security.protocol.map entry %q", entry)
+		}
+
+		securityProtocol, err := ParseSecurityProtocol(strings.ToUpper(strings.TrimSpace(protocol)))
+
+		if err != nil {
+			return nil, err
+		}
+
+		protocols[strings.ToUpper(strings.TrimSpace(name))] = securityProtocol
+	}
+
+	return protocols, nil
+}
+
+// Endpoint is a listener address, as given on listeners and
+// advertised.listeners: `NAME://host:port`.
+type Endpoint struct {
+	Name             string
+	Host             string
+	Port             int
+	SecurityProtocol SecurityProtocol
+}
+
+func (e Endpoint) Address() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+func (e Endpoint) String() string {
+	return e.Name + "://" + e.Address()
+}
+
+// ParseEndpoints parses a comma separated list of endpoints, each listener
+// name must be on protocols and appear only once.
+func ParseEndpoints(endpoints string, protocols map[string]SecurityProtocol) ([]Endpoint, error) {
+	var parsed []Endpoint
+
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+
+		if endpoint == "" {
+			continue
+		}
+
+		name, address, found := strings.Cut(endpoint, "://")
+
+		if !found {
+			return nil, fmt.Errorf("server: endpoint %q should be NAME://host:port", endpoint)
+		}
+
+		host, port, err := net.SplitHostPort(address)
+
+		if err != nil {
+			return nil, fmt.Errorf("server: endpoint %q: %w", endpoint, err)
+		}
+
+		portNumber, err := strconv.Atoi(port)
+
+		if err != nil || portNumber < 0 || portNumber > 65535 {
+			return nil, fmt.Errorf("server: endpoint %q has an invalid port", endpoint)
+		}
+
+		name = strings.ToUpper(name)
+		protocol, found := protocols[name]
+
+		if !found {
+			return nil, fmt.Errorf("server: listener %s has no security protocol on listener.security.protocol.map", name)
+		}
+
+		for _, other := range parsed {
+			if other.Name == name {
+				return nil, fmt.Errorf("server: listener %s is declared more than once", name)
+			}
+		}
+
+		parsed = append(parsed, Endpoint{
+			Name:             name,
+			Host:             host,
+			Port:             portNumber,
+			SecurityProtocol: protocol,
+		})
+	}
+
+	return parsed, nil
+}
+
+type ListenersConfig struct {
+	// Listeners are the endpoints bound by the server, like
+	// `PLAINTEXT://:9092,SASL_SSL://:9093,CONTROLLER://:9094`.
+	Listeners string
+	// AdvertisedListeners are the endpoints given to the clients, the ones of
+	// Listeners when empty. Every name must be one of the Listeners.
+	AdvertisedListeners string
+	// SecurityProtocolMap is the listener.security.protocol.map, the
+	// DefaultSecurityProtocolMap when empty.
+	SecurityProtocolMap string
+	// TLS has the configuration of the SSL and SASL_SSL listeners, by name.
+	TLS map[string]*TLSConfig
+	// SASL has the configuration of the SASL_PLAINTEXT and SASL_SSL
+	// listeners, by name.
+	SASL map[string]*SASLConfig
+}
+
+// AdvertisedListenerFromContext returns the endpoint advertised for the
+// listener that accepted the connection of the request, the one Metadata
+// and DescribeCluster answer with.
+func AdvertisedListenerFromContext(ctx context.Context) (Endpoint, bool) {
+	ks, ok := ServerFromContext(ctx)
+
+	if !ok {
+		return Endpoint{}, false
+	}
+
+	return ks.AdvertisedListener(ListenerFromContext(ctx))
+}
+
+// AdvertisedListener returns the endpoint advertised for the named listener.
+func (ks *KafkaServer) AdvertisedListener(name string) (Endpoint, bool) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	for _, endpoint := range ks.advertisedListeners {
+		if endpoint.Name == name {
+			return endpoint, true
+		}
+	}
+
+	return Endpoint{}, false
+}
+
+// AdvertisedListeners returns the endpoints advertised by ListenAndServeListeners.
+func (ks *KafkaServer) AdvertisedListeners() []Endpoint {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	return append([]Endpoint(nil), ks.advertisedListeners...)
+}
+
+func (ks *KafkaServer) newListenerState(endpoint Endpoint, config *ListenersConfig) (*listenerState, error) {
+	var state *listenerState
+	var err error
+
+	switch endpoint.SecurityProtocol {
+	case SSL, SASLSSL:
+		tlsConfig, found := config.TLS[endpoint.Name]
+
+		if !found {
+			return nil, fmt.Errorf("server: listener %s has no TLS configuration", endpoint.Name)
+		}
+
+		if state, err = ks.newTLSListenerState(endpoint.Name, tlsConfig); err != nil {
+			return nil, err
+		}
+	default:
+		state = &listenerState{name: endpoint.Name}
+	}
+
+	if endpoint.SecurityProtocol == SASLPlaintext || endpoint.SecurityProtocol == SASLSSL {
+		saslConfig, found := config.SASL[endpoint.Name]
+
+		if !found {
+			return nil, fmt.Errorf("server: listener %s has no SASL configuration", endpoint.Name)
+		}
+
+		if err = ks.enableSASL(state, saslConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
+// advertise resolves the advertised endpoints, the ones without port get
+// the port their listener was bound to, so `:0` listeners advertise where
+// they ended up.
+func advertise(config *ListenersConfig, protocols map[string]SecurityProtocol, bound []Endpoint, listeners []net.Listener) ([]Endpoint, error) {
+	advertised := bound
+
+	if config.AdvertisedListeners != "" {
+		var err error
+
+		if advertised, err = ParseEndpoints(config.AdvertisedListeners, protocols); err != nil {
+			return nil, err
+		}
+	}
+
+	resolved := make([]Endpoint, 0, len(advertised))
+
+	for _, endpoint := range advertised {
+		i := slices.IndexFunc(bound, func(boundEndpoint Endpoint) bool {
+			return boundEndpoint.Name == endpoint.Name
+		})
+
+		if i < 0 {
+			return nil, fmt.Errorf("server: advertised listener %s is not on listeners", endpoint.Name)
+		}
+
+		if address, ok := listeners[i].Addr().(*net.TCPAddr); ok && endpoint.Port == 0 {
+			endpoint.Port = address.Port
+		}
+
+		resolved = append(resolved, endpoint)
+	}
+
+	return resolved, nil
+}
+
+// ListenAndServeListeners binds every listener of config and serves them
+// until one of them fails, closing the others.
+func (ks *KafkaServer) ListenAndServeListeners(config *ListenersConfig) error {
+	protocolMap := config.SecurityProtocolMap
+
+	if protocolMap == "" {
+		protocolMap = DefaultSecurityProtocolMap
+	}
+
+	protocols, err := ParseSecurityProtocolMap(protocolMap)
+
+	if err != nil {
+		return err
+	}
+
+	endpoints, err := ParseEndpoints(config.Listeners, protocols)
+
+	if err != nil {
+		return err
+	}
+
+	if len(endpoints) == 0 {
+		return errors.New("server: no listener to serve")
+	}
+
+	states := make([]*listenerState, len(endpoints))
+
+	for i, endpoint := range endpoints {
+		if states[i], err = ks.newListenerState(endpoint, config); err != nil {
+			return err
+		}
+	}
+
+	listeners := make([]net.Listener, 0, len(endpoints))
+
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}()
+
+	for _, endpoint := range endpoints {
+		listener, err := net.Listen("tcp", endpoint.Address())
+
+		if err != nil {
+			return fmt.Errorf("server: listener %s: %w", endpoint.Name, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	advertised, err := advertise(config, protocols, endpoints, listeners)
+
+	if err != nil {
+		return err
+	}
+
+	ks.mutex.Lock()
+	ks.advertisedListeners = advertised
+	ks.mutex.Unlock()
+
+	errs := make(chan error, len(listeners))
+
+	for i, listener := range listeners {
+		if states[i].tlsConfig != nil {
+			listener = tls.NewListener(listener, states[i].tlsConfig)
+		}
+
+		ks.Logger().Info("listening", "listener", endpoints[i].Name, "address", endpoints[i].Address())
+
+		go func(state *listenerState, listener net.Listener) {
+			errs <- ks.serve(state, listener)
+		}(states[i], listener)
+	}
+
+	return <-errs
+}
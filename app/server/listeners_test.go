@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/sasl"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	protocols, err := ParseSecurityProtocolMap("INTERNAL:PLAINTEXT, EXTERNAL:SASL_SSL,controller:plaintext")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := ParseEndpoints("INTERNAL://:9092,EXTERNAL://broker.example.com:9093,CONTROLLER://[::1]:9094", protocols)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []Endpoint{
+		{Name: "INTERNAL", Host: "", Port: 9092, SecurityProtocol: Plaintext},
+		{Name: "EXTERNAL", Host: "broker.example.com", Port: 9093, SecurityProtocol: SASLSSL},
+		{Name: "CONTROLLER", Host: "::1", Port: 9094, SecurityProtocol: Plaintext},
+	}
+
+	if !slices.Equal(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+
+	invalidEndpoints := []string{
+		"UNKNOWN://:9092",
+		"INTERNAL://:9092,INTERNAL://:9093",
+		"INTERNAL:9092",
+		"INTERNAL://:http",
+	}
+
+	for _, endpoints := range invalidEndpoints {
+		if _, err := ParseEndpoints(endpoints, protocols); err == nil {
+			t.Fatalf("endpoints: %q, expected an error", endpoints)
+		}
+	}
+}
+
+type endpointResponse struct {
+	Endpoint string `kafka:"0"`
+}
+
+func handleEndpoint(ctx context.Context, _ *versionsRequest, _ ApiVersion) (*endpointResponse, error) {
+	endpoint, _ := AdvertisedListenerFromContext(ctx)
+	return &endpointResponse{Endpoint: endpoint.String()}, nil
+}
+
+func TestListenAndServeListeners(t *testing.T) {
+	ks := newTestServer(t)
+	Handle(ks, ApiVersions, ApiVersionRange{0, 4}, handleEndpoint)
+
+	go ks.ListenAndServeListeners(&ListenersConfig{
+		Listeners:           "INTERNAL://127.0.0.1:0,EXTERNAL://127.0.0.1:0",
+		AdvertisedListeners: "INTERNAL://127.0.0.1:0,EXTERNAL://broker.example.com:9093",
+		SecurityProtocolMap: "INTERNAL:PLAINTEXT,EXTERNAL:SASL_PLAINTEXT",
+		SASL: map[string]*SASLConfig{
+			"EXTERNAL": {Credentials: sasl.NewMemoryCredentialStore()},
+		},
+	})
+
+	deadline := time.Now().Add(time.Second)
+
+	for len(ks.AdvertisedListeners()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	advertised := ks.AdvertisedListeners()
+
+	if len(advertised) != 2 || advertised[1].String() != "EXTERNAL://broker.example.com:9093" {
+		t.Fatalf("unexpected advertised listeners: %v", advertised)
+	}
+
+	conn, err := net.Dial("tcp", advertised[0].Address())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	result, err := roundTrip(conn, ApiVersions, 4, nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if endpoint := string(result[6:]); endpoint != advertised[0].String() {
+		t.Fatalf("expected: %s, result: %s", advertised[0], endpoint)
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type LogFormat string
+
+const (
+	LogText LogFormat = "text"
+	LogJSON LogFormat = "json"
+)
+
+func ParseLogFormat(format string) (LogFormat, error) {
+	switch LogFormat(strings.ToLower(format)) {
+	case LogText:
+		return LogText, nil
+	case LogJSON:
+		return LogJSON, nil
+	default:
+		return "", fmt.Errorf("server: invalid log format %q", format)
+	}
+}
+
+// NewLogger returns a logger writing to w in the given format, passing a
+// *slog.LevelVar as level allows changing it while the server runs.
+func NewLogger(w io.Writer, format LogFormat, level slog.Leveler) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+
+	if format == LogJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// Logger returns the logger of the server, it logs at LogLevel.
+func (ks *KafkaServer) Logger() *slog.Logger {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	return ks.logger
+}
+
+// SetLogger replaces the logger of the server, it should be built with
+// LogLevel as level to keep the level switches working.
+func (ks *KafkaServer) SetLogger(logger *slog.Logger) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	ks.logger = logger
+}
+
+// LogLevel returns the level of the server logger, setting it takes effect
+// on the next log record.
+func (ks *KafkaServer) LogLevel() *slog.LevelVar {
+	return ks.logLevel
+}
+
+type remoteAddrKey struct{}
+
+// RemoteAddrFromContext returns the address of the client that sent the request.
+func RemoteAddrFromContext(ctx context.Context) (net.Addr, bool) {
+	addr, ok := ctx.Value(remoteAddrKey{}).(net.Addr)
+	return addr, ok
+}
+
+type loggerKey struct{}
+
+// LoggerFromContext returns the logger of the request, which adds the
+// fields of the request to every record, or slog.Default outside of one.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	if ks, ok := ServerFromContext(ctx); ok {
+		return ks.Logger()
+	}
+
+	return slog.Default()
+}
+
+// requestAttrs are the fields identifying a request on the logs.
+func requestAttrs(req *Request) []any {
+	attrs := []any{
+		slog.Int("api_key", int(req.ApiVersion.Key)),
+		slog.Int("api_version", int(req.ApiVersion.Version)),
+		slog.Int("correlation_id", int(req.Headers.CorrelationId)),
+		slog.String("client_id", req.Headers.ClientId),
+	}
+
+	if addr, ok := RemoteAddrFromContext(req.Context()); ok {
+		attrs = append(attrs, slog.String("remote_addr", addr.String()))
+	}
+
+	return attrs
+}
+
+// withRequestLogger stores the logger of the request on its context, once
+// its headers are decoded.
+func (ks *KafkaServer) withRequestLogger(req *Request) {
+	req.ctx = context.WithValue(req.Context(), loggerKey{}, ks.Logger().With(requestAttrs(req)...))
+}
+
+// Logging logs one record per handled request, with its latency and the
+// error code it is answered with. Failed requests are logged as warnings.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(rw ResponseWriter, req *Request) error {
+			start := time.Now()
+			err := next(rw, req)
+
+			errorCode := ErrNone
+			level := slog.LevelInfo
+
+			if err != nil {
+				level = slog.LevelWarn
+				errorCode = ErrUnknownServerError
+
+				if ks, ok := ServerFromContext(req.Context()); ok {
+					errorCode = ks.ErrorCodeOf(err)
+				}
+			}
+
+			attrs := append(requestAttrs(req),
+				slog.Duration("latency", time.Since(start)),
+				slog.Int("error_code", int(errorCode)),
+			)
+
+			if err != nil {
+				attrs = append(attrs, slog.Any("error", err))
+			}
+
+			logger.Log(req.Context(), level, "request", attrs...)
+
+			return err
+		}
+	}
+}
+
+// LogLevelHandler serves the level on GET and changes it on PUT, with the
+// level name as body, like `curl -X PUT -d debug host/loglevel`.
+func LogLevelHandler(level *slog.LevelVar) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64))
+
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err = level.UnmarshalText([]byte(strings.TrimSpace(string(body)))); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		fmt.Fprintln(w, level.Level())
+	})
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestLog(t *testing.T) {
+	ks := newTestServer(t)
+	output := new(bytes.Buffer)
+	ks.LogLevel().Set(slog.LevelDebug)
+	ks.SetLogger(NewLogger(output, LogJSON, ks.LogLevel()))
+	ks.Use(Logging(ks.Logger()))
+
+	AddTyped(
+		ks.Handler(DescribeTopicPartitions).Version(0, 0).Opts().ResponseHeaderVersion(1).And(),
+		func(ctx context.Context, _ *versionsRequest, _ ApiVersion) (*versionsResponse, error) {
+			LoggerFromContext(ctx).Debug("handling")
+			return nil, NewError(ErrInvalidRequest, errors.New("boom"))
+		},
+	)
+
+	if _, err := roundTrip(servePipe(t, ks), DescribeTopicPartitions, 0, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var records []map[string]any
+
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var record map[string]any
+
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		records = append(records, record)
+	}
+
+	if len(records) < 2 || records[0]["msg"] != "handling" {
+		t.Fatalf("expected the handler record first, result: %v", records)
+	}
+
+	if records[0]["correlation_id"] != float64(7) || records[0]["remote_addr"] != "pipe" {
+		t.Fatalf("expected the fields of the request on the handler record, result: %v", records[0])
+	}
+
+	var request map[string]any
+
+	for _, record := range records {
+		if record["msg"] == "request" {
+			request = record
+		}
+	}
+
+	expected := map[string]any{
+		"level":          "WARN",
+		"api_key":        float64(DescribeTopicPartitions),
+		"api_version":    float64(0),
+		"correlation_id": float64(7),
+		"client_id":      "",
+		"remote_addr":    "pipe",
+		"error_code":     float64(ErrInvalidRequest),
+	}
+
+	for key, value := range expected {
+		if request[key] != value {
+			t.Fatalf("expected: %s=%v, result: %v", key, value, request)
+		}
+	}
+
+	if _, found := request["latency"]; !found {
+		t.Fatalf("expected the latency of the request, result: %v", request)
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	level := new(slog.LevelVar)
+	handler := LogLevelHandler(level)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader("debug\n")))
+
+	if recorder.Code != http.StatusOK || level.Level() != slog.LevelDebug {
+		t.Fatalf("expected: DEBUG, result: %d %s", recorder.Code, level.Level())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader("verbose")))
+
+	if recorder.Code != http.StatusBadRequest || level.Level() != slog.LevelDebug {
+		t.Fatalf("expected the level to be kept, result: %d %s", recorder.Code, level.Level())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/loglevel", nil))
+
+	if strings.TrimSpace(recorder.Body.String()) != "DEBUG" {
+		t.Fatalf("expected: DEBUG, result: %q", recorder.Body.String())
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	if format, err := ParseLogFormat("JSON"); err != nil || format != LogJSON {
+		t.Fatalf("expected: json, result: %s %v", format, err)
+	}
+
+	if _, err := ParseLogFormat("xml"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/metrics"
+)
+
+// BrokerMetrics are the metrics of the requests, connections and logs of
+// the server, recorded on a metrics.Registry.
+type BrokerMetrics struct {
+	registry       *metrics.Registry
+	requests       *metrics.CounterVec
+	errors         *metrics.CounterVec
+	bytesIn        *metrics.CounterVec
+	bytesOut       *metrics.CounterVec
+	queueTime      *metrics.HistogramVec
+	handleTime     *metrics.HistogramVec
+	sendTime       *metrics.HistogramVec
+	logSize        *metrics.GaugeVec
+	logStartOffset *metrics.GaugeVec
+	logEndOffset   *metrics.GaugeVec
+	logSegments    *metrics.GaugeVec
+	logFlushTime   *metrics.HistogramVec
+}
+
+func NewBrokerMetrics(registry *metrics.Registry) *BrokerMetrics {
+	return &BrokerMetrics{
+		registry: registry,
+		requests: registry.Counter(
+			"kafka_server_requests_total", "Requests received.", "api_key", "api_version",
+		),
+		errors: registry.Counter(
+			"kafka_server_errors_total", "Requests answered with an error code.", "api_key", "error_code",
+		),
+		bytesIn: registry.Counter(
+			"kafka_server_bytes_in_total", "Bytes of the requests received.", "api_key",
+		),
+		bytesOut: registry.Counter(
+			"kafka_server_bytes_out_total", "Bytes of the responses sent.", "api_key",
+		),
+		queueTime: registry.Histogram(
+			"kafka_server_request_queue_seconds", "Time from reading a request to handling it.", nil, "api_key",
+		),
+		handleTime: registry.Histogram(
+			"kafka_server_request_handle_seconds", "Time spent in the handlers.", nil, "api_key",
+		),
+		sendTime: registry.Histogram(
+			"kafka_server_response_send_seconds", "Time spent writing the responses.", nil, "api_key",
+		),
+		logSize: registry.Gauge(
+			"kafka_log_size_bytes", "Size of the partition log.", "topic", "partition",
+		),
+		logStartOffset: registry.Gauge(
+			"kafka_log_start_offset", "First offset of the partition log.", "topic", "partition",
+		),
+		logEndOffset: registry.Gauge(
+			"kafka_log_end_offset", "Offset of the next record of the partition log.", "topic", "partition",
+		),
+		logSegments: registry.Gauge(
+			"kafka_log_segments", "Segments of the partition log.", "topic", "partition",
+		),
+		logFlushTime: registry.Histogram(
+			"kafka_log_flush_seconds", "Time spent flushing the partition logs to disk.", nil,
+		),
+	}
+}
+
+// LogStats are the metrics of a partition log.
+type LogStats struct {
+	Topic       string
+	Partition   int32
+	Size        int64
+	StartOffset int64
+	EndOffset   int64
+	Segments    int
+}
+
+// CollectLogs sets the metrics of the partition logs returned by stats on
+// every scrape, removing the ones of the logs gone since the last one.
+func (bm *BrokerMetrics) CollectLogs(stats func() []LogStats) {
+	var mutex sync.Mutex
+	collected := make(map[[2]string]bool)
+
+	bm.registry.OnCollect(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		current := make(map[[2]string]bool)
+
+		for _, stat := range stats() {
+			labels := [2]string{stat.Topic, strconv.Itoa(int(stat.Partition))}
+			current[labels] = true
+
+			bm.logSize.With(labels[:]...).Set(float64(stat.Size))
+			bm.logStartOffset.With(labels[:]...).Set(float64(stat.StartOffset))
+			bm.logEndOffset.With(labels[:]...).Set(float64(stat.EndOffset))
+			bm.logSegments.With(labels[:]...).Set(float64(stat.Segments))
+		}
+
+		for labels := range collected {
+			if !current[labels] {
+				bm.logSize.Delete(labels[:]...)
+				bm.logStartOffset.Delete(labels[:]...)
+				bm.logEndOffset.Delete(labels[:]...)
+				bm.logSegments.Delete(labels[:]...)
+			}
+		}
+
+		collected = current
+	})
+}
+
+// RecordLogFlush records the time a flush of a partition log took.
+func (bm *BrokerMetrics) RecordLogFlush(elapsed time.Duration) {
+	bm.logFlushTime.With().Observe(elapsed.Seconds())
+}
+
+// EnableMetrics records the requests and connections of the server on bm,
+// it can be called once per registry.
+func (ks *KafkaServer) EnableMetrics(bm *BrokerMetrics) {
+	bm.registry.GaugeFunc("kafka_server_connections_active", "Open connections.", func() float64 {
+		return float64(ks.ConnectionStats().Active)
+	})
+	bm.registry.CounterFunc("kafka_server_connections_accepted_total", "Connections accepted.", func() float64 {
+		return float64(ks.ConnectionStats().Accepted)
+	})
+	bm.registry.CounterFunc("kafka_server_connections_rejected_total", "Connections rejected by the limits.", func() float64 {
+		return float64(ks.ConnectionStats().Rejected)
+	})
+	bm.registry.CounterFunc("kafka_server_connections_idle_closed_total", "Connections closed for being idle.", func() float64 {
+		return float64(ks.ConnectionStats().IdleClosed)
+	})
+
+	ks.metrics.Store(bm)
+}
+
+func apiKeyLabel(apiKey ApiKey) string {
+	return strconv.Itoa(int(apiKey))
+}
+
+func (bm *BrokerMetrics) recordRequest(req *Request, received time.Time) {
+	apiKey := apiKeyLabel(req.ApiVersion.Key)
+
+	bm.requests.With(apiKey, strconv.Itoa(int(req.ApiVersion.Version))).Inc()
+	// the message size doesn't count the 4 bytes of the size itself
+	bm.bytesIn.With(apiKey).Add(float64(req.MessageSize) + 4)
+	bm.queueTime.With(apiKey).Observe(time.Since(received).Seconds())
+}
+
+func (bm *BrokerMetrics) recordHandle(req *Request, elapsed time.Duration) {
+	bm.handleTime.With(apiKeyLabel(req.ApiVersion.Key)).Observe(elapsed.Seconds())
+}
+
+func (bm *BrokerMetrics) recordError(req *Request, errorCode ErrorCode) {
+	bm.errors.With(apiKeyLabel(req.ApiVersion.Key), errorCode.Name()).Inc()
+}
+
+func (bm *BrokerMetrics) recordSend(req *Request, size int, elapsed time.Duration) {
+	apiKey := apiKeyLabel(req.ApiVersion.Key)
+
+	bm.bytesOut.With(apiKey).Add(float64(size))
+	bm.sendTime.With(apiKey).Observe(elapsed.Seconds())
+}
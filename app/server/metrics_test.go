@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/metrics"
+)
+
+func TestBrokerMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	ks := newTestServer(t)
+	ks.EnableMetrics(NewBrokerMetrics(registry))
+	Handle(ks, ApiVersions, ApiVersionRange{0, 4}, handleVersions)
+
+	conn := servePipe(t, ks)
+
+	if _, err := roundTrip(conn, ApiVersions, 4, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := roundTrip(conn, ApiVersions, 5, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result := new(bytes.Buffer)
+	registry.WriteTo(result)
+
+	expectedLines := []string{
+		`kafka_server_requests_total{api_key="18",api_version="4"} 1`,
+		`kafka_server_requests_total{api_key="18",api_version="5"} 1`,
+		`kafka_server_errors_total{api_key="18",error_code="UNSUPPORTED_VERSION"} 1`,
+		`kafka_server_bytes_in_total{api_key="18"} 30`,
+		`kafka_server_request_handle_seconds_count{api_key="18"} 1`,
+		// the send of the last response may be recorded after the client read it
+		`kafka_server_response_send_seconds_count{api_key="18"}`,
+	}
+
+	for _, line := range expectedLines {
+		if !strings.Contains(result.String(), line) {
+			t.Fatalf("expected %q on:\n%s", line, result)
+		}
+	}
+}
+
+func TestLogFlushMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	bm := NewBrokerMetrics(registry)
+
+	bm.RecordLogFlush(2 * time.Millisecond)
+	bm.RecordLogFlush(3 * time.Millisecond)
+
+	result := new(bytes.Buffer)
+	registry.WriteTo(result)
+
+	if line := "kafka_log_flush_seconds_count 2"; !strings.Contains(result.String(), line) {
+		t.Fatalf("expected %q on:\n%s", line, result)
+	}
+}
+
+func TestLogMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	bm := NewBrokerMetrics(registry)
+	stats := []LogStats{
+		{Topic: "foo", Partition: 0, Size: 4096, StartOffset: 10, EndOffset: 42, Segments: 2},
+		{Topic: "bar", Partition: 1, Size: 0, StartOffset: 0, EndOffset: 0, Segments: 1},
+	}
+
+	bm.CollectLogs(func() []LogStats { return stats })
+
+	result := new(bytes.Buffer)
+	registry.WriteTo(result)
+
+	expectedLines := []string{
+		`kafka_log_size_bytes{topic="foo",partition="0"} 4096`,
+		`kafka_log_start_offset{topic="foo",partition="0"} 10`,
+		`kafka_log_end_offset{topic="foo",partition="0"} 42`,
+		`kafka_log_segments{topic="foo",partition="0"} 2`,
+		`kafka_log_segments{topic="bar",partition="1"} 1`,
+	}
+
+	for _, line := range expectedLines {
+		if !strings.Contains(result.String(), line) {
+			t.Fatalf("expected %q on:\n%s", line, result)
+		}
+	}
+
+	// the metrics of the logs gone are removed on the next scrape
+	stats = stats[:1]
+	result.Reset()
+	registry.WriteTo(result)
+
+	if strings.Contains(result.String(), `topic="bar"`) {
+		t.Fatalf("unexpected metrics of bar on:\n%s", result)
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a HandlerFunc to add behaviour around it, like logging,
+// panic recovery or authorization. Middlewares registered through
+// KafkaServer.Use run for every request, the ones registered through
+// handlerBuilder.Use run only for that handler.
+type Middleware func(HandlerFunc) HandlerFunc
+
+// chain applies the middlewares so the first one is the outermost.
+func chain(handler HandlerFunc, middlewares []Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("server: handler panic: %v", e.Value)
+}
+
+// Recovery turns a panic inside the handler into a *PanicError, so only the
+// request fails and not the whole connection.
+func Recovery(logger *slog.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(rw ResponseWriter, req *Request) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					const size = 64 << 10
+					buf := make([]byte, size)
+					buf = buf[:runtime.Stack(buf, false)]
+
+					logger.Error("handler panic", append(requestAttrs(req), "panic", r, "stack", string(buf))...)
+					err = &PanicError{Value: r, Stack: buf}
+				}
+			}()
+
+			return next(rw, req)
+		}
+	}
+}
+
+type MetricsRecorder interface {
+	RecordRequest(apiKey ApiKey, version ApiVersion, elapsed time.Duration, err error)
+}
+
+// Metrics reports the duration and outcome of every request to recorder.
+func Metrics(recorder MetricsRecorder) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(rw ResponseWriter, req *Request) error {
+			start := time.Now()
+			err := next(rw, req)
+
+			recorder.RecordRequest(req.ApiVersion.Key, req.ApiVersion.Version, time.Since(start), err)
+
+			return err
+		}
+	}
+}
+
+type Principal struct {
+	Type string
+	Name string
+}
+
+var AnonymousPrincipal = Principal{Type: "User", Name: "ANONYMOUS"}
+
+func (p Principal) String() string {
+	return p.Type + ":" + p.Name
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated principal of the request,
+// or AnonymousPrincipal when nobody authenticated it.
+func PrincipalFromContext(ctx context.Context) Principal {
+	if principal, ok := ctx.Value(principalKey{}).(Principal); ok {
+		return principal
+	}
+
+	return AnonymousPrincipal
+}
+
+type Authenticator interface {
+	Authenticate(req *Request) (Principal, error)
+}
+
+type AuthenticatorFunc func(req *Request) (Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(req *Request) (Principal, error) {
+	return f(req)
+}
+
+type Authorizer interface {
+	Authorize(principal Principal, req *Request) error
+}
+
+type AuthorizerFunc func(principal Principal, req *Request) error
+
+func (f AuthorizerFunc) Authorize(principal Principal, req *Request) error {
+	return f(principal, req)
+}
+
+var ErrUnauthenticated = errors.New("server: request is not authenticated")
+var ErrUnauthorized = errors.New("server: principal is not authorized")
+
+// Authenticate resolves the principal of the request and stores it on the
+// request context, where Authorize and the handlers can read it.
+func Authenticate(authenticator Authenticator) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(rw ResponseWriter, req *Request) error {
+			principal, err := authenticator.Authenticate(req)
+
+			if err != nil {
+				return errors.Join(ErrUnauthenticated, err)
+			}
+
+			return next(rw, req.WithContext(WithPrincipal(req.Context(), principal)))
+		}
+	}
+}
+
+func Authorize(authorizer Authorizer) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(rw ResponseWriter, req *Request) error {
+			if err := authorizer.Authorize(PrincipalFromContext(req.Context()), req); err != nil {
+				return errors.Join(ErrUnauthorized, err)
+			}
+
+			return next(rw, req)
+		}
+	}
+}
+
+type Throttler interface {
+	// Throttle returns for how long the request must wait before being handled.
+	Throttle(req *Request) time.Duration
+}
+
+// Throttle delays the request by the time asked by throttler, giving up if
+// the request context is done first.
+func Throttle(throttler Throttler) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(rw ResponseWriter, req *Request) error {
+			if delay := throttler.Throttle(req); delay > 0 {
+				timer := time.NewTimer(delay)
+				defer timer.Stop()
+
+				select {
+				case <-timer.C:
+				case <-req.Context().Done():
+					return req.Context().Err()
+				}
+			}
+
+			return next(rw, req)
+		}
+	}
+}
+
+// RateThrottler is a token bucket allowing rate requests per second with
+// bursts of up to burst requests.
+type RateThrottler struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateThrottler(rate float64, burst int) *RateThrottler {
+	return &RateThrottler{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (rt *RateThrottler) Throttle(_ *Request) time.Duration {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	now := time.Now()
+	rt.tokens = min(rt.burst, rt.tokens+now.Sub(rt.last).Seconds()*rt.rate)
+	rt.last = now
+	rt.tokens--
+
+	if rt.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-rt.tokens / rt.rate * float64(time.Second))
+}
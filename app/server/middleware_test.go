@@ -0,0 +1,113 @@
+package server_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	handler := server.Recovery(slog.New(slog.NewTextHandler(io.Discard, nil)))(func(server.ResponseWriter, *server.Request) error {
+		panic("boom")
+	})
+
+	err := handler(new(bytes.Buffer), new(server.Request))
+
+	var panicError *server.PanicError
+	if !errors.As(err, &panicError) {
+		t.Fatalf("expected: *server.PanicError, result: %v", err)
+	}
+
+	if panicError.Value != "boom" {
+		t.Fatalf("expected: boom, result: %v", panicError.Value)
+	}
+}
+
+func TestAuthenticateAndAuthorizeMiddlewares(t *testing.T) {
+	expected := server.Principal{Type: "User", Name: "alice"}
+
+	var result server.Principal
+	handler := func(_ server.ResponseWriter, req *server.Request) error {
+		result = server.PrincipalFromContext(req.Context())
+		return nil
+	}
+
+	authenticate := server.Authenticate(server.AuthenticatorFunc(func(*server.Request) (server.Principal, error) {
+		return expected, nil
+	}))
+
+	allow := server.Authorize(server.AuthorizerFunc(func(server.Principal, *server.Request) error {
+		return nil
+	}))
+
+	if err := authenticate(allow(handler))(new(bytes.Buffer), new(server.Request)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result != expected {
+		t.Fatalf("expected: %s, result: %s", expected, result)
+	}
+
+	deny := server.Authorize(server.AuthorizerFunc(func(principal server.Principal, _ *server.Request) error {
+		return errors.New(principal.Name + " denied")
+	}))
+
+	if err := authenticate(deny(handler))(new(bytes.Buffer), new(server.Request)); !errors.Is(err, server.ErrUnauthorized) {
+		t.Fatalf("expected: %s, result: %v", server.ErrUnauthorized, err)
+	}
+}
+
+type recordedRequest struct {
+	apiKey  server.ApiKey
+	version server.ApiVersion
+	err     error
+}
+
+type recorder struct {
+	requests []recordedRequest
+}
+
+func (r *recorder) RecordRequest(apiKey server.ApiKey, version server.ApiVersion, _ time.Duration, err error) {
+	r.requests = append(r.requests, recordedRequest{apiKey, version, err})
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	handlerErr := errors.New("handler error")
+	recorder := new(recorder)
+
+	handler := server.Metrics(recorder)(func(server.ResponseWriter, *server.Request) error {
+		return handlerErr
+	})
+
+	req := new(server.Request)
+	req.ApiVersion.Key = server.ApiVersions
+	req.ApiVersion.Version = 3
+
+	handler(new(bytes.Buffer), req)
+
+	expected := []recordedRequest{{server.ApiVersions, 3, handlerErr}}
+
+	if !reflect.DeepEqual(expected, recorder.requests) {
+		t.Fatalf("expected: %v, result: %v", expected, recorder.requests)
+	}
+}
+
+func TestRateThrottler(t *testing.T) {
+	throttler := server.NewRateThrottler(10, 2)
+
+	for range 2 {
+		if delay := throttler.Throttle(nil); delay != 0 {
+			t.Fatalf("expected: 0, result: %s", delay)
+		}
+	}
+
+	if delay := throttler.Throttle(nil); delay <= 0 || delay > 100*time.Millisecond {
+		t.Fatalf("expected: (0s, 100ms], result: %s", delay)
+	}
+}
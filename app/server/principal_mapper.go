@@ -0,0 +1,167 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrNoMatchingRule = errors.New("server: no principal mapping rule matches the distinguished name")
+
+type principalRule struct {
+	isDefault   bool
+	pattern     *regexp.Regexp
+	replacement string
+	toLower     bool
+	toUpper     bool
+}
+
+// PrincipalMapper maps the distinguished name of a client certificate to a
+// principal name, following the syntax of ssl.principal.mapping.rules:
+//
+//	RULE:^CN=(.*?),OU=ServiceUsers.*$/$1/L,DEFAULT
+//
+// The first rule whose pattern matches the whole name is applied, L and U
+// make the result lower or upper case, DEFAULT keeps the name as it is.
+type PrincipalMapper struct {
+	rules []principalRule
+}
+
+// DefaultPrincipalMapper keeps the distinguished names as they are.
+var DefaultPrincipalMapper = &PrincipalMapper{
+	rules: []principalRule{{isDefault: true}},
+}
+
+func ParsePrincipalMappingRules(rules string) (*PrincipalMapper, error) {
+	mapper := new(PrincipalMapper)
+	remaining := strings.TrimSpace(rules)
+
+	for remaining != "" {
+		var rule principalRule
+		var err error
+
+		switch {
+		case strings.HasPrefix(remaining, "DEFAULT"):
+			rule.isDefault = true
+			remaining = remaining[len("DEFAULT"):]
+		case strings.HasPrefix(remaining, "RULE:"):
+			if rule, remaining, err = parsePrincipalRule(remaining[len("RULE:"):]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("server: invalid principal mapping rule %q", remaining)
+		}
+
+		mapper.rules = append(mapper.rules, rule)
+
+		remaining = strings.TrimSpace(remaining)
+
+		if remaining == "" {
+			break
+		}
+
+		if remaining[0] != ',' {
+			return nil, fmt.Errorf("server: invalid principal mapping rule %q", remaining)
+		}
+
+		remaining = strings.TrimSpace(remaining[1:])
+	}
+
+	if len(mapper.rules) == 0 {
+		return DefaultPrincipalMapper, nil
+	}
+
+	return mapper, nil
+}
+
+// parsePrincipalRule parses `pattern/replacement/[LU]` returning what is
+// left after it.
+func parsePrincipalRule(rule string) (principalRule, string, error) {
+	var parsed principalRule
+
+	pattern, remaining, found := cutUnescaped(rule, '/')
+	if !found {
+		return parsed, "", fmt.Errorf("server: principal mapping rule %q has no replacement", rule)
+	}
+
+	replacement, remaining, found := cutUnescaped(remaining, '/')
+	if !found {
+		return parsed, "", fmt.Errorf("server: principal mapping rule %q is not terminated", rule)
+	}
+
+	var err error
+	if parsed.pattern, err = regexp.Compile("^(?:" + pattern + ")$"); err != nil {
+		return parsed, "", fmt.Errorf("server: principal mapping rule %q: %w", rule, err)
+	}
+
+	parsed.replacement = javaReplacement(replacement)
+
+	switch {
+	case strings.HasPrefix(remaining, "L"):
+		parsed.toLower = true
+		remaining = remaining[1:]
+	case strings.HasPrefix(remaining, "U"):
+		parsed.toUpper = true
+		remaining = remaining[1:]
+	}
+
+	return parsed, remaining, nil
+}
+
+// cutUnescaped is strings.Cut ignoring the separators escaped with a backslash.
+func cutUnescaped(s string, sep byte) (before, after string, found bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+
+	return s, "", false
+}
+
+var javaGroupReference = regexp.MustCompile(`\$(\d+)`)
+
+// javaReplacement turns the java replacement syntax used by kafka, with
+// backslash escapes and $1 group references, into the one of regexp.
+func javaReplacement(replacement string) string {
+	var unescaped strings.Builder
+
+	for i := 0; i < len(replacement); i++ {
+		if replacement[i] == '\\' && i+1 < len(replacement) {
+			i++
+		}
+		unescaped.WriteByte(replacement[i])
+	}
+
+	return javaGroupReference.ReplaceAllString(unescaped.String(), "$${$1}")
+}
+
+// Name returns the principal name of the distinguished name.
+func (pm *PrincipalMapper) Name(distinguishedName string) (string, error) {
+	for _, rule := range pm.rules {
+		if rule.isDefault {
+			return distinguishedName, nil
+		}
+
+		if !rule.pattern.MatchString(distinguishedName) {
+			continue
+		}
+
+		name := rule.pattern.ReplaceAllString(distinguishedName, rule.replacement)
+
+		switch {
+		case rule.toLower:
+			name = strings.ToLower(name)
+		case rule.toUpper:
+			name = strings.ToUpper(name)
+		}
+
+		return name, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrNoMatchingRule, distinguishedName)
+}
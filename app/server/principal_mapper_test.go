@@ -0,0 +1,93 @@
+package server_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/server"
+)
+
+var testPrincipalMapperCases = []struct {
+	rules    string
+	dn       string
+	expected string
+}{
+	{
+		rules:    "",
+		dn:       "CN=kafka1,OU=Engineering,O=Acme,C=GB",
+		expected: "CN=kafka1,OU=Engineering,O=Acme,C=GB",
+	},
+	{
+		rules:    "RULE:^CN=(.*?),OU=ServiceUsers.*$/$1/,DEFAULT",
+		dn:       "CN=kafka-client,OU=ServiceUsers,O=Acme",
+		expected: "kafka-client",
+	},
+	{
+		rules:    "RULE:^CN=(.*?),OU=ServiceUsers.*$/$1/,DEFAULT",
+		dn:       "CN=alice,OU=People,O=Acme",
+		expected: "CN=alice,OU=People,O=Acme",
+	},
+	{
+		rules:    "RULE:^CN=(.*?),OU=(.*?),O=(.*?)$/$1@$2/L, RULE:^.*[Cc][Nn]=([a-zA-Z0-9.]*).*$/$1/U",
+		dn:       "CN=Bob,OU=SRE,O=Acme",
+		expected: "bob@sre",
+	},
+	{
+		rules:    "RULE:^CN=(.*?),OU=(.*?),O=(.*?)$/$1@$2/L,\nRULE:^.*[Cc][Nn]=([a-zA-Z0-9.]*).*$/$1/U",
+		dn:       "cn=carol,C=US",
+		expected: "CAROL",
+	},
+	{
+		rules:    `RULE:^CN=([^,]*),.*$/users\/$1/`,
+		dn:       "CN=dave,O=Acme",
+		expected: "users/dave",
+	},
+}
+
+func TestPrincipalMapper(t *testing.T) {
+	for _, testCase := range testPrincipalMapperCases {
+		mapper, err := server.ParsePrincipalMappingRules(testCase.rules)
+
+		if err != nil {
+			t.Fatalf("rules: %q, unexpected error: %s", testCase.rules, err)
+		}
+
+		result, err := mapper.Name(testCase.dn)
+
+		if err != nil {
+			t.Fatalf("rules: %q, unexpected error: %s", testCase.rules, err)
+		}
+
+		if result != testCase.expected {
+			t.Errorf("rules: %q, expected: %s, result: %s", testCase.rules, testCase.expected, result)
+		}
+	}
+}
+
+func TestPrincipalMapperWithoutMatchingRule(t *testing.T) {
+	mapper, err := server.ParsePrincipalMappingRules("RULE:^CN=(.*?),OU=ServiceUsers.*$/$1/")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err = mapper.Name("CN=alice"); !errors.Is(err, server.ErrNoMatchingRule) {
+		t.Fatalf("expected: %s, result: %v", server.ErrNoMatchingRule, err)
+	}
+}
+
+var testInvalidPrincipalMappingRules = []string{
+	"RULE:^CN=(.*)$",
+	"RULE:^CN=(.*)$/$1",
+	"RULE:^CN=((.*$/$1/",
+	"DEFAULT;",
+	"NOT_A_RULE",
+}
+
+func TestParseInvalidPrincipalMappingRules(t *testing.T) {
+	for _, rules := range testInvalidPrincipalMappingRules {
+		if _, err := server.ParsePrincipalMappingRules(rules); err == nil {
+			t.Errorf("rules %q should be invalid", rules)
+		}
+	}
+}
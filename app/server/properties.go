@@ -0,0 +1,245 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/config"
+	"github.com/codecrafters-io/kafka-starter-go/app/sasl"
+)
+
+// DefaultListeners is the listeners default, a single PLAINTEXT listener
+// on the Kafka port.
+const DefaultListeners = "PLAINTEXT://:9092"
+
+// certificateReloadInterval is how often the keystores of the listeners are
+// checked for changes, Kafka reloads them on dynamic config updates instead.
+const certificateReloadInterval = time.Minute
+
+// BrokerListenersConfig returns the listeners of the broker properties:
+// listeners, advertised.listeners and listener.security.protocol.map, with
+// the TLS configuration of the SSL and SASL_SSL listeners and the SASL one
+// of the SASL_PLAINTEXT and SASL_SSL listeners.
+func BrokerListenersConfig(properties config.Properties) (*ListenersConfig, error) {
+	listenersConfig := &ListenersConfig{
+		Listeners:           properties.String("listeners", DefaultListeners),
+		AdvertisedListeners: properties.String("advertised.listeners", ""),
+		SecurityProtocolMap: properties.String("listener.security.protocol.map", ""),
+		TLS:                 make(map[string]*TLSConfig),
+		SASL:                make(map[string]*SASLConfig),
+	}
+
+	protocolMap := listenersConfig.SecurityProtocolMap
+
+	if protocolMap == "" {
+		protocolMap = DefaultSecurityProtocolMap
+	}
+
+	protocols, err := ParseSecurityProtocolMap(protocolMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints, err := ParseEndpoints(listenersConfig.Listeners, protocols)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, endpoint := range endpoints {
+		if endpoint.SecurityProtocol == SSL || endpoint.SecurityProtocol == SASLSSL {
+			if listenersConfig.TLS[endpoint.Name], err = listenerTLSConfig(properties, endpoint.Name); err != nil {
+				return nil, err
+			}
+		}
+
+		if endpoint.SecurityProtocol == SASLPlaintext || endpoint.SecurityProtocol == SASLSSL {
+			if listenersConfig.SASL[endpoint.Name], err = listenerSASLConfig(properties, endpoint.Name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return listenersConfig, nil
+}
+
+// DefaultMaxIdle is the connections.max.idle.ms default of Kafka.
+const DefaultMaxIdle = 10 * time.Minute
+
+// BrokerConnectionConfig returns the connection limits of the broker
+// properties: max.connections, max.connections.per.ip and its overrides,
+// max.connection.creation.rate and connections.max.idle.ms. The read and
+// write timeouts have no broker property, they stay disabled.
+func BrokerConnectionConfig(properties config.Properties) (ConnectionConfig, error) {
+	connectionConfig := ConnectionConfig{MaxIdle: DefaultMaxIdle}
+	var err error
+
+	for key, value := range map[string]*int{
+		"max.connections":        &connectionConfig.MaxConnections,
+		"max.connections.per.ip": &connectionConfig.MaxConnectionsPerIp,
+	} {
+		if *value, err = parseCount(key, properties.String(key, "")); err != nil {
+			return ConnectionConfig{}, err
+		}
+	}
+
+	overrides := properties.String("max.connections.per.ip.overrides", "")
+
+	if connectionConfig.MaxConnectionsPerIpOverrides, err = ParseMaxConnectionsPerIpOverrides(overrides); err != nil {
+		return ConnectionConfig{}, err
+	}
+
+	if rate := properties.String("max.connection.creation.rate", ""); rate != "" {
+		if connectionConfig.MaxConnectionCreationRate, err = strconv.ParseFloat(rate, 64); err != nil || connectionConfig.MaxConnectionCreationRate < 0 {
+			return ConnectionConfig{}, fmt.Errorf("server: invalid max.connection.creation.rate %q", rate)
+		}
+	}
+
+	if idle := properties.String("connections.max.idle.ms", ""); idle != "" {
+		if connectionConfig.MaxIdle, err = parseMs("connections.max.idle.ms", idle); err != nil {
+			return ConnectionConfig{}, err
+		}
+	}
+
+	return connectionConfig, nil
+}
+
+// parseCount parses the limit of the config key, zero when the value is
+// empty, the Integer.MAX_VALUE default of Kafka is unlimited too.
+func parseCount(key string, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	count, err := strconv.ParseInt(value, 10, 32)
+
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("server: invalid %s %q", key, value)
+	}
+
+	if count == math.MaxInt32 {
+		return 0, nil
+	}
+
+	return int(count), nil
+}
+
+// listenerProperty returns the value of key for the listener, the
+// `listener.name.<listener>.` prefixed one first, like Kafka.
+func listenerProperty(properties config.Properties, listener string, key string) string {
+	prefixed := "listener.name." + strings.ToLower(listener) + "." + key
+
+	return properties.String(prefixed, properties.String(key, ""))
+}
+
+// listenerTLSConfig reads the ssl configs of the listener. The keystore and
+// the truststore are PEM files, the only ssl.keystore.type and
+// ssl.truststore.type supported: the keystore has the certificate chain and
+// the private key, the truststore the authorities trusted to sign the client
+// certificates.
+func listenerTLSConfig(properties config.Properties, listener string) (*TLSConfig, error) {
+	for _, key := range []string{"ssl.keystore.type", "ssl.truststore.type"} {
+		if storeType := listenerProperty(properties, listener, key); storeType != "" && !strings.EqualFold(storeType, "PEM") {
+			return nil, fmt.Errorf("server: listener %s: unsupported %s %s, only PEM is", listener, key, storeType)
+		}
+	}
+
+	keystore := listenerProperty(properties, listener, "ssl.keystore.location")
+
+	if keystore == "" {
+		return nil, fmt.Errorf("server: listener %s needs ssl.keystore.location", listener)
+	}
+
+	clientAuth, err := ParseClientAuth(listenerProperty(properties, listener, "ssl.client.auth"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TLSConfig{
+		CertFile:              keystore,
+		KeyFile:               keystore,
+		ClientCAFile:          listenerProperty(properties, listener, "ssl.truststore.location"),
+		ClientAuth:            clientAuth,
+		ReloadInterval:        certificateReloadInterval,
+		PrincipalMappingRules: listenerProperty(properties, listener, "ssl.principal.mapping.rules"),
+	}, nil
+}
+
+// jaasUser matches the `user_<name>="<password>"` options of a JAAS config.
+var jaasUser = regexp.MustCompile(`user_([^=\s]+)\s*=\s*"([^"]*)"`)
+
+// listenerSASLConfig reads the sasl configs of the listener: the
+// sasl.enabled.mechanisms, all the supported ones when unset, and the
+// connections.max.reauth.ms. The users and their passwords are the
+// `user_<name>="<password>"` options of the sasl.jaas.config, like the
+// PlainLoginModule of Kafka, the `listener.name.<listener>.<mechanism>.`
+// prefixed ones included. They are kept in memory and check the SCRAM
+// mechanisms too, Kafka keeps the SCRAM credentials in the cluster metadata.
+func listenerSASLConfig(properties config.Properties, listener string) (*SASLConfig, error) {
+	saslConfig := &SASLConfig{}
+
+	if mechanisms := listenerProperty(properties, listener, "sasl.enabled.mechanisms"); mechanisms != "" {
+		for _, mechanism := range strings.Split(mechanisms, ",") {
+			if mechanism = strings.TrimSpace(mechanism); mechanism != "" {
+				saslConfig.Mechanisms = append(saslConfig.Mechanisms, strings.ToUpper(mechanism))
+			}
+		}
+	}
+
+	jaasConfigs := []string{properties.String("sasl.jaas.config", "")}
+
+	for _, mechanism := range saslConfig.mechanisms() {
+		key := "listener.name." + strings.ToLower(listener) + "." + strings.ToLower(mechanism) + ".sasl.jaas.config"
+		jaasConfigs = append(jaasConfigs, properties.String(key, ""))
+	}
+
+	credentials := sasl.NewMemoryCredentialStore()
+	users := 0
+
+	for _, jaasConfig := range jaasConfigs {
+		for _, match := range jaasUser.FindAllStringSubmatch(jaasConfig, -1) {
+			if err := credentials.SetPassword(match[1], match[2]); err != nil {
+				return nil, err
+			}
+
+			users++
+		}
+	}
+
+	if users == 0 {
+		return nil, fmt.Errorf("server: listener %s has no user on sasl.jaas.config", listener)
+	}
+
+	sessionLifetime, err := parseMs("connections.max.reauth.ms", listenerProperty(properties, listener, "connections.max.reauth.ms"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	saslConfig.Credentials = credentials
+	saslConfig.SessionLifetime = sessionLifetime
+
+	return saslConfig, nil
+}
+
+// parseMs parses the milliseconds of the config key as a duration, zero
+// when the value is empty.
+func parseMs(key string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	ms, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("server: invalid %s %q", key, value)
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
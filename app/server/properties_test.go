@@ -0,0 +1,233 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/config"
+	"github.com/codecrafters-io/kafka-starter-go/app/sasl"
+)
+
+func TestBrokerListenersConfig(t *testing.T) {
+	result, err := BrokerListenersConfig(config.Properties{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Listeners != DefaultListeners || result.AdvertisedListeners != "" || result.SecurityProtocolMap != "" {
+		t.Fatalf("unexpected default listeners: %+v", result)
+	}
+
+	result, err = BrokerListenersConfig(config.Properties{
+		"listeners":                      "INTERNAL://:9092,CONTROLLER://:9093",
+		"advertised.listeners":           "INTERNAL://broker-1:9092",
+		"listener.security.protocol.map": "INTERNAL:PLAINTEXT,CONTROLLER:PLAINTEXT",
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if result.Listeners != "INTERNAL://:9092,CONTROLLER://:9093" ||
+		result.AdvertisedListeners != "INTERNAL://broker-1:9092" ||
+		result.SecurityProtocolMap != "INTERNAL:PLAINTEXT,CONTROLLER:PLAINTEXT" {
+		t.Fatalf("unexpected listeners: %+v", result)
+	}
+}
+
+func TestBrokerListenersConfigTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, pkix.Name{CommonName: "test-ca"}, nil)
+	newTestCertificate(t, pkix.Name{CommonName: "broker"}, ca).
+		write(t, filepath.Join(dir, "broker.pem"), filepath.Join(dir, "broker.key"))
+	ca.write(t, filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.key"))
+
+	// a PEM keystore has the certificate chain and the key
+	certificate, _ := os.ReadFile(filepath.Join(dir, "broker.pem"))
+	key, _ := os.ReadFile(filepath.Join(dir, "broker.key"))
+
+	if err := os.WriteFile(filepath.Join(dir, "keystore.pem"), append(certificate, key...), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	properties := config.Properties{
+		"listeners":                                    "INTERNAL://127.0.0.1:0,EXTERNAL://127.0.0.1:0",
+		"listener.security.protocol.map":               "INTERNAL:PLAINTEXT,EXTERNAL:SSL",
+		"listener.name.external.ssl.keystore.location": filepath.Join(dir, "keystore.pem"),
+		"ssl.keystore.type":                            "PEM",
+		"ssl.truststore.location":                      filepath.Join(dir, "ca.pem"),
+		"ssl.client.auth":                              "required",
+		"ssl.principal.mapping.rules":                  "RULE:^CN=(.*?),OU=ServiceUsers.*$/$1/L,DEFAULT",
+	}
+
+	listenersConfig, err := BrokerListenersConfig(properties)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, found := listenersConfig.TLS["INTERNAL"]; found || len(listenersConfig.TLS) != 1 {
+		t.Fatalf("unexpected TLS listeners: %v", listenersConfig.TLS)
+	}
+
+	ks := newTestServer(t)
+	Handle(ks, ApiVersions, ApiVersionRange{0, 4}, handlePrincipal)
+
+	go ks.ListenAndServeListeners(listenersConfig)
+
+	deadline := time.Now().Add(time.Second)
+
+	for len(ks.AdvertisedListeners()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	external, found := ks.AdvertisedListener("EXTERNAL")
+
+	if !found {
+		t.Fatalf("unexpected advertised listeners: %v", ks.AdvertisedListeners())
+	}
+
+	client := newTestCertificate(t, pkix.Name{
+		CommonName:         "Alice",
+		OrganizationalUnit: []string{"ServiceUsers"},
+	}, ca)
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.certificate)
+
+	conn, err := tls.Dial("tcp", external.Address(), &tls.Config{
+		RootCAs:      rootCAs,
+		Certificates: []tls.Certificate{client.tlsCertificate()},
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	result, err := roundTrip(conn, ApiVersions, 4, nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []byte{0, 0, 0, 7, 0, 5, 'a', 'l', 'i', 'c', 'e'}
+
+	if !slices.Equal(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+
+	for _, invalid := range []config.Properties{
+		{"listeners": "SSL://:9093"},
+		{"listeners": "SSL://:9093", "ssl.keystore.location": "keystore.jks", "ssl.keystore.type": "JKS"},
+		{"listeners": "SSL://:9093", "ssl.keystore.location": "keystore.pem", "ssl.client.auth": "always"},
+	} {
+		if _, err := BrokerListenersConfig(invalid); err == nil {
+			t.Fatalf("expected an error for %v", invalid)
+		}
+	}
+}
+
+func TestBrokerListenersConfigSASL(t *testing.T) {
+	listenersConfig, err := BrokerListenersConfig(config.Properties{
+		"listeners":                      "INTERNAL://:9092,EXTERNAL://:9093",
+		"listener.security.protocol.map": "INTERNAL:PLAINTEXT,EXTERNAL:SASL_PLAINTEXT",
+		"sasl.enabled.mechanisms":        "plain, SCRAM-SHA-512",
+		"connections.max.reauth.ms":      "3600000",
+		"sasl.jaas.config": `org.apache.kafka.common.security.plain.PlainLoginModule required ` +
+			`username="admin" password="admin-secret" user_admin="admin-secret";`,
+		"listener.name.external.scram-sha-512.sasl.jaas.config": `org.apache.kafka.common.security.scram.ScramLoginModule required ` +
+			`user_alice="alice-secret";`,
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	saslConfig, found := listenersConfig.SASL["EXTERNAL"]
+
+	if !found || len(listenersConfig.SASL) != 1 {
+		t.Fatalf("unexpected SASL listeners: %v", listenersConfig.SASL)
+	}
+
+	if !slices.Equal(saslConfig.Mechanisms, []string{sasl.Plain, sasl.ScramSha512}) || saslConfig.SessionLifetime != time.Hour {
+		t.Fatalf("unexpected SASL config: %+v", saslConfig)
+	}
+
+	for username, password := range map[string]string{"admin": "admin-secret", "alice": "alice-secret"} {
+		if err := saslConfig.Credentials.VerifyPassword(username, password); err != nil {
+			t.Fatalf("%s, unexpected error: %s", username, err)
+		}
+
+		if _, err := saslConfig.Credentials.ScramCredential(sasl.ScramSha512, username); err != nil {
+			t.Fatalf("%s, unexpected error: %s", username, err)
+		}
+	}
+
+	if err := saslConfig.Credentials.VerifyPassword("username", "admin"); err == nil {
+		t.Fatal("the login options shouldn't be users")
+	}
+
+	for _, invalid := range []config.Properties{
+		{"listeners": "SASL_PLAINTEXT://:9093"},
+		{"listeners": "SASL_PLAINTEXT://:9093", "sasl.jaas.config": `user_alice="alice-secret";`, "connections.max.reauth.ms": "soon"},
+	} {
+		if _, err := BrokerListenersConfig(invalid); err == nil {
+			t.Fatalf("expected an error for %v", invalid)
+		}
+	}
+}
+
+func TestBrokerConnectionConfig(t *testing.T) {
+	result, err := BrokerConnectionConfig(config.Properties{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if expected := (ConnectionConfig{MaxIdle: DefaultMaxIdle, MaxConnectionsPerIpOverrides: map[string]int{}}); !reflect.DeepEqual(expected, result) {
+		t.Fatalf("expected: %+v, result: %+v", expected, result)
+	}
+
+	result, err = BrokerConnectionConfig(config.Properties{
+		"max.connections":                  "1000",
+		"max.connections.per.ip":           "2147483647",
+		"max.connections.per.ip.overrides": "10.0.0.1:5,[::1]:0",
+		"max.connection.creation.rate":     "12.5",
+		"connections.max.idle.ms":          "30000",
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := ConnectionConfig{
+		MaxConnections:               1000,
+		MaxConnectionsPerIpOverrides: map[string]int{"10.0.0.1": 5, "::1": 0},
+		MaxConnectionCreationRate:    12.5,
+		MaxIdle:                      30 * time.Second,
+	}
+
+	if !reflect.DeepEqual(expected, result) {
+		t.Fatalf("expected: %+v, result: %+v", expected, result)
+	}
+
+	for _, invalid := range []config.Properties{
+		{"max.connections": "-1"},
+		{"max.connections.per.ip": "many"},
+		{"max.connections.per.ip.overrides": "10.0.0.1"},
+		{"max.connection.creation.rate": "fast"},
+		{"connections.max.idle.ms": "-5"},
+	} {
+		if _, err := BrokerConnectionConfig(invalid); err == nil {
+			t.Fatalf("expected an error for %v", invalid)
+		}
+	}
+}
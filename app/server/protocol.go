@@ -4,18 +4,23 @@ type ApiKey int16
 type ApiVersion int16
 
 const (
+	Produce                 ApiKey = 0
+	Fetch                   ApiKey = 1
+	SaslHandshake           ApiKey = 17
 	ApiVersions             ApiKey = 18
+	DeleteRecords           ApiKey = 21
+	AlterReplicaLogDirs     ApiKey = 34
+	DescribeLogDirs         ApiKey = 35
+	SaslAuthenticate        ApiKey = 36
+	DescribeClientQuotas    ApiKey = 48
+	AlterClientQuotas       ApiKey = 49
 	DescribeTopicPartitions ApiKey = 75
 )
 
+// ErrorCode is the error code of the kafka protocol, it implements error so
+// handlers can return it directly, see error_codes.go for the full catalog.
 type ErrorCode int16
 
-const (
-	UnknownServerError ErrorCode = -1
-	UnknownTopic       ErrorCode = 3
-	UnsupportedVersion ErrorCode = 35
-)
-
 type TaggedField struct {
 	Tag  uint32 `kafka:"0"`
 	Data []byte `kafka:"1"`
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/quota"
+)
+
+// requestThrottle is the throttle time of a request, reported on its
+// response and enforced by muting the connection after sending it.
+type requestThrottle struct {
+	time time.Duration
+	// recordResponse charges the size of the response to the quotas, it is
+	// set by Quotas on the requests whose responses count against them.
+	recordResponse   func(size int)
+	responseRecorded bool
+}
+
+type throttleKey struct{}
+
+// ThrottleTimeMsFromContext returns the ThrottleTimeMs the response of the
+// request must report.
+func ThrottleTimeMsFromContext(ctx context.Context) int32 {
+	if throttle, ok := ctx.Value(throttleKey{}).(*requestThrottle); ok {
+		return int32(throttle.time.Milliseconds())
+	}
+
+	return 0
+}
+
+// throttleRequest raises the throttle time of the request to throttleTime.
+func throttleRequest(ctx context.Context, throttleTime time.Duration) {
+	if throttle, ok := ctx.Value(throttleKey{}).(*requestThrottle); ok {
+		throttle.time = max(throttle.time, throttleTime)
+	}
+}
+
+// recordResponseSize charges the size of the encoded response to the quotas
+// of the client, returning whether it raised the throttle time of the
+// request.
+func recordResponseSize(ctx context.Context, size int) bool {
+	throttle, ok := ctx.Value(throttleKey{}).(*requestThrottle)
+
+	if !ok || throttle.recordResponse == nil || throttle.responseRecorded {
+		return false
+	}
+
+	before := throttle.time
+	throttle.recordResponse(size)
+	throttle.responseRecorded = true
+
+	return throttle.time > before
+}
+
+// reportThrottleTime raises the ThrottleTimeMs field of the response, when
+// it has one, to the throttle time of the request. It returns whether the
+// field changed.
+func reportThrottleTime(ctx context.Context, response any) bool {
+	value := reflect.ValueOf(response)
+
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return false
+	}
+
+	field := value.Elem().FieldByName("ThrottleTimeMs")
+	throttleTimeMs := ThrottleTimeMsFromContext(ctx)
+
+	if !field.IsValid() || field.Kind() != reflect.Int32 || !field.CanSet() || field.Int() >= int64(throttleTimeMs) {
+		return false
+	}
+
+	field.SetInt(int64(throttleTimeMs))
+
+	return true
+}
+
+// countingWriter counts the bytes written by the handler.
+type countingWriter struct {
+	ResponseWriter
+	written int
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.ResponseWriter.Write(p)
+	cw.written += n
+	return n, err
+}
+
+// Quotas throttles the clients over their quotas of manager, keyed by the
+// principal name and the client id. Produce requests count against the
+// producer_byte_rate, Fetch responses against the consumer_byte_rate and the
+// time spent handling any request against the request_percentage.
+//
+// The throttle known before the handler runs is reported through
+// ThrottleTimeMsFromContext. The typed handlers charge the size of the Fetch
+// responses once encoded, and report the throttle it causes on the response
+// itself, like the brokers do. The throttle of the time spent handling the
+// request only mutes the connection, the client sees it on its next
+// response.
+func Quotas(manager *quota.Manager) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(rw ResponseWriter, req *Request) error {
+			ctx := req.Context()
+			user := PrincipalFromContext(ctx).Name
+			clientId := req.Headers.ClientId
+			start := time.Now()
+
+			throttleRequest(ctx, manager.ThrottleTime(user, clientId, quota.RequestPercentage, start))
+
+			switch req.ApiVersion.Key {
+			case Produce:
+				throttleRequest(ctx, manager.Record(user, clientId, quota.ProducerByteRate, float64(req.MessageSize), start))
+			case Fetch:
+				throttleRequest(ctx, manager.ThrottleTime(user, clientId, quota.ConsumerByteRate, start))
+
+				if throttle, ok := ctx.Value(throttleKey{}).(*requestThrottle); ok {
+					throttle.recordResponse = func(size int) {
+						throttleRequest(ctx, manager.Record(user, clientId, quota.ConsumerByteRate, float64(size), time.Now()))
+					}
+				}
+			}
+
+			counter := &countingWriter{ResponseWriter: rw}
+			err := next(counter, req)
+			end := time.Now()
+
+			// the percentage of one thread used by the request
+			percentage := end.Sub(start).Seconds() * 100
+			throttleRequest(ctx, manager.Record(user, clientId, quota.RequestPercentage, percentage, end))
+
+			// the handlers that aren't typed only count once written
+			if req.ApiVersion.Key == Fetch {
+				recordResponseSize(ctx, counter.written)
+			}
+
+			return err
+		}
+	}
+}
+
+// mute waits for the throttle time of the response before the connection
+// reads the next request.
+func (c *conn) mute(res *response) {
+	if res.throttle.time <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(res.throttle.time)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-c.ctx.Done():
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/quota"
+)
+
+type throttleResponse struct {
+	ThrottleTimeMs int32 `kafka:"0"`
+}
+
+func handleThrottle(ctx context.Context, _ *versionsRequest, _ ApiVersion) (*throttleResponse, error) {
+	return &throttleResponse{ThrottleTimeMs: ThrottleTimeMsFromContext(ctx)}, nil
+}
+
+func TestQuotasThrottleAndMute(t *testing.T) {
+	manager := quota.NewManager(quota.Config{Samples: 2, WindowSize: 50 * time.Millisecond})
+	manager.Set(quota.Entity{User: AnonymousPrincipal.Name}, quota.ProducerByteRate, 10)
+
+	ks := newTestServer(t)
+	ks.Use(Quotas(manager))
+	Handle(ks, Produce, ApiVersionRange{0, 0}, handleThrottle)
+
+	conn := servePipe(t, ks)
+	result, err := roundTrip(conn, Produce, 0, make([]byte, 100))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the throttle is capped to the 100ms of the quota window
+	if throttleTimeMs := int32(binary.BigEndian.Uint32(result[4:])); throttleTimeMs != 100 {
+		t.Fatalf("expected: 100, result: %d", throttleTimeMs)
+	}
+
+	start := time.Now()
+
+	if _, err = roundTrip(conn, Produce, 0, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected the connection to be muted for 100ms, result: %s", elapsed)
+	}
+}
+
+type fetchThrottleResponse struct {
+	ThrottleTimeMs int32  `kafka:"0"`
+	Records        []byte `kafka:"1"`
+}
+
+func handleFetchThrottle(ctx context.Context, _ *versionsRequest, _ ApiVersion) (*fetchThrottleResponse, error) {
+	return &fetchThrottleResponse{ThrottleTimeMs: ThrottleTimeMsFromContext(ctx), Records: make([]byte, 200)}, nil
+}
+
+func TestQuotasChargeFetchResponses(t *testing.T) {
+	manager := quota.NewManager(quota.Config{Samples: 2, WindowSize: 50 * time.Millisecond})
+	manager.Set(quota.Entity{User: AnonymousPrincipal.Name}, quota.ConsumerByteRate, 10)
+
+	ks := newTestServer(t)
+	ks.Use(Quotas(manager))
+	Handle(ks, Fetch, ApiVersionRange{0, 0}, handleFetchThrottle)
+
+	conn := servePipe(t, ks)
+	result, err := roundTrip(conn, Fetch, 0, nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the first response over the quota already reports the throttle
+	if throttleTimeMs := int32(binary.BigEndian.Uint32(result[4:])); throttleTimeMs != 100 {
+		t.Fatalf("expected: 100, result: %d", throttleTimeMs)
+	}
+
+	if records := binary.BigEndian.Uint32(result[8:]); records != 200 || len(result) != 12+200 {
+		t.Fatalf("unexpected response of %d bytes, records: %d", len(result), records)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"slices"
+)
+
+// DefaultListenerName is the name of the listener opened by ListenAndServe.
+const DefaultListenerName = "PLAINTEXT"
+
+type SupportedApi struct {
+	Key      ApiKey
+	Versions ApiVersionRange
+}
+
+// SupportedApis returns the apis handled on the named listener, ordered by
+// ApiKey. An api with several handlers is advertised from the lowest to the
+// highest version handled, ApiVersions has no way to describe gaps between
+// them, the versions on a gap are answered as unsupported.
+func (ks *KafkaServer) SupportedApis(listener string) []SupportedApi {
+	ks.mutex.RLock()
+	apiKeys := make([]ApiKey, 0, len(ks.handlers))
+	for apiKey := range ks.handlers {
+		apiKeys = append(apiKeys, apiKey)
+	}
+	ks.mutex.RUnlock()
+
+	slices.Sort(apiKeys)
+
+	supportedApis := make([]SupportedApi, 0, len(apiKeys))
+
+	for _, apiKey := range apiKeys {
+		handlers := ks.visibleHandlers(apiKey, listener)
+
+		if len(handlers) == 0 {
+			continue
+		}
+
+		supportedApis = append(supportedApis, SupportedApi{
+			Key: apiKey,
+			Versions: ApiVersionRange{
+				Min: handlers[0].versionRange.Min,
+				Max: handlers[len(handlers)-1].versionRange.Max,
+			},
+		})
+	}
+
+	return supportedApis
+}
+
+type serverKey struct{}
+type listenerKey struct{}
+
+// ServerFromContext returns the server handling the request.
+func ServerFromContext(ctx context.Context) (*KafkaServer, bool) {
+	ks, ok := ctx.Value(serverKey{}).(*KafkaServer)
+	return ks, ok
+}
+
+// ListenerFromContext returns the name of the listener that accepted the
+// connection of the request.
+func ListenerFromContext(ctx context.Context) string {
+	if listener, ok := ctx.Value(listenerKey{}).(string); ok {
+		return listener
+	}
+
+	return DefaultListenerName
+}
+
+// SupportedApisFromContext returns the apis the server handling the request
+// supports on its listener.
+func SupportedApisFromContext(ctx context.Context) []SupportedApi {
+	ks, ok := ServerFromContext(ctx)
+
+	if !ok {
+		return nil
+	}
+
+	return ks.SupportedApis(ListenerFromContext(ctx))
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func handleVersions(context.Context, *versionsRequest, ApiVersion) (*versionsResponse, error) {
+	return &versionsResponse{}, nil
+}
+
+func TestSupportedApisArePerServer(t *testing.T) {
+	broker := newTestServer(t)
+	Handle(broker, DescribeTopicPartitions, ApiVersionRange{0, 0}, handleVersions)
+	Handle(broker, ApiVersions, ApiVersionRange{0, 4}, handleVersions)
+
+	controller := newTestServer(t)
+	Handle(controller, ApiVersions, ApiVersionRange{0, 3}, handleVersions)
+
+	expected := []SupportedApi{
+		{ApiVersions, ApiVersionRange{0, 4}},
+		{DescribeTopicPartitions, ApiVersionRange{0, 0}},
+	}
+
+	if result := broker.SupportedApis(DefaultListenerName); !reflect.DeepEqual(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+
+	expected = []SupportedApi{
+		{ApiVersions, ApiVersionRange{0, 3}},
+	}
+
+	if result := controller.SupportedApis(DefaultListenerName); !reflect.DeepEqual(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+}
+
+func TestApisHiddenFromOtherListeners(t *testing.T) {
+	ks := newTestServer(t)
+	Handle(ks, ApiVersions, ApiVersionRange{0, 4}, handleVersions)
+	AddTyped(ks.Handler(DescribeTopicPartitions).Listeners("CONTROLLER"), handleVersions)
+
+	expected := []SupportedApi{
+		{ApiVersions, ApiVersionRange{0, 4}},
+	}
+
+	if result := ks.SupportedApis(DefaultListenerName); !reflect.DeepEqual(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+
+	if _, err := roundTrip(servePipeOn(t, ks, "CONTROLLER"), DescribeTopicPartitions, 0, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err := roundTrip(servePipe(t, ks), DescribeTopicPartitions, 0, nil)
+
+	if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("expected the connection to be closed, result: %v", err)
+	}
+}
+
+func TestMultipleVersionRangesPerApi(t *testing.T) {
+	ks := newTestServer(t)
+
+	handleOld := func(context.Context, *versionsRequest, ApiVersion) (*versionsResponse, error) {
+		return &versionsResponse{ErrorCode: 1}, nil
+	}
+
+	handleNew := func(context.Context, *versionsRequest, ApiVersion) (*versionsResponse, error) {
+		return &versionsResponse{ErrorCode: 2}, nil
+	}
+
+	next := AddTyped(ks.Handler(DescribeTopicPartitions).Version(0, 1), handleOld)
+	AddTyped(next.Version(3, 4).Opts().ResponseHeaderVersion(1).And(), handleNew)
+
+	expected := []SupportedApi{
+		{DescribeTopicPartitions, ApiVersionRange{0, 4}},
+	}
+
+	if result := ks.SupportedApis(DefaultListenerName); !reflect.DeepEqual(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+
+	conn := servePipe(t, ks)
+
+	var testCases = []struct {
+		version  ApiVersion
+		expected []byte
+	}{
+		{version: 1, expected: []byte{0, 0, 0, 7, 0, 1, 0, 0, 0, 0}},
+		// the gap is answered with the shape of the next handler
+		{version: 2, expected: []byte{0, 0, 0, 7, 0, 0, 35, 0, 0, 0, 0}},
+		{version: 3, expected: []byte{0, 0, 0, 7, 0, 0, 2, 1}},
+	}
+
+	for _, testCase := range testCases {
+		result, err := roundTrip(conn, DescribeTopicPartitions, testCase.version, nil)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if !reflect.DeepEqual(testCase.expected, result) {
+			t.Errorf("version: %d, expected: %v, result: %v", testCase.version, testCase.expected, result)
+		}
+	}
+}
+
+func TestOverlappingVersionRangesPanic(t *testing.T) {
+	ks := newTestServer(t)
+	Handle(ks, ApiVersions, ApiVersionRange{0, 2}, handleVersions)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering ApiVersions for versions 2-4 should panic")
+		}
+	}()
+
+	Handle(ks, ApiVersions, ApiVersionRange{2, 4}, handleVersions)
+}
@@ -2,7 +2,8 @@ package server
 
 import (
 	"bytes"
-	"fmt"
+	"context"
+	"errors"
 	"io"
 
 	"github.com/codecrafters-io/kafka-starter-go/app/encoding/kafka"
@@ -22,8 +23,43 @@ type Request struct {
 	}
 	Headers RequestHeaders
 	Body    io.Reader
+
+	message    []byte
+	bodyOffset int
+	ctx        context.Context
+}
+
+// Context returns the request context, it is never nil.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+type requestKey struct{}
+
+// RequestFromContext returns the request being handled, it is set for the
+// handlers registered through Handle.
+func RequestFromContext(ctx context.Context) (*Request, bool) {
+	request, ok := ctx.Value(requestKey{}).(*Request)
+	return request, ok
+}
+
+// WithContext returns a shallow copy of the request with its context changed to ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r2 := new(Request)
+	*r2 = *r
+	r2.ctx = ctx
+	return r2
 }
 
+// apiVersionSize is the size of the api key and version that start every request.
+const apiVersionSize = 4
+
 func ParseRequest(reader io.Reader) (request *Request, err error) {
 	request = new(Request)
 
@@ -31,39 +67,65 @@ func ParseRequest(reader io.Reader) (request *Request, err error) {
 		return nil, err
 	}
 
-	var messageReader io.Reader
-
-	if messageReader, err = readMessage(reader, request.MessageSize); err != nil {
+	if request.message, err = readMessage(reader, request.MessageSize); err != nil {
 		return nil, err
 	}
 
+	messageReader := bytes.NewReader(request.message)
 	decoder := kafka.NewDecoder(messageReader)
 
 	if err = decoder.Decode(&request.ApiVersion); err != nil {
 		return nil, err
 	}
 
+	// the correlation id is the only header field present on every header
+	// version, the remaining ones are decoded once the handler is known
 	if err = decoder.DecodeWithOpts(&request.Headers, &kafka.DecoderOpts{
-		Version: 2, // TODO get correctly version Here
+		Version: 0,
 	}); err != nil {
 		return nil, err
 	}
 
 	request.Body = messageReader
+	request.bodyOffset = -1
 
-	if b, ok := messageReader.(*bytes.Buffer); ok {
-		fmt.Println(b.Bytes())
+	return request, nil
+}
+
+// decodeHeaders decodes the request headers using the given header version
+// and moves Body to the first byte after them.
+func (r *Request) decodeHeaders(version int) (err error) {
+	reader := bytes.NewReader(r.message[apiVersionSize:])
+
+	if err = kafka.NewDecoder(reader).DecodeWithOpts(&r.Headers, &kafka.DecoderOpts{
+		Version: version,
+	}); err != nil {
+		return err
 	}
 
-	return request, nil
+	r.Body = reader
+	r.bodyOffset = len(r.message) - reader.Len()
+
+	return nil
+}
+
+var errHeadersNotDecoded = errors.New("server: request headers were not decoded")
+
+// body returns a new reader over the request body, so it can be decoded again.
+func (r *Request) body() (io.Reader, error) {
+	if r.bodyOffset < 0 {
+		return nil, errHeadersNotDecoded
+	}
+
+	return bytes.NewReader(r.message[r.bodyOffset:]), nil
 }
 
-func readMessage(reader io.Reader, messageSize int32) (bytesReader io.Reader, err error) {
-	message := make([]byte, messageSize)
+func readMessage(reader io.Reader, messageSize int32) (message []byte, err error) {
+	message = make([]byte, messageSize)
 
-	if _, err = reader.Read(message); err != nil {
+	if _, err = io.ReadFull(reader, message); err != nil {
 		return nil, err
 	}
 
-	return bytes.NewBuffer(message), nil
+	return message, nil
 }
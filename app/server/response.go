@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"time"
 )
 
 type ResponseWriter interface {
@@ -14,10 +15,14 @@ type responseHeader struct {
 }
 
 type response struct {
-	conn    *conn
-	req     *Request
-	headers responseHeader
-	buffer  *bytes.Buffer
+	conn          *conn
+	req           *Request
+	headers       responseHeader
+	headerVersion int
+	buffer        *bytes.Buffer
+	throttle      *requestThrottle
+	// received is when the request was read
+	received time.Time
 }
 
 func (r *response) Write(p []byte) (n int, err error) {
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/sasl"
+)
+
+// SASLPlaintextListenerName is the name of the listener opened by
+// ListenAndServeSASL.
+const SASLPlaintextListenerName = "SASL_PLAINTEXT"
+
+type SASLConfig struct {
+	// Mechanisms are the sasl.enabled.mechanisms, all the mechanisms of the
+	// sasl package when empty.
+	Mechanisms []string
+	// Credentials are checked by the mechanisms to authenticate the clients.
+	Credentials sasl.CredentialStore
+	// SessionLifetime is the connections.max.reauth.ms, once it expires the
+	// client must re-authenticate before sending other requests (KIP-368).
+	// Zero keeps the sessions valid while the connection is open.
+	SessionLifetime time.Duration
+}
+
+func (sc *SASLConfig) mechanisms() []string {
+	if len(sc.Mechanisms) == 0 {
+		return sasl.Mechanisms
+	}
+
+	return sc.Mechanisms
+}
+
+type SaslHandshakeRequest struct {
+	Mechanism string `kafka:"0"`
+}
+
+// Versions starts at 1, on version 0 the authentication bytes follow the
+// handshake without SaslAuthenticate framing, which is not supported.
+func (SaslHandshakeRequest) Versions() ApiVersionRange {
+	return ApiVersionRange{Min: 1, Max: 1}
+}
+
+type SaslHandshakeResponse struct {
+	ErrorCode  ErrorCode `kafka:"0"`
+	Mechanisms []string  `kafka:"1"`
+}
+
+// ErrorResponse lists the enabled mechanisms, so the client knows which
+// ones it could have asked for.
+func (SaslHandshakeRequest) ErrorResponse(ctx context.Context, _ ApiVersion, code ErrorCode) *SaslHandshakeResponse {
+	response := &SaslHandshakeResponse{ErrorCode: code}
+
+	if authenticator, ok := saslAuthenticatorFromContext(ctx); ok {
+		response.Mechanisms = authenticator.config.mechanisms()
+	}
+
+	return response
+}
+
+type SaslAuthenticateRequest struct {
+	AuthBytes    []byte        `kafka:"0,compact=2"`
+	TaggedFields []TaggedField `kafka:"1,minVersion=2,compact,nilable"`
+}
+
+func (SaslAuthenticateRequest) Versions() ApiVersionRange {
+	return ApiVersionRange{Min: 0, Max: 2}
+}
+
+type SaslAuthenticateResponse struct {
+	ErrorCode         ErrorCode     `kafka:"0"`
+	ErrorMessage      string        `kafka:"1,compact=2"`
+	AuthBytes         []byte        `kafka:"2,compact=2"`
+	SessionLifetimeMs int64         `kafka:"3,minVersion=1"`
+	TaggedFields      []TaggedField `kafka:"4,minVersion=2,compact,nilable"`
+}
+
+func (SaslAuthenticateResponse) Versions() ApiVersionRange {
+	return ApiVersionRange{Min: 0, Max: 2}
+}
+
+func (SaslAuthenticateRequest) ErrorResponse(_ context.Context, _ ApiVersion, code ErrorCode) *SaslAuthenticateResponse {
+	return &SaslAuthenticateResponse{
+		ErrorCode:    code,
+		ErrorMessage: code.Message(),
+	}
+}
+
+type saslState int
+
+const (
+	// only ApiVersions and SaslHandshake are accepted
+	saslHandshake saslState = iota
+	// the mechanism is chosen, only SaslAuthenticate is accepted
+	saslAuthenticate
+	// the principal is authenticated until the session expires
+	saslComplete
+)
+
+var ErrSaslStateClosed = errors.New("server: connection closed by the SASL authentication")
+
+// saslAuthenticator is the authentication state machine of a connection on
+// a SASL listener.
+type saslAuthenticator struct {
+	config        *SASLConfig
+	state         saslState
+	mechanism     string
+	session       sasl.Session
+	authenticated bool
+	principal     Principal
+	expiresAt     time.Time
+	// failed closes the connection once the failure response is sent
+	failed bool
+}
+
+func newSaslAuthenticator(config *SASLConfig) *saslAuthenticator {
+	return &saslAuthenticator{config: config}
+}
+
+// allow checks whether the api can be requested on the current state, the
+// connection is closed when it can't.
+func (sa *saslAuthenticator) allow(apiKey ApiKey, now time.Time) error {
+	if sa.failed {
+		return ErrSaslStateClosed
+	}
+
+	switch sa.state {
+	case saslHandshake:
+		if apiKey == ApiVersions || apiKey == SaslHandshake {
+			return nil
+		}
+	case saslAuthenticate:
+		if apiKey == SaslAuthenticate {
+			return nil
+		}
+	case saslComplete:
+		if apiKey == SaslHandshake {
+			return nil
+		}
+
+		if !sa.expiresAt.IsZero() && now.After(sa.expiresAt) {
+			return fmt.Errorf("%w: the session of %s expired", ErrSaslStateClosed, sa.principal)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: api with key %d is not allowed before authentication", ErrSaslStateClosed, apiKey)
+}
+
+func (sa *saslAuthenticator) fail(code ErrorCode, err error) error {
+	sa.failed = true
+	return NewError(code, err)
+}
+
+func (sa *saslAuthenticator) handshake(mechanism string) error {
+	if sa.state != saslHandshake && sa.state != saslComplete {
+		return sa.fail(ErrIllegalSaslState, errors.New("unexpected SaslHandshake request"))
+	}
+
+	if !slices.Contains(sa.config.mechanisms(), mechanism) {
+		return sa.fail(ErrUnsupportedSaslMechanism, fmt.Errorf("%w: %s", sasl.ErrUnsupportedMechanism, mechanism))
+	}
+
+	if sa.authenticated && mechanism != sa.mechanism {
+		return sa.fail(ErrIllegalSaslState, fmt.Errorf(
+			"re-authentication must use %s, the mechanism of the session, not %s", sa.mechanism, mechanism,
+		))
+	}
+
+	session, err := sasl.NewSession(mechanism, sa.config.Credentials)
+
+	if err != nil {
+		return sa.fail(ErrUnsupportedSaslMechanism, err)
+	}
+
+	sa.mechanism = mechanism
+	sa.session = session
+	sa.state = saslAuthenticate
+
+	return nil
+}
+
+func (sa *saslAuthenticator) authenticate(authBytes []byte, now time.Time) (*SaslAuthenticateResponse, error) {
+	if sa.state != saslAuthenticate {
+		return nil, sa.fail(ErrIllegalSaslState, errors.New("unexpected SaslAuthenticate request"))
+	}
+
+	challenge, done, err := sa.session.Next(authBytes)
+
+	if err != nil {
+		return nil, sa.fail(ErrSaslAuthenticationFailed, err)
+	}
+
+	response := &SaslAuthenticateResponse{AuthBytes: challenge}
+
+	if !done {
+		return response, nil
+	}
+
+	principal := Principal{Type: "User", Name: sa.session.Username()}
+
+	if sa.authenticated && principal != sa.principal {
+		return nil, sa.fail(ErrSaslAuthenticationFailed, fmt.Errorf(
+			"re-authentication must keep the principal %s, not change it to %s", sa.principal, principal,
+		))
+	}
+
+	sa.authenticated = true
+	sa.principal = principal
+	sa.session = nil
+	sa.state = saslComplete
+
+	if sa.config.SessionLifetime > 0 {
+		sa.expiresAt = now.Add(sa.config.SessionLifetime)
+		response.SessionLifetimeMs = sa.config.SessionLifetime.Milliseconds()
+	}
+
+	return response, nil
+}
+
+type saslAuthenticatorKey struct{}
+
+func saslAuthenticatorFromContext(ctx context.Context) (*saslAuthenticator, bool) {
+	authenticator, ok := ctx.Value(saslAuthenticatorKey{}).(*saslAuthenticator)
+	return authenticator, ok
+}
+
+var errSaslDisabled = errors.New("SASL is not enabled on the listener")
+
+func handleSaslHandshake(ctx context.Context, request *SaslHandshakeRequest, _ ApiVersion) (*SaslHandshakeResponse, error) {
+	authenticator, ok := saslAuthenticatorFromContext(ctx)
+
+	if !ok {
+		return nil, NewError(ErrIllegalSaslState, errSaslDisabled)
+	}
+
+	if err := authenticator.handshake(request.Mechanism); err != nil {
+		return nil, err
+	}
+
+	return &SaslHandshakeResponse{Mechanisms: authenticator.config.mechanisms()}, nil
+}
+
+func handleSaslAuthenticate(ctx context.Context, request *SaslAuthenticateRequest, _ ApiVersion) (*SaslAuthenticateResponse, error) {
+	authenticator, ok := saslAuthenticatorFromContext(ctx)
+
+	if !ok {
+		return nil, NewError(ErrIllegalSaslState, errSaslDisabled)
+	}
+
+	return authenticator.authenticate(request.AuthBytes, time.Now())
+}
+
+// registerSASLHandlers adds the SaslHandshake and SaslAuthenticate handlers,
+// which answer ErrIllegalSaslState on listeners without SASL, like brokers do.
+func (ks *KafkaServer) registerSASLHandlers() {
+	ks.saslHandlers.Do(func() {
+		AddTyped(
+			ks.Handler(SaslHandshake).Version(1, 1).Opts().RequestHeaderVersion(1).And(),
+			handleSaslHandshake,
+		)
+
+		AddTyped(
+			AddTyped(
+				ks.Handler(SaslAuthenticate).Version(0, 1).Opts().RequestHeaderVersion(1).And(),
+				handleSaslAuthenticate,
+			).Version(2, 2).Opts().ResponseHeaderVersion(1).And(),
+			handleSaslAuthenticate,
+		)
+	})
+}
+
+// enableSASL makes the connections of the listener authenticate with SASL.
+func (ks *KafkaServer) enableSASL(state *listenerState, config *SASLConfig) error {
+	if config.Credentials == nil {
+		return errors.New("server: SASL listeners need a credential store")
+	}
+
+	for _, mechanism := range config.mechanisms() {
+		if !slices.Contains(sasl.Mechanisms, mechanism) {
+			return fmt.Errorf("%w: %s", sasl.ErrUnsupportedMechanism, mechanism)
+		}
+	}
+
+	ks.registerSASLHandlers()
+	state.sasl = config
+
+	return nil
+}
+
+func (ks *KafkaServer) ListenAndServeSASL(addr string, config *SASLConfig) error {
+	listener, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return err
+	}
+
+	defer listener.Close()
+
+	return ks.ServeSASL(SASLPlaintextListenerName, listener, config)
+}
+
+// ServeSASL accepts connections that must authenticate with SASL before
+// sending any request other than ApiVersions, the authenticated user becomes
+// the principal of their requests.
+func (ks *KafkaServer) ServeSASL(name string, listener net.Listener, config *SASLConfig) error {
+	state := &listenerState{name: name}
+
+	if err := ks.enableSASL(state, config); err != nil {
+		return err
+	}
+
+	return ks.serve(state, listener)
+}
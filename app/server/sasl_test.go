@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/encoding/kafka"
+	"github.com/codecrafters-io/kafka-starter-go/app/sasl"
+)
+
+func newTestSASLConn(t *testing.T, sessionLifetime time.Duration) net.Conn {
+	ks := newTestServer(t)
+	Handle(ks, ApiVersions, ApiVersionRange{0, 4}, handlePrincipal)
+	Handle(ks, DescribeTopicPartitions, ApiVersionRange{0, 0}, handleVersions)
+
+	credentials := sasl.NewMemoryCredentialStore()
+	credentials.SetPassword("alice", "alice-secret")
+	credentials.SetPassword("bob", "bob-secret")
+
+	state := &listenerState{name: SASLPlaintextListenerName}
+
+	err := ks.enableSASL(state, &SASLConfig{
+		Mechanisms:      []string{sasl.Plain},
+		Credentials:     credentials,
+		SessionLifetime: sessionLifetime,
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	go ks.newConn(state, server).serve()
+
+	return client
+}
+
+func sendSaslHandshake(t *testing.T, conn net.Conn, mechanism string) *SaslHandshakeResponse {
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.BigEndian, int16(len(mechanism)))
+	body.WriteString(mechanism)
+
+	result, err := roundTripWithHeader(conn, SaslHandshake, 1, 1, body.Bytes())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	response := new(SaslHandshakeResponse)
+
+	if err = kafka.NewDecoder(bytes.NewReader(result[4:])).DecodeWithOpts(response, &kafka.DecoderOpts{Version: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return response
+}
+
+func sendSaslAuthenticate(t *testing.T, conn net.Conn, username, password string) *SaslAuthenticateResponse {
+	authBytes := "\x00" + username + "\x00" + password
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.BigEndian, int32(len(authBytes)))
+	body.WriteString(authBytes)
+
+	result, err := roundTripWithHeader(conn, SaslAuthenticate, 1, 1, body.Bytes())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	response := new(SaslAuthenticateResponse)
+
+	if err = kafka.NewDecoder(bytes.NewReader(result[4:])).DecodeWithOpts(response, &kafka.DecoderOpts{Version: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return response
+}
+
+func requestPrincipal(conn net.Conn) (string, error) {
+	result, err := roundTrip(conn, ApiVersions, 4, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(result[6:]), nil
+}
+
+func TestSASLPlainAuthentication(t *testing.T) {
+	conn := newTestSASLConn(t, 0)
+
+	if principal, err := requestPrincipal(conn); err != nil || principal != "ANONYMOUS" {
+		t.Fatalf("expected: ANONYMOUS, result: %s, err: %v", principal, err)
+	}
+
+	handshake := sendSaslHandshake(t, conn, sasl.Plain)
+
+	if handshake.ErrorCode != ErrNone || len(handshake.Mechanisms) != 1 || handshake.Mechanisms[0] != sasl.Plain {
+		t.Fatalf("unexpected handshake response: %+v", handshake)
+	}
+
+	if authenticate := sendSaslAuthenticate(t, conn, "alice", "alice-secret"); authenticate.ErrorCode != ErrNone {
+		t.Fatalf("unexpected authenticate response: %+v", authenticate)
+	}
+
+	if principal, err := requestPrincipal(conn); err != nil || principal != "alice" {
+		t.Fatalf("expected: alice, result: %s, err: %v", principal, err)
+	}
+
+	if _, err := roundTrip(conn, DescribeTopicPartitions, 0, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestSASLBlocksRequestsBeforeAuthentication(t *testing.T) {
+	conn := newTestSASLConn(t, 0)
+
+	if _, err := roundTrip(conn, DescribeTopicPartitions, 0, nil); err == nil {
+		t.Fatal("requests before the authentication should close the connection")
+	}
+}
+
+func TestSASLFailedAuthenticationClosesConnection(t *testing.T) {
+	conn := newTestSASLConn(t, 0)
+
+	if handshake := sendSaslHandshake(t, conn, sasl.ScramSha256); handshake.ErrorCode != ErrUnsupportedSaslMechanism {
+		t.Fatalf("expected: %s, result: %+v", ErrUnsupportedSaslMechanism, handshake)
+	}
+
+	if _, err := requestPrincipal(conn); err == nil {
+		t.Fatal("the connection should be closed after an unsupported mechanism")
+	}
+
+	conn = newTestSASLConn(t, 0)
+	sendSaslHandshake(t, conn, sasl.Plain)
+
+	if authenticate := sendSaslAuthenticate(t, conn, "alice", "wrong"); authenticate.ErrorCode != ErrSaslAuthenticationFailed {
+		t.Fatalf("expected: %s, result: %+v", ErrSaslAuthenticationFailed, authenticate)
+	}
+
+	if _, err := requestPrincipal(conn); err == nil {
+		t.Fatal("the connection should be closed after a failed authentication")
+	}
+}
+
+func TestSASLReauthentication(t *testing.T) {
+	conn := newTestSASLConn(t, 100*time.Millisecond)
+
+	sendSaslHandshake(t, conn, sasl.Plain)
+
+	if authenticate := sendSaslAuthenticate(t, conn, "alice", "alice-secret"); authenticate.SessionLifetimeMs != 100 {
+		t.Fatalf("expected: 100, result: %+v", authenticate)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	sendSaslHandshake(t, conn, sasl.Plain)
+
+	if authenticate := sendSaslAuthenticate(t, conn, "alice", "alice-secret"); authenticate.ErrorCode != ErrNone {
+		t.Fatalf("unexpected authenticate response: %+v", authenticate)
+	}
+
+	if principal, err := requestPrincipal(conn); err != nil || principal != "alice" {
+		t.Fatalf("expected: alice, result: %s, err: %v", principal, err)
+	}
+
+	sendSaslHandshake(t, conn, sasl.Plain)
+
+	if authenticate := sendSaslAuthenticate(t, conn, "bob", "bob-secret"); authenticate.ErrorCode != ErrSaslAuthenticationFailed {
+		t.Fatalf("re-authentication as another principal should fail, result: %+v", authenticate)
+	}
+
+	conn = newTestSASLConn(t, 50*time.Millisecond)
+	sendSaslHandshake(t, conn, sasl.Plain)
+	sendSaslAuthenticate(t, conn, "alice", "alice-secret")
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := requestPrincipal(conn); err == nil {
+		t.Fatal("requests after the session expired should close the connection")
+	}
+}
@@ -2,12 +2,19 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net"
 	"os"
 	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/codecrafters-io/kafka-starter-go/app/encoding/kafka"
 )
@@ -28,15 +35,32 @@ type handlerOpts struct {
 }
 
 type handlerState struct {
-	versionRange ApiVersionRange
-	opts         handlerOpts
-	handlerFunc  HandlerFunc
+	versionRange  ApiVersionRange
+	opts          handlerOpts
+	handlerFunc   HandlerFunc
+	middlewares   []Middleware
+	errorResponse ErrorResponseFunc
+	listeners     []string
+}
+
+// visibleOn reports whether the handler is exposed on the named listener,
+// handlers without listeners are exposed on all of them.
+func (hs *handlerState) visibleOn(listener string) bool {
+	return len(hs.listeners) == 0 || slices.Contains(hs.listeners, listener)
 }
 
 type KafkaServer struct {
-	mutex    sync.RWMutex
-	logger   *log.Logger
-	handlers map[ApiKey]handlerState
+	mutex         sync.RWMutex
+	logger        *slog.Logger
+	logLevel      *slog.LevelVar
+	handlers      map[ApiKey][]handlerState
+	middlewares   []Middleware
+	errorMappings []errorMapping
+	saslHandlers  sync.Once
+	// advertisedListeners are set by ListenAndServeListeners
+	advertisedListeners []Endpoint
+	connections         *connectionLimiter
+	metrics             atomic.Pointer[BrokerMetrics]
 }
 
 type ApiVersionRange struct {
@@ -44,34 +68,32 @@ type ApiVersionRange struct {
 	Max ApiVersion
 }
 
-var apisMap map[ApiKey]ApiVersionRange
+func (vr ApiVersionRange) Contains(version ApiVersion) bool {
+	return version >= vr.Min && version <= vr.Max
+}
 
-func GetSupportedApis() map[ApiKey]ApiVersionRange {
-	return apisMap
+func (vr ApiVersionRange) overlaps(other ApiVersionRange) bool {
+	return vr.Min <= other.Max && other.Min <= vr.Max
 }
 
-func addSupportedApi(apiKey ApiKey, vesionRange ApiVersionRange) {
-	if apisMap == nil {
-		apisMap = make(map[ApiKey]ApiVersionRange)
-	}
-	_, found := apisMap[apiKey]
+func NewKafkaServer() *KafkaServer {
+	logLevel := new(slog.LevelVar)
 
-	if found {
-		return
+	return &KafkaServer{
+		logger:      NewLogger(os.Stdout, LogText, logLevel),
+		logLevel:    logLevel,
+		handlers:    make(map[ApiKey][]handlerState),
+		connections: newConnectionLimiter(),
 	}
-
-	apisMap[apiKey] = vesionRange
 }
 
-func (vr ApiVersionRange) Contains(version ApiVersion) bool {
-	return version >= vr.Min && version <= vr.Max
-}
+// Use appends middlewares to the chain that wraps every handler. The first
+// middleware registered is the outermost one.
+func (ks *KafkaServer) Use(middlewares ...Middleware) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
 
-func NewKafkaServer() *KafkaServer {
-	return &KafkaServer{
-		logger:   log.New(os.Stdout, "kafka-server:", log.LstdFlags|log.LUTC|log.Lmsgprefix|log.Lshortfile),
-		handlers: make(map[ApiKey]handlerState),
-	}
+	ks.middlewares = append(ks.middlewares, middlewares...)
 }
 
 func (ks *KafkaServer) Handler(apiKey ApiKey) *handlerBuilder {
@@ -99,24 +121,58 @@ func (ks *KafkaServer) handlerFunc(
 	versionRange ApiVersionRange,
 	handler HandlerFunc,
 	opts handlerOpts,
+	middlewares []Middleware,
+	errorResponse ErrorResponseFunc,
+	listeners []string,
 ) {
 	ks.mutex.Lock()
 	defer ks.mutex.Unlock()
 
-	if foundedHandlerState, found := ks.handlers[apiKey]; found {
-		ks.logger.Panicf(
-			"api with key %d is already registred for the following version range[Min=%d,Max=%d]",
-			apiKey, foundedHandlerState.versionRange.Min, foundedHandlerState.versionRange.Max,
-		)
+	if versionRange.Min > versionRange.Max {
+		panic(fmt.Sprintf(
+			"api with key %d has an invalid version range[Min=%d,Max=%d]",
+			apiKey, versionRange.Min, versionRange.Max,
+		))
+	}
+
+	for _, foundedHandlerState := range ks.handlers[apiKey] {
+		if foundedHandlerState.versionRange.overlaps(versionRange) {
+			panic(fmt.Sprintf(
+				"api with key %d is already registred for the following version range[Min=%d,Max=%d]",
+				apiKey, foundedHandlerState.versionRange.Min, foundedHandlerState.versionRange.Max,
+			))
+		}
 	}
 
-	ks.handlers[apiKey] = handlerState{
-		versionRange: versionRange,
-		opts:         opts,
-		handlerFunc:  handler,
+	handlers := append(ks.handlers[apiKey], handlerState{
+		versionRange:  versionRange,
+		opts:          opts,
+		handlerFunc:   handler,
+		middlewares:   middlewares,
+		errorResponse: errorResponse,
+		listeners:     listeners,
+	})
+
+	slices.SortFunc(handlers, func(a, b handlerState) int {
+		return int(a.versionRange.Min) - int(b.versionRange.Min)
+	})
+
+	ks.handlers[apiKey] = handlers
+}
+
+// visibleHandlers returns the handlers of apiKey exposed on the listener,
+// ordered by version.
+func (ks *KafkaServer) visibleHandlers(apiKey ApiKey, listener string) (handlers []handlerState) {
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+
+	for _, handlerState := range ks.handlers[apiKey] {
+		if handlerState.visibleOn(listener) {
+			handlers = append(handlers, handlerState)
+		}
 	}
 
-	addSupportedApi(apiKey, versionRange)
+	return handlers
 }
 
 func (ks *KafkaServer) ListenAndServe(addr string) error {
@@ -128,116 +184,285 @@ func (ks *KafkaServer) ListenAndServe(addr string) error {
 
 	defer listener.Close()
 
-	return ks.serve(listener)
+	return ks.ServeListener(DefaultListenerName, listener)
+}
+
+// listenerState is what the connections know about the listener that
+// accepted them.
+type listenerState struct {
+	name            string
+	tlsConfig       *tls.Config
+	principalMapper *PrincipalMapper
+	sasl            *SASLConfig
+}
+
+// ServeListener accepts the connections of listener, the handlers restricted
+// to other listener names are hidden from them.
+func (ks *KafkaServer) ServeListener(name string, listener net.Listener) error {
+	return ks.serve(&listenerState{name: name}, listener)
 }
 
-func (ks *KafkaServer) serve(listener net.Listener) error {
+// ServeConn serves a single connection accepted elsewhere, like one side of
+// a net.Pipe, as if the named listener accepted it. It returns once the
+// connection is closed.
+func (ks *KafkaServer) ServeConn(name string, connection net.Conn) {
+	ks.newConn(&listenerState{name: name}, connection).serve()
+}
+
+func (ks *KafkaServer) serve(state *listenerState, listener net.Listener) error {
 	for {
+		if delay := ks.connections.creationDelay(); delay > 0 {
+			time.Sleep(delay)
+		}
+
 		connection, err := listener.Accept()
 
 		if err != nil {
 			return err
 		}
 
-		conn := ks.newConn(connection)
+		ip := remoteIp(connection)
+
+		if err = ks.connections.acquire(ip); err != nil {
+			ks.Logger().Warn("rejected connection",
+				"remote_addr", connection.RemoteAddr().String(), "listener", state.name, "error", err,
+			)
+			connection.Close()
+			continue
+		}
+
+		conn := ks.newConn(state, connection)
+		conn.ip = ip
 		go conn.serve()
 	}
 
 }
 
-func (ks *KafkaServer) handleRequest(res *response, req *Request) {
+// handleRequest answers the request, an error is returned when it can't be
+// answered and the connection must be closed.
+func (ks *KafkaServer) handleRequest(res *response, req *Request) error {
+	if metrics := ks.metrics.Load(); metrics != nil {
+		metrics.recordRequest(req, res.received)
+	}
+
 	handlerState, found := ks.findHandler(req)
 
 	if !found {
-		ks.handleError(res, UnsupportedVersion)
-		return
+		return ks.handleUnsupportedVersion(res, req)
+	}
+
+	if err := req.decodeHeaders(handlerState.opts.request.version); err != nil {
+		LoggerFromContext(req.Context()).Warn("couldn't decode request headers", append(requestAttrs(req), "error", err)...)
+		ks.sendError(res, &handlerState, NewError(ErrInvalidRequest, err))
+		return nil
 	}
 
-	opts := handlerState.opts
-	handler := handlerState.handlerFunc
+	res.headerVersion = handlerState.opts.response.version
+	ks.withRequestLogger(req)
+
+	ks.mutex.RLock()
+	middlewares := ks.middlewares
+	ks.mutex.RUnlock()
 
-	if err := ks.writeResponseHeaders(res, int(opts.response.version)); err != nil {
-		ks.logger.Printf("Couldn't encode response headers: %s\n%v", fmt.Sprint(res.headers), err)
-		ks.handleError(res, UnknownServerError)
+	handler := chain(chain(handlerState.handlerFunc, handlerState.middlewares), middlewares)
+
+	start := time.Now()
+	err := handler(res, req)
+
+	if metrics := ks.metrics.Load(); metrics != nil {
+		metrics.recordHandle(req, time.Since(start))
 	}
 
-	if err := handler(res, req); err != nil {
-		ks.logger.Printf("Couldn't handle request:%v", err)
-		ks.handleError(res, UnknownServerError)
+	if err != nil {
+		LoggerFromContext(req.Context()).Debug("couldn't handle request", "error", err)
+		ks.sendError(res, &handlerState, err)
+		return nil
 	}
 
 	if err := ks.sendResponse(res); err != nil {
-		ks.logger.Printf("Couldn't send response:%v", err)
-		ks.handleError(res, UnknownServerError)
+		LoggerFromContext(req.Context()).Warn("couldn't send response", "error", err)
 	}
+
+	return nil
 }
 
 func (ks *KafkaServer) findHandler(req *Request) (handlerState, bool) {
-	handler, found := ks.handlers[req.ApiVersion.Key]
-	if !found {
-		return handler, false
+	for _, handler := range ks.visibleHandlers(req.ApiVersion.Key, ListenerFromContext(req.Context())) {
+		if handler.versionRange.Contains(req.ApiVersion.Version) {
+			return handler, true
+		}
 	}
 
-	if !handler.versionRange.Contains(req.ApiVersion.Version) {
-		return handler, false
+	return handlerState{}, false
+}
+
+// handleUnsupportedVersion answers requests for versions without handler.
+// ApiVersions requests get a v0 response carrying the supported versions,
+// which every client can parse and use to downgrade, like brokers do since
+// KIP-511. Requests older than the newest handler get an error response on
+// their own version, shaped by the next handler, but newer ones have no known
+// shape and close the connection.
+func (ks *KafkaServer) handleUnsupportedVersion(res *response, req *Request) error {
+	handlers := ks.visibleHandlers(req.ApiVersion.Key, ListenerFromContext(req.Context()))
+
+	if len(handlers) == 0 {
+		return fmt.Errorf("api with key %d is not supported", req.ApiVersion.Key)
 	}
 
-	return handler, true
+	err := NewError(ErrUnsupportedVersion, fmt.Errorf(
+		"api with key %d doesn't support version %d", req.ApiVersion.Key, req.ApiVersion.Version,
+	))
+
+	if req.ApiVersion.Key == ApiVersions {
+		fallback := handlers[0]
+		fallback.opts.response.version = 0
+
+		ks.sendErrorWithVersion(res, &fallback, 0, err)
+		return nil
+	}
+
+	nextHandler := slices.IndexFunc(handlers, func(handler handlerState) bool {
+		return handler.versionRange.Min > req.ApiVersion.Version
+	})
+
+	if nextHandler < 0 {
+		return err
+	}
+
+	handlerState := handlers[nextHandler]
+
+	if decodeErr := req.decodeHeaders(handlerState.opts.request.version); decodeErr != nil {
+		return decodeErr
+	}
+
+	ks.sendError(res, &handlerState, err)
+	return nil
+}
+
+// sendError answers the request with the ErrorCode mapped from err, using
+// the error response of the handler when it has one, or a lone error code.
+func (ks *KafkaServer) sendError(res *response, handlerState *handlerState, err error) {
+	ks.sendErrorWithVersion(res, handlerState, res.req.ApiVersion.Version, err)
 }
 
-func (ks *KafkaServer) handleError(res *response, errorCode ErrorCode) {
-	handlerState, found := ks.findHandler(res.req)
-	version := 0
-	if found {
-		version = int(handlerState.opts.response.version)
+func (ks *KafkaServer) sendErrorWithVersion(res *response, handlerState *handlerState, version ApiVersion, err error) {
+	errorCode := ks.ErrorCodeOf(err)
+	res.headerVersion = handlerState.opts.response.version
+
+	if metrics := ks.metrics.Load(); metrics != nil {
+		metrics.recordError(res.req, errorCode)
 	}
 
-	if err := ks.writeResponseHeaders(res, version); err != nil {
-		ks.logger.Panicf("Couldn't encode response headers: %s\n%v", fmt.Sprint(res.headers), err)
+	// whatever the handler wrote before failing is discarded
+	res.buffer.Reset()
+
+	if handlerState.errorResponse != nil {
+		if err := ks.writeErrorResponse(res, handlerState.errorResponse, version, errorCode); err != nil {
+			LoggerFromContext(res.req.Context()).Error("couldn't encode error response", "error", err)
+			res.buffer.Reset()
+		}
 	}
 
-	if err := kafka.NewEncoder(res).Encode(errorCode); err != nil {
-		ks.logger.Panicf("Couldn't encode response errorCode %d:\n%v", errorCode, err)
+	if res.buffer.Len() == 0 {
+		if err := kafka.NewEncoder(res).Encode(errorCode); err != nil {
+			panic(fmt.Sprintf("Couldn't encode response errorCode %d:\n%v", errorCode, err))
+		}
 	}
 
 	if err := ks.sendResponse(res); err != nil {
-		ks.logger.Panicf("Couldn't send response:%v", err)
+		LoggerFromContext(res.req.Context()).Warn("couldn't send response", "error", err)
 	}
 }
 
-func (ks *KafkaServer) writeResponseHeaders(res *response, version int) (err error) {
-	if err = kafka.NewEncoder(res).EncodeWithOpts(res.headers, &kafka.EncoderOpts{
-		Version: version,
-	}); err != nil {
+func (ks *KafkaServer) writeErrorResponse(
+	res *response,
+	errorResponse ErrorResponseFunc,
+	version ApiVersion,
+	errorCode ErrorCode,
+) error {
+	response, err := errorResponse(res.req, version, errorCode)
+
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return kafka.NewEncoder(res).EncodeWithOpts(response, &kafka.EncoderOpts{
+		Version: int(version),
+	})
 }
 
+// sendResponse writes the message size, the response headers and the body
+// written by the handler to the connection.
 func (ks *KafkaServer) sendResponse(res *response) (err error) {
-	connection := res.conn.connection
-	if err = kafka.NewEncoder(connection).Encode(res.messageSize()); err != nil {
+	headers := new(bytes.Buffer)
+
+	if err = kafka.NewEncoder(headers).EncodeWithOpts(res.headers, &kafka.EncoderOpts{
+		Version: res.headerVersion,
+	}); err != nil {
 		return err
 	}
 
-	if _, err = connection.Write(res.buffer.Bytes()); err != nil {
+	message := new(bytes.Buffer)
+	messageSize := int32(headers.Len()) + res.messageSize()
+
+	if err = kafka.NewEncoder(message).Encode(messageSize); err != nil {
 		return err
 	}
 
+	message.Write(headers.Bytes())
+	message.Write(res.buffer.Bytes())
+
+	if timeout := res.conn.config.WriteTimeout; timeout > 0 {
+		res.conn.connection.SetWriteDeadline(time.Now().Add(timeout))
+	}
+
+	start := time.Now()
+
+	if _, err = res.conn.connection.Write(message.Bytes()); err != nil {
+		return err
+	}
+
+	if metrics := ks.metrics.Load(); metrics != nil {
+		metrics.recordSend(res.req, message.Len(), time.Since(start))
+	}
+
 	return nil
 }
 
-func (ks *KafkaServer) newConn(connection net.Conn) *conn {
-	return &conn{
-		ks,
-		connection,
+func (ks *KafkaServer) newConn(listener *listenerState, connection net.Conn) *conn {
+	ctx := context.WithValue(context.Background(), serverKey{}, ks)
+	ctx = context.WithValue(ctx, listenerKey{}, listener.name)
+	ctx = context.WithValue(ctx, remoteAddrKey{}, connection.RemoteAddr())
+	ctx, cancel := context.WithCancel(ctx)
+
+	c := &conn{
+		server:     ks,
+		listener:   listener,
+		connection: connection,
+		ctx:        ctx,
+		cancel:     cancel,
+		config:     ks.connections.currentConfig(),
+	}
+
+	if listener.sasl != nil {
+		c.authenticator = newSaslAuthenticator(listener.sasl)
+		c.ctx = context.WithValue(c.ctx, saslAuthenticatorKey{}, c.authenticator)
 	}
+
+	return c
 }
 
 type conn struct {
 	server     *KafkaServer
+	listener   *listenerState
 	connection net.Conn
+	ctx        context.Context
+	cancel     context.CancelFunc
+	// authenticator is set on SASL listeners
+	authenticator *saslAuthenticator
+	// ip is set when the connection counts on the server limits
+	ip     string
+	config ConnectionConfig
 }
 
 func (c *conn) serve() {
@@ -247,50 +472,114 @@ func (c *conn) serve() {
 			buf := make([]byte, size)
 			buf = buf[:runtime.Stack(buf, false)]
 
-			c.server.logger.Printf("panic: %v\n%s", err, buf)
+			c.logger().Error("connection panic", "panic", err, "stack", string(buf))
 		}
 		c.close()
 	}()
 
+	principal, err := c.handshake()
+
+	if err != nil {
+		c.logger().Warn("couldn't authenticate connection", "error", err)
+		return
+	}
+
+	c.ctx = WithPrincipal(c.ctx, principal)
+
 	for {
 		response, err := c.readRequest()
 
+		if errors.Is(err, io.EOF) {
+			return
+		}
+
+		if errors.Is(err, errIdleConnection) {
+			c.server.connections.idleClosed.Add(1)
+			c.logger().Info("closing idle connection", "error", err)
+			return
+		}
+
 		if err != nil {
-			c.server.handleError(response, UnknownServerError)
+			c.logger().Warn("couldn't read request", "error", err)
+			return
 		}
 
-		c.server.handleRequest(response, response.req)
+		if c.authenticator != nil {
+			if err = c.authenticator.allow(response.req.ApiVersion.Key, time.Now()); err != nil {
+				c.logger().Warn("closing connection", "error", err)
+				return
+			}
+		}
+
+		if err = c.server.handleRequest(response, response.req); err != nil {
+			c.logger().Warn("closing connection", "error", err)
+			return
+		}
+
+		if c.authenticator != nil && c.authenticator.failed {
+			c.logger().Warn("closing connection after failed SASL authentication")
+			return
+		}
+
+		c.mute(response)
 	}
 }
 
+// logger returns the server logger with the fields of the connection.
+func (c *conn) logger() *slog.Logger {
+	return c.server.Logger().With("remote_addr", c.connection.RemoteAddr().String(), "listener", c.listener.name)
+}
+
 func (c *conn) close() {
+	c.cancel()
 	c.connection.Close()
+
+	if c.ip != "" {
+		c.server.connections.release(c.ip)
+	}
 }
 
 func (c *conn) readRequest() (res *response, err error) {
-	request, err := ParseRequest(c.connection)
+	request, err := ParseRequest(&deadlineReader{
+		connection: c.connection,
+		idle:       c.config.MaxIdle,
+		timeout:    c.config.ReadTimeout,
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	request.ctx = c.ctx
+
+	if c.authenticator != nil && c.authenticator.authenticated {
+		request.ctx = WithPrincipal(c.ctx, c.authenticator.principal)
+	}
+
 	res = &response{
-		conn:   c,
-		req:    request,
-		buffer: new(bytes.Buffer),
+		conn:     c,
+		req:      request,
+		buffer:   new(bytes.Buffer),
+		throttle: new(requestThrottle),
+		received: time.Now(),
 	}
 
+	request.ctx = context.WithValue(request.ctx, throttleKey{}, res.throttle)
+
 	res.headers.CorrelationId = request.Headers.CorrelationId
 
 	return res, nil
 }
 
 type handlerBuilder struct {
-	server       *KafkaServer
-	apiKey       ApiKey
-	versionRange ApiVersionRange
-	opts         handlerOpts
-	handlerFunc  HandlerFunc
+	server        *KafkaServer
+	apiKey        ApiKey
+	versionRange  ApiVersionRange
+	opts          handlerOpts
+	handlerFunc   HandlerFunc
+	middlewares   []Middleware
+	errorResponse ErrorResponseFunc
+	listeners     []string
 }
 
 func (hb *handlerBuilder) Version(min ApiVersion, max ApiVersion) *handlerBuilder {
@@ -309,10 +598,47 @@ func (hb *handlerBuilder) Opts() *handlerOptsBuilder {
 	}
 }
 
-func (hb *handlerBuilder) Add(handlerFunc HandlerFunc) {
+// Use appends middlewares that only wrap this handler, they run inside the
+// ones registered on the server.
+func (hb *handlerBuilder) Use(middlewares ...Middleware) *handlerBuilder {
+	hb.middlewares = append(hb.middlewares, middlewares...)
+	return hb
+}
+
+// ErrorResponse sets how the response of a failed request is built, without
+// it the handler failures are answered with a lone error code.
+func (hb *handlerBuilder) ErrorResponse(errorResponse ErrorResponseFunc) *handlerBuilder {
+	hb.errorResponse = errorResponse
+	return hb
+}
+
+// Listeners restricts the handler to the named listeners, on the others the
+// api is neither handled nor advertised, like the controller only apis.
+func (hb *handlerBuilder) Listeners(names ...string) *handlerBuilder {
+	hb.listeners = append(hb.listeners, names...)
+	return hb
+}
+
+// Add registers the handler for the version range and returns a new builder
+// for the same api, so other version ranges can get their own handler and
+// options:
+//
+//	ks.Handler(Fetch).Version(0, 3).Add(messageSetFetch).
+//		Version(4, 16).Add(recordBatchFetch)
+func (hb *handlerBuilder) Add(handlerFunc HandlerFunc) *handlerBuilder {
 	// TODO validate if all values is setted correctly
 
-	hb.server.handlerFunc(hb.apiKey, hb.versionRange, handlerFunc, hb.opts)
+	hb.server.handlerFunc(
+		hb.apiKey,
+		hb.versionRange,
+		handlerFunc,
+		hb.opts,
+		hb.middlewares,
+		hb.errorResponse,
+		hb.listeners,
+	)
+
+	return hb.server.Handler(hb.apiKey)
 }
 
 type handlerOptsBuilder struct {
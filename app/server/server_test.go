@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) *KafkaServer {
+	ks := NewKafkaServer()
+	ks.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return ks
+}
+
+// servePipe serves a single connection of ks over net.Pipe, returning the
+// client side of it.
+func servePipe(t *testing.T, ks *KafkaServer) net.Conn {
+	return servePipeOn(t, ks, DefaultListenerName)
+}
+
+func servePipeOn(t *testing.T, ks *KafkaServer, listener string) net.Conn {
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	go ks.newConn(&listenerState{name: listener}, server).serve()
+
+	return client
+}
+
+// roundTrip sends a request with a v2 header and returns the response
+// without its message size.
+func roundTrip(conn net.Conn, apiKey ApiKey, version ApiVersion, body []byte) ([]byte, error) {
+	return roundTripWithHeader(conn, apiKey, version, 2, body)
+}
+
+func roundTripWithHeader(conn net.Conn, apiKey ApiKey, version ApiVersion, headerVersion int, body []byte) ([]byte, error) {
+	message := new(bytes.Buffer)
+	binary.Write(message, binary.BigEndian, apiKey)
+	binary.Write(message, binary.BigEndian, version)
+	binary.Write(message, binary.BigEndian, int32(7))
+	binary.Write(message, binary.BigEndian, int16(-1))
+	if headerVersion >= 2 {
+		message.WriteByte(0)
+	}
+	message.Write(body)
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	if err := binary.Write(conn, binary.BigEndian, int32(message.Len())); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write(message.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var size int32
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, size)
+	_, err := io.ReadFull(conn, response)
+
+	return response, err
+}
+
+type versionsRequest struct{}
+
+type versionsResponse struct {
+	ErrorCode ErrorCode      `kafka:"0"`
+	ApiKeys   []versionRange `kafka:"1,compact=3"`
+}
+
+type versionRange struct {
+	Min ApiVersion `kafka:"0"`
+	Max ApiVersion `kafka:"1"`
+}
+
+func TestApiVersionsFallbackToV0(t *testing.T) {
+	ks := newTestServer(t)
+
+	AddTyped(
+		ks.Handler(ApiVersions).Version(0, 4).ErrorResponse(func(_ *Request, _ ApiVersion, code ErrorCode) (any, error) {
+			return &versionsResponse{ErrorCode: code, ApiKeys: []versionRange{{0, 4}}}, nil
+		}),
+		func(context.Context, *versionsRequest, ApiVersion) (*versionsResponse, error) {
+			return &versionsResponse{}, nil
+		},
+	)
+
+	result, err := roundTrip(servePipe(t, ks), ApiVersions, 100, nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// correlation id, error code and a non compact array with one range
+	expected := []byte{0, 0, 0, 7, 0, 35, 0, 0, 0, 1, 0, 0, 0, 4}
+
+	if !slices.Equal(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+}
+
+func TestUnsupportedVersionsOfOtherApis(t *testing.T) {
+	ks := newTestServer(t)
+
+	AddTyped(
+		ks.Handler(DescribeTopicPartitions).Version(2, 3).Opts().ResponseHeaderVersion(1).And(),
+		func(context.Context, *versionsRequest, ApiVersion) (*versionsResponse, error) {
+			return &versionsResponse{}, nil
+		},
+	)
+
+	conn := servePipe(t, ks)
+
+	result, err := roundTrip(conn, DescribeTopicPartitions, 1, nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// response header v1 and the v1 shape of the response
+	expected := []byte{0, 0, 0, 7, 0, 0, 35, 0, 0, 0, 0}
+
+	if !slices.Equal(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+
+	if _, err = roundTrip(conn, DescribeTopicPartitions, 4, nil); !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("expected the connection to be closed, result: %v", err)
+	}
+}
+
+func TestUnknownApiKeyClosesConnection(t *testing.T) {
+	_, err := roundTrip(servePipe(t, newTestServer(t)), 1000, 0, nil)
+
+	if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("expected the connection to be closed, result: %v", err)
+	}
+}
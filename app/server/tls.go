@@ -0,0 +1,262 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// SSLListenerName is the name of the listener opened by ListenAndServeTLS.
+const SSLListenerName = "SSL"
+
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile has the certificates of the authorities trusted to sign
+	// client certificates, it is required when ClientAuth verifies them.
+	ClientCAFile string
+	// ClientAuth is the ssl.client.auth of the listener, see ParseClientAuth.
+	ClientAuth tls.ClientAuthType
+	// ReloadInterval is how often the files are checked for changes, so
+	// renewed certificates are used by the next connections. Zero disables
+	// the hot reload.
+	ReloadInterval time.Duration
+	// PrincipalMappingRules maps the client certificate subject to the
+	// principal name, see PrincipalMapper.
+	PrincipalMappingRules string
+}
+
+// ParseClientAuth parses the ssl.client.auth values: none, requested or required.
+func ParseClientAuth(clientAuth string) (tls.ClientAuthType, error) {
+	switch clientAuth {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "requested":
+		return tls.VerifyClientCertIfGiven, nil
+	case "required":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("server: invalid ssl.client.auth %q", clientAuth)
+	}
+}
+
+// certificateStore keeps the certificates of a TLS listener, reloading them
+// when their files change.
+type certificateStore struct {
+	mutex       sync.RWMutex
+	config      *TLSConfig
+	logger      *slog.Logger
+	certificate tls.Certificate
+	clientCAs   *x509.CertPool
+	modTimes    map[string]time.Time
+	lastCheck   time.Time
+}
+
+func newCertificateStore(config *TLSConfig, logger *slog.Logger) (*certificateStore, error) {
+	store := &certificateStore{
+		config: config,
+		logger: logger,
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (cs *certificateStore) files() []string {
+	files := []string{cs.config.CertFile, cs.config.KeyFile}
+
+	if cs.config.ClientCAFile != "" {
+		files = append(files, cs.config.ClientCAFile)
+	}
+
+	return files
+}
+
+func (cs *certificateStore) load() error {
+	modTimes := make(map[string]time.Time)
+
+	for _, file := range cs.files() {
+		info, err := os.Stat(file)
+
+		if err != nil {
+			return err
+		}
+
+		modTimes[file] = info.ModTime()
+	}
+
+	certificate, err := tls.LoadX509KeyPair(cs.config.CertFile, cs.config.KeyFile)
+
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+
+	if cs.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(cs.config.ClientCAFile)
+
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("server: no certificate found on %s", cs.config.ClientCAFile)
+		}
+	} else if cs.config.ClientAuth >= tls.VerifyClientCertIfGiven {
+		return errors.New("server: client certificates can't be verified without ClientCAFile")
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	cs.certificate = certificate
+	cs.clientCAs = clientCAs
+	cs.modTimes = modTimes
+
+	return nil
+}
+
+// reloadIfChanged reloads the files when any of them changed since the last
+// load, keeping the current certificates if the new ones are invalid.
+func (cs *certificateStore) reloadIfChanged() {
+	if cs.config.ReloadInterval <= 0 {
+		return
+	}
+
+	cs.mutex.Lock()
+	if time.Since(cs.lastCheck) < cs.config.ReloadInterval {
+		cs.mutex.Unlock()
+		return
+	}
+	cs.lastCheck = time.Now()
+	modTimes := cs.modTimes
+	cs.mutex.Unlock()
+
+	changed := false
+
+	for _, file := range cs.files() {
+		if info, err := os.Stat(file); err == nil && !info.ModTime().Equal(modTimes[file]) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := cs.load(); err != nil {
+		cs.logger.Warn("couldn't reload certificates, keeping the current ones", "error", err)
+		return
+	}
+
+	cs.logger.Info("reloaded certificates", "cert_file", cs.config.CertFile)
+}
+
+func (cs *certificateStore) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cs.reloadIfChanged()
+
+			cs.mutex.RLock()
+			defer cs.mutex.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{cs.certificate},
+				ClientCAs:    cs.clientCAs,
+				ClientAuth:   cs.config.ClientAuth,
+			}, nil
+		},
+	}
+}
+
+func (ks *KafkaServer) ListenAndServeTLS(addr string, config *TLSConfig) error {
+	listener, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return err
+	}
+
+	defer listener.Close()
+
+	return ks.ServeTLS(listener, config)
+}
+
+// ServeTLS accepts TLS connections on listener. When the client presents a
+// certificate its subject, mapped by the PrincipalMappingRules, becomes the
+// principal of the requests.
+func (ks *KafkaServer) ServeTLS(listener net.Listener, config *TLSConfig) error {
+	state, err := ks.newTLSListenerState(SSLListenerName, config)
+
+	if err != nil {
+		return err
+	}
+
+	return ks.serve(state, tls.NewListener(listener, state.tlsConfig))
+}
+
+func (ks *KafkaServer) newTLSListenerState(name string, config *TLSConfig) (*listenerState, error) {
+	principalMapper, err := ParsePrincipalMappingRules(config.PrincipalMappingRules)
+
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := newCertificateStore(config, ks.Logger())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &listenerState{
+		name:            name,
+		tlsConfig:       store.tlsConfig(),
+		principalMapper: principalMapper,
+	}, nil
+}
+
+const handshakeTimeout = 10 * time.Second
+
+// handshake completes the TLS handshake of the connection, returning the
+// principal of the client certificate, if any was sent.
+func (c *conn) handshake() (principal Principal, err error) {
+	tlsConnection, ok := c.connection.(*tls.Conn)
+
+	if !ok {
+		return AnonymousPrincipal, nil
+	}
+
+	tlsConnection.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer tlsConnection.SetDeadline(time.Time{})
+
+	if err = tlsConnection.HandshakeContext(c.ctx); err != nil {
+		return principal, err
+	}
+
+	peerCertificates := tlsConnection.ConnectionState().PeerCertificates
+
+	if len(peerCertificates) == 0 {
+		return AnonymousPrincipal, nil
+	}
+
+	var name string
+
+	if name, err = c.listener.principalMapper.Name(peerCertificates[0].Subject.String()); err != nil {
+		return principal, err
+	}
+
+	return Principal{Type: "User", Name: name}, nil
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	der         []byte
+}
+
+func newTestCertificate(t *testing.T, subject pkix.Name, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	issuer, issuerKey := template, key
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		issuer, issuerKey = parent.certificate, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	certificate, _ := x509.ParseCertificate(der)
+
+	return &testCertificate{certificate, key, der}
+}
+
+var certificateWrites atomic.Int64
+
+func (tc *testCertificate) write(t *testing.T, certFile, keyFile string) {
+	keyDer, _ := x509.MarshalECPrivateKey(tc.key)
+
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+
+	// the reload only happens when the modification time changes
+	modTime := time.Now().Add(time.Duration(certificateWrites.Add(1)) * time.Second)
+	os.Chtimes(certFile, modTime, modTime)
+}
+
+func (tc *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.der}, PrivateKey: tc.key}
+}
+
+type principalResponse struct {
+	Name string `kafka:"0"`
+}
+
+func handlePrincipal(ctx context.Context, _ *versionsRequest, _ ApiVersion) (*principalResponse, error) {
+	return &principalResponse{Name: PrincipalFromContext(ctx).Name}, nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, pkix.Name{CommonName: "test-ca"}, nil)
+	newTestCertificate(t, pkix.Name{CommonName: "broker"}, ca).
+		write(t, filepath.Join(dir, "broker.pem"), filepath.Join(dir, "broker.key"))
+	ca.write(t, filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.key"))
+
+	client := newTestCertificate(t, pkix.Name{
+		CommonName:         "Alice",
+		OrganizationalUnit: []string{"ServiceUsers"},
+		Organization:       []string{"Acme"},
+	}, ca)
+
+	ks := newTestServer(t)
+	Handle(ks, ApiVersions, ApiVersionRange{0, 4}, handlePrincipal)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer listener.Close()
+
+	go ks.ServeTLS(listener, &TLSConfig{
+		CertFile:              filepath.Join(dir, "broker.pem"),
+		KeyFile:               filepath.Join(dir, "broker.key"),
+		ClientCAFile:          filepath.Join(dir, "ca.pem"),
+		ClientAuth:            tls.RequireAndVerifyClientCert,
+		ReloadInterval:        time.Nanosecond,
+		PrincipalMappingRules: "RULE:^CN=(.*?),OU=ServiceUsers.*$/$1/L,DEFAULT",
+	})
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.certificate)
+
+	dial := func(certificates ...tls.Certificate) (*tls.Conn, error) {
+		return tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: certificates,
+		})
+	}
+
+	conn, err := dial(client.tlsCertificate())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	result, err := roundTrip(conn, ApiVersions, 4, nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []byte{0, 0, 0, 7, 0, 5, 'a', 'l', 'i', 'c', 'e'}
+
+	if !slices.Equal(expected, result) {
+		t.Fatalf("expected: %v, result: %v", expected, result)
+	}
+
+	if anonymous, err := dial(); err == nil {
+		if _, err = roundTrip(anonymous, ApiVersions, 4, nil); err == nil {
+			t.Fatal("connections without client certificate should be refused")
+		}
+		anonymous.Close()
+	}
+
+	newTestCertificate(t, pkix.Name{CommonName: "reloaded"}, ca).
+		write(t, filepath.Join(dir, "broker.pem"), filepath.Join(dir, "broker.key"))
+
+	reloaded, err := dial(client.tlsCertificate())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer reloaded.Close()
+
+	if commonName := reloaded.ConnectionState().PeerCertificates[0].Subject.CommonName; commonName != "reloaded" {
+		t.Fatalf("expected: reloaded, result: %s", commonName)
+	}
+}
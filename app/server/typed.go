@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/codecrafters-io/kafka-starter-go/app/encoding/kafka"
+)
+
+// TypedHandlerFunc handles a request already decoded with the negotiated
+// version, the returned response is encoded with that same version.
+type TypedHandlerFunc[Req, Resp any] func(ctx context.Context, request *Req, version ApiVersion) (*Resp, error)
+
+// VersionedMessage is implemented by request and response types that know
+// which versions their fields describe, Handle refuses to register them for
+// versions outside of it.
+type VersionedMessage interface {
+	Versions() ApiVersionRange
+}
+
+// Handle registers handler for apiKey on the given versions, taking care of
+// decoding the request and encoding the response.
+func Handle[Req, Resp any](ks *KafkaServer, apiKey ApiKey, versions ApiVersionRange, handler TypedHandlerFunc[Req, Resp]) {
+	AddTyped(ks.Handler(apiKey).Version(versions.Min, versions.Max), handler)
+}
+
+// HandleFlexible registers handler for apiKey on the versions of nonFlexible,
+// whose requests have the v1 header, and on the flexible ones, whose requests
+// have the v2 header and responses the v1 header (KIP-482).
+func HandleFlexible[Req, Resp any](ks *KafkaServer, apiKey ApiKey, nonFlexible, flexible ApiVersionRange, handler TypedHandlerFunc[Req, Resp]) {
+	AddTyped(
+		AddTyped(
+			ks.Handler(apiKey).Version(nonFlexible.Min, nonFlexible.Max).Opts().RequestHeaderVersion(1).And(),
+			handler,
+		).Version(flexible.Min, flexible.Max).Opts().ResponseHeaderVersion(1).And(),
+		handler,
+	)
+}
+
+// AddTyped is Handle for handlers that need the handlerBuilder options, like
+// header versions or middlewares. As Add, it returns a builder for another
+// version range of the same api.
+func AddTyped[Req, Resp any](hb *handlerBuilder, handler TypedHandlerFunc[Req, Resp]) *handlerBuilder {
+	if err := validateMessage(reflect.TypeFor[Req](), hb.versionRange, kafka.CheckDecodable); err != nil {
+		panic(fmt.Sprintf("invalid request type for api with key %d: %v", hb.apiKey, err))
+	}
+
+	if err := validateMessage(reflect.TypeFor[Resp](), hb.versionRange, kafka.CheckEncodable); err != nil {
+		panic(fmt.Sprintf("invalid response type for api with key %d: %v", hb.apiKey, err))
+	}
+
+	if hb.errorResponse == nil {
+		hb.errorResponse = deriveErrorResponse[Req, Resp]()
+	}
+
+	return hb.Add(typedHandler(handler))
+}
+
+func validateMessage(t reflect.Type, versionRange ApiVersionRange, check func(reflect.Type) error) error {
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("%s should be a struct", t)
+	}
+
+	if err := check(t); err != nil {
+		return err
+	}
+
+	message, ok := reflect.New(t).Interface().(VersionedMessage)
+
+	if !ok {
+		return nil
+	}
+
+	supported := message.Versions()
+
+	if !supported.Contains(versionRange.Min) || !supported.Contains(versionRange.Max) {
+		return fmt.Errorf(
+			"%s supports the version range[Min=%d,Max=%d] but was registered for [Min=%d,Max=%d]",
+			t, supported.Min, supported.Max, versionRange.Min, versionRange.Max,
+		)
+	}
+
+	return nil
+}
+
+func typedHandler[Req, Resp any](handler TypedHandlerFunc[Req, Resp]) HandlerFunc {
+	return func(rw ResponseWriter, req *Request) (err error) {
+		version := req.ApiVersion.Version
+		request := new(Req)
+
+		if err = kafka.NewDecoder(req.Body).DecodeWithOpts(request, &kafka.DecoderOpts{
+			Version: int(version),
+		}); err != nil {
+			return NewError(ErrInvalidRequest, err)
+		}
+
+		ctx := context.WithValue(req.Context(), requestKey{}, req)
+
+		var response *Resp
+
+		if response, err = handler(ctx, request, version); err != nil {
+			return err
+		}
+
+		buffer := new(bytes.Buffer)
+		encode := func() error {
+			buffer.Reset()
+
+			return kafka.NewEncoder(buffer).EncodeWithOpts(response, &kafka.EncoderOpts{
+				Version: int(version),
+			})
+		}
+
+		if err = encode(); err != nil {
+			return err
+		}
+
+		// the response reports the throttle caused by its own size
+		if recordResponseSize(ctx, buffer.Len()) && reportThrottleTime(ctx, response) {
+			if err = encode(); err != nil {
+				return err
+			}
+		}
+
+		_, err = rw.Write(buffer.Bytes())
+
+		return err
+	}
+}
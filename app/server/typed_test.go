@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+)
+
+type echoRequest struct {
+	Value int16  `kafka:"0"`
+	Name  string `kafka:"1,minVersion=1,compact"`
+}
+
+type echoResponse struct {
+	Value int16  `kafka:"0"`
+	Name  string `kafka:"1,minVersion=1,compact"`
+}
+
+func (echoResponse) Versions() ApiVersionRange {
+	return ApiVersionRange{Min: 0, Max: 1}
+}
+
+func echoHandler(_ context.Context, request *echoRequest, _ ApiVersion) (*echoResponse, error) {
+	return &echoResponse{Value: request.Value, Name: request.Name}, nil
+}
+
+var testTypedHandlerCases = []struct {
+	version  ApiVersion
+	body     []byte
+	expected []byte
+}{
+	{
+		version:  0,
+		body:     []byte{0, 7},
+		expected: []byte{0, 7},
+	},
+	{
+		version:  1,
+		body:     []byte{0, 7, 2, 'a'},
+		expected: []byte{0, 7, 2, 'a'},
+	},
+}
+
+func TestTypedHandler(t *testing.T) {
+	handler := typedHandler(echoHandler)
+
+	for _, testCase := range testTypedHandlerCases {
+		req := new(Request)
+		req.ApiVersion.Version = testCase.version
+		req.Body = bytes.NewReader(testCase.body)
+
+		result := new(bytes.Buffer)
+
+		if err := handler(result, req); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if !slices.Equal(testCase.expected, result.Bytes()) {
+			t.Errorf("version: %d, expected: %v, result: %v", testCase.version, testCase.expected, result.Bytes())
+		}
+	}
+}
+
+func TestHandleRejectsUnsupportedVersions(t *testing.T) {
+	ks := NewKafkaServer()
+	ks.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering echoResponse for versions 0-2 should panic")
+		}
+	}()
+
+	Handle(ks, ApiVersions, ApiVersionRange{Min: 0, Max: 2}, echoHandler)
+}
+
+func TestHandleFlexible(t *testing.T) {
+	ks := newTestServer(t)
+	HandleFlexible(ks, Produce, ApiVersionRange{0, 1}, ApiVersionRange{2, 3}, handleThrottle)
+
+	conn := servePipe(t, ks)
+
+	for _, testCase := range []struct {
+		version       ApiVersion
+		headerVersion int
+		expected      []byte
+	}{
+		{version: 1, headerVersion: 1, expected: []byte{0, 0, 0, 7, 0, 0, 0, 0}},
+		// the response header has its tagged fields
+		{version: 2, headerVersion: 2, expected: []byte{0, 0, 0, 7, 0, 0, 0, 0, 0}},
+	} {
+		result, err := roundTripWithHeader(conn, Produce, testCase.version, testCase.headerVersion, nil)
+
+		if err != nil {
+			t.Fatalf("v%d, unexpected error: %s", testCase.version, err)
+		}
+
+		if !slices.Equal(testCase.expected, result) {
+			t.Fatalf("v%d, expected: %v, result: %v", testCase.version, testCase.expected, result)
+		}
+	}
+}